@@ -0,0 +1,305 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Interactive event socket client, like fs_cli.
+//
+// Lines are sent as api commands, and lines starting with / are commands of
+// the client itself, see /help. Events subscribed to are printed as they
+// come. Lines are edited as in shells, with history, which is kept in
+// ~/.esl_history, recalled with the arrows, or with !! or !n.
+//
+// Usage:
+//
+//	esl -H localhost -P 8021 -p ClueCon
+//	esl -x "show channels"
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+)
+
+const help = `Commands:
+  <command>                   run an api command, e.g. status
+  /bgapi <command>            run an api command in the background
+  /event [json] <names...>    subscribe to events, e.g. /event CHANNEL_ANSWER
+  /nixevent <names...>        unsubscribe from events
+  /noevents                   unsubscribe from all events
+  /filter <header> <value>    only receive events with the header value
+  /nofilter <header> [value]  delete filters
+  /status                     show subscriptions and filters
+  /history                    show the history, recalled with !! or !n
+  /help                       show this help
+  /quit, /exit, /bye          quit
+`
+
+const maxHistory = 1000
+
+func main() {
+	host := flag.String("H", "localhost", "FreeSWITCH host")
+	port := flag.Int("P", 8021, "event socket port")
+	passwd := flag.String("p", "ClueCon", "event socket password")
+	execute := flag.String("x", "", "run an api command and exit")
+	flag.Parse()
+	addr := net.JoinHostPort(*host, strconv.Itoa(*port))
+	c, err := eventsocket.Dial(addr, *passwd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "esl:", err)
+		os.Exit(1)
+	}
+	defer c.Close()
+	if *execute != "" {
+		if err := api(os.Stdout, c, *execute); err != nil {
+			c.Close()
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Printf("Connected to %s, type /help for help.\n", addr)
+	if err := interact(c); err != nil {
+		fmt.Fprintln(os.Stderr, "esl:", err)
+		c.Close()
+		os.Exit(1)
+	}
+}
+
+// interact runs the lines typed until the user quits, or the connection
+// terminates, and returns why it did.
+func interact(c *eventsocket.Connection) error {
+	t := newTerminal()
+	defer t.Close()
+	s := &session{c: c, out: t, history: loadHistory()}
+	defer s.saveHistory()
+	failed := make(chan error, 1)
+	go func() { failed <- printEvents(t, c) }()
+	for {
+		line, err := t.ReadLine("esl> ", s.history, failed)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			if line = s.recall(line); line == "" {
+				continue
+			}
+			fmt.Fprintln(t, line)
+		}
+		s.remember(line)
+		if !s.run(line) {
+			return nil
+		}
+	}
+}
+
+// session is the state of an interactive session.
+type session struct {
+	c       *eventsocket.Connection
+	out     io.Writer
+	history []string
+	added   int // Lines added to history in this session
+}
+
+// run runs a line, and returns false to quit.
+func (s *session) run(line string) bool {
+	if !strings.HasPrefix(line, "/") {
+		api(s.out, s.c, line)
+		return true
+	}
+	name, args, _ := strings.Cut(line[1:], " ")
+	args = strings.TrimSpace(args)
+	subs := s.c.Subscriptions()
+	var err error
+	switch name {
+	case "quit", "exit", "bye":
+		return false
+	case "help":
+		fmt.Fprint(s.out, help)
+	case "bgapi":
+		err = bgapi(s.out, s.c, args)
+	case "event", "events":
+		f := strings.Fields(args)
+		if len(f) > 0 && (f[0] == "json" || f[0] == "plain") {
+			subs.SetFormat(f[0])
+			f = f[1:]
+		}
+		if len(f) == 0 {
+			f = []string{"ALL"}
+		}
+		err = subs.Subscribe(f...)
+	case "nixevent":
+		err = subs.Unsubscribe(strings.Fields(args)...)
+	case "noevents":
+		err = subs.UnsubscribeAll()
+	case "filter":
+		header, value, _ := strings.Cut(args, " ")
+		err = s.c.Filter(header, strings.TrimSpace(value))
+	case "nofilter":
+		if args == "" {
+			err = s.c.FilterDeleteAll()
+			break
+		}
+		header, value, _ := strings.Cut(args, " ")
+		err = s.c.FilterDelete(header, strings.TrimSpace(value))
+	case "status":
+		fmt.Fprintln(s.out, subs)
+	case "history":
+		for n, line := range s.history {
+			fmt.Fprintf(s.out, "%5d  %s\n", n+1, line)
+		}
+	default:
+		err = fmt.Errorf("unknown command /%s, see /help", name)
+	}
+	if err != nil {
+		fmt.Fprintln(s.out, "-ERR", err)
+	}
+	return true
+}
+
+// api runs an api command and prints its output. Error responses, like
+// -ERR and -USAGE, are returned as errors.
+func api(out io.Writer, c *eventsocket.Connection, command string) error {
+	ev, err := c.Send("api " + command)
+	if err != nil {
+		fmt.Fprintln(out, "-ERR", err)
+		return err
+	}
+	fmt.Fprint(out, ev.Body)
+	if !strings.HasSuffix(ev.Body, "\n") {
+		fmt.Fprintln(out)
+	}
+	if body := strings.TrimSpace(ev.Body); strings.HasPrefix(body, "-") {
+		return errors.New(body)
+	}
+	return nil
+}
+
+// bgapi starts a background job, and prints its result once it completes.
+func bgapi(out io.Writer, c *eventsocket.Connection, command string) error {
+	if err := c.Subscriptions().Subscribe(eventsocket.EventBackgroundJob); err != nil {
+		return err
+	}
+	job, err := c.BgAPI(command)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "Job-UUID:", job.UUID)
+	go func() {
+		result, err := job.Wait()
+		if err != nil {
+			result = "-ERR " + err.Error()
+		}
+		fmt.Fprintf(out, "\nJob %s (%s):\n%s\n", job.UUID, job.Command, strings.TrimRight(result, "\n"))
+	}()
+	return nil
+}
+
+// printEvents prints the events received until the connection terminates,
+// and returns why it did.
+func printEvents(out io.Writer, c *eventsocket.Connection) error {
+	for {
+		ev, err := c.ReadEvent()
+		if err != nil {
+			// Not io.EOF, which is the end of the input.
+			return fmt.Errorf("connection terminated: %v", err)
+		}
+		name := ev.Get("Event-Name")
+		if name == eventsocket.EventBackgroundJob {
+			continue // Printed by bgapi
+		}
+		if name == eventsocket.EventCustom {
+			name += " " + ev.Get("Event-Subclass")
+		}
+		keys := ev.Keys()
+		sort.Strings(keys)
+		width := 0
+		for _, k := range keys {
+			width = max(width, len(k))
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "\n[%s]\n", name)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "  %-*s  %s\n", width, k, ev.Get(k))
+		}
+		if ev.Body != "" {
+			fmt.Fprintf(&b, "\n%s\n", strings.TrimRight(ev.Body, "\n"))
+		}
+		io.WriteString(out, b.String()) // At once, above the line being edited
+	}
+}
+
+// recall returns the line of history referred to by !! or !n.
+func (s *session) recall(line string) string {
+	n := len(s.history)
+	if line != "!!" {
+		var err error
+		if n, err = strconv.Atoi(line[1:]); err != nil {
+			fmt.Fprintln(s.out, "-ERR usage: !! or !n")
+			return ""
+		}
+	}
+	if n < 1 || n > len(s.history) {
+		fmt.Fprintln(s.out, "-ERR no such line in history")
+		return ""
+	}
+	return s.history[n-1]
+}
+
+// remember adds a line to history, unless it's the same as the last one.
+func (s *session) remember(line string) {
+	if n := len(s.history); n > 0 && s.history[n-1] == line {
+		return
+	}
+	s.history = append(s.history, line)
+	s.added++
+}
+
+func historyFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".esl_history")
+}
+
+// loadHistory reads the history of previous sessions.
+func loadHistory() []string {
+	b, err := os.ReadFile(historyFile())
+	if err != nil {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// saveHistory writes the last lines of history, if any was added.
+func (s *session) saveHistory() {
+	if s.added == 0 || historyFile() == "" {
+		return
+	}
+	lines := s.history
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+	}
+	os.WriteFile(historyFile(), []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
@@ -0,0 +1,18 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package main
+
+type termState struct{}
+
+// makeRaw fails, lines are read without editing on this system.
+func makeRaw(fd int) (*termState, error) {
+	return nil, errNotTerminal
+}
+
+func restore(fd int, s *termState) error {
+	return nil
+}
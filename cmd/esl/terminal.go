@@ -0,0 +1,336 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var errNotTerminal = errors.New("not a terminal")
+
+// terminal reads lines typed by the user, with line editing and history
+// when stdin is a terminal, and writes output, e.g. events, without
+// messing up the line being edited, which is redrawn after it.
+//
+// Keys: arrows, Home, End, Delete, Backspace, and the usual Ctrl keys:
+// A, E, B, F, P, N, U, K, W, C cancels the line and D quits on an empty
+// one.
+type terminal struct {
+	in    *os.File
+	out   *os.File
+	state *termState // Saved before raw mode, nil if not a terminal
+	keys  chan []byte
+	lines chan string // When not a terminal
+	err   error       // Why reading stopped, set before keys or lines is closed
+	ahead []byte      // Keys typed after Enter, for the next line
+
+	mu      sync.Mutex // Guards the fields below, and serializes output
+	editing bool       // Whether a line is being edited
+	prompt  string
+	line    []rune
+	pos     int // Of the cursor in line
+}
+
+// newTerminal puts stdin in raw mode for line editing, if it's a
+// terminal, and starts reading it. Close restores it.
+func newTerminal() *terminal {
+	t := &terminal{in: os.Stdin, out: os.Stdout}
+	state, err := makeRaw(int(t.in.Fd()))
+	if err != nil {
+		t.lines = make(chan string)
+		go t.readLines()
+		return t
+	}
+	t.state = state
+	t.keys = make(chan []byte)
+	go t.readKeys()
+	return t
+}
+
+// Close restores the terminal.
+func (t *terminal) Close() {
+	if t.state != nil {
+		restore(int(t.in.Fd()), t.state)
+	}
+}
+
+func (t *terminal) readLines() {
+	in := bufio.NewScanner(t.in)
+	for in.Scan() {
+		t.lines <- in.Text()
+	}
+	t.err = in.Err()
+	if t.err == nil {
+		t.err = io.EOF
+	}
+	close(t.lines)
+}
+
+func (t *terminal) readKeys() {
+	for {
+		b := make([]byte, 256)
+		n, err := t.in.Read(b)
+		if n > 0 {
+			t.keys <- b[:n]
+		}
+		if err != nil {
+			t.err = err
+			close(t.keys)
+			return
+		}
+	}
+}
+
+// Write writes output above the line being edited, if any.
+func (t *terminal) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.editing {
+		io.WriteString(t.out, "\r\x1b[K")
+	}
+	n, err := t.out.Write(p)
+	if t.editing {
+		if len(p) > 0 && p[len(p)-1] != '\n' {
+			io.WriteString(t.out, "\n")
+		}
+		t.redraw()
+	}
+	return n, err
+}
+
+// ReadLine reads a line, with history recalled by the arrows, until it's
+// typed or cancel fires. It returns io.EOF once the input ends.
+func (t *terminal) ReadLine(prompt string, history []string, cancel <-chan error) (string, error) {
+	if t.state == nil {
+		fmt.Fprint(t, prompt)
+		select {
+		case line, ok := <-t.lines:
+			if !ok {
+				fmt.Fprintln(t)
+				return "", t.err
+			}
+			return line, nil
+		case err := <-cancel:
+			return "", err
+		}
+	}
+	t.mu.Lock()
+	t.editing, t.prompt, t.line, t.pos = true, prompt, nil, 0
+	t.redraw()
+	t.mu.Unlock()
+	e := &edit{t: t, history: history, index: len(history)}
+	for {
+		var b []byte
+		if len(t.ahead) > 0 {
+			b, t.ahead = t.ahead, nil
+		} else {
+			var ok bool
+			select {
+			case b, ok = <-t.keys:
+				if !ok {
+					t.done("\r\n")
+					return "", t.err
+				}
+			case err := <-cancel:
+				t.done("\r\n")
+				return "", err
+			}
+		}
+		t.mu.Lock()
+		line, done, err := e.keys(b)
+		if done || err != nil {
+			t.editing = false
+			io.WriteString(t.out, "\r\n")
+		} else {
+			t.redraw()
+		}
+		t.mu.Unlock()
+		if done || err != nil {
+			return line, err
+		}
+	}
+}
+
+// done stops editing the line, and writes s.
+func (t *terminal) done(s string) {
+	t.mu.Lock()
+	t.editing = false
+	io.WriteString(t.out, s)
+	t.mu.Unlock()
+}
+
+// redraw writes the prompt and the line, and puts the cursor in place.
+// The lock must be held.
+func (t *terminal) redraw() {
+	s := "\r" + t.prompt + string(t.line) + "\x1b[K"
+	if n := len(t.line) - t.pos; n > 0 {
+		s += fmt.Sprintf("\x1b[%dD", n)
+	}
+	io.WriteString(t.out, s)
+}
+
+// edit is the state of a line being edited.
+type edit struct {
+	t       *terminal
+	history []string
+	index   int    // Of the line of history shown, len(history) when new
+	saved   string // The new line, while browsing history
+	utf     []byte // Incomplete UTF-8 sequence
+}
+
+// keys handles the keys typed, and returns the line once Enter is typed.
+// Keys after Enter are kept for the next line.
+func (e *edit) keys(b []byte) (line string, done bool, err error) {
+	t := e.t
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == '\r' || c == '\n':
+			if c == '\r' && i+1 < len(b) && b[i+1] == '\n' {
+				i++
+			}
+			t.ahead = append(t.ahead, b[i+1:]...)
+			return string(t.line), true, nil
+		case c == 0x1b: // Escape sequence, e.g. ESC [ A for up
+			n := escapeLen(b[i:])
+			e.escape(string(b[i : i+n]))
+			i += n - 1
+		case c == 3: // Ctrl-C
+			io.WriteString(t.out, "^C\r\n")
+			t.line, t.pos, e.index = nil, 0, len(e.history)
+		case c == 4: // Ctrl-D
+			if len(t.line) == 0 {
+				return "", false, io.EOF
+			}
+			e.delete()
+		case c == 1:
+			t.pos = 0
+		case c == 5:
+			t.pos = len(t.line)
+		case c == 2:
+			t.pos = max(t.pos-1, 0)
+		case c == 6:
+			t.pos = min(t.pos+1, len(t.line))
+		case c == 16:
+			e.up()
+		case c == 14:
+			e.down()
+		case c == 21: // Ctrl-U
+			t.line, t.pos = t.line[t.pos:], 0
+		case c == 11: // Ctrl-K
+			t.line = t.line[:t.pos]
+		case c == 23: // Ctrl-W
+			j := t.pos
+			for j > 0 && t.line[j-1] == ' ' {
+				j--
+			}
+			for j > 0 && t.line[j-1] != ' ' {
+				j--
+			}
+			t.line, t.pos = append(t.line[:j], t.line[t.pos:]...), j
+		case c == 127 || c == 8: // Backspace
+			if t.pos > 0 {
+				t.pos--
+				e.delete()
+			}
+		case c < ' ':
+			// Other control keys, like Tab, are ignored.
+		default:
+			e.utf = append(e.utf, c)
+			if !utf8.FullRune(e.utf) {
+				continue
+			}
+			r, _ := utf8.DecodeRune(e.utf)
+			e.utf = e.utf[:0]
+			t.line = append(t.line[:t.pos], append([]rune{r}, t.line[t.pos:]...)...)
+			t.pos++
+		}
+	}
+	return "", false, nil
+}
+
+// escapeLen returns the length of the escape sequence b starts with: ESC
+// alone, or followed by a character, or by [ or O and parameters up to the
+// final character.
+func escapeLen(b []byte) int {
+	if len(b) < 2 {
+		return len(b)
+	}
+	if b[1] != '[' && b[1] != 'O' {
+		return 2
+	}
+	for i := 2; i < len(b); i++ {
+		if b[i] >= 0x40 && b[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(b)
+}
+
+// escape handles the escape sequences of the arrows and such.
+func (e *edit) escape(seq string) {
+	t := e.t
+	switch strings.Replace(seq, "O", "[", 1) {
+	case "\x1b[A":
+		e.up()
+	case "\x1b[B":
+		e.down()
+	case "\x1b[C":
+		t.pos = min(t.pos+1, len(t.line))
+	case "\x1b[D":
+		t.pos = max(t.pos-1, 0)
+	case "\x1b[H", "\x1b[1~", "\x1b[7~":
+		t.pos = 0
+	case "\x1b[F", "\x1b[4~", "\x1b[8~":
+		t.pos = len(t.line)
+	case "\x1b[3~":
+		e.delete()
+	}
+}
+
+// delete deletes the character under the cursor.
+func (e *edit) delete() {
+	t := e.t
+	if t.pos < len(t.line) {
+		t.line = append(t.line[:t.pos], t.line[t.pos+1:]...)
+	}
+}
+
+// up shows the previous line of history.
+func (e *edit) up() {
+	if e.index == 0 {
+		return
+	}
+	if e.index == len(e.history) {
+		e.saved = string(e.t.line)
+	}
+	e.index--
+	e.show(e.history[e.index])
+}
+
+// down shows the next line of history, or the new line after the last.
+func (e *edit) down() {
+	if e.index == len(e.history) {
+		return
+	}
+	e.index++
+	if e.index == len(e.history) {
+		e.show(e.saved)
+		return
+	}
+	e.show(e.history[e.index])
+}
+
+func (e *edit) show(line string) {
+	e.t.line = []rune(line)
+	e.t.pos = len(e.t.line)
+}
@@ -0,0 +1,226 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Capture of events, to reproduce problems, e.g. in bug reports.
+//
+// By default it records everything read from the socket once subscribed,
+// with its timing, to a file that eventsocket.ReplayConnection replays.
+// With -journal, the events are appended to an eventsocket.EventJournal
+// in the given directory instead. Either way, only the events subscribed
+// to, and with the headers of -filter, are captured, until the duration or
+// size limit is reached, or it's interrupted.
+//
+// Usage:
+//
+//	esldump -o incident.eslrec -d 5m
+//	esldump -events "CHANNEL_CREATE CHANNEL_HANGUP_COMPLETE" -filter Caller-Context=public
+//	esldump -journal -o /var/tmp/capture -size 100
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+)
+
+func main() {
+	host := flag.String("H", "localhost", "FreeSWITCH host")
+	port := flag.Int("P", 8021, "event socket port")
+	passwd := flag.String("p", "ClueCon", "event socket password")
+	events := flag.String("events", "ALL", "events to subscribe to, separated by spaces")
+	var filters filterFlag
+	flag.Var(&filters, "filter", "only capture events with `header=value`, can be repeated")
+	output := flag.String("o", "", "output file, or directory with -journal (default esldump-<time>)")
+	journal := flag.Bool("journal", false, "append events to a journal instead of recording the socket")
+	duration := flag.Duration("d", 0, "stop after this long, 0 for no limit")
+	size := flag.Int64("size", 0, "stop after this many MiB, 0 for no limit")
+	quiet := flag.Bool("q", false, "do not print progress")
+	flag.Parse()
+	if *output == "" {
+		*output = "esldump-" + time.Now().Format("20060102-150405")
+		if !*journal {
+			*output += ".eslrec"
+		}
+	}
+	addr := net.JoinHostPort(*host, strconv.Itoa(*port))
+	c, err := eventsocket.Dial(addr, *passwd)
+	if err != nil {
+		fatal(err)
+	}
+	defer c.Close()
+	for _, f := range filters {
+		if err := c.Filter(f[0], f[1]); err != nil {
+			fatal(err)
+		}
+	}
+	if err := c.Subscriptions().Subscribe(strings.Fields(*events)...); err != nil {
+		fatal(err)
+	}
+
+	d := &dump{limit: *size << 20, full: make(chan struct{})}
+	var capture func(*eventsocket.Event) error
+	var stop func() error
+	if *journal {
+		j, err := eventsocket.OpenEventJournal(*output)
+		if err != nil {
+			fatal(err)
+		}
+		capture = func(ev *eventsocket.Event) error {
+			b, err := ev.MarshalJSON()
+			if err != nil {
+				return err
+			}
+			d.add(12 + len(b)) // Size of the record, see EventJournal
+			return j.Append(ev)
+		}
+		stop = j.Close
+	} else {
+		f, err := os.Create(*output)
+		if err != nil {
+			fatal(err)
+		}
+		d.w = f
+		// Recording starts with the next message, after the replies
+		// to the commands above.
+		stopRecord := c.Record(d)
+		stop = func() error {
+			err := stopRecord()
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		}
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	var timeout <-chan time.Time
+	if *duration > 0 {
+		timeout = time.After(*duration)
+	}
+	var progress <-chan time.Time
+	if !*quiet {
+		progress = time.Tick(time.Second)
+	}
+	errc := make(chan error, 1)
+	count := 0
+	var mu sync.Mutex
+	go func() {
+		for {
+			ev, err := c.ReadEvent()
+			if err == nil && capture != nil {
+				err = capture(ev)
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+			mu.Lock()
+			count++
+			mu.Unlock()
+		}
+	}()
+	start := time.Now()
+	status := func(end string) {
+		mu.Lock()
+		n := count
+		mu.Unlock()
+		fmt.Fprintf(os.Stderr, "\r%s: %d events, %d bytes, %s%s",
+			*output, n, d.written(), time.Since(start).Truncate(time.Second), end)
+	}
+	var reason error
+loop:
+	for {
+		select {
+		case <-progress:
+			status("")
+		case <-sig:
+			break loop
+		case <-timeout:
+			break loop
+		case <-d.full:
+			break loop
+		case reason = <-errc:
+			break loop
+		}
+	}
+	if err := stop(); err != nil && reason == nil {
+		reason = err
+	}
+	if !*quiet {
+		status("\n")
+	}
+	if reason != nil {
+		fatal(reason)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "esldump:", err)
+	os.Exit(1)
+}
+
+// dump counts what's captured, and signals once it reaches the limit.
+type dump struct {
+	w     *os.File // Recording, if not a journal
+	limit int64    // Zero for no limit
+	full  chan struct{}
+
+	mu   sync.Mutex
+	n    int64
+	done bool
+}
+
+// Write writes to the recording.
+func (d *dump) Write(b []byte) (int, error) {
+	n, err := d.w.Write(b)
+	d.add(n)
+	return n, err
+}
+
+// add counts n bytes captured.
+func (d *dump) add(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.n += int64(n)
+	if d.limit > 0 && d.n >= d.limit && !d.done {
+		d.done = true
+		close(d.full)
+	}
+}
+
+func (d *dump) written() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.n
+}
+
+// filterFlag is a list of header=value flags.
+type filterFlag [][2]string
+
+func (f *filterFlag) String() string {
+	var s []string
+	for _, v := range *f {
+		s = append(s, v[0]+"="+v[1])
+	}
+	return strings.Join(s, " ")
+}
+
+func (f *filterFlag) Set(v string) error {
+	header, value, ok := strings.Cut(v, "=")
+	if !ok || header == "" {
+		return fmt.Errorf("invalid filter %q, want header=value", v)
+	}
+	*f = append(*f, [2]string{header, value})
+	return nil
+}
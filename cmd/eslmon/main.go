@@ -0,0 +1,347 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Live event monitor for the terminal.
+//
+// It shows counters of the events received, by name, the calls they belong
+// to, and the last events that match a filter, refreshed every second.
+//
+// Filters are made of terms that must all match: a bare word matches the
+// event name, or the subclass of CUSTOM events, and Header=value,
+// Header!=value and Header~regexp match header values. A new filter can be
+// typed while it runs, followed by enter; an empty line clears it, and
+// /reset resets the counters.
+//
+// Usage:
+//
+//	eslmon -events "CHANNEL_CREATE CHANNEL_ANSWER CHANNEL_HANGUP_COMPLETE"
+//	eslmon -f "CHANNEL_ANSWER Caller-Caller-ID-Number~^1"
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+)
+
+func main() {
+	host := flag.String("H", "localhost", "FreeSWITCH host")
+	port := flag.Int("P", 8021, "event socket port")
+	passwd := flag.String("p", "ClueCon", "event socket password")
+	events := flag.String("events", "ALL", "events to subscribe to, separated by spaces")
+	filter := flag.String("f", "", "filter of the events shown")
+	lines := flag.Int("n", 20, "number of events shown")
+	refresh := flag.Duration("refresh", time.Second, "refresh interval")
+	plain := flag.Bool("plain", false, "print events as they come, without redrawing the screen")
+	flag.Parse()
+	m := &monitor{
+		counters: make(map[string]int),
+		calls:    make(map[string]*call),
+		lines:    *lines,
+		started:  time.Now(),
+	}
+	if err := m.setFilter(*filter); err != nil {
+		fmt.Fprintln(os.Stderr, "eslmon:", err)
+		os.Exit(1)
+	}
+	addr := net.JoinHostPort(*host, strconv.Itoa(*port))
+	c, err := eventsocket.Dial(addr, *passwd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "eslmon:", err)
+		os.Exit(1)
+	}
+	defer c.Close()
+	if err := c.Subscriptions().Subscribe(strings.Fields(*events)...); err != nil {
+		fmt.Fprintln(os.Stderr, "eslmon:", err)
+		os.Exit(1)
+	}
+	m.addr = addr
+	go m.readInput()
+	if !*plain {
+		go func() {
+			for range time.Tick(*refresh) {
+				m.draw()
+			}
+		}()
+	}
+	for {
+		ev, err := c.ReadEvent()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "eslmon:", err)
+			os.Exit(1)
+		}
+		if line, ok := m.add(ev); ok && *plain {
+			fmt.Println(line)
+		}
+	}
+}
+
+// monitor is the state of the monitor.
+type monitor struct {
+	addr     string
+	mu       sync.Mutex
+	filter   []term
+	expr     string
+	status   string // Error of the last filter typed, if any
+	counters map[string]int
+	total    int
+	calls    map[string]*call // Channel-Call-UUID:call
+	recent   []string         // Last events that matched the filter
+	lines    int
+	started  time.Time
+}
+
+// call is a call, made of the channels with the same Channel-Call-UUID.
+type call struct {
+	id        string
+	legs      map[string]bool
+	caller    string
+	dest      string
+	last      string // Name of the last event
+	created   time.Time
+	updated   time.Time
+	destroyed int // Legs destroyed
+}
+
+// add accounts for an event, and returns its summary if it matches the
+// filter.
+func (m *monitor) add(ev *eventsocket.Event) (string, bool) {
+	name := eventName(ev)
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name]++
+	m.total++
+	if uuid := ev.Get("Unique-Id"); uuid != "" && eventsocket.IsChannelEvent(ev) {
+		m.track(ev, name, uuid, now)
+	}
+	for _, t := range m.filter {
+		if !t.match(ev, name) {
+			return "", false
+		}
+	}
+	line := summary(ev, name, now)
+	m.recent = append(m.recent, line)
+	if len(m.recent) > m.lines {
+		m.recent = m.recent[len(m.recent)-m.lines:]
+	}
+	return line, true
+}
+
+// track adds a channel event to its call, with mu held.
+func (m *monitor) track(ev *eventsocket.Event, name, uuid string, now time.Time) {
+	id := ev.Get("Channel-Call-Uuid")
+	if id == "" {
+		id = uuid
+	}
+	cl := m.calls[id]
+	if cl == nil {
+		cl = &call{id: id, legs: make(map[string]bool), created: now}
+		m.calls[id] = cl
+	}
+	cl.legs[uuid] = true
+	cl.last, cl.updated = name, now
+	if cl.caller == "" {
+		cl.caller = ev.Get("Caller-Caller-Id-Number")
+		cl.dest = ev.Get("Caller-Destination-Number")
+	}
+	if name == eventsocket.EventChannelDestroy {
+		cl.destroyed++
+	}
+}
+
+// draw redraws the screen.
+func (m *monitor) draw() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J") // Home, clear
+	elapsed := time.Since(m.started).Seconds()
+	fmt.Fprintf(&b, "eslmon %s  events=%d (%.1f/s)  calls=%d  filter=%q %s\n\n",
+		m.addr, m.total, float64(m.total)/elapsed, len(m.calls), m.expr, m.status)
+	names := make([]string, 0, len(m.counters))
+	for name := range m.counters {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if m.counters[names[i]] != m.counters[names[j]] {
+			return m.counters[names[i]] > m.counters[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > 10 {
+		names = names[:10]
+	}
+	b.WriteString("EVENTS\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %8d  %s\n", m.counters[name], name)
+	}
+	calls := make([]*call, 0, len(m.calls))
+	for id, cl := range m.calls {
+		// Calls are shown for a while after all legs are gone.
+		if cl.destroyed >= len(cl.legs) && time.Since(cl.updated) > 10*time.Second {
+			delete(m.calls, id)
+			continue
+		}
+		calls = append(calls, cl)
+	}
+	sort.Slice(calls, func(i, j int) bool { return calls[i].updated.After(calls[j].updated) })
+	if len(calls) > 10 {
+		calls = calls[:10]
+	}
+	b.WriteString("\nCALLS\n")
+	for _, cl := range calls {
+		fmt.Fprintf(&b, "  %-8.8s  legs=%d  %-14s -> %-14s  %-26s  %s\n",
+			cl.id, len(cl.legs), cl.caller, cl.dest, cl.last,
+			time.Since(cl.created).Truncate(time.Second))
+	}
+	b.WriteString("\nLAST EVENTS\n")
+	for _, line := range m.recent {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	b.WriteString("\nfilter> ")
+	os.Stdout.WriteString(b.String())
+}
+
+// readInput reads filters typed, one per line.
+func (m *monitor) readInput() {
+	in := bufio.NewScanner(os.Stdin)
+	for in.Scan() {
+		line := strings.TrimSpace(in.Text())
+		if line == "/reset" {
+			m.mu.Lock()
+			m.counters = make(map[string]int)
+			m.total = 0
+			m.started = time.Now()
+			m.mu.Unlock()
+			continue
+		}
+		err := m.setFilter(line)
+		m.mu.Lock()
+		m.status = ""
+		if err != nil {
+			m.status = "(" + err.Error() + ")"
+		}
+		m.mu.Unlock()
+	}
+}
+
+// setFilter parses and sets the filter, which applies to events received
+// from then on.
+func (m *monitor) setFilter(expr string) error {
+	filter, err := parseFilter(expr)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.filter, m.expr, m.recent = filter, expr, nil
+	m.mu.Unlock()
+	return nil
+}
+
+// term is a term of a filter.
+type term struct {
+	key   string // Empty for event names
+	op    string // =, != or ~
+	value string
+	re    *regexp.Regexp
+}
+
+// parseFilter parses a filter, e.g. "CHANNEL_ANSWER Caller-Context=public".
+func parseFilter(expr string) ([]term, error) {
+	var terms []term
+	for _, f := range strings.Fields(expr) {
+		var t term
+		switch {
+		case strings.Contains(f, "!="):
+			t.op = "!="
+		case strings.Contains(f, "="):
+			t.op = "="
+		case strings.Contains(f, "~"):
+			t.op = "~"
+		default:
+			terms = append(terms, term{op: "=", value: f})
+			continue
+		}
+		t.key, t.value, _ = strings.Cut(f, t.op)
+		if t.key == "" {
+			return nil, fmt.Errorf("missing header in %q", f)
+		}
+		if t.op == "~" {
+			re, err := regexp.Compile(t.value)
+			if err != nil {
+				return nil, err
+			}
+			t.re = re
+		}
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+// match reports whether an event matches the term.
+func (t term) match(ev *eventsocket.Event, name string) bool {
+	v := name
+	if t.key != "" {
+		v = header(ev, t.key)
+	}
+	switch t.op {
+	case "!=":
+		return v != t.value
+	case "~":
+		return t.re.MatchString(v)
+	}
+	return v == t.value
+}
+
+// header returns the value of a header, whose name is in any case.
+func header(ev *eventsocket.Event, key string) string {
+	if v, ok := ev.GetOk(key); ok {
+		return v
+	}
+	for _, k := range ev.Keys() {
+		if strings.EqualFold(k, key) {
+			return ev.Get(k)
+		}
+	}
+	return ""
+}
+
+// eventName returns the name of an event, or its subclass for CUSTOM
+// events.
+func eventName(ev *eventsocket.Event) string {
+	if name := ev.Get("Event-Name"); name != eventsocket.EventCustom {
+		return name
+	}
+	return ev.Get("Event-Subclass")
+}
+
+// summary returns a line that describes an event.
+func summary(ev *eventsocket.Event, name string, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  %-26s", now.Format("15:04:05.000"), name)
+	if uuid := ev.Get("Unique-Id"); uuid != "" {
+		fmt.Fprintf(&b, "  %-8.8s", uuid)
+	}
+	if caller := ev.Get("Caller-Caller-Id-Number"); caller != "" {
+		fmt.Fprintf(&b, "  %s -> %s", caller, ev.Get("Caller-Destination-Number"))
+	}
+	if state := ev.Get("Channel-Call-State"); state != "" {
+		fmt.Fprintf(&b, "  %s", state)
+	}
+	if cause := ev.Get("Hangup-Cause"); cause != "" {
+		fmt.Fprintf(&b, "  %s", cause)
+	}
+	return b.String()
+}
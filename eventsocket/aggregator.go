@@ -0,0 +1,272 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// callEvents are the events CallAggregator groups into calls.
+var callEvents = []string{
+	"CHANNEL_CREATE", "CHANNEL_PROGRESS", "CHANNEL_PROGRESS_MEDIA",
+	"CHANNEL_ANSWER", "CHANNEL_BRIDGE", "CHANNEL_HANGUP",
+	"CHANNEL_HANGUP_COMPLETE", "CHANNEL_DESTROY", "RECORD_START",
+}
+
+// CallSummary is the summary of a call, made of one or more legs, built by
+// CallAggregator from their events.
+type CallSummary struct {
+	UUID              string   // Of the first leg
+	Legs              []string // UUIDs of all legs, the first one first
+	Direction         string   // Of the first leg, inbound or outbound
+	CallerIDName      string
+	CallerIDNumber    string
+	DestinationNumber string
+
+	Created  time.Time // When the first leg was created
+	Ringing  time.Time // When any leg started ringing or early media
+	Answered time.Time // When any leg was answered
+	Hangup   time.Time // When the last leg hung up
+
+	// SetupTime is from the creation of the call until it started ringing,
+	// or was answered without ringing. RingTime is from then until it was
+	// answered, or hung up if it wasn't.
+	SetupTime time.Duration
+	RingTime  time.Duration
+
+	HangupCause   HangupCause // Of the first leg
+	TransferredTo []string    // Destinations the legs were transferred to
+	Recordings    []string    // Files recorded during the call
+
+	// Events are the events of all legs, in the order received.
+	Events []*Event
+}
+
+// Billsec returns how long the call was up, from answer to hangup.
+func (s *CallSummary) Billsec() time.Duration {
+	if s.Answered.IsZero() || s.Hangup.Before(s.Answered) {
+		return 0
+	}
+	return s.Hangup.Sub(s.Answered)
+}
+
+// CallAggregator groups the events of calls, by Unique-ID and the
+// Other-Leg-Unique-ID of their legs, and hands a CallSummary to OnSummary
+// once the last leg of a call is destroyed, e.g. for CDR-like pipelines.
+//
+// Example:
+//
+//	a := eventsocket.NewCallAggregator(c, func(s *eventsocket.CallSummary) {
+//		fmt.Println(s.CallerIDNumber, s.DestinationNumber, s.Billsec(), s.HangupCause)
+//	})
+//	go a.Run(ctx)
+type CallAggregator struct {
+	// OnSummary is called with the summary of every call, from Run.
+	OnSummary func(*CallSummary)
+
+	conn  *Connection
+	mu    sync.Mutex
+	calls map[string]*aggregatedCall // uuid of any leg:call
+}
+
+// aggregatedCall is a call whose legs aren't all destroyed yet.
+type aggregatedCall struct {
+	summary CallSummary
+	active  map[string]bool // Legs not destroyed yet
+}
+
+// NewCallAggregator creates a CallAggregator for the given connection,
+// that calls fn with the summary of every call.
+func NewCallAggregator(c *Connection, fn func(*CallSummary)) *CallAggregator {
+	return &CallAggregator{
+		OnSummary: fn,
+		conn:      c,
+		calls:     make(map[string]*aggregatedCall),
+	}
+}
+
+// Run subscribes to channel and RECORD_START events, and groups them into
+// calls until the context is cancelled or the connection terminates.
+// Calls that were already up when Run started are summarized with the
+// events received from then on.
+func (a *CallAggregator) Run(ctx context.Context) error {
+	events := newEventQueue()
+	cancel := a.conn.observe(func(ev *Event) bool {
+		switch ev.peek("Event-Name") {
+		case "CHANNEL_CREATE", "CHANNEL_PROGRESS", "CHANNEL_PROGRESS_MEDIA",
+			"CHANNEL_ANSWER", "CHANNEL_BRIDGE", "CHANNEL_HANGUP",
+			"CHANNEL_HANGUP_COMPLETE", "CHANNEL_DESTROY", "RECORD_START":
+			events.push(ev.retain())
+		}
+		return false
+	})
+	defer cancel()
+	if err := a.conn.Subscriptions().Subscribe(callEvents...); err != nil {
+		return err
+	}
+	for {
+		for ev, ok := events.pop(); ok; ev, ok = events.pop() {
+			// Kept by the summary, not released.
+			a.HandleEvent(ev)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-a.conn.done:
+			return a.conn.err
+		case <-events.wake:
+		}
+	}
+}
+
+// HandleEvent adds an event to its call, and calls OnSummary if it's the
+// CHANNEL_DESTROY of the last leg. Events without Unique-ID are ignored.
+// It's called by Run, and only needs to be called directly by those not
+// using Run.
+func (a *CallAggregator) HandleEvent(ev *Event) {
+	uuid := ev.Get("Unique-Id")
+	if uuid == "" {
+		return
+	}
+	a.mu.Lock()
+	call := a.calls[uuid]
+	if call == nil {
+		call = a.join(ev)
+		if call == nil {
+			call = &aggregatedCall{
+				summary: CallSummary{UUID: uuid},
+				active:  make(map[string]bool),
+			}
+		}
+		call.summary.Legs = append(call.summary.Legs, uuid)
+		call.active[uuid] = true
+		a.calls[uuid] = call
+	}
+	call.add(uuid, ev)
+	var done *CallSummary
+	if ev.Get("Event-Name") == "CHANNEL_DESTROY" {
+		delete(call.active, uuid)
+		if len(call.active) == 0 {
+			for _, leg := range call.summary.Legs {
+				delete(a.calls, leg)
+			}
+			call.summary.finish()
+			done = &call.summary
+		}
+	}
+	a.mu.Unlock()
+	if done != nil && a.OnSummary != nil {
+		a.OnSummary(done)
+	}
+}
+
+// join returns the call of the other leg of an event, if any, with mu
+// held.
+func (a *CallAggregator) join(ev *Event) *aggregatedCall {
+	for _, key := range []string{"Other-Leg-Unique-Id", "Bridge-A-Unique-Id", "Bridge-B-Unique-Id"} {
+		if call := a.calls[ev.Get(key)]; call != nil {
+			return call
+		}
+	}
+	return nil
+}
+
+// add updates the call with an event of one of its legs.
+func (call *aggregatedCall) add(uuid string, ev *Event) {
+	s := &call.summary
+	s.Events = append(s.Events, ev)
+	first := uuid == s.UUID
+	if first {
+		set := func(field *string, key string) {
+			if v := ev.Get(key); v != "" {
+				*field = v
+			}
+		}
+		set(&s.Direction, "Call-Direction")
+		set(&s.CallerIDName, "Caller-Caller-Id-Name")
+		set(&s.CallerIDNumber, "Caller-Caller-Id-Number")
+		set(&s.DestinationNumber, "Caller-Destination-Number")
+		if cause, ok := ev.HangupCause(); ok {
+			s.HangupCause = cause
+		}
+	}
+	times := ev.ChannelTimes()
+	earliest := func(t *time.Time, v time.Time) {
+		if !v.IsZero() && (t.IsZero() || v.Before(*t)) {
+			*t = v
+		}
+	}
+	earliest(&s.Created, times.Created)
+	earliest(&s.Ringing, times.Progress)
+	earliest(&s.Ringing, times.ProgressMedia)
+	earliest(&s.Answered, times.Answered)
+	if times.Hangup.After(s.Hangup) {
+		s.Hangup = times.Hangup
+	}
+	switch ev.Get("Event-Name") {
+	case "RECORD_START":
+		if path := ev.Get("Record-File-Path"); path != "" {
+			s.Recordings = appendNew(s.Recordings, path)
+		}
+	case "CHANNEL_HANGUP_COMPLETE", "CHANNEL_DESTROY":
+		for _, dest := range transferHistory(ev) {
+			s.TransferredTo = appendNew(s.TransferredTo, dest)
+		}
+	}
+}
+
+// finish computes the durations of the summary once all legs are gone.
+func (s *CallSummary) finish() {
+	if s.Created.IsZero() {
+		return
+	}
+	setup := s.Ringing
+	if setup.IsZero() || (!s.Answered.IsZero() && s.Answered.Before(setup)) {
+		setup = s.Answered
+	}
+	if setup.IsZero() {
+		return
+	}
+	s.SetupTime = setup.Sub(s.Created)
+	end := s.Answered
+	if end.IsZero() {
+		end = s.Hangup
+	}
+	if end.After(setup) {
+		s.RingTime = end.Sub(setup)
+	}
+}
+
+// transferHistory returns the destinations in the transfer_history
+// variable of an event, whose entries are epoch:uuid:type:dest, e.g.
+// 1700000000:2f8e...:bl_xfer:1000/XML/default.
+func transferHistory(ev *Event) []string {
+	ev.load()
+	v, ok := ev.Header["Variable_transfer_history"]
+	if !ok {
+		return nil
+	}
+	history := strings.TrimPrefix(plainValue(v), "ARRAY::")
+	var dests []string
+	for _, entry := range strings.Split(history, "|:") {
+		if f := strings.SplitN(entry, ":", 4); len(f) == 4 {
+			dests = append(dests, f[3])
+		}
+	}
+	return dests
+}
+
+// appendNew appends s to list unless it's there already.
+func appendNew(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
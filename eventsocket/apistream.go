@@ -0,0 +1,135 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// ApiStream sends an api command and returns the body of the response as
+// it's read from the socket, e.g. for "show channels" on a busy box, which
+// can be tens of megabytes. The body ends after Content-Length bytes.
+//
+// The connection can't read anything else until the body is closed, so it
+// must always be closed, even when not read to the end. Replies starting
+// with -ERR are returned as errors, but others like -USAGE are part of the
+// body.
+//
+// Unlike Send, ApiStream doesn't time out waiting for the response, close
+// the connection to give up.
+//
+// Example:
+//
+//	body, err := c.ApiStream("show channels as json")
+//	if err != nil {
+//		...
+//	}
+//	defer body.Close()
+//	dec := json.NewDecoder(body)
+func (h *Connection) ApiStream(command string) (body io.ReadCloser, err error) {
+	cmd := []byte("api " + command + "\r\n\r\n")
+	if m := h.stats(); m != nil {
+		defer func(start time.Time) {
+			m.CommandSent(commandName(cmd), time.Since(start), err)
+		}(time.Now())
+	}
+	ch, err := h.write(cmd, true)
+	if err != nil {
+		return nil, err
+	}
+	var r *reply
+	select {
+	case r = <-ch:
+	case <-h.done:
+		select {
+		case r = <-ch:
+		default:
+			return nil, h.err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.stream == nil {
+		// Not an api response, e.g. a command/reply.
+		return nil, errUnexpectedEvent
+	}
+	return r.stream, nil
+}
+
+// apiStream is the body of an api response, read by the caller of
+// ApiStream while the read loop waits for it to be closed.
+type apiStream struct {
+	mu     sync.Mutex
+	r      io.Reader
+	closed bool
+	done   chan struct{} // Closed by Close
+}
+
+// Read reads from the body of the response.
+func (s *apiStream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, errClosed
+	}
+	return s.r.Read(p)
+}
+
+// Close discards what's left of the body and lets the read loop go on.
+func (s *apiStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	_, err := io.Copy(io.Discard, s.r)
+	close(s.done)
+	return err
+}
+
+// streaming reports whether the caller waiting for the next reply wants
+// its body streamed.
+func (h *Connection) streaming() bool {
+	h.pmu.Lock()
+	defer h.pmu.Unlock()
+	return len(h.pending) > 0 && h.pending[0].stream
+}
+
+// readStream hands the body of an api response to the caller of ApiStream,
+// and waits for it to be closed before going on reading from the socket.
+func (h *Connection) readStream(length int) error {
+	if length < 0 {
+		length = 0
+	}
+	if length >= 2 {
+		b, err := h.reader.Peek(2)
+		if err != nil {
+			return err
+		}
+		if string(b) == "-E" {
+			body := make([]byte, length)
+			if _, err := io.ReadFull(h.reader, body); err != nil {
+				return err
+			}
+			h.deliver(&reply{err: replyError(string(body))})
+			return nil
+		}
+	}
+	s := &apiStream{
+		r:    io.LimitReader(h.reader, int64(length)),
+		done: make(chan struct{}),
+	}
+	h.deliver(&reply{stream: s})
+	select {
+	case <-s.done:
+		return nil
+	case <-h.done:
+		return h.err
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"sync"
+)
+
+// OriginateStrategy picks the node of a Cluster to make a new call on.
+type OriginateStrategy interface {
+	// Pick returns the index of the chosen node, given the status of the
+	// connected ones, which are never empty.
+	Pick(nodes []NodeStatus) int
+}
+
+// OriginateScheduler spreads new calls across the nodes of a Cluster,
+// according to a strategy.
+//
+// Calls are made with Connection.Originate, which requires connections
+// subscribed to BACKGROUND_JOB events, and strategies based on load, like
+// LeastSessions, require HEARTBEAT events. Subscribe to both in the Setup
+// of the Cluster.
+//
+// Example:
+//
+//	c := eventsocket.NewCluster("ClueCon", "fs1:8021", "fs2:8021")
+//	c.Setup = func(conn *eventsocket.Connection) error {
+//		return conn.Subscriptions().Subscribe("BACKGROUND_JOB", "HEARTBEAT")
+//	}
+//	go c.Run(ctx)
+//	s := eventsocket.NewOriginateScheduler(c, eventsocket.LeastSessions())
+//	uuid, node, err := s.Originate(ctx, eventsocket.NewOriginate().
+//		Endpoint("sofia/gateway/pstn/5551234").
+//		Extension("9000", "XML", "default"))
+type OriginateScheduler struct {
+	cluster  *Cluster
+	strategy OriginateStrategy
+}
+
+// NewOriginateScheduler creates an OriginateScheduler for the cluster,
+// using the given strategy, or RoundRobin if nil.
+func NewOriginateScheduler(c *Cluster, strategy OriginateStrategy) *OriginateScheduler {
+	if strategy == nil {
+		strategy = RoundRobin()
+	}
+	return &OriginateScheduler{cluster: c, strategy: strategy}
+}
+
+// Originate makes a call on the node picked by the strategy, and returns
+// the UUID of the new channel along with the address of the node that owns
+// it. See Connection.Originate. It returns ErrDisconnected if no node is
+// connected.
+//
+// Calls that fail aren't tried again on other nodes, since they may have
+// gone through already.
+func (s *OriginateScheduler) Originate(ctx context.Context, b *OriginateBuilder) (uuid, node string, err error) {
+	conns, status := s.cluster.connected()
+	if len(conns) == 0 {
+		return "", "", ErrDisconnected
+	}
+	k := s.strategy.Pick(status)
+	if k < 0 || k >= len(conns) {
+		k = 0
+	}
+	uuid, err = conns[k].Originate(ctx, b)
+	return uuid, status[k].Addr, err
+}
+
+// RoundRobin returns a strategy that picks nodes in turns.
+func RoundRobin() OriginateStrategy {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	mu   sync.Mutex
+	last string // Address of the last node picked
+}
+
+func (r *roundRobin) Pick(nodes []NodeStatus) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// The node after the last one picked, in order of addresses, so turns
+	// aren't skipped when nodes come and go.
+	k := -1
+	for i, n := range nodes {
+		if n.Addr > r.last && (k < 0 || n.Addr < nodes[k].Addr) {
+			k = i
+		}
+	}
+	if k < 0 {
+		for i, n := range nodes {
+			if k < 0 || n.Addr < nodes[k].Addr {
+				k = i
+			}
+		}
+	}
+	r.last = nodes[k].Addr
+	return k
+}
+
+// LeastSessions returns a strategy that picks the node with the fewest
+// active sessions, as reported by its last HEARTBEAT, relative to its
+// limit of sessions if any. Nodes without heartbeats are only picked if no
+// node has any.
+func LeastSessions() OriginateStrategy {
+	return leastSessions{}
+}
+
+type leastSessions struct{}
+
+func (leastSessions) Pick(nodes []NodeStatus) int {
+	k, least := 0, -1.0
+	for i, n := range nodes {
+		hb := n.Heartbeat
+		if hb == nil {
+			continue
+		}
+		load := float64(hb.SessionCount)
+		if hb.MaxSessions > 0 {
+			load /= float64(hb.MaxSessions)
+		}
+		if least < 0 || load < least {
+			k, least = i, load
+		}
+	}
+	return k
+}
+
+// Weighted returns a strategy that picks nodes in proportion to their
+// weights, by address, e.g. a node of weight 2 gets twice the calls of a
+// node of weight 1. Nodes missing from weights have weight 1.
+func Weighted(weights map[string]int) OriginateStrategy {
+	w := make(map[string]int, len(weights))
+	for addr, n := range weights {
+		w[addr] = n
+	}
+	return &weighted{weights: w, current: make(map[string]int)}
+}
+
+// weighted is the smooth weighted round robin of nginx, which interleaves
+// the nodes rather than picking the same node many times in a row.
+type weighted struct {
+	mu      sync.Mutex
+	weights map[string]int
+	current map[string]int
+}
+
+func (w *weighted) Pick(nodes []NodeStatus) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	k, total := 0, 0
+	for i, n := range nodes {
+		weight, ok := w.weights[n.Addr]
+		if !ok {
+			weight = 1
+		}
+		total += weight
+		w.current[n.Addr] += weight
+		if w.current[n.Addr] > w.current[nodes[k].Addr] {
+			k = i
+		}
+	}
+	w.current[nodes[k].Addr] -= total
+	return k
+}
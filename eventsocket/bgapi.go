@@ -0,0 +1,106 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "strings"
+
+// Job is a background api command started by BgAPI.
+type Job struct {
+	UUID    string // Job-UUID, also in the BACKGROUND_JOB event
+	Command string // The api command, e.g. originate ...
+
+	h      *Connection
+	done   chan struct{}
+	ev     *Event
+	cancel func()
+}
+
+// BgAPI runs an api command in the background, using bgapi, and returns
+// immediately. The returned Job tells when the command completes, based on
+// the BACKGROUND_JOB event matching its Job-UUID.
+//
+// The connection must be subscribed to BACKGROUND_JOB events.
+//
+// Example:
+//
+//	c.Send("events plain BACKGROUND_JOB")
+//	job, err := c.BgAPI("originate user/1000 &park()")
+//	...
+//	result, err := job.Wait()
+//
+// See http://wiki.freeswitch.org/wiki/Event_Socket#bgapi for details.
+func (h *Connection) BgAPI(command string) (*Job, error) {
+	if command == "" || strings.IndexAny(command, "\r\n") >= 0 {
+		return nil, errInvalidCommand
+	}
+	j := &Job{
+		UUID:    newUUID(),
+		Command: command,
+		h:       h,
+		done:    make(chan struct{}),
+	}
+	j.cancel = h.observe(func(ev *Event) bool {
+		if ev.peek("Event-Name") != EventBackgroundJob ||
+			ev.peek("Job-Uuid") != j.UUID {
+			return false
+		}
+		j.ev = ev.retain()
+		close(j.done)
+		return true
+	})
+	_, err := h.do([]byte("bgapi " + command + "\nJob-UUID: " + j.UUID + "\n\n"))
+	if err != nil {
+		j.cancel()
+		return nil, err
+	}
+	return j, nil
+}
+
+// Done returns a channel that's closed when the job completes.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Event returns the BACKGROUND_JOB event of the job, or nil if it didn't
+// complete yet.
+func (j *Job) Event() *Event {
+	select {
+	case <-j.done:
+		return j.ev
+	default:
+		return nil
+	}
+}
+
+// Wait waits for the job to complete and returns its result, which is the
+// same as the api command would return. Results starting with -ERR are
+// returned as errors, as well as connection errors.
+func (j *Job) Wait() (string, error) {
+	select {
+	case <-j.done:
+	case <-j.h.done:
+		select {
+		case <-j.done:
+		default:
+			j.cancel()
+			return "", j.h.err
+		}
+	}
+	return j.Result()
+}
+
+// Result returns the result of a completed job, like Wait, or an error if
+// the job didn't complete yet.
+func (j *Job) Result() (string, error) {
+	ev := j.Event()
+	if ev == nil {
+		return "", errJobPending
+	}
+	body := strings.TrimSpace(ev.Body)
+	if strings.HasPrefix(body, "-") {
+		return "", replyError(body)
+	}
+	return body, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var errBridge = errors.New("Unexpected uuid_bridge result")
+
+// Bridge bridges two existing channels using uuid_bridge. It returns
+// ErrNoSuchChannel when either channel doesn't exist.
+//
+// FreeSWITCH replies as soon as the bridge is scheduled, see BridgeWait
+// to wait until it's actually established.
+func (h *Connection) Bridge(uuidA, uuidB string) error {
+	if !validArg(uuidA) || !validArg(uuidB) {
+		return errInvalidArgument
+	}
+	result, err := h.api("uuid_bridge " + uuidA + " " + uuidB)
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "invalid uuid") {
+			return ErrNoSuchChannel
+		}
+		return err
+	}
+	if !strings.HasPrefix(result, "+OK") {
+		return errBridge
+	}
+	return nil
+}
+
+// BridgeWait bridges two channels like Bridge, and waits for the
+// CHANNEL_BRIDGE event confirming the bridge is up. It returns
+// ErrChannelHangup if either channel hangs up first, or the context error.
+//
+// The connection must be subscribed to CHANNEL_BRIDGE and CHANNEL_HANGUP
+// events of both channels.
+//
+// Example:
+//
+//	c.Send("events plain CHANNEL_BRIDGE CHANNEL_HANGUP")
+//	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+//	defer cancel()
+//	if err := c.BridgeWait(ctx, agent, caller); err != nil {
+//		...
+//	}
+func (h *Connection) BridgeWait(ctx context.Context, uuidA, uuidB string) error {
+	result := make(chan error, 1)
+	// Observe before bridging so the events can't be missed.
+	cancel := h.observe(func(ev *Event) bool {
+		uuid := ev.peek("Unique-Id")
+		switch ev.peek("Event-Name") {
+		case "CHANNEL_BRIDGE":
+			a, b := ev.peek("Bridge-A-Unique-Id"), ev.peek("Bridge-B-Unique-Id")
+			if a == uuidA && b == uuidB || a == uuidB && b == uuidA {
+				result <- nil
+				return true
+			}
+		case "CHANNEL_HANGUP":
+			if uuid == uuidA || uuid == uuidB {
+				result <- ErrChannelHangup
+				return true
+			}
+		}
+		return false
+	})
+	defer cancel()
+	if err := h.Bridge(uuidA, uuidB); err != nil {
+		return err
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-h.done:
+		return h.err
+	}
+}
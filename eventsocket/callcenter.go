@@ -0,0 +1,353 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errCallCenterReply = errors.New("Unexpected callcenter_config reply")
+
+// Agent statuses of mod_callcenter.
+const (
+	AgentLoggedOut         = "Logged Out"
+	AgentAvailable         = "Available"
+	AgentAvailableOnDemand = "Available (On Demand)"
+	AgentOnBreak           = "On Break"
+)
+
+// CallCenter manages the agents, queues and tiers of mod_callcenter, using
+// callcenter_config.
+//
+// See http://wiki.freeswitch.org/wiki/Mod_callcenter for details.
+//
+// Example:
+//
+//	cc := eventsocket.NewCallCenter(c)
+//	cc.Login("1000@default")
+//	agents, err := cc.QueueAgents("support@default")
+type CallCenter struct {
+	conn *Connection
+}
+
+// NewCallCenter creates a CallCenter that issues commands on the given
+// connection.
+func NewCallCenter(c *Connection) *CallCenter {
+	return &CallCenter{conn: c}
+}
+
+// CallCenterAgent is an agent of mod_callcenter.
+type CallCenterAgent struct {
+	Name          string
+	Type          string // callback or uuid-standby
+	Contact       string // Dial string of the agent
+	Status        string // See AgentAvailable and friends
+	State         string // e.g. Waiting, Receiving, In a queue call
+	CallsAnswered int
+	NoAnswerCount int
+
+	// Fields has all the fields listed by mod_callcenter, by name.
+	Fields map[string]string
+}
+
+// CallCenterQueue is a queue of mod_callcenter.
+type CallCenterQueue struct {
+	Name     string
+	Strategy string // e.g. longest-idle-agent, ring-all
+
+	// Fields has all the fields listed by mod_callcenter, by name.
+	Fields map[string]string
+}
+
+// CallCenterTier links an agent to a queue.
+type CallCenterTier struct {
+	Queue    string
+	Agent    string
+	State    string
+	Level    int
+	Position int
+}
+
+// Login sets the status of an agent to Available.
+func (cc *CallCenter) Login(agent string) error {
+	return cc.SetAgentStatus(agent, AgentAvailable)
+}
+
+// Logout sets the status of an agent to Logged Out.
+func (cc *CallCenter) Logout(agent string) error {
+	return cc.SetAgentStatus(agent, AgentLoggedOut)
+}
+
+// SetAgentStatus sets the status of an agent, e.g. AgentOnBreak.
+func (cc *CallCenter) SetAgentStatus(agent, status string) error {
+	return cc.exec("agent set status", agent, QuoteArg(status))
+}
+
+// AgentStatus returns the status of an agent.
+func (cc *CallCenter) AgentStatus(agent string) (string, error) {
+	if !validArg(agent) {
+		return "", errInvalidArgument
+	}
+	return cc.config("agent get status " + agent)
+}
+
+// AddAgent adds an agent of the given type, callback or uuid-standby.
+func (cc *CallCenter) AddAgent(agent, agentType string) error {
+	return cc.exec("agent add", agent, agentType)
+}
+
+// RemoveAgent removes an agent.
+func (cc *CallCenter) RemoveAgent(agent string) error {
+	return cc.exec("agent del", agent)
+}
+
+// Agents returns all agents.
+func (cc *CallCenter) Agents() ([]CallCenterAgent, error) {
+	return cc.agents("agent list")
+}
+
+// QueueAgents returns the agents of a queue.
+func (cc *CallCenter) QueueAgents(queue string) ([]CallCenterAgent, error) {
+	if !validArg(queue) {
+		return nil, errInvalidArgument
+	}
+	return cc.agents("queue list agents " + queue)
+}
+
+// Queues returns all queues.
+func (cc *CallCenter) Queues() ([]CallCenterQueue, error) {
+	rows, err := cc.list("queue list")
+	if err != nil {
+		return nil, err
+	}
+	queues := make([]CallCenterQueue, len(rows))
+	for n, row := range rows {
+		queues[n] = CallCenterQueue{
+			Name:     row["name"],
+			Strategy: row["strategy"],
+			Fields:   row,
+		}
+	}
+	return queues, nil
+}
+
+// AddTier adds an agent to a queue, with the given level and position.
+func (cc *CallCenter) AddTier(queue, agent string, level, position int) error {
+	return cc.exec("tier add", queue, agent, strconv.Itoa(level), strconv.Itoa(position))
+}
+
+// SetTierLevel changes the level of an agent in a queue.
+func (cc *CallCenter) SetTierLevel(queue, agent string, level int) error {
+	return cc.exec("tier set level", queue, agent, strconv.Itoa(level))
+}
+
+// SetTierPosition changes the position of an agent in a queue.
+func (cc *CallCenter) SetTierPosition(queue, agent string, position int) error {
+	return cc.exec("tier set position", queue, agent, strconv.Itoa(position))
+}
+
+// RemoveTier removes an agent from a queue.
+func (cc *CallCenter) RemoveTier(queue, agent string) error {
+	return cc.exec("tier del", queue, agent)
+}
+
+// Tiers returns all tiers.
+func (cc *CallCenter) Tiers() ([]CallCenterTier, error) {
+	rows, err := cc.list("tier list")
+	if err != nil {
+		return nil, err
+	}
+	tiers := make([]CallCenterTier, len(rows))
+	for n, row := range rows {
+		tiers[n] = CallCenterTier{
+			Queue:    row["queue"],
+			Agent:    row["agent"],
+			State:    row["state"],
+			Level:    atoi(row["level"]),
+			Position: atoi(row["position"]),
+		}
+	}
+	return tiers, nil
+}
+
+// agents runs a command that lists agents.
+func (cc *CallCenter) agents(cmd string) ([]CallCenterAgent, error) {
+	rows, err := cc.list(cmd)
+	if err != nil {
+		return nil, err
+	}
+	agents := make([]CallCenterAgent, len(rows))
+	for n, row := range rows {
+		agents[n] = CallCenterAgent{
+			Name:          row["name"],
+			Type:          row["type"],
+			Contact:       row["contact"],
+			Status:        row["status"],
+			State:         row["state"],
+			CallsAnswered: atoi(row["calls_answered"]),
+			NoAnswerCount: atoi(row["no_answer_count"]),
+			Fields:        row,
+		}
+	}
+	return agents, nil
+}
+
+// exec runs a command that changes the configuration, validating its
+// arguments, which are already quoted if needed.
+func (cc *CallCenter) exec(cmd string, args ...string) error {
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, "\r\n") {
+			return errInvalidArgument
+		}
+	}
+	result, err := cc.config(cmd + " " + strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(result, "+OK") {
+		return errCallCenterReply
+	}
+	return nil
+}
+
+// list runs a command that lists things as a table with | separated
+// fields and a header, and returns its rows.
+func (cc *CallCenter) list(cmd string) ([]map[string]string, error) {
+	result, err := cc.config(cmd)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(result, "\n")
+	if n := len(lines) - 1; lines[n] == "+OK" {
+		lines = lines[:n]
+	}
+	if len(lines) == 0 || lines[0] == "" {
+		return nil, errCallCenterReply
+	}
+	header := strings.Split(lines[0], "|")
+	rows := make([]map[string]string, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		row := make(map[string]string, len(header))
+		for n, v := range strings.Split(line, "|") {
+			if n < len(header) {
+				row[header[n]] = v
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// config runs callcenter_config.
+func (cc *CallCenter) config(cmd string) (string, error) {
+	return cc.conn.api("callcenter_config " + cmd)
+}
+
+// CallCenterEvent is an event of mod_callcenter parsed by
+// ParseCallCenterEvent: *AgentStatusChange, *AgentStateChange,
+// *MemberQueueStart or *MemberQueueEnd.
+type CallCenterEvent interface {
+	callCenterEvent()
+}
+
+// AgentStatusChange is sent when the status of an agent changes, e.g. from
+// Available to On Break.
+type AgentStatusChange struct {
+	Agent  string
+	Status string
+}
+
+// AgentStateChange is sent when the state of an agent changes, e.g. from
+// Waiting to Receiving.
+type AgentStateChange struct {
+	Agent string
+	State string
+}
+
+// MemberQueueStart is sent when a caller enters a queue.
+type MemberQueueStart struct {
+	Queue          string
+	MemberUUID     string // Member-UUID, identifies the caller in the queue
+	SessionUUID    string // Channel of the caller
+	CallerIDName   string
+	CallerIDNumber string
+}
+
+// MemberQueueEnd is sent when a caller leaves a queue, either answered by
+// an agent or not.
+type MemberQueueEnd struct {
+	Queue        string
+	MemberUUID   string
+	SessionUUID  string
+	Agent        string    // Agent that answered, if any
+	Cause        string    // Terminated if answered, Cancel otherwise
+	CancelReason string    // e.g. TIMEOUT or BREAK_OUT, when cancelled
+	Joined       time.Time // When the caller entered the queue
+	Left         time.Time // When the caller left the queue
+}
+
+func (*AgentStatusChange) callCenterEvent() {}
+func (*AgentStateChange) callCenterEvent()  {}
+func (*MemberQueueStart) callCenterEvent()  {}
+func (*MemberQueueEnd) callCenterEvent()    {}
+
+// ParseCallCenterEvent parses callcenter::info CUSTOM events, based on
+// their CC-Action header. It returns false for other events and actions.
+//
+// The connection must be subscribed to the events with
+// "events plain CUSTOM callcenter::info".
+func ParseCallCenterEvent(ev *Event) (CallCenterEvent, bool) {
+	if ev.Get("Event-Subclass") != "callcenter::info" {
+		return nil, false
+	}
+	switch ev.Get("Cc-Action") {
+	case "agent-status-change":
+		return &AgentStatusChange{
+			Agent:  ev.Get("Cc-Agent"),
+			Status: ev.Get("Cc-Agent-Status"),
+		}, true
+	case "agent-state-change":
+		return &AgentStateChange{
+			Agent: ev.Get("Cc-Agent"),
+			State: ev.Get("Cc-Agent-State"),
+		}, true
+	case "member-queue-start":
+		return &MemberQueueStart{
+			Queue:          ev.Get("Cc-Queue"),
+			MemberUUID:     ev.Get("Cc-Member-Uuid"),
+			SessionUUID:    ev.Get("Cc-Member-Session-Uuid"),
+			CallerIDName:   ev.Get("Cc-Member-Cid-Name"),
+			CallerIDNumber: ev.Get("Cc-Member-Cid-Number"),
+		}, true
+	case "member-queue-end":
+		return &MemberQueueEnd{
+			Queue:        ev.Get("Cc-Queue"),
+			MemberUUID:   ev.Get("Cc-Member-Uuid"),
+			SessionUUID:  ev.Get("Cc-Member-Session-Uuid"),
+			Agent:        ev.Get("Cc-Agent"),
+			Cause:        ev.Get("Cc-Cause"),
+			CancelReason: ev.Get("Cc-Cancel-Reason"),
+			Joined:       epoch(ev.Get("Cc-Member-Joined-Time")),
+			Left:         epoch(ev.Get("Cc-Member-Leaving-Time")),
+		}, true
+	}
+	return nil, false
+}
+
+// epoch converts seconds since the epoch to time, or the zero time if s
+// is not a number or 0.
+func epoch(s string) time.Time {
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
@@ -0,0 +1,196 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"sync"
+	"time"
+)
+
+// CallStoreVariable is the channel variable CallStore uses to carry its
+// token along with the call.
+const CallStoreVariable = "eventsocket_call_token"
+
+const callStoreTTL = time.Hour
+
+// CallStore keeps application state about calls that's shared across
+// handlers, like a session store in web applications.
+//
+// Each call gets a token, stored in the CallStoreVariable channel variable
+// by Attach, so when the call is transferred back into a socket application
+// and a new outbound connection comes in, the handler can find the state
+// left by the previous one.
+//
+// Example:
+//
+//	var store = eventsocket.NewCallStore(0)
+//
+//	func menu(c *eventsocket.Connection) {
+//		ev, _ := c.Send("connect")
+//		token, _ := store.Attach(c, ev.Get("Unique-Id"))
+//		store.Set(token, "account", account)
+//		...
+//	}
+//
+//	func payment(c *eventsocket.Connection) {
+//		ev, _ := c.Send("connect")
+//		token, _ := store.Token(ev)
+//		account, _ := store.Get(token, "account")
+//		...
+//	}
+//
+// CallStore is safe for concurrent use. State is kept in memory only.
+type CallStore struct {
+	ttl   time.Duration
+	mu    sync.Mutex
+	calls map[string]*callState
+	swept time.Time
+}
+
+// callState holds the values of a single call.
+type callState struct {
+	values  map[string]interface{}
+	ttl     time.Duration // See SetTTL, 0 for the one of the store
+	expires time.Time
+}
+
+// NewCallStore creates a CallStore that forgets calls that aren't accessed
+// for longer than ttl, or one hour when ttl is 0. The lifetime of single
+// calls can be changed with SetTTL.
+func NewCallStore(ttl time.Duration) *CallStore {
+	if ttl <= 0 {
+		ttl = callStoreTTL
+	}
+	return &CallStore{
+		ttl:   ttl,
+		calls: make(map[string]*callState),
+		swept: time.Now(),
+	}
+}
+
+// NewToken creates an empty entry in the store and returns its token.
+func (s *CallStore) NewToken() string {
+	token := newUUID()
+	s.mu.Lock()
+	s.state(token, true)
+	s.mu.Unlock()
+	return token
+}
+
+// Attach creates a new entry in the store for the channel identified by
+// uuid, and saves its token in the CallStoreVariable channel variable.
+// Channels that already have a token keep it.
+func (s *CallStore) Attach(c *Connection, uuid string) (string, error) {
+	if !validArg(uuid) {
+		return "", errInvalidArgument
+	}
+	token, err := c.api("uuid_getvar " + uuid + " " + CallStoreVariable)
+	if err != nil {
+		return "", err
+	}
+	if token != "" && token != "_undef_" {
+		return token, nil
+	}
+	token = s.NewToken()
+	_, err = c.api("uuid_setvar " + uuid + " " + CallStoreVariable + " " + token)
+	if err != nil {
+		s.Forget(token)
+		return "", err
+	}
+	return token, nil
+}
+
+// Token returns the token carried by a channel event, like the reply to
+// "connect" on outbound connections.
+func (s *CallStore) Token(ev *Event) (string, bool) {
+	return ev.VariableOk(CallStoreVariable)
+}
+
+// Set stores a value for the call, and extends its lifetime.
+func (s *CallStore) Set(token, key string, value interface{}) {
+	s.mu.Lock()
+	s.state(token, true).values[key] = value
+	s.mu.Unlock()
+}
+
+// Get returns a value stored for the call, and extends its lifetime.
+func (s *CallStore) Get(token, key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cs := s.state(token, false)
+	if cs == nil {
+		return nil, false
+	}
+	v, ok := cs.values[key]
+	return v, ok
+}
+
+// SetTTL sets how long the call is kept without being accessed, instead
+// of the ttl of the store, and extends its lifetime. A d of 0 restores the
+// ttl of the store.
+//
+// Example:
+//
+//	token := store.NewToken()
+//	store.SetTTL(token, 24*time.Hour) // e.g. a callback scheduled for tomorrow
+func (s *CallStore) SetTTL(token string, d time.Duration) {
+	s.mu.Lock()
+	cs := s.state(token, true)
+	cs.ttl = max(d, 0)
+	cs.expires = time.Now().Add(s.lifetime(cs))
+	s.mu.Unlock()
+}
+
+// Delete removes a value stored for the call.
+func (s *CallStore) Delete(token, key string) {
+	s.mu.Lock()
+	if cs := s.state(token, false); cs != nil {
+		delete(cs.values, key)
+	}
+	s.mu.Unlock()
+}
+
+// Forget removes all values stored for the call.
+func (s *CallStore) Forget(token string) {
+	s.mu.Lock()
+	delete(s.calls, token)
+	s.mu.Unlock()
+}
+
+// state returns the state of the call, creating it when create is set.
+// It must be called with s.mu held.
+func (s *CallStore) state(token string, create bool) *callState {
+	now := time.Now()
+	if now.Sub(s.swept) > s.ttl {
+		for k, cs := range s.calls {
+			if now.After(cs.expires) {
+				delete(s.calls, k)
+			}
+		}
+		s.swept = now
+	}
+	cs := s.calls[token]
+	if cs != nil && now.After(cs.expires) {
+		delete(s.calls, token)
+		cs = nil
+	}
+	if cs == nil {
+		if !create {
+			return nil
+		}
+		cs = &callState{values: make(map[string]interface{})}
+		s.calls[token] = cs
+	}
+	cs.expires = now.Add(s.lifetime(cs))
+	return cs
+}
+
+// lifetime returns the ttl of the call.
+func (s *CallStore) lifetime(cs *callState) time.Duration {
+	if cs.ttl > 0 {
+		return cs.ttl
+	}
+	return s.ttl
+}
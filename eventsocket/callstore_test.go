@@ -0,0 +1,36 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCallStoreTTL checks that calls can be kept for less, or longer, than
+// the ttl of the store.
+func TestCallStoreTTL(t *testing.T) {
+	s := NewCallStore(50 * time.Millisecond)
+	short, long, def := s.NewToken(), s.NewToken(), s.NewToken()
+	for _, token := range []string{short, long, def} {
+		s.Set(token, "k", token)
+	}
+	s.SetTTL(short, 10*time.Millisecond)
+	s.SetTTL(long, time.Hour)
+	time.Sleep(25 * time.Millisecond)
+	if _, ok := s.Get(short, "k"); ok {
+		t.Fatal("call with a short ttl wasn't forgotten")
+	}
+	if _, ok := s.Get(def, "k"); !ok {
+		t.Fatal("call with the ttl of the store was forgotten early")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := s.Get(def, "k"); ok {
+		t.Fatal("call with the ttl of the store wasn't forgotten")
+	}
+	if v, ok := s.Get(long, "k"); !ok || v != long {
+		t.Fatal("call with a long ttl was forgotten")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "strings"
+
+// ChannelData is the state of the channel of an outbound connection, as
+// sent by FreeSWITCH in reply to connect.
+type ChannelData struct {
+	UUID              string // Unique-ID
+	Name              string // Channel-Name, e.g. sofia/internal/1000@host
+	Direction         string // Call-Direction, inbound or outbound
+	State             string // Channel-State, e.g. CS_EXECUTE
+	CallerIDName      string // Caller-Caller-ID-Name
+	CallerIDNumber    string // Caller-Caller-ID-Number
+	DestinationNumber string // Caller-Destination-Number
+	Context           string // Caller-Context
+	Dialplan          string // Caller-Dialplan
+
+	// Variables are the channel variables, without the variable_ prefix.
+	Variables map[string]string
+
+	// SocketApp is the first word after host:port in the data of the
+	// socket application, e.g. ivr in "127.0.0.1:9090 ivr async full", or
+	// "" if none. Router dispatches connections by it. SocketArgs are the
+	// words after it, without async and full.
+	SocketApp  string
+	SocketArgs []string
+
+	// Async and Full are the options of the socket application: whether
+	// the connection is in async mode, where sendmsg returns right away,
+	// and whether it has full access, e.g. to api commands and the
+	// events of other channels. See TargetUUID and RouteOtherChannels.
+	Async bool
+	Full  bool
+
+	// Event is the connect reply, with all the headers.
+	Event *Event
+}
+
+// ParseChannelData parses the reply to connect, or any other event with
+// channel data, like CHANNEL_ANSWER.
+func ParseChannelData(ev *Event) *ChannelData {
+	ev.load()
+	d := &ChannelData{
+		UUID:              ev.Get("Unique-Id"),
+		Name:              ev.Get("Channel-Name"),
+		Direction:         ev.Get("Call-Direction"),
+		State:             ev.Get("Channel-State"),
+		CallerIDName:      ev.Get("Caller-Caller-Id-Name"),
+		CallerIDNumber:    ev.Get("Caller-Caller-Id-Number"),
+		DestinationNumber: ev.Get("Caller-Destination-Number"),
+		Context:           ev.Get("Caller-Context"),
+		Dialplan:          ev.Get("Caller-Dialplan"),
+		Variables:         make(map[string]string),
+		Event:             ev,
+	}
+	for k := range ev.Header {
+		name := ev.name(k)
+		if len(name) > len(variablePrefix) &&
+			strings.EqualFold(name[:len(variablePrefix)], string(variablePrefix)) {
+			d.Variables[name[len(variablePrefix):]] = ev.Get(k)
+		}
+	}
+	if d.Variables["current_application"] == "socket" {
+		data := d.Variables["current_application_data"]
+		d.SocketApp, d.SocketArgs = parseSocketData(data)
+		for _, w := range strings.Fields(data) {
+			d.Async = d.Async || w == "async"
+			d.Full = d.Full || w == "full"
+		}
+	}
+	return d
+}
+
+// parseSocketData returns the application name and arguments in the data
+// of the socket application: host:port, then any words, where async and
+// full are options of FreeSWITCH.
+func parseSocketData(data string) (app string, args []string) {
+	f := strings.Fields(data)
+	if len(f) < 2 {
+		return "", nil
+	}
+	for _, w := range f[1:] {
+		if w != "async" && w != "full" {
+			args = append(args, w)
+		}
+	}
+	if len(args) == 0 {
+		return "", nil
+	}
+	return args[0], args[1:]
+}
+
+// Variable returns the value of a channel variable, or "" if not set.
+func (d *ChannelData) Variable(name string) string {
+	return d.Variables[name]
+}
+
+// Connect sends connect on an outbound connection and returns the data of
+// the channel, which is also kept for ChannelData.
+func (h *Connection) Connect() (*ChannelData, error) {
+	ev, err := h.Send("connect")
+	if err != nil {
+		return nil, err
+	}
+	if ev.Get("Unique-Id") == "" {
+		return nil, ErrMissingHeader
+	}
+	d := ParseChannelData(ev)
+	h.dmu.Lock()
+	h.data = d
+	h.dmu.Unlock()
+	return d, nil
+}
+
+// ChannelData returns the channel data received by Connect, or nil if it
+// wasn't called.
+func (h *Connection) ChannelData() *ChannelData {
+	h.dmu.Lock()
+	defer h.dmu.Unlock()
+	return h.data
+}
@@ -0,0 +1,272 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// channelEvents are the events ChannelRegistry keeps track of.
+var channelEvents = []string{
+	"CHANNEL_CREATE", "CHANNEL_STATE", "CHANNEL_CALLSTATE", "CHANNEL_ANSWER",
+	"CHANNEL_BRIDGE", "CHANNEL_UNBRIDGE", "CHANNEL_DESTROY",
+}
+
+// Channel is an active channel, tracked by ChannelRegistry.
+type Channel struct {
+	UUID              string
+	Direction         string // inbound or outbound
+	Name              string // e.g. sofia/internal/1000@host
+	State             string // e.g. CS_EXECUTE
+	CallState         string // e.g. ACTIVE, RINGING, HELD
+	CallerIDName      string
+	CallerIDNumber    string
+	CalleeIDName      string
+	CalleeIDNumber    string
+	DestinationNumber string
+	Context           string
+	BridgedTo         string    // UUID of the other leg, when bridged
+	Created           time.Time // When the channel was created
+	Answered          time.Time // When the channel was answered, if known
+}
+
+// Duration returns how long ago the channel was created.
+func (ch *Channel) Duration() time.Duration {
+	if ch.Created.IsZero() {
+		return 0
+	}
+	return time.Since(ch.Created)
+}
+
+// ChannelRegistry keeps track of the active channels, based on "show
+// channels" and on the channel events that follow, for monitoring.
+//
+// Example:
+//
+//	r := eventsocket.NewChannelRegistry(c)
+//	go r.Run(ctx)
+//	...
+//	for _, ch := range r.Snapshot() {
+//		fmt.Println(ch.CallerIDNumber, ch.DestinationNumber, ch.Duration())
+//	}
+type ChannelRegistry struct {
+	conn     *Connection
+	mu       sync.Mutex
+	channels map[string]*Channel // uuid:channel
+}
+
+// NewChannelRegistry creates a ChannelRegistry that issues commands on the
+// given connection.
+func NewChannelRegistry(c *Connection) *ChannelRegistry {
+	return &ChannelRegistry{
+		conn:     c,
+		channels: make(map[string]*Channel),
+	}
+}
+
+// Run subscribes to channel events, loads the current channels with Sync,
+// and keeps them up to date until the context is cancelled or the
+// connection terminates.
+func (r *ChannelRegistry) Run(ctx context.Context) error {
+	events := newEventQueue()
+	cancel := r.conn.observe(func(ev *Event) bool {
+		switch ev.peek("Event-Name") {
+		case "CHANNEL_CREATE", "CHANNEL_STATE", "CHANNEL_CALLSTATE",
+			"CHANNEL_ANSWER", "CHANNEL_BRIDGE", "CHANNEL_UNBRIDGE",
+			"CHANNEL_DESTROY":
+			events.push(ev.retain())
+		}
+		return false
+	})
+	defer cancel()
+	if err := r.conn.Subscriptions().Subscribe(channelEvents...); err != nil {
+		return err
+	}
+	// Events received meanwhile are queued, and applied after the sync.
+	if err := r.Sync(); err != nil {
+		return err
+	}
+	for {
+		for ev, ok := events.pop(); ok; ev, ok = events.pop() {
+			r.HandleEvent(ev)
+			ev.Release()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.conn.done:
+			return r.conn.err
+		case <-events.wake:
+		}
+	}
+}
+
+// Sync replaces the channels tracked with the ones listed by "show
+// channels".
+func (r *ChannelRegistry) Sync() error {
+	list, err := r.conn.ShowChannels()
+	if err != nil {
+		return err
+	}
+	channels := make(map[string]*Channel, len(list))
+	for _, info := range list {
+		channels[info.UUID] = &Channel{
+			UUID:              info.UUID,
+			Direction:         info.Direction,
+			Name:              info.Name,
+			State:             info.State,
+			CallState:         info.CallState,
+			CallerIDName:      info.CallerIDName,
+			CallerIDNumber:    info.CallerIDNumber,
+			CalleeIDName:      info.CalleeIDName,
+			CalleeIDNumber:    info.CalleeIDNumber,
+			DestinationNumber: info.DestinationNumber,
+			Context:           info.Context,
+			Created:           info.Created,
+		}
+	}
+	// Bridged legs share the call_uuid of the a-leg.
+	for _, info := range list {
+		if info.CallUUID == "" || info.CallUUID == info.UUID {
+			continue
+		}
+		if peer, ok := channels[info.CallUUID]; ok {
+			channels[info.UUID].BridgedTo = peer.UUID
+			peer.BridgedTo = info.UUID
+		}
+	}
+	r.mu.Lock()
+	r.channels = channels
+	r.mu.Unlock()
+	return nil
+}
+
+// HandleEvent updates the channels from CHANNEL_CREATE, CHANNEL_STATE,
+// CHANNEL_CALLSTATE, CHANNEL_ANSWER, CHANNEL_BRIDGE, CHANNEL_UNBRIDGE and
+// CHANNEL_DESTROY events. Other events are ignored. It's called by Run,
+// and only needs to be called directly by those not using Run.
+func (r *ChannelRegistry) HandleEvent(ev *Event) {
+	name := ev.Get("Event-Name")
+	switch name {
+	case "CHANNEL_CREATE", "CHANNEL_STATE", "CHANNEL_CALLSTATE",
+		"CHANNEL_ANSWER", "CHANNEL_BRIDGE", "CHANNEL_UNBRIDGE",
+		"CHANNEL_DESTROY":
+	default:
+		return
+	}
+	uuid := ev.Get("Unique-Id")
+	if uuid == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name == "CHANNEL_DESTROY" {
+		if ch, ok := r.channels[uuid]; ok {
+			r.unbridge(ch)
+			delete(r.channels, uuid)
+		}
+		return
+	}
+	ch, ok := r.channels[uuid]
+	if !ok {
+		// Created before the sync, or the sync didn't run.
+		ch = &Channel{UUID: uuid}
+		r.channels[uuid] = ch
+	}
+	updateChannel(ch, ev)
+	switch name {
+	case "CHANNEL_BRIDGE":
+		a, b := ev.Get("Bridge-A-Unique-Id"), ev.Get("Bridge-B-Unique-Id")
+		if peer, ok := r.channels[b]; ok && a == uuid {
+			ch.BridgedTo, peer.BridgedTo = b, a
+		} else if peer, ok := r.channels[a]; ok && b == uuid {
+			ch.BridgedTo, peer.BridgedTo = a, b
+		} else if other := ev.Get("Other-Leg-Unique-Id"); other != "" {
+			ch.BridgedTo = other
+		}
+	case "CHANNEL_UNBRIDGE":
+		r.unbridge(ch)
+	}
+}
+
+// unbridge clears the bridge of a channel and its peer, with mu held.
+func (r *ChannelRegistry) unbridge(ch *Channel) {
+	if peer, ok := r.channels[ch.BridgedTo]; ok && peer.BridgedTo == ch.UUID {
+		peer.BridgedTo = ""
+	}
+	ch.BridgedTo = ""
+}
+
+// updateChannel updates a channel with the headers present in the event.
+func updateChannel(ch *Channel, ev *Event) {
+	set := func(field *string, key string) {
+		if v := ev.Get(key); v != "" {
+			*field = v
+		}
+	}
+	set(&ch.Direction, "Call-Direction")
+	set(&ch.Name, "Channel-Name")
+	set(&ch.State, "Channel-State")
+	set(&ch.CallState, "Channel-Call-State")
+	set(&ch.CallerIDName, "Caller-Caller-Id-Name")
+	set(&ch.CallerIDNumber, "Caller-Caller-Id-Number")
+	set(&ch.CalleeIDName, "Caller-Callee-Id-Name")
+	set(&ch.CalleeIDNumber, "Caller-Callee-Id-Number")
+	set(&ch.DestinationNumber, "Caller-Destination-Number")
+	set(&ch.Context, "Caller-Context")
+	times := ev.ChannelTimes()
+	if !times.Created.IsZero() {
+		ch.Created = times.Created
+	}
+	if !times.Answered.IsZero() {
+		ch.Answered = times.Answered
+	}
+}
+
+// Get returns the channel with the given UUID, if active.
+func (r *ChannelRegistry) Get(uuid string) (Channel, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch, ok := r.channels[uuid]
+	if !ok {
+		return Channel{}, false
+	}
+	return *ch, true
+}
+
+// Len returns the number of active channels.
+func (r *ChannelRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.channels)
+}
+
+// Snapshot returns all active channels, oldest first.
+func (r *ChannelRegistry) Snapshot() []Channel {
+	return r.Find(nil)
+}
+
+// Find returns the active channels for which match returns true, oldest
+// first, e.g. the channels of a caller. A nil match returns all channels.
+func (r *ChannelRegistry) Find(match func(Channel) bool) []Channel {
+	r.mu.Lock()
+	var list []Channel
+	for _, ch := range r.channels {
+		if match == nil || match(*ch) {
+			list = append(list, *ch)
+		}
+	}
+	r.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Created.Equal(list[j].Created) {
+			return list[i].Created.Before(list[j].Created)
+		}
+		return list[i].UUID < list[j].UUID
+	})
+	return list
+}
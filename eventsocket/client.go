@@ -0,0 +1,347 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	clientMinBackoff = time.Second
+	clientMaxBackoff = 30 * time.Second
+	clientMaxPending = 100
+)
+
+// ErrDisconnected is returned by Client for commands that can't be sent
+// while it's disconnected, either by their ReplayPolicy or because too
+// many commands are queued already.
+var ErrDisconnected = errors.New("Disconnected")
+
+// ReplayPolicy tells a Client what to do with commands sent while it's
+// disconnected.
+type ReplayPolicy int
+
+// Replay policies of commands.
+const (
+	// FailFast fails the command with ErrDisconnected, for commands that
+	// make no sense later, like originating a call the caller has given
+	// up on.
+	FailFast ReplayPolicy = iota
+
+	// ReplayOnReconnect queues the command, and sends it once the
+	// connection is established again, for commands that are safe to
+	// send late, like subscriptions.
+	ReplayOnReconnect
+)
+
+// DefaultReplayPolicy replays commands that set up the session, like event
+// subscriptions and filters, and fails fast all others.
+func DefaultReplayPolicy(command string) ReplayPolicy {
+	name := command
+	if n := strings.IndexAny(name, " \r\n"); n >= 0 {
+		name = name[:n]
+	}
+	switch name {
+	case "event", "events", "myevents", "nixevent", "noevents", "filter",
+		"divert_events", "linger", "nolinger":
+		return ReplayOnReconnect
+	}
+	return FailFast
+}
+
+// Client is a connection to FreeSWITCH that's established again whenever
+// it's lost, for as long as Run runs. Events of all connections are
+// returned by ReadEvent, and commands sent while disconnected are either
+// queued or failed, according to their ReplayPolicy.
+//
+// Commands are never sent twice: those waiting for a reply when the
+// connection is lost fail with its error, as FreeSWITCH may have run them.
+//
+// Example:
+//
+//	c := eventsocket.NewClient("localhost:8021", "ClueCon")
+//	c.Setup = func(conn *eventsocket.Connection) error {
+//		_, err := conn.Send("events plain ALL")
+//		return err
+//	}
+//	go c.Run(ctx)
+//	for {
+//		ev, err := c.ReadEvent()
+//		...
+//	}
+type Client struct {
+	// MinBackoff and MaxBackoff bound the wait between attempts to
+	// connect, which doubles after every failure. They default to 1s and
+	// 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// MaxPending is how many commands can be queued while disconnected.
+	// Defaults to 100. Commands beyond it fail with ErrDisconnected.
+	MaxPending int
+
+	// ReplayPolicy tells what to do with each command sent while
+	// disconnected. Defaults to DefaultReplayPolicy.
+	ReplayPolicy func(command string) ReplayPolicy
+
+	// Setup, when set, is called for every new connection before queued
+	// commands are sent and events are read, e.g. to subscribe to events.
+	// If it fails, the connection is closed and established again.
+	Setup func(*Connection) error
+
+	// Metrics, when set, is set on every new connection, and told about
+	// reconnections.
+	Metrics Metrics
+
+	// OnConnect and OnDisconnect, when set, are called from Run when a
+	// connection is ready, and when it's lost, with its error.
+	OnConnect    func(*Connection)
+	OnDisconnect func(error)
+
+	addr      string
+	passwd    string
+	mu        sync.Mutex
+	conn      *Connection       // Current connection, if ready
+	replaying bool              // Whether queued commands are being sent
+	pending   []*pendingCommand // Queued while disconnected
+	evt       *eventQueue
+	done      chan struct{} // Closed when the client is closed
+	err       error         // Why it was closed, set before done is closed
+	closeOnce sync.Once
+}
+
+// pendingCommand is a command queued while disconnected.
+type pendingCommand struct {
+	command string
+	ch      chan *reply
+}
+
+// NewClient creates a Client for the FreeSWITCH at the given address. It
+// only connects once Run is called.
+func NewClient(addr, passwd string) *Client {
+	return &Client{
+		addr:   addr,
+		passwd: passwd,
+		evt:    newEventQueue(),
+		done:   make(chan struct{}),
+	}
+}
+
+// Run connects to FreeSWITCH, and connects again whenever the connection
+// is lost, until the context is cancelled or the client is closed. The
+// client is closed when Run returns.
+func (c *Client) Run(ctx context.Context) error {
+	backoff := c.minBackoff()
+	connected := false
+	for {
+		conn, err := Dial(c.addr, c.passwd)
+		if err == nil {
+			err = c.setup(conn)
+		}
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				c.terminate(ctx.Err())
+				return ctx.Err()
+			case <-c.done:
+				return c.err
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > c.maxBackoff() {
+				backoff = c.maxBackoff()
+			}
+			continue
+		}
+		backoff = c.minBackoff()
+		if connected && c.Metrics != nil {
+			c.Metrics.Reconnected()
+		}
+		connected = true
+		if c.OnConnect != nil {
+			c.OnConnect(conn)
+		}
+		err = c.serve(ctx, conn)
+		if c.OnDisconnect != nil {
+			c.OnDisconnect(err)
+		}
+		select {
+		case <-ctx.Done():
+			c.terminate(ctx.Err())
+			return ctx.Err()
+		case <-c.done:
+			return c.err
+		default:
+		}
+	}
+}
+
+// setup prepares a new connection and sends the commands queued while
+// disconnected, before making it the current connection.
+func (c *Client) setup(conn *Connection) error {
+	if c.Metrics != nil {
+		conn.SetMetrics(c.Metrics)
+	}
+	if c.Setup != nil {
+		if err := c.Setup(conn); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	c.mu.Lock()
+	c.replaying = true
+	for len(c.pending) > 0 {
+		// Commands sent meanwhile are queued as well, to keep the order.
+		batch := c.pending
+		c.pending = nil
+		c.mu.Unlock()
+		for _, p := range batch {
+			ev, err := conn.Send(p.command)
+			p.ch <- &reply{ev: ev, err: err}
+		}
+		c.mu.Lock()
+	}
+	c.replaying = false
+	c.conn = conn
+	c.mu.Unlock()
+	return nil
+}
+
+// serve moves the events of a connection to the client until the
+// connection terminates, closing it when the context is cancelled or the
+// client is closed. It returns the error that terminated the connection.
+func (c *Client) serve(ctx context.Context, conn *Connection) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.done:
+		case <-stop:
+			return
+		}
+		conn.Close()
+	}()
+	for {
+		ev, err := conn.ReadEvent()
+		if err != nil {
+			c.mu.Lock()
+			c.conn = nil
+			c.mu.Unlock()
+			return err
+		}
+		c.evt.push(ev)
+	}
+}
+
+// Send sends a command on the current connection, like Connection.Send.
+// While disconnected, the command is either queued until the connection
+// is established again, or fails with ErrDisconnected, according to the
+// ReplayPolicy.
+func (c *Client) Send(command string) (*Event, error) {
+	c.mu.Lock()
+	conn := c.conn
+	if conn != nil && conn.State() != StateClosed {
+		c.mu.Unlock()
+		return conn.Send(command)
+	}
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return nil, c.err
+	default:
+	}
+	replay := c.replaying || c.replayPolicy(command) == ReplayOnReconnect
+	if !replay || len(c.pending) >= c.maxPending() {
+		c.mu.Unlock()
+		return nil, ErrDisconnected
+	}
+	p := &pendingCommand{command: command, ch: make(chan *reply, 1)}
+	c.pending = append(c.pending, p)
+	c.mu.Unlock()
+	select {
+	case r := <-p.ch:
+		return r.ev, r.err
+	case <-c.done:
+		return nil, c.err
+	}
+}
+
+// ReadEvent returns the events received by all connections, in order.
+// Events received before the client was closed are still returned, after
+// that ReadEvent returns the reason it was closed.
+func (c *Client) ReadEvent() (*Event, error) {
+	for {
+		if ev, ok := c.evt.pop(); ok {
+			return ev, nil
+		}
+		select {
+		case <-c.evt.wake:
+		case <-c.done:
+			if ev, ok := c.evt.pop(); ok {
+				return ev, nil
+			}
+			return nil, c.err
+		}
+	}
+}
+
+// Conn returns the current connection, or nil while disconnected.
+func (c *Client) Conn() *Connection {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+// Close closes the client and its current connection, which makes Run
+// return. Commands still queued fail.
+func (c *Client) Close() {
+	c.terminate(errClosed)
+}
+
+// terminate records why the client is closed and wakes up everyone
+// waiting on it. Only the first call has any effect.
+func (c *Client) terminate(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		close(c.done)
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.mu.Unlock()
+	})
+}
+
+func (c *Client) minBackoff() time.Duration {
+	if c.MinBackoff > 0 {
+		return c.MinBackoff
+	}
+	return clientMinBackoff
+}
+
+func (c *Client) maxBackoff() time.Duration {
+	if c.MaxBackoff > 0 {
+		return c.MaxBackoff
+	}
+	return clientMaxBackoff
+}
+
+func (c *Client) maxPending() int {
+	if c.MaxPending > 0 {
+		return c.MaxPending
+	}
+	return clientMaxPending
+}
+
+func (c *Client) replayPolicy(command string) ReplayPolicy {
+	if c.ReplayPolicy != nil {
+		return c.ReplayPolicy(command)
+	}
+	return DefaultReplayPolicy(command)
+}
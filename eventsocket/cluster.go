@@ -0,0 +1,373 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const clusterResolveInterval = time.Minute
+
+var errUnknownNode = errors.New("Unknown node")
+
+// NodeStatus is the status of a node of a Cluster.
+type NodeStatus struct {
+	Addr      string     // Address of the node
+	Connected bool       // Whether the node is connected
+	Active    bool       // Whether commands are routed to the node
+	Since     time.Time  // When the node connected or disconnected
+	Err       error      // Why the node disconnected, if it did
+	Heartbeat *Heartbeat // Last heartbeat, when subscribed to HEARTBEAT
+}
+
+// Cluster keeps connections to several FreeSWITCH nodes, and sends
+// commands to one of them, the active node, failing over to the next
+// connected node when it goes down. Events of all nodes are returned by
+// ReadEvent; their FreeSWITCH-Hostname header tells them apart.
+//
+// Connections are established again whenever they're lost, see Client.
+//
+// Example:
+//
+//	c := eventsocket.NewCluster("ClueCon", "fs1:8021", "fs2:8021", "fs3:8021")
+//	c.Setup = func(conn *eventsocket.Connection) error {
+//		_, err := conn.Send("events plain CHANNEL_HANGUP_COMPLETE")
+//		return err
+//	}
+//	go c.Run(ctx)
+//	...
+//	ev, err := c.Send("api originate sofia/gateway/gw/1000 &park")
+type Cluster struct {
+	// Setup, when set, is called for every new connection to any node,
+	// e.g. to subscribe to events. See Client.
+	Setup func(*Connection) error
+
+	// Metrics, when set, is set on the connections to all nodes.
+	Metrics Metrics
+
+	// Resolver, when set, resolves the addresses of the nodes when Run
+	// starts, and again every ResolveInterval, which defaults to a
+	// minute. Nodes are added and removed as they come and go, and kept
+	// as they are when resolving fails.
+	Resolver        Resolver
+	ResolveInterval time.Duration
+
+	passwd string
+	mu     sync.Mutex
+	nodes  []*clusterNode
+	active string // Address of the active node
+	ctx    context.Context
+	wg     sync.WaitGroup // Goroutines of the nodes
+	evt    *eventQueue
+	done   chan struct{} // Closed when Run returns
+	err    error         // Why Run returned, set before done is closed
+}
+
+// clusterNode is a node of a Cluster.
+type clusterNode struct {
+	client *Client
+	cancel context.CancelFunc // Stops the client
+	mu     sync.Mutex
+	status NodeStatus
+}
+
+// NewCluster creates a Cluster of the FreeSWITCH nodes at the given
+// addresses, all with the same password. The first node is active at
+// first. It only connects once Run is called.
+//
+// Nodes can be resolved dynamically instead, with a Resolver:
+//
+//	c := eventsocket.NewCluster("ClueCon")
+//	c.Resolver = &eventsocket.SRVResolver{Service: "esl", Proto: "tcp", Name: "example.com"}
+func NewCluster(passwd string, addrs ...string) *Cluster {
+	c := &Cluster{
+		passwd: passwd,
+		evt:    newEventQueue(),
+		done:   make(chan struct{}),
+	}
+	for _, addr := range addrs {
+		c.nodes = append(c.nodes, c.newNode(addr))
+	}
+	if len(addrs) > 0 {
+		c.active = addrs[0]
+	}
+	return c
+}
+
+// newNode creates a node, which isn't connected until started.
+func (c *Cluster) newNode(addr string) *clusterNode {
+	n := &clusterNode{
+		client: NewClient(addr, c.passwd),
+		status: NodeStatus{Addr: addr},
+	}
+	n.client.OnConnect = func(conn *Connection) {
+		n.setConnected(true, nil)
+		conn.observe(func(ev *Event) bool {
+			if ev.peek("Event-Name") != "HEARTBEAT" {
+				return false
+			}
+			hb, _ := ParseHeartbeat(ev)
+			n.mu.Lock()
+			n.status.Heartbeat = hb
+			n.mu.Unlock()
+			return false
+		})
+	}
+	n.client.OnDisconnect = func(err error) { n.setConnected(false, err) }
+	return n
+}
+
+// Run connects to all nodes, and keeps them connected until the context is
+// cancelled. The cluster is closed when Run returns.
+func (c *Cluster) Run(ctx context.Context) error {
+	c.mu.Lock()
+	c.ctx = ctx
+	for _, n := range c.nodes {
+		c.start(n)
+	}
+	c.mu.Unlock()
+	if c.Resolver != nil {
+		interval := c.ResolveInterval
+		if interval <= 0 {
+			interval = clusterResolveInterval
+		}
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+	resolve:
+		for {
+			c.resolve(ctx)
+			select {
+			case <-ctx.Done():
+				break resolve
+			case <-tick.C:
+			}
+		}
+	}
+	<-ctx.Done()
+	c.wg.Wait()
+	c.err = ctx.Err()
+	close(c.done)
+	return c.err
+}
+
+// start runs the client of a node and moves its events to the cluster,
+// with mu held.
+func (c *Cluster) start(n *clusterNode) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	n.cancel = cancel
+	n.client.Setup = c.Setup
+	n.client.Metrics = c.Metrics
+	c.wg.Add(2)
+	go func() {
+		defer c.wg.Done()
+		n.client.Run(ctx)
+	}()
+	go func() {
+		defer c.wg.Done()
+		for {
+			ev, err := n.client.ReadEvent()
+			if err != nil {
+				return
+			}
+			c.evt.push(ev)
+		}
+	}()
+}
+
+// resolve updates the nodes with the addresses returned by the Resolver,
+// starting the new ones and stopping those that are gone.
+func (c *Cluster) resolve(ctx context.Context) {
+	addrs, err := c.Resolver.Resolve(ctx)
+	if err != nil || len(addrs) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := make(map[string]*clusterNode, len(c.nodes))
+	for _, n := range c.nodes {
+		old[n.status.Addr] = n
+	}
+	nodes := make([]*clusterNode, 0, len(addrs))
+	for _, addr := range addrs {
+		n, ok := old[addr]
+		if ok {
+			delete(old, addr)
+		} else {
+			n = c.newNode(addr)
+			c.start(n)
+		}
+		nodes = append(nodes, n)
+	}
+	for _, n := range old {
+		n.cancel()
+	}
+	c.nodes = nodes
+	if _, gone := old[c.active]; gone || c.active == "" {
+		c.active = addrs[0]
+	}
+}
+
+// Send sends a command to the active node, like Connection.Send. If the
+// active node is disconnected, the next connected node becomes active.
+// It returns ErrDisconnected if no node is connected.
+//
+// Commands are never sent twice: those waiting for a reply when the
+// connection to a node is lost fail with its error.
+func (c *Cluster) Send(command string) (*Event, error) {
+	conn := c.pick()
+	if conn == nil {
+		return nil, ErrDisconnected
+	}
+	return conn.Send(command)
+}
+
+// pick returns the connection to the active node, failing over to the next
+// connected one, or nil if none is connected.
+func (c *Cluster) pick() *Connection {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	start := 0
+	for i, n := range c.nodes {
+		if n.status.Addr == c.active {
+			start = i
+			break
+		}
+	}
+	for i := range c.nodes {
+		n := c.nodes[(start+i)%len(c.nodes)]
+		conn := n.client.Conn()
+		if conn == nil || conn.State() == StateClosed {
+			continue
+		}
+		if n.status.Addr != c.active {
+			conn.log().Infof("eventsocket: failing over from %s to %s",
+				c.active, n.status.Addr)
+			c.active = n.status.Addr
+		}
+		return conn
+	}
+	return nil
+}
+
+// connected returns the connections to the nodes that are connected, and
+// their status.
+func (c *Cluster) connected() ([]*Connection, []NodeStatus) {
+	var (
+		conns  []*Connection
+		status []NodeStatus
+	)
+	for _, n := range c.list() {
+		conn := n.client.Conn()
+		if conn == nil || conn.State() == StateClosed {
+			continue
+		}
+		conns = append(conns, conn)
+		status = append(status, c.snapshot(n))
+	}
+	return conns, status
+}
+
+// ReadEvent returns the events received by all nodes. After Run returns,
+// events still queued are returned, followed by the error of Run.
+func (c *Cluster) ReadEvent() (*Event, error) {
+	for {
+		if ev, ok := c.evt.pop(); ok {
+			return ev, nil
+		}
+		select {
+		case <-c.evt.wake:
+		case <-c.done:
+			if ev, ok := c.evt.pop(); ok {
+				return ev, nil
+			}
+			return nil, c.err
+		}
+	}
+}
+
+// Node returns the Client of the node at the given address, or nil, e.g.
+// to send commands to a specific node.
+func (c *Cluster) Node(addr string) *Client {
+	for _, n := range c.list() {
+		if n.status.Addr == addr {
+			return n.client
+		}
+	}
+	return nil
+}
+
+// Scheduler creates a Scheduler that runs commands on the nodes of the
+// cluster, by address, at most perSecond commands per second on each node,
+// or unlimited when 0. Commands for node "" are sent to the active node,
+// like Send. Commands for unknown nodes fail. The scheduler is closed when
+// Run returns.
+//
+// Example:
+//
+//	s := c.Scheduler(10)
+//	for _, st := range c.Status() {
+//		s.Submit(st.Addr, eventsocket.PriorityBackground, "api show calls count")
+//	}
+//	cmd := s.Submit("fs2:8021", eventsocket.PriorityEmergency, "api hupall MANAGER_REQUEST")
+//	ev, err := cmd.Wait()
+func (c *Cluster) Scheduler(perSecond float64) *Scheduler {
+	s := NewScheduler(perSecond, func(node, command string) (*Event, error) {
+		if node == "" {
+			return c.Send(command)
+		}
+		client := c.Node(node)
+		if client == nil {
+			return nil, errUnknownNode
+		}
+		return client.Send(command)
+	})
+	go func() {
+		<-c.done
+		s.Close()
+	}()
+	return s
+}
+
+// Status returns the status of all nodes, in the order given to
+// NewCluster or returned by the Resolver.
+func (c *Cluster) Status() []NodeStatus {
+	nodes := c.list()
+	list := make([]NodeStatus, len(nodes))
+	for i, n := range nodes {
+		list[i] = c.snapshot(n)
+	}
+	return list
+}
+
+// list returns the current nodes.
+func (c *Cluster) list() []*clusterNode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*clusterNode(nil), c.nodes...)
+}
+
+// snapshot returns the status of a node.
+func (c *Cluster) snapshot(n *clusterNode) NodeStatus {
+	c.mu.Lock()
+	active := c.active
+	c.mu.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	st := n.status
+	st.Active = st.Addr == active
+	return st
+}
+
+// setConnected records a node connecting or disconnecting.
+func (n *clusterNode) setConnected(connected bool, err error) {
+	n.mu.Lock()
+	n.status.Connected = connected
+	n.status.Since = time.Now()
+	n.status.Err = err
+	n.mu.Unlock()
+}
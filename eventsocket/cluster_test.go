@@ -0,0 +1,54 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+	"github.com/fiorix/go-eventsocket/eventsocket/eventsockettest"
+)
+
+func TestClusterScheduler(t *testing.T) {
+	s1, s2 := eventsockettest.NewServer(), eventsockettest.NewServer()
+	defer s1.Close()
+	defer s2.Close()
+	s1.HandleAPI("hostname", func(string) string { return "fs1" })
+	s2.HandleAPI("hostname", func(string) string { return "fs2" })
+	c := eventsocket.NewCluster(s1.Password, s1.Addr, s2.Addr)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		st := c.Status()
+		if st[0].Connected && st[1].Connected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nodes didn't connect: %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s := c.Scheduler(0)
+	for node, want := range map[string]string{"": "fs1", s1.Addr: "fs1", s2.Addr: "fs2"} {
+		ev, err := s.Submit(node, eventsocket.PriorityEmergency, "api hostname").Wait()
+		if err != nil {
+			t.Fatalf("node %q: %v", node, err)
+		}
+		if ev.Body != want {
+			t.Fatalf("node %q: got %q, want %q", node, ev.Body, want)
+		}
+	}
+	if _, err := s.Submit("fs3:8021", eventsocket.PriorityNormal, "api hostname").Wait(); err == nil {
+		t.Fatal("command for an unknown node succeeded")
+	}
+	cancel()
+	<-done
+	if _, err := s.Submit(s1.Addr, eventsocket.PriorityNormal, "api hostname").Wait(); err == nil {
+		t.Fatal("command succeeded after Run returned")
+	}
+}
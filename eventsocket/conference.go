@@ -0,0 +1,127 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "strconv"
+
+// ConferenceEvent is an event of mod_conference parsed by
+// ParseConferenceEvent: *MemberJoin, *MemberLeave, *StartTalking,
+// *StopTalking or *FloorChange.
+type ConferenceEvent interface {
+	conferenceEvent()
+}
+
+// ConferenceMember is a member of a conference, as described by the
+// events of mod_conference.
+type ConferenceMember struct {
+	Conference     string // Conference-Name
+	ConferenceUUID string // Conference-Unique-ID
+	MemberID       int    // Member-ID, unique within the conference
+	MemberType     string // member or moderator
+	UUID           string // Channel of the member
+	CallerIDName   string
+	CallerIDNumber string
+
+	Hear       bool // Can hear the conference
+	Speak      bool // Can be heard by the conference
+	Talking    bool // Is talking right now
+	MuteDetect bool // Talks while muted
+	Floor      bool // Has the floor
+	Video      bool // Has video
+}
+
+// MemberJoin is sent when a member joins a conference.
+type MemberJoin struct{ ConferenceMember }
+
+// MemberLeave is sent when a member leaves a conference.
+type MemberLeave struct{ ConferenceMember }
+
+// StartTalking is sent when a member starts talking.
+type StartTalking struct{ ConferenceMember }
+
+// StopTalking is sent when a member stops talking.
+type StopTalking struct{ ConferenceMember }
+
+// FloorChange is sent when the floor moves to another member. Member IDs
+// are 0 when nobody had or has the floor.
+type FloorChange struct {
+	Conference     string
+	ConferenceUUID string
+	OldMemberID    int
+	NewMemberID    int
+}
+
+func (*MemberJoin) conferenceEvent()   {}
+func (*MemberLeave) conferenceEvent()  {}
+func (*StartTalking) conferenceEvent() {}
+func (*StopTalking) conferenceEvent()  {}
+func (*FloorChange) conferenceEvent()  {}
+
+// ParseConferenceEvent parses conference::maintenance CUSTOM events, based
+// on their Action header. It returns false for other events and actions.
+//
+// The connection must be subscribed to the events with
+// "events plain CUSTOM conference::maintenance".
+//
+// Example:
+//
+//	switch e := ev.(type) {
+//	case *eventsocket.MemberJoin:
+//		fmt.Println(e.CallerIDNumber, "joined", e.Conference)
+//	case *eventsocket.StartTalking:
+//		fmt.Println("member", e.MemberID, "is talking")
+//	}
+func ParseConferenceEvent(ev *Event) (ConferenceEvent, bool) {
+	if ev.Get("Event-Subclass") != "conference::maintenance" {
+		return nil, false
+	}
+	switch ev.Get("Action") {
+	case "add-member":
+		return &MemberJoin{parseConferenceMember(ev)}, true
+	case "del-member":
+		return &MemberLeave{parseConferenceMember(ev)}, true
+	case "start-talking":
+		return &StartTalking{parseConferenceMember(ev)}, true
+	case "stop-talking":
+		return &StopTalking{parseConferenceMember(ev)}, true
+	case "floor-change":
+		return &FloorChange{
+			Conference:     ev.Get("Conference-Name"),
+			ConferenceUUID: ev.Get("Conference-Unique-Id"),
+			OldMemberID:    atoi(ev.Get("Old-Id")),
+			NewMemberID:    atoi(ev.Get("New-Id")),
+		}, true
+	}
+	return nil, false
+}
+
+// parseConferenceMember parses the member headers of conference events.
+func parseConferenceMember(ev *Event) ConferenceMember {
+	flag := func(key string) bool {
+		v, _ := ev.GetBool(key)
+		return v
+	}
+	return ConferenceMember{
+		Conference:     ev.Get("Conference-Name"),
+		ConferenceUUID: ev.Get("Conference-Unique-Id"),
+		MemberID:       atoi(ev.Get("Member-Id")),
+		MemberType:     ev.Get("Member-Type"),
+		UUID:           ev.Get("Unique-Id"),
+		CallerIDName:   ev.Get("Caller-Caller-Id-Name"),
+		CallerIDNumber: ev.Get("Caller-Caller-Id-Number"),
+		Hear:           flag("Hear"),
+		Speak:          flag("Speak"),
+		Talking:        flag("Talking"),
+		MuteDetect:     flag("Mute-Detect"),
+		Floor:          flag("Floor"),
+		Video:          flag("Video"),
+	}
+}
+
+// atoi converts s to an int, or 0 if it's not a number, like "none".
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,80 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Context returns a context that's cancelled when the channel of an
+// outbound connection hangs up, when FreeSWITCH sends a disconnect notice,
+// or when the connection terminates. It lets the goroutines working on a
+// call, like database lookups or TTS fetches, stop as soon as the caller
+// hangs up.
+//
+// Hangups are only detected for the channel returned by Connect, and
+// require CHANNEL_HANGUP events, e.g. with myevents.
+//
+// Connections accepted by a Server have contexts derived from its
+// BaseContext, with their ConnInfo and the values of ConnContext, and
+// they're also cancelled by Shutdown.
+//
+// Example:
+//
+//	func handler(c *eventsocket.Connection, d *eventsocket.ChannelData) {
+//		ctx := c.Context()
+//		req, _ := http.NewRequestWithContext(ctx, "GET", ttsURL, nil)
+//		resp, err := http.DefaultClient.Do(req) // fails on hangup
+//		...
+//	}
+func (h *Connection) Context() context.Context {
+	return h.ctx
+}
+
+// ConnInfo is the metadata of a connection accepted by a Server, in its
+// Context.
+type ConnInfo struct {
+	Server     *Server
+	Conn       *Connection
+	RemoteAddr net.Addr
+	LocalAddr  net.Addr
+	Accepted   time.Time
+}
+
+// ChannelData returns the channel data of the connection, once Connect
+// was called, or nil.
+func (i *ConnInfo) ChannelData() *ChannelData {
+	return i.Conn.ChannelData()
+}
+
+type connInfoKey struct{}
+
+// ConnInfoFromContext returns the ConnInfo in the context of a connection
+// accepted by a Server, or nil, e.g. for logging in code that only gets
+// the context.
+func ConnInfoFromContext(ctx context.Context) *ConnInfo {
+	i, _ := ctx.Value(connInfoKey{}).(*ConnInfo)
+	return i
+}
+
+// checkHangup cancels the context of the connection if ev means the
+// channel is gone, and notes when the connection starts lingering.
+func (h *Connection) checkHangup(ev *Event) {
+	if ev.peek("Content-Type") == "text/disconnect-notice" {
+		if ev.peek("Content-Disposition") == "linger" {
+			h.setState(StateLingering)
+		}
+		h.cancel()
+		return
+	}
+	if ev.peek("Event-Name") != "CHANNEL_HANGUP" {
+		return
+	}
+	if d := h.ChannelData(); d != nil && d.UUID == ev.peek("Unique-Id") {
+		h.cancel()
+	}
+}
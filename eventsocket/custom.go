@@ -0,0 +1,121 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"strings"
+	"sync"
+)
+
+// SubscribeCustom subscribes to the CUSTOM events of a subclass, like
+// sofia::register, with "event plain CUSTOM sofia::register" unless
+// already subscribed to, and hands them to fn, in order, instead of
+// ReadEvent, until cancel is called or the connection terminates.
+// Subscribing again to the same subclass replaces its function.
+//
+// fn runs in its own goroutine, one per subclass, and the events are
+// handed over as if returned by ReadEvent. Cancel doesn't unsubscribe,
+// see Subscriptions.Unsubscribe; events of the subclass go to ReadEvent
+// from then on.
+//
+// Example:
+//
+//	cancel, err := c.SubscribeCustom("sofia::register", func(ev *eventsocket.Event) {
+//		v, _ := eventsocket.DecodeCustom(ev)
+//		r := v.(*eventsocket.Registration)
+//		log.Println(r.AOR(), "registered from", r.Contact)
+//	})
+func (h *Connection) SubscribeCustom(subclass string, fn func(*Event)) (cancel func(), err error) {
+	if !validArg(subclass) || !strings.Contains(subclass, "::") {
+		return nil, errInvalidArgument
+	}
+	// Routed before subscribing, so no event is missed.
+	r := h.newRoute(nil, fn)
+	h.updateCustom(func(m customRoutes) {
+		if prev := m[subclass]; prev != nil {
+			close(prev.stop)
+		}
+		m[subclass] = r
+	})
+	cancel = func() {
+		h.updateCustom(func(m customRoutes) {
+			if m[subclass] == r {
+				delete(m, subclass)
+				close(r.stop)
+			}
+		})
+	}
+	if err := h.Subscriptions().Subscribe(subclass); err != nil {
+		cancel()
+		return nil, err
+	}
+	return cancel, nil
+}
+
+// customRoutes are the routes of CUSTOM events, by subclass.
+type customRoutes map[string]*eventRoute
+
+// updateCustom calls fn to change the routes of subclasses. The map is
+// copied so the read loop can use it without locking.
+func (h *Connection) updateCustom(fn func(customRoutes)) {
+	h.cmu.Lock()
+	defer h.cmu.Unlock()
+	m := make(customRoutes)
+	if old := h.custom.Load(); old != nil {
+		for k, v := range *old {
+			m[k] = v
+		}
+	}
+	fn(m)
+	h.custom.Store(&m)
+}
+
+// SubclassDecoder decodes the CUSTOM events of a subclass into a typed
+// value, see RegisterSubclassDecoder.
+type SubclassDecoder func(*Event) (interface{}, error)
+
+var subclassDecoders = struct {
+	sync.RWMutex
+	m map[string]SubclassDecoder
+}{m: map[string]SubclassDecoder{
+	"sofia::register": func(ev *Event) (interface{}, error) {
+		return parseRegistration(ev), nil
+	},
+}}
+
+// RegisterSubclassDecoder registers the decoder of the CUSTOM events of a
+// subclass, used by DecodeCustom and DecodeEvent, replacing the previous
+// one if any. A nil decoder removes it. Modules of FreeSWITCH, and the
+// applications firing their own events, can plug in their types this way.
+//
+// The decoder of sofia::register, which returns a *Registration, is
+// registered by default.
+//
+// Example:
+//
+//	eventsocket.RegisterSubclassDecoder("callcenter::info", func(ev *eventsocket.Event) (interface{}, error) {
+//		return &QueueEvent{Queue: ev.Get("Cc-Queue"), Action: ev.Get("Cc-Action")}, nil
+//	})
+func RegisterSubclassDecoder(subclass string, dec SubclassDecoder) {
+	subclassDecoders.Lock()
+	defer subclassDecoders.Unlock()
+	if dec == nil {
+		delete(subclassDecoders.m, subclass)
+		return
+	}
+	subclassDecoders.m[subclass] = dec
+}
+
+// DecodeCustom decodes a CUSTOM event with the decoder registered for its
+// Event-Subclass. Events without one are returned as they are, as *Event.
+func DecodeCustom(ev *Event) (interface{}, error) {
+	subclassDecoders.RLock()
+	dec := subclassDecoders.m[ev.Get("Event-Subclass")]
+	subclassDecoders.RUnlock()
+	if dec == nil {
+		return ev, nil
+	}
+	return dec(ev)
+}
@@ -0,0 +1,171 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"strings"
+	"time"
+)
+
+// ChannelEvent has the headers common to the events of a channel, see
+// DecodeEvent.
+type ChannelEvent struct {
+	Time              time.Time // When the event was fired
+	UUID              string    // Unique-ID
+	CallUUID          string    // Channel-Call-UUID, the same for all legs
+	Name              string    // Channel-Name, e.g. sofia/internal/1000@host
+	Direction         string    // Call-Direction, inbound or outbound
+	State             string    // Channel-State, e.g. CS_EXECUTE
+	CallState         string    // Channel-Call-State, e.g. ACTIVE
+	CallerIDName      string    // Caller-Caller-ID-Name
+	CallerIDNumber    string    // Caller-Caller-ID-Number
+	DestinationNumber string    // Caller-Destination-Number
+	Context           string    // Caller-Context
+	OtherLegUUID      string    // Other-Leg-Unique-ID, if bridged
+}
+
+// ChannelCreate is a CHANNEL_CREATE event.
+type ChannelCreate struct {
+	ChannelEvent
+}
+
+// ChannelAnswer is a CHANNEL_ANSWER event.
+type ChannelAnswer struct {
+	ChannelEvent
+	Times       ChannelTimes
+	AnswerDelay time.Duration // From creation to answer
+}
+
+// ChannelHangupComplete is a CHANNEL_HANGUP_COMPLETE event, the last one
+// with the variables of the channel, as used for CDRs.
+type ChannelHangupComplete struct {
+	ChannelEvent
+	Cause         HangupCause
+	Times         ChannelTimes
+	Duration      time.Duration // From creation to hangup
+	Billsec       time.Duration // From answer to hangup, 0 if not answered
+	SIPTermStatus string        // sip_term_status variable, e.g. 486
+	HangupBy      string        // sip_hangup_disposition variable, e.g. recv_bye
+}
+
+// BackgroundJob is a BACKGROUND_JOB event, with the result of a bgapi
+// command, see also BgAPI.
+type BackgroundJob struct {
+	Time    time.Time
+	JobUUID string // Job-UUID
+	Command string // Job-Command, e.g. originate
+	Args    string // Job-Command-Arg
+	Result  string // Output of the command, e.g. +OK ...
+}
+
+// Err returns the result of the job as an error if it failed, or nil.
+func (j *BackgroundJob) Err() error {
+	if body := strings.TrimSpace(j.Result); strings.HasPrefix(body, "-") {
+		return replyError(body)
+	}
+	return nil
+}
+
+// DecodeEvent decodes the events received the most into typed structs:
+// *ChannelCreate, *ChannelAnswer, *ChannelHangupComplete, *BackgroundJob,
+// DTMF and *Heartbeat, and CUSTOM events with a decoder registered for
+// their subclass, see RegisterSubclassDecoder. Other events are returned
+// as they are, as *Event.
+// It returns ErrMissingHeader for events without the headers that identify
+// them, like Unique-ID for channel events.
+//
+// The typed values don't refer to the event, which may be released.
+//
+// Example:
+//
+//	v, err := eventsocket.DecodeEvent(ev)
+//	...
+//	switch e := v.(type) {
+//	case *eventsocket.ChannelAnswer:
+//		log.Println(e.UUID, "answered after", e.AnswerDelay)
+//	case *eventsocket.ChannelHangupComplete:
+//		log.Println(e.UUID, "hung up with", e.Cause, "after", e.Billsec)
+//	case *eventsocket.Event:
+//		// Anything else.
+//	}
+func DecodeEvent(ev *Event) (interface{}, error) {
+	switch ev.Get("Event-Name") {
+	case EventChannelCreate:
+		ce, err := decodeChannelEvent(ev)
+		if err != nil {
+			return nil, err
+		}
+		return &ChannelCreate{ChannelEvent: ce}, nil
+	case EventChannelAnswer:
+		ce, err := decodeChannelEvent(ev)
+		if err != nil {
+			return nil, err
+		}
+		a := &ChannelAnswer{ChannelEvent: ce, Times: ev.ChannelTimes()}
+		a.AnswerDelay, _ = ev.AnswerDelay()
+		return a, nil
+	case EventChannelHangupComplete:
+		ce, err := decodeChannelEvent(ev)
+		if err != nil {
+			return nil, err
+		}
+		hc := &ChannelHangupComplete{
+			ChannelEvent:  ce,
+			Times:         ev.ChannelTimes(),
+			SIPTermStatus: ev.Variable("sip_term_status"),
+			HangupBy:      ev.Variable("sip_hangup_disposition"),
+		}
+		hc.Cause, _ = ev.HangupCause()
+		hc.Duration, _ = ev.CallDuration()
+		hc.Billsec, _ = ev.Billsec()
+		return hc, nil
+	case EventBackgroundJob:
+		j := &BackgroundJob{
+			JobUUID: ev.Get("Job-Uuid"),
+			Command: ev.Get("Job-Command"),
+			Args:    ev.Get("Job-Command-Arg"),
+			Result:  ev.Body,
+		}
+		if j.JobUUID == "" {
+			return nil, ErrMissingHeader
+		}
+		j.Time, _ = ev.Timestamp()
+		return j, nil
+	case EventDTMF:
+		d, err := ParseDTMF(ev)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	case EventHeartbeat:
+		hb, _ := ParseHeartbeat(ev)
+		return hb, nil
+	case EventCustom:
+		return DecodeCustom(ev)
+	}
+	return ev, nil
+}
+
+// decodeChannelEvent decodes the headers common to channel events.
+func decodeChannelEvent(ev *Event) (ChannelEvent, error) {
+	ce := ChannelEvent{
+		UUID:              ev.Get("Unique-Id"),
+		CallUUID:          ev.Get("Channel-Call-Uuid"),
+		Name:              ev.Get("Channel-Name"),
+		Direction:         ev.Get("Call-Direction"),
+		State:             ev.Get("Channel-State"),
+		CallState:         ev.Get("Channel-Call-State"),
+		CallerIDName:      ev.Get("Caller-Caller-Id-Name"),
+		CallerIDNumber:    ev.Get("Caller-Caller-Id-Number"),
+		DestinationNumber: ev.Get("Caller-Destination-Number"),
+		Context:           ev.Get("Caller-Context"),
+		OtherLegUUID:      ev.Get("Other-Leg-Unique-Id"),
+	}
+	if ce.UUID == "" {
+		return ce, ErrMissingHeader
+	}
+	ce.Time, _ = ev.Timestamp()
+	return ce, nil
+}
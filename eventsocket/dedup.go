@@ -0,0 +1,99 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"sync"
+	"time"
+)
+
+// Deduplicator drops events seen before within a window of time, based on
+// their Event-UUID. Duplicates come up when subscribed to the same events
+// more than once, e.g. with both myevents and "events ALL", or when
+// consuming events from multiple connections to the same FreeSWITCH.
+//
+// The same Deduplicator can be shared by multiple connections, so each
+// event is only returned by ReadEvent of the first to receive it.
+//
+// Example:
+//
+//	d := eventsocket.NewDeduplicator(time.Minute)
+//	c1.Deduplicate(d)
+//	c2.Deduplicate(d)
+type Deduplicator struct {
+	window time.Duration
+	mu     sync.Mutex
+	seen   map[string]time.Time // uuid:when
+	queue  []seenEvent          // In the order seen, for expiring them
+	head   int                  // Index of the oldest in queue
+}
+
+// seenEvent is an event seen by a Deduplicator.
+type seenEvent struct {
+	uuid string
+	when time.Time
+}
+
+// NewDeduplicator creates a Deduplicator that remembers events for the
+// given window of time.
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	return &Deduplicator{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// Duplicate reports whether the event was seen before within the window,
+// and remembers it otherwise. Events without Event-UUID are never
+// duplicates.
+func (d *Deduplicator) Duplicate(ev *Event) bool {
+	uuid := ev.peek("Event-Uuid")
+	if uuid == "" {
+		return false
+	}
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire(now)
+	if _, ok := d.seen[uuid]; ok {
+		return true
+	}
+	d.seen[uuid] = now
+	d.queue = append(d.queue, seenEvent{uuid, now})
+	return false
+}
+
+// Len returns the number of events remembered.
+func (d *Deduplicator) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire(time.Now())
+	return len(d.seen)
+}
+
+// expire forgets the events seen before the window, with mu held.
+func (d *Deduplicator) expire(now time.Time) {
+	for d.head < len(d.queue) && now.Sub(d.queue[d.head].when) > d.window {
+		delete(d.seen, d.queue[d.head].uuid)
+		d.queue[d.head] = seenEvent{}
+		d.head++
+	}
+	if d.head == len(d.queue) {
+		// Reuse the slice once it's drained.
+		d.queue = d.queue[:0]
+		d.head = 0
+	} else if d.head > len(d.queue)/2 {
+		// Reclaim the space of expired events.
+		d.queue = append(d.queue[:0], d.queue[d.head:]...)
+		d.head = 0
+	}
+}
+
+// Deduplicate drops events already seen by d, before they reach
+// ReadEvent. Observers of the connection, like BgAPI jobs, still get
+// every event. Setting d to nil stops dropping duplicates.
+func (h *Connection) Deduplicate(d *Deduplicator) {
+	h.dedup.Store(d)
+}
@@ -0,0 +1,114 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+var errInvalidVariable = errors.New("Invalid channel variable name")
+
+// channelVar is a channel variable set in a dial string.
+type channelVar struct {
+	name, value string
+}
+
+// GlobalVars formats channel variables as a {} group, which applies to all
+// legs of a dial string, or to all legs of an enterprise group. Variables
+// are sorted by name, and values are escaped with EscapeValue.
+//
+// Example:
+//
+//	vars, err := eventsocket.GlobalVars(map[string]string{
+//		"origination_caller_id_name": "Doe, John",
+//		"ignore_early_media":         "true",
+//	})
+//	// {ignore_early_media=true,origination_caller_id_name='Doe\, John'}
+func GlobalVars(vars map[string]string) (string, error) {
+	return formatVars('{', '}', sortedVars(vars))
+}
+
+// EnterpriseVars formats channel variables as a <> group, which applies to
+// all the groups of an enterprise originate, separated by :_:.
+func EnterpriseVars(vars map[string]string) (string, error) {
+	return formatVars('<', '>', sortedVars(vars))
+}
+
+// LegVars formats channel variables as a [] group, which applies to the
+// endpoint that follows it only, like leg_timeout or leg_delay_start.
+//
+// Example:
+//
+//	legs := make([]string, 0, 2)
+//	for n, endpoint := range []string{"user/1000", "user/1001"} {
+//		vars, _ := eventsocket.LegVars(map[string]string{
+//			"leg_delay_start": strconv.Itoa(n * 5),
+//		})
+//		legs = append(legs, vars+endpoint)
+//	}
+//	dialstring := strings.Join(legs, ",")
+func LegVars(vars map[string]string) (string, error) {
+	return formatVars('[', ']', sortedVars(vars))
+}
+
+// EscapeValue escapes the value of a channel variable for variable groups
+// of dial strings: commas, which otherwise separate variables, are escaped
+// and values with spaces or quotes are quoted.
+func EscapeValue(s string) string {
+	s = EscapeCommas(s)
+	if strings.ContainsAny(s, " '") {
+		s = "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+	}
+	return s
+}
+
+// EscapeCommas escapes commas, which separate endpoints in dial strings and
+// arguments of some applications, like the destinations of bridge or the
+// files of playback with file_string://.
+func EscapeCommas(s string) string {
+	return strings.Replace(s, ",", `\,`, -1)
+}
+
+// QuoteArg quotes an argument of api commands, like originate, if it
+// contains spaces, which otherwise separate arguments.
+func QuoteArg(s string) string {
+	if !strings.ContainsAny(s, " \t") {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
+
+// sortedVars converts variables to a list sorted by name.
+func sortedVars(vars map[string]string) []channelVar {
+	list := make([]channelVar, 0, len(vars))
+	for name, value := range vars {
+		list = append(list, channelVar{name, value})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+// formatVars formats variables enclosed in the given brackets, or returns
+// an empty string if there are none.
+func formatVars(open, close byte, vars []channelVar) (string, error) {
+	if len(vars) == 0 {
+		return "", nil
+	}
+	s := []byte{open}
+	for n, v := range vars {
+		if v.name == "" || strings.IndexAny(v.name, "=,{}[]<>'\" \t\r\n") >= 0 {
+			return "", errInvalidVariable
+		}
+		if n > 0 {
+			s = append(s, ',')
+		}
+		s = append(s, v.name...)
+		s = append(s, '=')
+		s = append(s, EscapeValue(v.value)...)
+	}
+	return string(append(s, close)), nil
+}
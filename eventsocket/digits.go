@@ -0,0 +1,139 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Errors returned by PlayAndGetDigits.
+var (
+	ErrDigitsTimeout = errors.New("No digits entered")
+	ErrInvalidDigits = errors.New("Invalid digits entered")
+)
+
+// DigitsVariable is the channel variable PlayAndGetDigits stores digits
+// in, unless DigitsOptions.Variable is set.
+const DigitsVariable = "eventsocket_digits"
+
+// DigitsOptions are the parameters of PlayAndGetDigits.
+//
+// See http://wiki.freeswitch.org/wiki/Misc._Dialplan_Tools_play_and_get_digits
+// for details.
+type DigitsOptions struct {
+	File        string        // Prompt played while collecting digits
+	InvalidFile string        // Played when digits don't match Regexp
+	Min         int           // Minimum number of digits, defaults to 1
+	Max         int           // Maximum number of digits, defaults to Min
+	Tries       int           // Attempts, defaults to 1
+	Timeout     time.Duration // Wait for the first digit, defaults to 5s
+	Terminators string        // Digits that end the input, defaults to #
+
+	// DigitTimeout is how long to wait between digits. Defaults to
+	// Timeout.
+	DigitTimeout time.Duration
+
+	// Regexp the digits must match, defaults to \d+.
+	Regexp string
+
+	// Variable to store the digits in, defaults to DigitsVariable.
+	Variable string
+}
+
+// PlayAndGetDigits plays a prompt and collects digits, using the
+// play_and_get_digits application. It returns the digits entered, or
+// ErrDigitsTimeout when no digits were entered, or ErrInvalidDigits when
+// they didn't match the regexp in any of the tries.
+//
+// Example:
+//
+//	pin, err := s.PlayAndGetDigits(&eventsocket.DigitsOptions{
+//		File:    "/prompts/enter-pin.wav",
+//		Min:     4,
+//		Max:     4,
+//		Tries:   3,
+//		Timeout: 10 * time.Second,
+//	})
+func (s *Session) PlayAndGetDigits(opts *DigitsOptions) (string, error) {
+	o := *opts
+	if o.Min <= 0 {
+		o.Min = 1
+	}
+	if o.Max < o.Min {
+		o.Max = o.Min
+	}
+	if o.Tries <= 0 {
+		o.Tries = 1
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if o.DigitTimeout <= 0 {
+		o.DigitTimeout = o.Timeout
+	}
+	if o.Terminators == "" {
+		o.Terminators = "#"
+	}
+	if o.InvalidFile == "" {
+		o.InvalidFile = "silence_stream://250"
+	}
+	if o.Regexp == "" {
+		o.Regexp = `\d+`
+	}
+	if o.Variable == "" {
+		o.Variable = DigitsVariable
+	}
+	// Prompts may have spaces, e.g. say:Please enter your PIN, and are
+	// quoted.
+	if o.File == "" || strings.ContainsAny(o.File+o.InvalidFile, "\r\n") ||
+		!validArg(o.Variable) {
+		return "", errInvalidArgument
+	}
+	// Clear results of previous calls, which FreeSWITCH leaves around.
+	for _, name := range []string{o.Variable, o.Variable + "_invalid"} {
+		if _, err := s.Execute("unset", name); err != nil {
+			return "", err
+		}
+	}
+	arg := fmt.Sprintf("%d %d %d %d %s %s %s %s %s %d",
+		o.Min, o.Max, o.Tries, o.Timeout/time.Millisecond,
+		QuoteArg(o.Terminators), QuoteArg(o.File), QuoteArg(o.InvalidFile),
+		o.Variable, QuoteArg(o.Regexp), o.DigitTimeout/time.Millisecond)
+	ev, err := s.Execute("play_and_get_digits", arg)
+	if err != nil {
+		return "", err
+	}
+	digits, err := s.variable(ev, o.Variable)
+	if err != nil || digits != "" {
+		return digits, err
+	}
+	invalid, err := s.variable(ev, o.Variable+"_invalid")
+	if err != nil {
+		return "", err
+	}
+	if invalid != "" {
+		return "", ErrInvalidDigits
+	}
+	return "", ErrDigitsTimeout
+}
+
+// variable returns a channel variable from ev, or from FreeSWITCH when
+// events don't carry variables, which is the case without verbose_events.
+func (s *Session) variable(ev *Event, name string) (string, error) {
+	if v, ok := ev.VariableOk(name); ok {
+		return v, nil
+	}
+	if ev.Get("Variable_uuid") != "" {
+		return "", nil // The event has variables, just not this one
+	}
+	v, err := s.h.api("uuid_getvar " + s.UUID + " " + name)
+	if err != nil || v == "_undef_" {
+		return "", err
+	}
+	return v, nil
+}
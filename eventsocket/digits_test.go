@@ -0,0 +1,67 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+	"github.com/fiorix/go-eventsocket/eventsocket/eventsockettest"
+)
+
+// TestPlayAndGetDigitsPrompt checks that prompts may have spaces, as say:
+// and phrase: prompts do.
+func TestPlayAndGetDigitsPrompt(t *testing.T) {
+	fs := eventsockettest.NewServer()
+	defer fs.Close()
+	fs.HandleAPI("uuid_getvar", func(args string) string { return "1234" })
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		digits string
+		err    error
+	}
+	done := make(chan result, 1)
+	srv := &eventsocket.Server{Handler: eventsocket.HandleFunc(func(c *eventsocket.Connection) {
+		s, err := eventsocket.NewSession(c)
+		if err != nil {
+			done <- result{"", err}
+			return
+		}
+		digits, err := s.PlayAndGetDigits(&eventsocket.DigitsOptions{
+			Min:  4,
+			Max:  4,
+			File: "say:Please enter your PIN",
+		})
+		done <- result{digits, err}
+	})}
+	go srv.Serve(ln)
+	defer ln.Close()
+	if _, err := fs.Connect(ln.Addr().String(), nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-done:
+		if r.err != nil || r.digits != "1234" {
+			t.Fatalf("PlayAndGetDigits returned %q, %v", r.digits, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("PlayAndGetDigits didn't return")
+	}
+	for _, cmd := range fs.Received() {
+		if cmd.Header.Get("Execute-App-Name") == "play_and_get_digits" {
+			if !strings.Contains(cmd.Body+cmd.Header.Get("Execute-App-Arg"), "Please enter your PIN") {
+				t.Fatalf("prompt not sent: %q", cmd.Header.Get("Execute-App-Arg"))
+			}
+			return
+		}
+	}
+	t.Fatal("play_and_get_digits not executed")
+}
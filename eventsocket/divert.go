@@ -0,0 +1,51 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+// DivertEvents enables or disables divert_events. When enabled, the
+// events that would go to the input callback of the channel while an
+// application runs, like DTMF during playback, or DETECTED_SPEECH during
+// play_and_detect_speech or detect_speech, are sent to the connection.
+// That's what ASR driven IVRs are built on.
+//
+// It applies to the channel of an outbound connection, or of the
+// connection subscribed with MyEvents.
+func (h *Connection) DivertEvents(enable bool) error {
+	cmd := "divert_events off"
+	if enable {
+		cmd = "divert_events on"
+	}
+	_, err := h.Send(cmd)
+	return err
+}
+
+// RouteDivertedEvents hands the events diverted by DivertEvents, DTMF and
+// DETECTED_SPEECH, to fn, in order, instead of ReadEvent, until cancel is
+// called or the connection terminates, so a recognizer can consume them
+// while the call flow goes on reading the other events.
+//
+// fn runs in its own goroutine, and the events are handed over as if
+// returned by ReadEvent. Observers, like the DTMF stream, still see
+// them.
+//
+// Example:
+//
+//	c.DivertEvents(true)
+//	cancel := c.RouteDivertedEvents(func(ev *eventsocket.Event) {
+//		if ev.Get("Event-Name") == "DETECTED_SPEECH" && ev.Get("Speech-Type") == "detected-speech" {
+//			results <- ev.Body
+//		}
+//	})
+//	defer cancel()
+//	c.Execute("play_and_detect_speech", "menu.wav detect:unimrcp {}grammar", false)
+func (h *Connection) RouteDivertedEvents(fn func(*Event)) (cancel func()) {
+	return h.startRoute(&h.diverted, func(ev *Event) bool {
+		switch ev.peek("Event-Name") {
+		case "DTMF", "DETECTED_SPEECH":
+			return true
+		}
+		return false
+	}, fn)
+}
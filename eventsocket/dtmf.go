@@ -0,0 +1,206 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dtmfBuffer is how many digits a DTMFStream holds before dropping new
+// ones, which is plenty for anyone pressing keys by hand.
+const dtmfBuffer = 64
+
+// DTMF is a key pressed on a channel, from a DTMF event.
+type DTMF struct {
+	UUID     string        // Channel the digit was pressed on
+	Digit    string        // 0-9, *, #, or A-D
+	Duration time.Duration // How long the key was pressed
+	Source   string        // How it was detected, e.g. RTP or INBAND
+	Time     time.Time     // When it was pressed
+}
+
+// ParseDTMF parses a DTMF event. It returns ErrMissingHeader for events
+// without DTMF-Digit.
+func ParseDTMF(ev *Event) (DTMF, error) {
+	d := DTMF{
+		UUID:   ev.Get("Unique-Id"),
+		Digit:  ev.Get("Dtmf-Digit"),
+		Source: ev.Get("Dtmf-Source"),
+	}
+	if d.Digit == "" {
+		return d, ErrMissingHeader
+	}
+	// The duration is in samples at 8kHz.
+	if n, err := strconv.Atoi(ev.Get("Dtmf-Duration")); err == nil {
+		d.Duration = time.Duration(n) * time.Second / 8000
+	}
+	var err error
+	if d.Time, err = ev.Timestamp(); err != nil {
+		d.Time = time.Now()
+	}
+	return d, nil
+}
+
+// DTMFStream delivers the keys pressed on channels, see DTMF.
+type DTMFStream struct {
+	// C delivers the digits. It's closed when the stream is closed or
+	// the connection terminates.
+	C <-chan DTMF
+
+	h      *Connection
+	c      chan DTMF
+	cancel func()
+	once   sync.Once
+	closed chan struct{}
+}
+
+// DTMF returns a stream of the keys pressed on the channel of an outbound
+// connection after Connect, or on all channels otherwise. Digits are
+// dropped if the stream isn't read.
+//
+// The connection must be subscribed to DTMF events, which myevents does.
+//
+// Example:
+//
+//	dtmf := c.DTMF()
+//	defer dtmf.Close()
+//	s.Playback("/prompts/menu.wav")
+//	switch digit, _ := dtmf.Collect(1, 5*time.Second); digit {
+//	case "1":
+//		...
+//	}
+func (h *Connection) DTMF() *DTMFStream {
+	var uuid string
+	if d := h.ChannelData(); d != nil {
+		uuid = d.UUID
+	}
+	c := make(chan DTMF, dtmfBuffer)
+	s := &DTMFStream{C: c, h: h, c: c, closed: make(chan struct{})}
+	s.cancel = h.observe(func(ev *Event) bool {
+		if ev.peek("Event-Name") != "DTMF" {
+			return false
+		}
+		if uuid != "" && ev.peek("Unique-Id") != uuid {
+			return false
+		}
+		if d, err := ParseDTMF(ev); err == nil {
+			select {
+			case c <- d:
+			default:
+			}
+		}
+		return false
+	})
+	go func() {
+		select {
+		case <-h.done:
+			s.Close()
+		case <-s.closed:
+		}
+	}()
+	return s
+}
+
+// Close stops the stream and closes C.
+func (s *DTMFStream) Close() {
+	s.once.Do(func() {
+		// Once cancel returns the observer can't send anymore.
+		s.cancel()
+		close(s.closed)
+		close(s.c)
+	})
+}
+
+// Collect reads exactly n digits, waiting up to timeout for each one. On
+// timeout, it returns the digits read so far and ErrDigitsTimeout.
+func (s *DTMFStream) Collect(n int, timeout time.Duration) (string, error) {
+	var digits []string
+	for len(digits) < n {
+		d, err := s.next(timeout)
+		if err != nil {
+			return strings.Join(digits, ""), err
+		}
+		digits = append(digits, d.Digit)
+	}
+	return strings.Join(digits, ""), nil
+}
+
+// ReadUntil reads digits until one of the terminators is pressed, max
+// digits are read, or no digit is pressed within interDigit. The
+// terminator isn't returned. It returns ErrDigitsTimeout only when no
+// digits were read at all.
+func (s *DTMFStream) ReadUntil(terminators string, max int, interDigit time.Duration) (string, error) {
+	var digits []string
+	for max <= 0 || len(digits) < max {
+		d, err := s.next(interDigit)
+		if err == ErrDigitsTimeout && len(digits) > 0 {
+			break
+		}
+		if err != nil {
+			return strings.Join(digits, ""), err
+		}
+		if strings.Contains(terminators, d.Digit) {
+			break
+		}
+		digits = append(digits, d.Digit)
+	}
+	return strings.Join(digits, ""), nil
+}
+
+// next waits for the next digit.
+func (s *DTMFStream) next(timeout time.Duration) (DTMF, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case d, ok := <-s.C:
+		if !ok {
+			select {
+			case <-s.h.done:
+				return d, s.h.err
+			default:
+				return d, errClosed
+			}
+		}
+		return d, nil
+	case <-timer.C:
+		return DTMF{}, ErrDigitsTimeout
+	}
+}
+
+// SendDTMF sends digits to a channel, using uuid_send_dtmf, to drive the
+// IVR on the other end. Digits are 0-9, *, #, A-D, and the pauses w, of
+// half a second, and W, of one second. Each tone lasts for duration, or
+// the FreeSWITCH default when 0.
+//
+// Example:
+//
+//	c.SendDTMF(uuid, "1W2345#", 200*time.Millisecond)
+func (h *Connection) SendDTMF(uuid, digits string, duration time.Duration) error {
+	if !validArg(uuid) || !validDTMF(digits) || duration < 0 {
+		return errInvalidArgument
+	}
+	if duration > 0 {
+		digits += "@" + strconv.FormatInt(int64(duration/time.Millisecond), 10)
+	}
+	_, err := h.api("uuid_send_dtmf " + uuid + " " + digits)
+	return err
+}
+
+// validDTMF reports whether s only has digits and pauses valid for
+// uuid_send_dtmf.
+func validDTMF(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789*#ABCDabcdwW", c) {
+			return false
+		}
+	}
+	return true
+}
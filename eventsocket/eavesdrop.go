@@ -0,0 +1,116 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"time"
+)
+
+// EavesdropMode is what a supervisor listening in on a call can do.
+type EavesdropMode int
+
+// Eavesdrop modes.
+const (
+	EavesdropListen  EavesdropMode = iota // Listen only
+	EavesdropWhisper                      // Talk to the A leg, e.g. the agent
+	EavesdropBarge                        // Talk to both legs
+)
+
+// EavesdropOptions are the settings of Eavesdrop.
+type EavesdropOptions struct {
+	// Mode is what the supervisor can do initially.
+	Mode EavesdropMode
+
+	// EnableDTMF lets the supervisor switch modes with the keypad: 1
+	// talks to the A leg, 2 to the B leg, 3 to both and 0 only listens.
+	EnableDTMF bool
+
+	// RequireGroup, when set, only allows eavesdropping on channels that
+	// are members of the group, set with the eavesdrop_group variable.
+	RequireGroup string
+
+	// CallerIDName and CallerIDNumber are presented to the supervisor.
+	CallerIDName   string
+	CallerIDNumber string
+
+	// Timeout is how long to wait for the supervisor to answer.
+	Timeout time.Duration
+}
+
+// Eavesdrop calls a supervisor, e.g. user/1000, and lets them listen in on
+// the channel identified by uuid once they answer. It returns the UUID of
+// the supervisor's channel, or an *OriginateError, see Originate.
+//
+// Example:
+//
+//	c.Send("events plain BACKGROUND_JOB")
+//	uuid, err := c.Eavesdrop(ctx, "user/1000", agentUUID, &eventsocket.EavesdropOptions{
+//		Mode:       eventsocket.EavesdropWhisper,
+//		EnableDTMF: true,
+//	})
+func (h *Connection) Eavesdrop(ctx context.Context, supervisor, uuid string, opts *EavesdropOptions) (string, error) {
+	if !validArg(supervisor) || !validArg(uuid) {
+		return "", errInvalidArgument
+	}
+	if opts == nil {
+		opts = &EavesdropOptions{}
+	}
+	b := NewOriginate().
+		Endpoint(supervisor).
+		CallerID(opts.CallerIDName, opts.CallerIDNumber).
+		App("eavesdrop", uuid)
+	if opts.Timeout > 0 {
+		b.Timeout(opts.Timeout)
+	}
+	switch opts.Mode {
+	case EavesdropWhisper:
+		b.Var("eavesdrop_whisper_aleg", "true")
+	case EavesdropBarge:
+		b.Var("eavesdrop_whisper_aleg", "true")
+		b.Var("eavesdrop_whisper_bleg", "true")
+	}
+	if opts.EnableDTMF {
+		b.Var("eavesdrop_enable_dtmf", "true")
+	}
+	if opts.RequireGroup != "" {
+		b.Var("eavesdrop_require_group", opts.RequireGroup)
+	}
+	return h.Originate(ctx, b)
+}
+
+// EavesdropEvent is the start or end of an eavesdrop, from the
+// CHANNEL_EXECUTE and CHANNEL_EXECUTE_COMPLETE events of the supervisor's
+// channel.
+type EavesdropEvent struct {
+	SupervisorUUID string // Channel listening in
+	TargetUUID     string // Channel listened to
+	Started        bool   // Whether the eavesdrop started or ended
+
+	// Response is how the eavesdrop ended, e.g. "+OK", set when Started
+	// is false.
+	Response string
+}
+
+// ParseEavesdropEvent parses the events of the eavesdrop application. It
+// returns false for any other events.
+func ParseEavesdropEvent(ev *Event) (*EavesdropEvent, bool) {
+	if ev.Get("Application") != "eavesdrop" {
+		return nil, false
+	}
+	e := &EavesdropEvent{
+		SupervisorUUID: ev.Get("Unique-Id"),
+		TargetUUID:     ev.Get("Application-Data"),
+	}
+	switch ev.Get("Event-Name") {
+	case "CHANNEL_EXECUTE":
+		e.Started = true
+	case "CHANNEL_EXECUTE_COMPLETE":
+		e.Response = ev.Get("Application-Response")
+	default:
+		return nil, false
+	}
+	return e, true
+}
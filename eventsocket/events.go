@@ -0,0 +1,205 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "strings"
+
+// Event names of FreeSWITCH, the values of the Event-Name header, and of
+// the subscriptions to them.
+const (
+	EventCustom                 = "CUSTOM"
+	EventClone                  = "CLONE"
+	EventChannelCreate          = "CHANNEL_CREATE"
+	EventChannelDestroy         = "CHANNEL_DESTROY"
+	EventChannelState           = "CHANNEL_STATE"
+	EventChannelCallstate       = "CHANNEL_CALLSTATE"
+	EventChannelAnswer          = "CHANNEL_ANSWER"
+	EventChannelHangup          = "CHANNEL_HANGUP"
+	EventChannelHangupComplete  = "CHANNEL_HANGUP_COMPLETE"
+	EventChannelExecute         = "CHANNEL_EXECUTE"
+	EventChannelExecuteComplete = "CHANNEL_EXECUTE_COMPLETE"
+	EventChannelHold            = "CHANNEL_HOLD"
+	EventChannelUnhold          = "CHANNEL_UNHOLD"
+	EventChannelBridge          = "CHANNEL_BRIDGE"
+	EventChannelUnbridge        = "CHANNEL_UNBRIDGE"
+	EventChannelProgress        = "CHANNEL_PROGRESS"
+	EventChannelProgressMedia   = "CHANNEL_PROGRESS_MEDIA"
+	EventChannelOutgoing        = "CHANNEL_OUTGOING"
+	EventChannelPark            = "CHANNEL_PARK"
+	EventChannelUnpark          = "CHANNEL_UNPARK"
+	EventChannelApplication     = "CHANNEL_APPLICATION"
+	EventChannelOriginate       = "CHANNEL_ORIGINATE"
+	EventChannelUUID            = "CHANNEL_UUID"
+	EventAPI                    = "API"
+	EventLog                    = "LOG"
+	EventInboundChan            = "INBOUND_CHAN"
+	EventOutboundChan           = "OUTBOUND_CHAN"
+	EventStartup                = "STARTUP"
+	EventShutdown               = "SHUTDOWN"
+	EventPublish                = "PUBLISH"
+	EventUnpublish              = "UNPUBLISH"
+	EventTalk                   = "TALK"
+	EventNotalk                 = "NOTALK"
+	EventSessionCrash           = "SESSION_CRASH"
+	EventModuleLoad             = "MODULE_LOAD"
+	EventModuleUnload           = "MODULE_UNLOAD"
+	EventDTMF                   = "DTMF"
+	EventMessage                = "MESSAGE"
+	EventPresenceIn             = "PRESENCE_IN"
+	EventNotifyIn               = "NOTIFY_IN"
+	EventPresenceOut            = "PRESENCE_OUT"
+	EventPresenceProbe          = "PRESENCE_PROBE"
+	EventMessageWaiting         = "MESSAGE_WAITING"
+	EventMessageQuery           = "MESSAGE_QUERY"
+	EventRoster                 = "ROSTER"
+	EventCodec                  = "CODEC"
+	EventBackgroundJob          = "BACKGROUND_JOB"
+	EventDetectedSpeech         = "DETECTED_SPEECH"
+	EventDetectedTone           = "DETECTED_TONE"
+	EventPrivateCommand         = "PRIVATE_COMMAND"
+	EventHeartbeat              = "HEARTBEAT"
+	EventTrap                   = "TRAP"
+	EventAddSchedule            = "ADD_SCHEDULE"
+	EventDelSchedule            = "DEL_SCHEDULE"
+	EventExeSchedule            = "EXE_SCHEDULE"
+	EventReSchedule             = "RE_SCHEDULE"
+	EventReloadXML              = "RELOADXML"
+	EventNotify                 = "NOTIFY"
+	EventPhoneFeature           = "PHONE_FEATURE"
+	EventPhoneFeatureSubscribe  = "PHONE_FEATURE_SUBSCRIBE"
+	EventSendMessage            = "SEND_MESSAGE"
+	EventRecvMessage            = "RECV_MESSAGE"
+	EventRequestParams          = "REQUEST_PARAMS"
+	EventChannelData            = "CHANNEL_DATA"
+	EventGeneral                = "GENERAL"
+	EventCommand                = "COMMAND"
+	EventSessionHeartbeat       = "SESSION_HEARTBEAT"
+	EventClientDisconnected     = "CLIENT_DISCONNECTED"
+	EventServerDisconnected     = "SERVER_DISCONNECTED"
+	EventSendInfo               = "SEND_INFO"
+	EventRecvInfo               = "RECV_INFO"
+	EventRecvRTCPMessage        = "RECV_RTCP_MESSAGE"
+	EventSendRTCPMessage        = "SEND_RTCP_MESSAGE"
+	EventCallSecure             = "CALL_SECURE"
+	EventNAT                    = "NAT"
+	EventRecordStart            = "RECORD_START"
+	EventRecordStop             = "RECORD_STOP"
+	EventPlaybackStart          = "PLAYBACK_START"
+	EventPlaybackStop           = "PLAYBACK_STOP"
+	EventCallUpdate             = "CALL_UPDATE"
+	EventFailure                = "FAILURE"
+	EventSocketData             = "SOCKET_DATA"
+	EventMediaBugStart          = "MEDIA_BUG_START"
+	EventMediaBugStop           = "MEDIA_BUG_STOP"
+	EventConferenceDataQuery    = "CONFERENCE_DATA_QUERY"
+	EventConferenceData         = "CONFERENCE_DATA"
+	EventCallSetupReq           = "CALL_SETUP_REQ"
+	EventCallSetupResult        = "CALL_SETUP_RESULT"
+	EventCallDetail             = "CALL_DETAIL"
+	EventDeviceState            = "DEVICE_STATE"
+	EventText                   = "TEXT"
+	EventShutdownRequested      = "SHUTDOWN_REQUESTED"
+	EventAll                    = "ALL"
+)
+
+// EventClass is the kind of an event, see ClassifyEvent.
+type EventClass string
+
+// Event classes.
+const (
+	EventClassChannel  EventClass = "channel"  // About a channel, with its Unique-ID
+	EventClassPresence EventClass = "presence" // Presence, message waiting and device state
+	EventClassMessage  EventClass = "message"  // Messages, notifies and info of endpoints
+	EventClassJob      EventClass = "job"      // Results of api and bgapi commands
+	EventClassSystem   EventClass = "system"   // Of FreeSWITCH itself, like HEARTBEAT
+	EventClassCustom   EventClass = "custom"   // CUSTOM, see Event-Subclass
+	EventClassOther    EventClass = "other"    // Anything else
+)
+
+var eventClasses = map[string]EventClass{
+	EventCallUpdate:       EventClassChannel,
+	EventCallSecure:       EventClassChannel,
+	EventCallDetail:       EventClassChannel,
+	EventDTMF:             EventClassChannel,
+	EventTalk:             EventClassChannel,
+	EventNotalk:           EventClassChannel,
+	EventDetectedSpeech:   EventClassChannel,
+	EventDetectedTone:     EventClassChannel,
+	EventPlaybackStart:    EventClassChannel,
+	EventPlaybackStop:     EventClassChannel,
+	EventRecordStart:      EventClassChannel,
+	EventRecordStop:       EventClassChannel,
+	EventMediaBugStart:    EventClassChannel,
+	EventMediaBugStop:     EventClassChannel,
+	EventSessionHeartbeat: EventClassChannel,
+
+	EventPresenceIn:     EventClassPresence,
+	EventPresenceOut:    EventClassPresence,
+	EventPresenceProbe:  EventClassPresence,
+	EventMessageWaiting: EventClassPresence,
+	EventMessageQuery:   EventClassPresence,
+	EventRoster:         EventClassPresence,
+	EventNotifyIn:       EventClassPresence,
+	EventDeviceState:    EventClassPresence,
+
+	EventMessage:               EventClassMessage,
+	EventSendMessage:           EventClassMessage,
+	EventRecvMessage:           EventClassMessage,
+	EventSendInfo:              EventClassMessage,
+	EventRecvInfo:              EventClassMessage,
+	EventNotify:                EventClassMessage,
+	EventText:                  EventClassMessage,
+	EventPhoneFeature:          EventClassMessage,
+	EventPhoneFeatureSubscribe: EventClassMessage,
+	EventSendRTCPMessage:       EventClassMessage,
+	EventRecvRTCPMessage:       EventClassMessage,
+
+	EventAPI:           EventClassJob,
+	EventBackgroundJob: EventClassJob,
+
+	EventHeartbeat:         EventClassSystem,
+	EventStartup:           EventClassSystem,
+	EventShutdown:          EventClassSystem,
+	EventShutdownRequested: EventClassSystem,
+	EventModuleLoad:        EventClassSystem,
+	EventModuleUnload:      EventClassSystem,
+	EventReloadXML:         EventClassSystem,
+	EventSessionCrash:      EventClassSystem,
+	EventTrap:              EventClassSystem,
+	EventCodec:             EventClassSystem,
+	EventNAT:               EventClassSystem,
+	EventLog:               EventClassSystem,
+	EventFailure:           EventClassSystem,
+	EventPublish:           EventClassSystem,
+	EventUnpublish:         EventClassSystem,
+	EventAddSchedule:       EventClassSystem,
+	EventDelSchedule:       EventClassSystem,
+	EventExeSchedule:       EventClassSystem,
+	EventReSchedule:        EventClassSystem,
+
+	EventCustom: EventClassCustom,
+}
+
+// ClassifyEvent returns the class of an event, by its name.
+func ClassifyEvent(ev *Event) EventClass {
+	return ClassifyEventName(ev.Get("Event-Name"))
+}
+
+// ClassifyEventName returns the class of events with the given name.
+func ClassifyEventName(name string) EventClass {
+	if c, ok := eventClasses[name]; ok {
+		return c
+	}
+	if strings.HasPrefix(name, "CHANNEL_") {
+		return EventClassChannel
+	}
+	return EventClassOther
+}
+
+// IsChannelEvent reports whether an event is about a channel, like
+// CHANNEL_ANSWER or DTMF, and carries its Unique-ID and data.
+func IsChannelEvent(ev *Event) bool {
+	return ClassifyEvent(ev) == EventClassChannel
+}
@@ -18,55 +18,166 @@ package eventsocket
 import (
 	"bufio"
 	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
-	"net/textproto"
-	"net/url"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const bufferSize = 1024 << 6 // For the socket reader
-const eventsBuffer = 16      // For the events channel (memory eater!)
-const timeoutPeriod = 60 * time.Second
+
+// timeoutPeriod is how long commands wait for their reply. It's a variable
+// so tests can shorten it.
+var timeoutPeriod = 60 * time.Second
 
 var errMissingAuthRequest = errors.New("Missing auth request")
 var errInvalidPassword = errors.New("Invalid password")
 var errInvalidCommand = errors.New("Invalid command contains \\r or \\n")
 var errTimeout = errors.New("Timeout")
+var errClosed = errors.New("Connection closed")
+var errInvalidArgument = errors.New("Invalid argument")
+var errMalformedHeader = errors.New("Malformed event header")
+var errContentLength = errors.New("Content-Length doesn't match the data")
+var errUnexpectedEvent = errors.New("Unexpected event")
+var errJobPending = errors.New("Job still running")
+
+// ErrNoSuchChannel is returned by commands that refer to a channel that
+// doesn't exist (anymore).
+var ErrNoSuchChannel = errors.New("No such channel")
+
+// ErrMissingHeader is returned by the typed Event getters when the
+// requested header doesn't exist.
+var ErrMissingHeader = errors.New("Missing header")
 
 // Connection is the event socket connection handler.
+//
+// Commands may be sent from multiple goroutines at the same time, each
+// caller gets its own reply.
 type Connection struct {
-	conn          net.Conn
-	reader        *bufio.Reader
-	textreader    *textproto.Reader
-	err           chan error
-	cmd, api, evt chan *Event
+	conn       net.Conn
+	reader     *bufio.Reader
+	frame      frameHeader // Of the message being read, reused
+	evt        *eventQueue
+	urgent     *eventQueue   // Priority lane, shares the wake of evt
+	wmu        sync.Mutex    // Serializes writes to conn
+	pmu        sync.Mutex    // Guards pending
+	pending    []*waiter     // Callers waiting for replies, in order
+	done       chan struct{} // Closed when the connection terminates
+	err        error         // Why it terminated, set before done is closed
+	closeOnce  sync.Once
+	sampler    sampler
+	omu        sync.Mutex                // Guards observers
+	observers  map[int]func(*Event) bool // Called for every event received
+	observerID int                       // Last observer registered
+
+	lazyVariables atomic.Bool // See LazyVariables
+	poolEvents    atomic.Bool // See PoolEvents
+	subsOnce      sync.Once
+	subs          *Subscriptions
+	dmu           sync.Mutex   // Guards data
+	data          *ChannelData // See Connect
+	ctx           context.Context
+	cancel        context.CancelFunc                // Cancels ctx, see Context
+	metrics       atomic.Pointer[Metrics]           // See SetMetrics
+	logger        atomic.Pointer[Logger]            // See SetLogger
+	tracer        atomic.Pointer[tracer]            // See Trace
+	recorder      atomic.Pointer[recorder]          // See Record
+	priority      atomic.Pointer[map[string]bool]   // See PriorityEvents
+	onGap         atomic.Pointer[func(SequenceGap)] // See OnSequenceGap
+	dedup         atomic.Pointer[Deduplicator]      // See Deduplicate
+	readAt        atomic.Int64                      // When data was last read, in ns
+	idle          atomic.Int64                      // See IdleTimeout
+	closing       atomic.Bool                       // See Shutdown
+	state         atomic.Int32                      // See State
+	smu           sync.Mutex                        // Guards stateFuncs, serializes state changes
+	stateFuncs    map[int]func(from, to State)      // See OnStateChange
+	stateID       int                               // Last callback registered
+	kmu           sync.Mutex                        // Guards kstop
+	kstop         chan struct{}                     // Stops KeepAlive
+	sequence      uint64                            // Of the last event, see OnSequenceGap
+	boundary      atomic.Bool                       // Next read starts a message
+	noRecover     bool                              // See Server.NoRecover
+	others        atomic.Pointer[eventRoute]        // See RouteOtherChannels
+	diverted      atomic.Pointer[eventRoute]        // See RouteDivertedEvents
+	cmu           sync.Mutex                        // Serializes changes to custom
+	custom        atomic.Pointer[customRoutes]      // See SubscribeCustom
+}
+
+// EventSocket is the interface of Connection, for code that only sends
+// commands and reads events, so it can be tested with fakes instead of a
+// live socket.
+type EventSocket interface {
+	Send(command string) (*Event, error)
+	SendMsg(m MSG, uuid, appData string) (*Event, error)
+	Execute(appName, appArg string, lock bool) (*Event, error)
+	ExecuteUUID(uuid, appName, appArg string) (*Event, error)
+	ReadEvent() (*Event, error)
+	Close()
+	RemoteAddr() net.Addr
+}
+
+var _ EventSocket = (*Connection)(nil)
+
+// reply is the response to a command, handed by the read loop to the
+// caller waiting for it.
+type reply struct {
+	ev     *Event
+	err    error
+	stream *apiStream // Body of api responses, see ApiStream
+}
+
+// waiter is a caller waiting for the reply to its command.
+type waiter struct {
+	ch     chan *reply // Buffered, so delivering never blocks
+	stream bool        // Whether the body must be streamed
 }
 
 // newConnection allocates a new Connection and initialize its buffers.
 func newConnection(c net.Conn) *Connection {
 	h := Connection{
-		conn:   c,
-		reader: bufio.NewReaderSize(c, bufferSize),
-		err:    make(chan error, 1),
-		cmd:    make(chan *Event),
-		api:    make(chan *Event),
-		evt:    make(chan *Event, eventsBuffer),
-	}
-	h.textreader = textproto.NewReader(h.reader)
+		evt:  newEventQueue(),
+		done: make(chan struct{}),
+	}
+	h.urgent = &eventQueue{wake: h.evt.wake}
+	h.conn = wireConn{c, &h}
+	h.readAt.Store(time.Now().UnixNano())
+	h.reader = bufio.NewReaderSize(h.conn, bufferSize)
+	h.ctx, h.cancel = context.WithCancel(context.Background())
 	return &h
 }
 
 // HandleFunc is the function called on new incoming connections.
 type HandleFunc func(*Connection)
 
+// ServeConn implements Handler, calling f. It never fails.
+func (f HandleFunc) ServeConn(c *Connection) error {
+	f(c)
+	return nil
+}
+
+// Handler handles new incoming connections, see Server. ServeConn returns
+// why handling the call failed, if it did, for Server.ErrorHandler.
+type Handler interface {
+	ServeConn(c *Connection) error
+}
+
+// HandlerFunc is a function that implements Handler.
+type HandlerFunc func(*Connection) error
+
+// ServeConn implements Handler, calling f.
+func (f HandlerFunc) ServeConn(c *Connection) error {
+	return f(c)
+}
+
 // ListenAndServe listens for incoming connections from FreeSWITCH and calls
 // HandleFunc in a new goroutine for each client.
 //
@@ -87,20 +198,10 @@ type HandleFunc func(*Connection)
 //		}
 //	}
 //
+// See Server for more settings.
 func ListenAndServe(addr string, fn HandleFunc) error {
-	srv, err := net.Listen("tcp", addr)
-	if err != nil {
-		return err
-	}
-	for {
-		c, err := srv.Accept()
-		if err != nil {
-			return err
-		}
-		h := newConnection(c)
-		go h.readLoop()
-		go fn(h)
-	}
+	s := &Server{Addr: addr, Handler: fn}
+	return s.ListenAndServe()
 }
 
 // Dial attemps to connect to FreeSWITCH and authenticate.
@@ -114,135 +215,207 @@ func ListenAndServe(addr string, fn HandleFunc) error {
 //		ev.PrettyPrint()
 //		...
 //	}
-//
 func Dial(addr, passwd string) (*Connection, error) {
 	c, err := net.Dial("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
 	h := newConnection(c)
-	m, err := h.textreader.ReadMIMEHeader()
-	if err != nil {
+	h.setState(StateAuthenticating)
+	if err := readFrameHeader(h.reader, &h.frame); err != nil {
 		c.Close()
 		return nil, err
 	}
-	if m.Get("Content-Type") != "auth/request" {
+	if h.frame.contentType != "auth/request" {
 		c.Close()
 		return nil, errMissingAuthRequest
 	}
 	fmt.Fprintf(c, "auth %s\r\n\r\n", passwd)
-	m, err = h.textreader.ReadMIMEHeader()
-	if err != nil {
+	if err := readFrameHeader(h.reader, &h.frame); err != nil {
 		c.Close()
 		return nil, err
 	}
-	if m.Get("Reply-Text") != "+OK accepted" {
+	if h.frame.get("Reply-Text") != "+OK accepted" {
 		c.Close()
 		return nil, errInvalidPassword
 	}
+	h.setState(StateReady)
 	go h.readLoop()
 	return h, err
 }
 
 // readLoop calls readOne until a fatal error occurs, then close the socket.
 func (h *Connection) readLoop() {
-	for h.readOne() {
+	if !h.noRecover {
+		defer h.recoverPanic("read loop")
+	}
+	for {
+		if err := h.readOne(); err != nil {
+			switch {
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				err = ErrIdleTimeout
+			case err == io.EOF && h.closing.Load():
+				err = errClosed // See Shutdown
+			}
+			h.terminate(err)
+			return
+		}
 	}
-	h.Close()
 }
 
 // readOne reads a single event and send over the appropriate channel.
 // It separates incoming events from api and command responses.
-func (h *Connection) readOne() bool {
-	hdr, err := h.textreader.ReadMIMEHeader()
-	if err != nil {
-		h.err <- err
-		return false
+//
+// Replies are handed to the oldest caller waiting for one, and never block
+// the loop. Errors returned by readOne are fatal.
+func (h *Connection) readOne() error {
+	h.recordBoundary()
+	fh := &h.frame
+	if err := readFrameHeader(h.reader, fh); err != nil {
+		return err
 	}
-	resp := new(Event)
-	resp.Header = make(EventHeader)
-	if v := hdr.Get("Content-Length"); v != "" {
-		length, err := strconv.Atoi(v)
+	ct := fh.contentType
+	if ct == "api/response" && h.streaming() {
+		return h.readStream(fh.length)
+	}
+	var body []byte
+	if fh.length > 0 {
+		buf, err := readBody(h.reader, fh.length)
 		if err != nil {
-			h.err <- err
-			return false
-		}
-		b := make([]byte, length)
-		if _, err := io.ReadFull(h.reader, b); err != nil {
-			h.err <- err
-			return false
+			return err
 		}
-		resp.Body = string(b)
+		defer putBody(buf)
+		body = *buf
 	}
-	switch hdr.Get("Content-Type") {
+	switch ct {
 	case "command/reply":
-		reply := hdr.Get("Reply-Text")
-		if len(reply)>1 && reply[:2] == "-E" {
-			h.err <- errors.New(reply[5:])
-			return true
-		}
-		if reply[0] == '%' {
-			copyHeaders(&hdr, resp, true)
-		} else {
-			copyHeaders(&hdr, resp, false)
+		if text := fh.get("Reply-Text"); strings.HasPrefix(text, "-E") {
+			h.deliver(&reply{err: replyError(text)})
+			return nil
 		}
-		h.cmd <- resp
 	case "api/response":
-		if len(resp.Body)>1 && string(resp.Body[:2]) == "-E" {
-			h.err <- errors.New(string(resp.Body)[5:])
-			return true
-		}
-		copyHeaders(&hdr, resp, false)
-		h.api <- resp
-	case "text/event-plain":
-		reader := bufio.NewReader(bytes.NewReader([]byte(resp.Body)))
-		resp.Body = ""
-		textreader := textproto.NewReader(reader)
-		hdr, err = textreader.ReadMIMEHeader()
-		if err != nil {
-			h.err <- err
-			return false
-		}
-		if v := hdr.Get("Content-Length"); v != "" {
-			length, err := strconv.Atoi(v)
-			if err != nil {
-				h.err <- err
-				return false
-			}
-			b := make([]byte, length)
-			if _, err = io.ReadFull(reader, b); err != nil {
-				h.err <- err
-				return false
-			}
-			resp.Body = string(b)
-		}
-		copyHeaders(&hdr, resp, true)
-		h.evt <- resp
-	case "text/event-json":
-		tmp := make(EventHeader)
-		err := json.Unmarshal([]byte(resp.Body), &tmp)
-		if err != nil {
-			h.err <- err
-			return false
+		if bytes.HasPrefix(body, []byte("-E")) {
+			h.deliver(&reply{err: replyError(string(body))})
+			return nil
 		}
-		// capitalize header keys for consistency.
-		for k, v := range tmp {
-			resp.Header[capitalize(k)] = v
+	}
+	ev, err := parseMessage(fh, body, h.lazyVariables.Load(), h.poolEvents.Load())
+	if err == errUnsupportedContent {
+		// Discarded, the body was read already.
+		h.log().Errorf("eventsocket: unsupported content type %q from %s",
+			ct, h.conn.RemoteAddr())
+		return nil
+	} else if err != nil {
+		return err
+	}
+	switch ct {
+	case "command/reply", "api/response":
+		h.deliver(&reply{ev: ev})
+	default:
+		h.dispatch(ev)
+	}
+	return nil
+}
+
+// replyError converts "-ERR reason" replies into errors.
+func replyError(reply string) error {
+	reply = strings.TrimSpace(strings.TrimPrefix(reply, "-ERR"))
+	if strings.Contains(strings.ToLower(reply), "no such channel") {
+		return ErrNoSuchChannel
+	}
+	return errors.New(reply)
+}
+
+// deliver hands a reply to the oldest caller waiting for one. Replies to
+// callers that gave up waiting are discarded.
+func (h *Connection) deliver(r *reply) {
+	h.pmu.Lock()
+	if len(h.pending) == 0 {
+		h.pmu.Unlock()
+		h.log().Errorf("eventsocket: discarded reply from %s, no command is waiting",
+			h.conn.RemoteAddr())
+		return
+	}
+	w := h.pending[0]
+	h.pending = h.pending[1:]
+	h.pmu.Unlock()
+	w.ch <- r // buffered, never blocks
+}
+
+// dispatch queues an event for ReadEvent. It never blocks.
+func (h *Connection) dispatch(ev *Event) {
+	m := h.stats()
+	if m != nil {
+		m.EventReceived(eventName(ev))
+	}
+	h.checkSequence(ev)
+	h.checkHangup(ev)
+	h.notify(ev)
+	if d := h.dedup.Load(); (d != nil && d.Duplicate(ev)) || !h.sampler.keep(ev) {
+		if m != nil {
+			m.EventDropped(eventName(ev))
 		}
-		if v, _ := resp.Header["_body"]; v != nil {
-			resp.Body = v.(string)
-			delete(resp.Header, "_body")
-		} else {
-			resp.Body = ""
+		ev.Release()
+		return
+	}
+	if h.routeEvent(ev) {
+		return
+	}
+	if h.urgentEvent(ev) {
+		h.urgent.push(ev)
+		return
+	}
+	h.evt.push(ev)
+}
+
+// observe registers fn to be called by the read loop for every event
+// received, before it's queued for ReadEvent, and returns a function that
+// unregisters it. It's used to correlate commands with the events they
+// generate without taking events away from ReadEvent.
+//
+// fn must not block, nor register or unregister observers. It's
+// unregistered once it returns true.
+func (h *Connection) observe(fn func(*Event) bool) (cancel func()) {
+	h.omu.Lock()
+	defer h.omu.Unlock()
+	if h.observers == nil {
+		h.observers = make(map[int]func(*Event) bool)
+	}
+	h.observerID++
+	id := h.observerID
+	h.observers[id] = fn
+	return func() {
+		h.omu.Lock()
+		delete(h.observers, id)
+		h.omu.Unlock()
+	}
+}
+
+// notify calls the observers of the connection.
+func (h *Connection) notify(ev *Event) {
+	h.omu.Lock()
+	defer h.omu.Unlock()
+	for id, fn := range h.observers {
+		if fn(ev) {
+			delete(h.observers, id)
 		}
-		h.evt <- resp
-	case "text/disconnect-notice":
-		copyHeaders(&hdr, resp, false)
-		h.evt <- resp
-	default:
-		log.Fatal("Unsupported event:", hdr)
 	}
-	return true
+}
+
+// terminate records why the connection is going away, wakes up everyone
+// waiting on it and closes the socket. Only the first call has any effect.
+func (h *Connection) terminate(err error) {
+	h.closeOnce.Do(func() {
+		h.log().Infof("eventsocket: connection to %s terminated: %v",
+			h.conn.RemoteAddr(), err)
+		h.err = err
+		defer func() { // Even if a callback of OnStateChange panics
+			close(h.done)
+			h.conn.Close()
+			h.cancel()
+		}()
+		h.setState(StateClosed)
+	})
 }
 
 // RemoteAddr returns the remote addr of the connection.
@@ -252,7 +425,7 @@ func (h *Connection) RemoteAddr() net.Addr {
 
 // Close terminates the connection.
 func (h *Connection) Close() {
-	h.conn.Close()
+	h.terminate(errClosed)
 }
 
 // ReadEvent reads and returns events from the server. It supports both plain
@@ -261,64 +434,144 @@ func (h *Connection) Close() {
 // When subscribing to events (e.g. `Send("events json ALL")`) it makes no
 // difference to use plain or json. ReadEvent will parse them and return
 // all headers and the body (if any) in an Event struct.
+//
+// Events received before the connection terminated are still returned,
+// after that ReadEvent returns the error that terminated the connection.
+//
+// Events of the types given to PriorityEvents are returned before any
+// others waiting.
 func (h *Connection) ReadEvent() (*Event, error) {
-	var (
-		ev  *Event
-		err error
-	)
-	select {
-	case err = <-h.err:
-		return nil, err
-	case ev = <-h.evt:
-		return ev, nil
+	for {
+		if ev, ok := h.nextEvent(); ok {
+			return ev, nil
+		}
+		select {
+		case <-h.evt.wake:
+		case <-h.done:
+			if ev, ok := h.nextEvent(); ok {
+				return ev, nil
+			}
+			return nil, h.err
+		}
+	}
+}
+
+// nextEvent pops the next event for ReadEvent, from the priority lane
+// first.
+func (h *Connection) nextEvent() (*Event, bool) {
+	if ev, ok := h.urgent.pop(); ok {
+		return ev, true
+	}
+	return h.evt.pop()
+}
+
+// newUUID returns a random (version 4) UUID, used to correlate commands
+// with the events they generate.
+func newUUID() string {
+	var b [16]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		panic(err)
 	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
 }
 
-// copyHeaders copies all keys and values from the MIMEHeader to Event.Header,
-// normalizing header keys to their capitalized version and values by
-// unescaping them when decode is set to true.
+// parsePlain parses the headers and body of a text/event-plain event into
+// ev. Header names are capitalized and values unescaped, but the names sent
+// by FreeSWITCH are kept as well.
 //
-// It's used after parsing plain text event headers, but not JSON.
-func copyHeaders(src *textproto.MIMEHeader, dst *Event, decode bool) {
-	var err error
-	for k, v := range *src {
-		k = capitalize(k)
-		if decode {
-			dst.Header[k], err = url.QueryUnescape(v[0])
-			if err != nil {
-				dst.Header[k] = v[0]
-			}
+// When lazy is set, channel variables are only decoded on first access.
+func parsePlain(b []byte, ev *Event, lazy bool) error {
+	var deferred []byte
+	for len(b) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line, b = b[:i], b[i+1:]
 		} else {
-			dst.Header[k] = v[0]
+			line, b = b, nil
+		}
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			break
+		}
+		if lazy && bytes.HasPrefix(line, variablePrefix) {
+			if bytes.IndexByte(line, ':') < 0 {
+				return errMalformedHeader
+			}
+			deferred = append(deferred, line...)
+			deferred = append(deferred, '\n')
+			continue
+		}
+		if err := ev.parseHeader(line); err != nil {
+			return err
+		}
+	}
+	if deferred != nil {
+		ev.lazy = &lazyHeaders{raw: deferred}
+	}
+	// Not using Get, which would decode the deferred headers.
+	if v, _ := ev.Header["Content-Length"].(string); v != "" {
+		length, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		if length > len(b) {
+			return io.ErrUnexpectedEOF
 		}
+		ev.Body = string(b[:length])
+	}
+	return nil
+}
+
+// parseHeader parses a single "Name: value" header line of a plain event.
+func (r *Event) parseHeader(line []byte) error {
+	i := bytes.IndexByte(line, ':')
+	if i <= 0 {
+		return errMalformedHeader
 	}
+	value := unescape(bytes.TrimLeft(line[i+1:], " \t"))
+	r.addHeader(headerName(line[:i]), value)
+	return nil
 }
 
 // capitalize capitalizes strings in a very particular manner.
 // Headers such as Job-UUID become Job-Uuid and so on. Headers starting with
 // Variable_ only replace ^v with V, and headers staring with _ are ignored.
 func capitalize(s string) string {
-	if s[0] == '_' {
+	if s == "" || s[0] == '_' {
 		return s
 	}
-	ns := bytes.ToLower([]byte(s))
-	if len(s) > 9 && s[1:9] == "ariable_" {
-		ns[0] = 'V'
-		return string(ns)
-	}
+	variable := len(s) > 9 && s[1:9] == "ariable_"
 	toUpper := true
-	for n, c := range ns {
+	var ns strings.Builder // Only used once the result differs from s
+	differs := false
+	for n := 0; n < len(s); n++ {
+		c := s[n]
 		if toUpper {
 			if 'a' <= c && c <= 'z' {
 				c -= 'a' - 'A'
 			}
-			ns[n] = c
 			toUpper = false
-		} else if c == '-' || c == '_' {
-			toUpper = true
+		} else {
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			toUpper = !variable && (c == '-' || c == '_')
+		}
+		if c != s[n] && !differs {
+			differs = true
+			ns.Grow(len(s))
+			ns.WriteString(s[:n])
+		}
+		if differs {
+			ns.WriteByte(c)
 		}
 	}
-	return string(ns)
+	if !differs {
+		return s
+	}
+	return ns.String()
 }
 
 // Send sends a single command to the server and returns a response Event.
@@ -330,23 +583,94 @@ func (h *Connection) Send(command string) (*Event, error) {
 	//if strings.IndexAny(command, "\r\n") > 0 {
 	//	return nil, errInvalidCommand
 	//}
-	fmt.Fprintf(h.conn, "%s\r\n\r\n", command)
-	var (
-		ev  *Event
-		err error
-	)
-	select {
-	case err = <-h.err:
+	return h.do([]byte(command + "\r\n\r\n"))
+}
+
+// API runs an api command, e.g. status, and returns its output, without
+// the trailing new line. Error responses, like -ERR and -USAGE, are
+// returned as errors.
+func (h *Connection) API(command string) (string, error) {
+	return h.api(command)
+}
+
+// api sends an api command and returns the body of the response, without
+// the trailing new line. Error responses are returned as errors.
+func (h *Connection) api(command string) (string, error) {
+	ev, err := h.Send("api " + command)
+	if err != nil {
+		return "", err
+	}
+	body := strings.TrimSpace(ev.Body)
+	if strings.HasPrefix(body, "-") {
+		// e.g. -USAGE, since -ERR is handled by readOne.
+		return "", replyError(body)
+	}
+	return body, nil
+}
+
+// validArg reports whether s can be safely used as a single argument of a
+// command, e.g. a channel UUID.
+func validArg(s string) bool {
+	return s != "" && strings.IndexAny(s, " \t\r\n") < 0
+}
+
+// do writes a command to the server and waits for its reply.
+func (h *Connection) do(cmd []byte) (ev *Event, err error) {
+	if m := h.stats(); m != nil {
+		defer func(start time.Time) {
+			m.CommandSent(commandName(cmd), time.Since(start), err)
+		}(time.Now())
+	}
+	ch, err := h.write(cmd, false)
+	if err != nil {
 		return nil, err
-	case ev = <-h.cmd:
-		return ev, nil
-	case ev = <-h.api:
-		return ev, nil
-	case <-time.After(timeoutPeriod):
+	}
+	h.log().Debugf("eventsocket: sent %q to %s", commandName(cmd), h.conn.RemoteAddr())
+	timer := time.NewTimer(timeoutPeriod)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		return r.ev, r.err
+	case <-h.done:
+		select {
+		case r := <-ch:
+			return r.ev, r.err
+		default:
+			return nil, h.err
+		}
+	case <-timer.C:
+		h.log().Errorf("eventsocket: no reply to %q from %s in %s",
+			commandName(cmd), h.conn.RemoteAddr(), timeoutPeriod)
 		return nil, errTimeout
 	}
 }
 
+// write writes a command to the server and returns the channel its reply
+// will be delivered to.
+//
+// The caller is queued before the command is written, so replies, which
+// FreeSWITCH sends in order, can be matched to their callers.
+func (h *Connection) write(cmd []byte, stream bool) (chan *reply, error) {
+	w := &waiter{ch: make(chan *reply, 1), stream: stream}
+	h.wmu.Lock()
+	select {
+	case <-h.done:
+		h.wmu.Unlock()
+		return nil, h.err
+	default:
+	}
+	h.pmu.Lock()
+	h.pending = append(h.pending, w)
+	h.pmu.Unlock()
+	_, err := h.conn.Write(cmd)
+	h.wmu.Unlock()
+	if err != nil {
+		h.terminate(err)
+		return nil, err
+	}
+	return w.ch, nil
+}
+
 // MSG is the container used by SendMsg to store messages sent to FreeSWITCH.
 // It's supposed to be populated with directives supported by the sendmsg
 // command only, like "call-command: execute".
@@ -370,14 +694,15 @@ type MSG map[string]string
 //	}, "", "")
 //
 // Keys with empty values are ignored; uuid and appData are optional.
-// If appData is set, a "content-length" header is expected (lower case!).
+// If appData is set, the "content-length" header is calculated from it; a
+// content-length set in the MSG that doesn't match appData is an error.
 //
 // See http://wiki.freeswitch.org/wiki/Event_Socket#sendmsg for details.
 func (h *Connection) SendMsg(m MSG, uuid, appData string) (*Event, error) {
 	b := bytes.NewBufferString("sendmsg")
 	if uuid != "" {
 		// Make sure there's no \r or \n in the UUID.
-		if strings.IndexAny(uuid, "\r\n") > 0 {
+		if strings.IndexAny(uuid, "\r\n") >= 0 {
 			return nil, errInvalidCommand
 		}
 		b.WriteString(" " + uuid)
@@ -385,35 +710,29 @@ func (h *Connection) SendMsg(m MSG, uuid, appData string) (*Event, error) {
 	b.WriteString("\n")
 	for k, v := range m {
 		// Make sure there's no \r or \n in the key, and value.
-		if strings.IndexAny(k, "\r\n") > 0 {
+		if strings.IndexAny(k, "\r\n") >= 0 {
 			return nil, errInvalidCommand
 		}
+		if strings.EqualFold(k, "content-length") {
+			if v != "" && v != strconv.Itoa(len(appData)) {
+				return nil, errContentLength
+			}
+			continue
+		}
 		if v != "" {
-			if strings.IndexAny(v, "\r\n") > 0 {
+			if strings.IndexAny(v, "\r\n") >= 0 {
 				return nil, errInvalidCommand
 			}
 			b.WriteString(fmt.Sprintf("%s: %s\n", k, v))
 		}
 	}
-	b.WriteString("\n")
-	if m["content-length"] != "" && appData != "" {
+	if appData != "" {
+		fmt.Fprintf(b, "content-length: %d\n\n", len(appData))
 		b.WriteString(appData)
+	} else {
+		b.WriteString("\n")
 	}
-	if _, err := b.WriteTo(h.conn); err != nil {
-		return nil, err
-	}
-	var (
-		ev  *Event
-		err error
-	)
-	select {
-	case err = <-h.err:
-		return nil, err
-	case ev = <-h.cmd:
-		return ev, nil
-	case <-time.After(timeoutPeriod):
-		return nil, errTimeout
-	}
+	return h.do(b.Bytes())
 }
 
 // Execute is a shortcut to SendMsg with call-command: execute without UUID,
@@ -425,28 +744,55 @@ func (h *Connection) SendMsg(m MSG, uuid, appData string) (*Event, error) {
 //
 // See http://wiki.freeswitch.org/wiki/Event_Socket#execute for details.
 func (h *Connection) Execute(appName, appArg string, lock bool) (*Event, error) {
-	var evlock string
-	if lock {
-		// Could be strconv.FormatBool(lock), but we don't want to
-		// send event-lock when it's set to false.
-		evlock = "true"
-	}
-	return h.SendMsg(MSG{
-		"call-command":     "execute",
-		"execute-app-name": appName,
-		"execute-app-arg":  appArg,
-		"event-lock":       evlock,
-	}, "", "")
+	return h.ExecuteWith(appName, appArg, &ExecuteOptions{EventLock: lock})
 }
 
 // ExecuteUUID is similar to Execute, but takes a UUID and no lock. Suitable
 // for use on inbound event socket connections (acting as client).
 func (h *Connection) ExecuteUUID(uuid, appName, appArg string) (*Event, error) {
-	return h.SendMsg(MSG{
-		"call-command":     "execute",
-		"execute-app-name": appName,
-		"execute-app-arg":  appArg,
-	}, uuid, "")
+	return h.ExecuteWith(appName, appArg, &ExecuteOptions{UUID: uuid})
+}
+
+// SendEvent fires an event in FreeSWITCH using the sendevent command, and
+// returns the response Event.
+//
+// Example:
+//
+//	SendEvent("CUSTOM", map[string]string{
+//		"Event-Subclass": "myapp::alert",
+//		"Alert-Level":    "high",
+//	}, "disk is almost full")
+//
+// Header names and values can't contain \r or \n, the body can contain
+// anything. Events named CUSTOM must have an Event-Subclass header.
+//
+// See http://wiki.freeswitch.org/wiki/Event_Socket#sendevent for details.
+func (h *Connection) SendEvent(name string, headers map[string]string, body string) (*Event, error) {
+	if !validArg(name) {
+		return nil, errInvalidArgument
+	}
+	keys := make([]string, 0, len(headers))
+	for k, v := range headers {
+		if k == "" || strings.IndexAny(k, ":\r\n") >= 0 ||
+			strings.IndexAny(v, "\r\n") >= 0 {
+			return nil, errInvalidCommand
+		}
+		if strings.EqualFold(k, "content-length") {
+			continue // Always calculated from body
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b := bytes.NewBufferString("sendevent " + name + "\n")
+	for _, k := range keys {
+		b.WriteString(k + ": " + headers[k] + "\n")
+	}
+	if body != "" {
+		fmt.Fprintf(b, "content-length: %d\n\n%s", len(body), body)
+	} else {
+		b.WriteString("\n")
+	}
+	return h.do(b.Bytes())
 }
 
 // EventHeader represents events as a pair of key:value.
@@ -456,9 +802,70 @@ type EventHeader map[string]interface{}
 type Event struct {
 	Header EventHeader // Event headers, key:val
 	Body   string      // Raw body, available in some events
+
+	names map[string]string // Header key:name as sent by FreeSWITCH
+	order []string          // Header keys in the order received
+	lazy  *lazyHeaders      // Headers not decoded yet
+
+	pooled bool  // Leased from eventPool, see PoolEvents
+	refs   int32 // References to a pooled event, see Release
+}
+
+// addHeader adds a header received from FreeSWITCH under its capitalized
+// key, and remembers the original name. The first of repeated headers wins.
+func (r *Event) addHeader(name string, value interface{}) {
+	key := headerKey(name)
+	if _, exists := r.Header[key]; exists {
+		return
+	}
+	r.Header[key] = value
+	r.order = append(r.order, key)
+	if !hasDefaultName(key, name) {
+		if r.names == nil {
+			r.names = make(map[string]string)
+		}
+		r.names[key] = name
+	}
+}
+
+// Keys returns the header keys of the event in the order FreeSWITCH sent
+// them, followed by the keys added to the Header map, sorted. It's the
+// order used by MarshalPlain, MarshalJSON and PrettyPrint.
+func (r *Event) Keys() []string {
+	r.load()
+	keys := make([]string, 0, len(r.Header))
+	for _, k := range r.order {
+		if _, ok := r.Header[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == len(r.Header) {
+		return keys
+	}
+	known := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		known[k] = true
+	}
+	n := len(keys)
+	for k := range r.Header {
+		if !known[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys[n:])
+	return keys
+}
+
+// name returns the name of a header as sent by FreeSWITCH.
+func (r *Event) name(key string) string {
+	if name, ok := r.names[key]; ok {
+		return name
+	}
+	return defaultName(key)
 }
 
 func (r *Event) String() string {
+	r.load()
 	if r.Body == "" {
 		return fmt.Sprintf("%s", r.Header)
 	} else {
@@ -468,34 +875,143 @@ func (r *Event) String() string {
 
 // Get returns an Event value, or "" if the key doesn't exist.
 func (r *Event) Get(key string) string {
+	v, _ := r.GetOk(key)
+	return v
+}
+
+// GetOk returns an Event value and whether the key exists. Values that
+// are not plain strings, like arrays in JSON events, are joined with ", ".
+func (r *Event) GetOk(key string) (string, bool) {
+	r.load()
 	val, ok := r.Header[key]
 	if !ok || val == nil {
-		return ""
+		return "", false
 	}
-	if s, ok := val.([]string); ok {
-		return strings.Join(s, ", ")
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case []string:
+		return strings.Join(v, ", "), true
+	case []interface{}:
+		s := make([]string, len(v))
+		for n, item := range v {
+			s[n] = fmt.Sprint(item)
+		}
+		return strings.Join(s, ", "), true
+	default:
+		return fmt.Sprint(v), true
 	}
-	return val.(string)
+}
+
+// Variable returns the value of a channel variable, or "" if it's not set.
+//
+// Channel variables are sent by FreeSWITCH as variable_<name> headers,
+// which are stored as Variable_<name> in both plain and json events.
+// Variable takes care of that, e.g. Variable("sip_from_user") returns the
+// value of the variable_sip_from_user header.
+func (r *Event) Variable(name string) string {
+	v, _ := r.VariableOk(name)
+	return v
+}
+
+// VariableOk returns the value of a channel variable and whether it's set.
+func (r *Event) VariableOk(name string) (string, bool) {
+	if v, ok := r.GetOk("Variable_" + strings.ToLower(name)); ok {
+		return v, true
+	}
+	// Events built by hand may not use the capitalized form.
+	return r.GetOk("variable_" + name)
+}
+
+// GetDefault returns an Event value, or def if the key doesn't exist.
+func (r *Event) GetDefault(key, def string) string {
+	if v, ok := r.GetOk(key); ok {
+		return v
+	}
+	return def
 }
 
 // GetInt returns an Event value converted to int, or an error if conversion
 // is not possible.
 func (r *Event) GetInt(key string) (int, error) {
-	n, err := strconv.Atoi(r.Header[key].(string))
+	v, ok := r.GetOk(key)
+	if !ok {
+		return 0, ErrMissingHeader
+	}
+	n, err := strconv.Atoi(v)
 	if err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
+// GetBool returns an Event value converted to bool. Besides the values
+// accepted by strconv.ParseBool, it understands FreeSWITCH's yes/no and
+// on/off.
+func (r *Event) GetBool(key string) (bool, error) {
+	v, ok := r.GetOk(key)
+	if !ok {
+		return false, ErrMissingHeader
+	}
+	switch strings.ToLower(v) {
+	case "yes", "on", "enabled":
+		return true, nil
+	case "no", "off", "disabled":
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// GetFloat returns an Event value converted to float64.
+func (r *Event) GetFloat(key string) (float64, error) {
+	v, ok := r.GetOk(key)
+	if !ok {
+		return 0, ErrMissingHeader
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// GetDuration returns an Event value converted to time.Duration. Integer
+// values are multiplied by unit, e.g. GetDuration("Variable_billsec",
+// time.Second). Anything else is parsed by time.ParseDuration.
+func (r *Event) GetDuration(key string, unit time.Duration) (time.Duration, error) {
+	v, ok := r.GetOk(key)
+	if !ok {
+		return 0, ErrMissingHeader
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Duration(n) * unit, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// GetTime returns an Event value converted to time.Time.
+//
+// Integer values are taken as microseconds since the epoch, which is what
+// FreeSWITCH uses in headers like Event-Date-Timestamp and
+// Caller-Channel-Created-Time. A value of 0 means the time is not set and
+// returns the zero Time. Event-Date-GMT and Event-Date-Local style dates
+// are also supported.
+func (r *Event) GetTime(key string) (time.Time, error) {
+	v, ok := r.GetOk(key)
+	if !ok {
+		return time.Time{}, ErrMissingHeader
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if n == 0 {
+			return time.Time{}, nil
+		}
+		return time.Unix(n/1e6, (n%1e6)*1e3), nil
+	}
+	if t, err := time.Parse(time.RFC1123, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02 15:04:05", v, time.Local)
+}
+
 // PrettyPrint prints Event headers and body to the standard output.
 func (r *Event) PrettyPrint() {
-	var keys []string
-	for k := range r.Header {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	for _, k := range keys {
+	for _, k := range r.Keys() {
 		fmt.Printf("%s: %#v\n", k, r.Header[k])
 	}
 	if r.Body != "" {
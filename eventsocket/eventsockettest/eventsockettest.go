@@ -0,0 +1,555 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package eventsockettest provides a fake FreeSWITCH for testing code built
+// on the eventsocket package, without a real FreeSWITCH.
+//
+// The Server speaks the event socket protocol: it authenticates clients,
+// takes event subscriptions, and replies to api, bgapi, sendmsg, filter and
+// the other commands. Tests script the replies and inject events.
+//
+// Example:
+//
+//	func TestStatus(t *testing.T) {
+//		s := eventsockettest.NewServer()
+//		defer s.Close()
+//		s.HandleAPI("status", func(args string) string {
+//			return "UP 0 years, 0 days, 1 hour\n"
+//		})
+//		c, err := eventsocket.Dial(s.Addr, s.Password)
+//		...
+//		c.Send("events plain CHANNEL_ANSWER")
+//		s.Inject(&eventsocket.Event{Header: eventsocket.EventHeader{
+//			"Event-Name": "CHANNEL_ANSWER",
+//			"Unique-ID":  "4a5e...",
+//		}})
+//		ev, err := c.ReadEvent()
+//		...
+//	}
+package eventsockettest
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+)
+
+// DefaultPassword is the password of new servers, same as FreeSWITCH's.
+const DefaultPassword = "ClueCon"
+
+// Command is a command received from a client.
+type Command struct {
+	Name   string               // e.g. api, bgapi, sendmsg, events
+	Args   string               // Rest of the first line, e.g. status
+	Header textproto.MIMEHeader // Following lines, e.g. of sendmsg
+	Body   string               // e.g. the application arguments of sendmsg
+}
+
+// String returns the first line of the command, e.g. api status.
+func (c *Command) String() string {
+	if c.Args == "" {
+		return c.Name
+	}
+	return c.Name + " " + c.Args
+}
+
+// APIFunc returns the result of an api command, given its arguments.
+type APIFunc func(args string) string
+
+// MsgFunc returns the reply to a sendmsg command, e.g. +OK, received on
+// a connection.
+type MsgFunc func(c *Conn, cmd *Command) string
+
+// Server is a fake FreeSWITCH accepting event socket connections on a
+// local port, or connecting to outbound servers with Connect.
+type Server struct {
+	Addr     string // Address of the server, for eventsocket.Dial
+	Password string // Password of the server, DefaultPassword by default
+
+	l        net.Listener
+	mu       sync.Mutex
+	conns    map[*Conn]bool
+	api      map[string]APIFunc
+	msg      MsgFunc
+	received []*Command
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a Server on a random local port. It panics if it can't
+// listen, like httptest.NewServer.
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("eventsockettest: failed to listen: %v", err))
+	}
+	s := &Server{
+		Addr:     l.Addr().String(),
+		Password: DefaultPassword,
+		l:        l,
+		conns:    make(map[*Conn]bool),
+		api:      make(map[string]APIFunc),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Close stops the server and closes all its connections.
+func (s *Server) Close() {
+	s.l.Close()
+	for _, c := range s.Conns() {
+		c.Close()
+	}
+	s.wg.Wait()
+}
+
+// HandleAPI sets the function that returns the result of an api command,
+// e.g. status, for both api and bgapi. Commands without a function reply
+// -ERR <name> Command not found!
+func (s *Server) HandleAPI(name string, fn APIFunc) {
+	s.mu.Lock()
+	s.api[name] = fn
+	s.mu.Unlock()
+}
+
+// HandleMsg sets the function that replies to sendmsg commands. By default
+// they get +OK, and execute commands are followed by the CHANNEL_EXECUTE
+// and CHANNEL_EXECUTE_COMPLETE events of the application, to the
+// connections subscribed to them.
+func (s *Server) HandleMsg(fn MsgFunc) {
+	s.mu.Lock()
+	s.msg = fn
+	s.mu.Unlock()
+}
+
+// Received returns the commands received from all connections, in order,
+// except auth.
+func (s *Server) Received() []*Command {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Command(nil), s.received...)
+}
+
+// Conns returns the open connections.
+func (s *Server) Conns() []*Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*Conn, 0, len(s.conns))
+	for c := range s.conns {
+		list = append(list, c)
+	}
+	return list
+}
+
+// Inject sends an event to all connections subscribed to it.
+func (s *Server) Inject(ev *eventsocket.Event) {
+	for _, c := range s.Conns() {
+		c.Send(ev)
+	}
+}
+
+// Connect connects to an outbound event socket server at addr, as
+// FreeSWITCH does when the socket application is executed, with the given
+// channel data, which is sent in reply to the connect command. A
+// Unique-ID is generated if not given.
+func (s *Server) Connect(addr string, channel map[string]string) (*Conn, error) {
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]string{
+		"Event-Name":    "CHANNEL_DATA",
+		"Channel-State": "CS_EXECUTE",
+	}
+	for k, v := range channel {
+		data[k] = v
+	}
+	if data["Unique-ID"] == "" {
+		data["Unique-ID"] = newUUID()
+	}
+	c := s.add(nc)
+	c.channel = data
+	go c.serve(false)
+	return c, nil
+}
+
+// serve accepts connections until the listener is closed.
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.add(nc).serve(true)
+	}
+}
+
+// add registers a new connection.
+func (s *Server) add(nc net.Conn) *Conn {
+	c := &Conn{
+		s:      s,
+		conn:   nc,
+		r:      bufio.NewReader(nc),
+		w:      bufio.NewWriter(nc),
+		events: make(map[string]bool),
+	}
+	s.mu.Lock()
+	s.conns[c] = true
+	s.mu.Unlock()
+	s.wg.Add(1)
+	return c
+}
+
+// Conn is a connection of the Server with a client.
+type Conn struct {
+	s       *Server
+	conn    net.Conn
+	r       *bufio.Reader
+	wmu     sync.Mutex // Guards w
+	w       *bufio.Writer
+	mu      sync.Mutex // Guards the subscriptions
+	format  string     // plain or json
+	all     bool
+	events  map[string]bool   // Event names and subclasses subscribed
+	channel map[string]string // Channel data of outbound connections
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Disconnect sends a disconnect notice, like FreeSWITCH does when the
+// channel of an outbound connection hangs up, and closes the connection.
+func (c *Conn) Disconnect() error {
+	body := "Disconnected, goodbye.\nSee you at ClueCon! http://www.cluecon.com/\n"
+	c.write("Content-Type: text/disconnect-notice\nContent-Length: %d\n\n%s", len(body), body)
+	return c.Close()
+}
+
+// Subscribed reports whether the client subscribed to an event, by name,
+// or by subclass for CUSTOM events.
+func (c *Conn) Subscribed(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.all || c.events[name]
+}
+
+// Send sends an event to the client, if it's subscribed to it, in the
+// format it subscribed with.
+func (c *Conn) Send(ev *eventsocket.Event) error {
+	name := ev.Get("Event-Name")
+	if name == "CUSTOM" {
+		name = ev.Get("Event-Subclass")
+	}
+	if !c.Subscribed(name) {
+		return nil
+	}
+	return c.SendAlways(ev)
+}
+
+// SendAlways sends an event to the client, even if it's not subscribed
+// to it.
+func (c *Conn) SendAlways(ev *eventsocket.Event) error {
+	c.mu.Lock()
+	format := c.format
+	c.mu.Unlock()
+	if format == "json" {
+		b, err := ev.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		return c.write("Content-Length: %d\nContent-Type: text/event-json\n\n%s", len(b), b)
+	}
+	b, err := ev.MarshalPlain()
+	if err != nil {
+		return err
+	}
+	return c.write("%s", b)
+}
+
+// Write writes raw data to the client, e.g. to test malformed messages.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	n, err := c.w.Write(b)
+	if err == nil {
+		err = c.w.Flush()
+	}
+	return n, err
+}
+
+// Replay writes a recording made by eventsocket's Record to the client,
+// with the timing of eventsocket.Replay.
+func (c *Conn) Replay(r io.Reader, speed float64) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := eventsocket.Replay(c.w, r, speed); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// write writes a formatted message to the client.
+func (c *Conn) write(format string, v ...interface{}) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	fmt.Fprintf(c.w, format, v...)
+	return c.w.Flush()
+}
+
+// reply sends a command/reply with the given Reply-Text and headers.
+func (c *Conn) reply(text string, headers ...string) {
+	var b strings.Builder
+	b.WriteString("Content-Type: command/reply\n")
+	for n := 0; n+1 < len(headers); n += 2 {
+		fmt.Fprintf(&b, "%s: %s\n", headers[n], headers[n+1])
+	}
+	fmt.Fprintf(&b, "Reply-Text: %s\n\n", text)
+	c.write("%s", b.String())
+}
+
+// serve reads and handles the commands of the client until it goes away.
+func (c *Conn) serve(auth bool) {
+	defer c.s.wg.Done()
+	defer func() {
+		c.s.mu.Lock()
+		delete(c.s.conns, c)
+		c.s.mu.Unlock()
+		c.conn.Close()
+	}()
+	if auth {
+		c.write("Content-Type: auth/request\n\n")
+		cmd, err := c.readCommand()
+		if err != nil {
+			return
+		}
+		if cmd.Name != "auth" || cmd.Args != c.s.Password {
+			c.reply("-ERR invalid")
+			return
+		}
+		c.reply("+OK accepted")
+	}
+	for {
+		cmd, err := c.readCommand()
+		if err != nil {
+			return
+		}
+		c.s.mu.Lock()
+		c.s.received = append(c.s.received, cmd)
+		c.s.mu.Unlock()
+		if !c.handle(cmd) {
+			return
+		}
+	}
+}
+
+// readCommand reads a command: the first line, headers, and the body if
+// there's a Content-Length.
+func (c *Conn) readCommand() (*Command, error) {
+	tp := textproto.NewReader(c.r)
+	var line string
+	for line == "" {
+		l, err := tp.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(l)
+	}
+	hdr, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	cmd := &Command{Header: hdr}
+	cmd.Name, cmd.Args, _ = strings.Cut(line, " ")
+	cmd.Args = strings.TrimSpace(cmd.Args)
+	if v := hdr.Get("Content-Length"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		cmd.Body = string(b)
+	}
+	return cmd, nil
+}
+
+// handle replies to a command. It returns false when the connection must
+// be closed.
+func (c *Conn) handle(cmd *Command) bool {
+	switch cmd.Name {
+	case "api":
+		body := c.s.callAPI(cmd.Args)
+		c.write("Content-Type: api/response\nContent-Length: %d\n\n%s", len(body), body)
+	case "bgapi":
+		job := cmd.Header.Get("Job-UUID")
+		if job == "" {
+			job = newUUID()
+		}
+		c.reply("+OK Job-UUID: "+job, "Job-UUID", job)
+		name, _, _ := strings.Cut(cmd.Args, " ")
+		c.Send(&eventsocket.Event{
+			Header: eventsocket.EventHeader{
+				"Event-Name":      "BACKGROUND_JOB",
+				"Job-UUID":        job,
+				"Job-Command":     name,
+				"Job-Command-Arg": strings.TrimSpace(strings.TrimPrefix(cmd.Args, name)),
+			},
+			Body: c.s.callAPI(cmd.Args),
+		})
+	case "event", "events":
+		c.subscribe(cmd.Args)
+		c.mu.Lock()
+		format := c.format
+		c.mu.Unlock()
+		c.reply("+OK event listener enabled " + format)
+	case "myevents":
+		c.mu.Lock()
+		c.all = true
+		for _, f := range strings.Fields(cmd.Args) {
+			if f == "plain" || f == "json" {
+				c.format = f
+			}
+		}
+		c.mu.Unlock()
+		c.reply("+OK Events Enabled")
+	case "nixevent":
+		c.mu.Lock()
+		for _, name := range strings.Fields(cmd.Args) {
+			delete(c.events, name)
+		}
+		c.mu.Unlock()
+		c.reply("+OK events nixed")
+	case "noevents":
+		c.mu.Lock()
+		c.all = false
+		c.events = make(map[string]bool)
+		c.mu.Unlock()
+		c.reply("+OK no longer listening for events")
+	case "filter":
+		if strings.HasPrefix(cmd.Args, "delete ") {
+			c.reply("+OK filter deleted.")
+		} else {
+			k, v, _ := strings.Cut(cmd.Args, " ")
+			c.reply(fmt.Sprintf("+OK filter added. [%s]=[%s]", k, v))
+		}
+	case "sendmsg":
+		c.s.mu.Lock()
+		fn := c.s.msg
+		c.s.mu.Unlock()
+		if fn != nil {
+			c.reply(fn(c, cmd))
+			break
+		}
+		c.reply("+OK")
+		if strings.EqualFold(cmd.Header.Get("Call-Command"), "execute") {
+			c.execute(cmd)
+		}
+	case "sendevent":
+		c.reply("+OK " + newUUID())
+	case "connect":
+		if c.channel == nil {
+			c.reply("-ERR command not found")
+			break
+		}
+		var headers []string
+		for k, v := range c.channel {
+			headers = append(headers, k, v)
+		}
+		c.reply("+OK", headers...)
+	case "linger":
+		c.reply("+OK will linger")
+	case "nolinger":
+		c.reply("+OK will not linger")
+	case "divert_events", "resume", "log", "nolog":
+		c.reply("+OK")
+	case "exit":
+		c.reply("+OK bye")
+		c.Disconnect()
+		return false
+	default:
+		c.reply("-ERR command not found")
+	}
+	return true
+}
+
+// subscribe handles the arguments of the events command, e.g.
+// "plain CHANNEL_ANSWER CUSTOM sofia::register".
+func (c *Conn) subscribe(args string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := strings.Fields(args)
+	if len(f) > 0 {
+		c.format, f = f[0], f[1:]
+	}
+	for _, name := range f {
+		switch name {
+		case "ALL":
+			c.all = true
+		case "CUSTOM":
+		default:
+			c.events[name] = true
+		}
+	}
+}
+
+// callAPI returns the result of an api command.
+func (s *Server) callAPI(command string) string {
+	name, args, _ := strings.Cut(command, " ")
+	s.mu.Lock()
+	fn := s.api[name]
+	s.mu.Unlock()
+	if fn == nil {
+		return "-ERR " + name + " Command not found!\n"
+	}
+	return fn(strings.TrimSpace(args))
+}
+
+// execute sends the events of an application executed by sendmsg.
+func (c *Conn) execute(cmd *Command) {
+	uuid := cmd.Args
+	if uuid == "" && c.channel != nil {
+		uuid = c.channel["Unique-ID"]
+	}
+	arg := cmd.Header.Get("Execute-App-Arg")
+	if cmd.Body != "" {
+		arg = cmd.Body
+	}
+	for _, name := range []string{"CHANNEL_EXECUTE", "CHANNEL_EXECUTE_COMPLETE"} {
+		h := eventsocket.EventHeader{
+			"Event-Name":       name,
+			"Unique-ID":        uuid,
+			"Application":      cmd.Header.Get("Execute-App-Name"),
+			"Application-Data": arg,
+			"Application-UUID": cmd.Header.Get("Event-UUID"),
+		}
+		if name == "CHANNEL_EXECUTE_COMPLETE" {
+			h["Application-Response"] = "_none_"
+		}
+		c.Send(&eventsocket.Event{Header: h})
+	}
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
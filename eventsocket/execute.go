@@ -0,0 +1,84 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "strconv"
+
+// ExecuteOptions are the optional settings of applications executed by
+// ExecuteWith, which map to sendmsg headers.
+//
+// See http://wiki.freeswitch.org/wiki/Event_Socket#sendmsg for details.
+type ExecuteOptions struct {
+	// UUID of the channel. Required on inbound connections, optional on
+	// outbound connections where it defaults to the controlled channel.
+	UUID string
+
+	// Loops is how many times the application is executed, 0 means once.
+	Loops int
+
+	// Async executes the application without waiting for the previous
+	// ones to complete, on outbound connections in sync mode.
+	Async bool
+
+	// EventLock executes applications in the order they were sent on
+	// outbound connections in async mode.
+	EventLock bool
+
+	// EventUUID is sent back in the Application-UUID header of the
+	// CHANNEL_EXECUTE and CHANNEL_EXECUTE_COMPLETE events, to match them
+	// with the command. See also ExecuteAsync.
+	EventUUID string
+
+	// ContentType, when set, sends the application argument as the body
+	// of the message rather than a header. That's required for arguments
+	// with new lines or very long ones. Usually text/plain.
+	ContentType string
+}
+
+// ExecuteWith executes an application with the given options. Nil options
+// are the same as Execute without lock, for outbound connections.
+//
+// Example:
+//
+//	ExecuteWith("playback", "/tmp/beep.wav", &ExecuteOptions{
+//		UUID:  uuid,
+//		Loops: 3,
+//	})
+func (h *Connection) ExecuteWith(appName, appArg string, opts *ExecuteOptions) (*Event, error) {
+	if opts == nil {
+		opts = &ExecuteOptions{}
+	}
+	m := MSG{
+		"call-command":     "execute",
+		"execute-app-name": appName,
+		"event-uuid":       opts.EventUUID,
+		"content-type":     opts.ContentType,
+	}
+	// Like event-lock and async, loops is only sent when needed.
+	if opts.Loops > 1 {
+		m["loops"] = strconv.Itoa(opts.Loops)
+	}
+	if opts.Async {
+		m["async"] = "true"
+	}
+	if opts.EventLock {
+		m["event-lock"] = "true"
+	}
+	if opts.ContentType != "" {
+		return h.SendMsg(m, opts.UUID, appArg)
+	}
+	m["execute-app-arg"] = appArg
+	return h.SendMsg(m, opts.UUID, "")
+}
+
+// NoMedia takes the media of the channel identified by uuid off FreeSWITCH,
+// using the nomedia call-command. The uuid may be empty on outbound
+// connections. The nomediaUUID is the other leg of the call.
+func (h *Connection) NoMedia(uuid, nomediaUUID string) (*Event, error) {
+	return h.SendMsg(MSG{
+		"call-command": "nomedia",
+		"nomedia-uuid": nomediaUUID,
+	}, uuid, "")
+}
@@ -0,0 +1,112 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+// Execution tracks an application executed by ExecuteAsync.
+type Execution struct {
+	// UUID identifies the execution. FreeSWITCH sends it back in the
+	// Application-UUID header of the related events.
+	UUID string
+
+	h      *Connection
+	done   chan struct{}
+	ev     *Event
+	cancel func()
+}
+
+// ExecuteAsync executes an application like ExecuteUUID, but doesn't wait
+// for it to run. The returned Execution tells when the application
+// completes, based on the CHANNEL_EXECUTE_COMPLETE event matching its
+// Event-UUID. The uuid may be empty on outbound connections.
+//
+// The connection must be subscribed to CHANNEL_EXECUTE_COMPLETE events,
+// e.g. with "myevents" or "events plain CHANNEL_EXECUTE_COMPLETE".
+//
+// Example:
+//
+//	ex, err := c.ExecuteAsync("", "playback", "/tmp/test.wav")
+//	...
+//	select {
+//	case <-ex.Done():
+//		fmt.Println("playback:", ex.Response())
+//	case <-time.After(time.Minute):
+//		c.Send("api uuid_break " + uuid)
+//	}
+func (h *Connection) ExecuteAsync(uuid, appName, appArg string) (*Execution, error) {
+	return h.ExecuteAsyncWith(appName, appArg, &ExecuteOptions{UUID: uuid})
+}
+
+// ExecuteAsyncWith is like ExecuteAsync, but takes ExecuteOptions. The
+// EventUUID option is ignored, a new one is always generated.
+func (h *Connection) ExecuteAsyncWith(appName, appArg string, opts *ExecuteOptions) (*Execution, error) {
+	e := &Execution{
+		UUID: newUUID(),
+		h:    h,
+		done: make(chan struct{}),
+	}
+	o := ExecuteOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.EventUUID = e.UUID
+	// Observe before sending so the completion can't be missed.
+	e.cancel = h.observe(func(ev *Event) bool {
+		if ev.peek("Event-Name") != "CHANNEL_EXECUTE_COMPLETE" ||
+			ev.peek("Application-Uuid") != e.UUID {
+			return false
+		}
+		e.ev = ev.retain()
+		close(e.done)
+		return true
+	})
+	if _, err := h.ExecuteWith(appName, appArg, &o); err != nil {
+		e.cancel()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Done returns a channel that's closed when the application completes.
+func (e *Execution) Done() <-chan struct{} {
+	return e.done
+}
+
+// Event returns the CHANNEL_EXECUTE_COMPLETE event of the application, or
+// nil if it didn't complete yet.
+func (e *Execution) Event() *Event {
+	select {
+	case <-e.done:
+		return e.ev
+	default:
+		return nil
+	}
+}
+
+// Response returns the Application-Response of the completed application,
+// e.g. FILE PLAYED for playback, or "" if it didn't complete yet.
+func (e *Execution) Response() string {
+	if ev := e.Event(); ev != nil {
+		return ev.Get("Application-Response")
+	}
+	return ""
+}
+
+// Wait waits for the application to complete and returns its
+// CHANNEL_EXECUTE_COMPLETE event, or an error if the connection terminates
+// first.
+func (e *Execution) Wait() (*Event, error) {
+	select {
+	case <-e.done:
+		return e.ev, nil
+	case <-e.h.done:
+		select {
+		case <-e.done:
+			return e.ev, nil
+		default:
+			e.cancel()
+			return nil, e.h.err
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "strings"
+
+// Filter restricts the events received on the connection to those that
+// have the header set to value. Multiple filters are combined, events that
+// match any of them are received.
+//
+// Example:
+//
+//	c.Send("events plain ALL")
+//	c.Filter("Unique-ID", uuid) // Only events of one channel
+//
+// See http://wiki.freeswitch.org/wiki/Event_Socket#filter for details.
+func (h *Connection) Filter(header, value string) error {
+	if !validArg(header) || value == "" || strings.IndexAny(value, "\r\n") >= 0 {
+		return errInvalidArgument
+	}
+	if err := h.command("filter " + header + " " + value); err != nil {
+		return err
+	}
+	h.Subscriptions().addFilter(header, value)
+	return nil
+}
+
+// FilterDelete removes a filter added by Filter. If value is empty, all
+// filters on the header are removed.
+func (h *Connection) FilterDelete(header, value string) error {
+	if !validArg(header) || strings.IndexAny(value, "\r\n") >= 0 {
+		return errInvalidArgument
+	}
+	cmd := "filter delete " + header
+	if value != "" {
+		cmd += " " + value
+	}
+	if err := h.command(cmd); err != nil {
+		return err
+	}
+	h.Subscriptions().deleteFilter(header, value)
+	return nil
+}
+
+// FilterDeleteAll removes all filters.
+func (h *Connection) FilterDeleteAll() error {
+	if err := h.command("filter delete all"); err != nil {
+		return err
+	}
+	h.Subscriptions().deleteFilter("", "")
+	return nil
+}
+
+// Nixevent unsubscribes from the given events, e.g. after subscribing to
+// ALL, and keeps receiving the others.
+func (h *Connection) Nixevent(names ...string) error {
+	if len(names) == 0 {
+		return errInvalidArgument
+	}
+	for _, name := range names {
+		if !validArg(name) {
+			return errInvalidArgument
+		}
+	}
+	if err := h.command("nixevent " + strings.Join(names, " ")); err != nil {
+		return err
+	}
+	h.Subscriptions().nixevent(names)
+	return nil
+}
+
+// command sends a command that's expected to reply +OK. Other replies are
+// returned as errors.
+func (h *Connection) command(cmd string) error {
+	ev, err := h.Send(cmd)
+	if err != nil {
+		return err
+	}
+	if reply := ev.Get("Reply-Text"); !strings.HasPrefix(reply, "+OK") {
+		return replyError(reply)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+var (
+	hdrContentType   = []byte("Content-Type")
+	hdrContentLength = []byte("Content-Length")
+)
+
+// frameHeader is the outer header of a message of the protocol, e.g.
+//
+//	Content-Length: 526
+//	Content-Type: text/event-plain
+//
+// It's reused for every message read by a connection, and only allocates
+// strings for the headers of replies, which are copied to their Event.
+type frameHeader struct {
+	contentType string // Interned for known types
+	length      int    // Content-Length, or -1 if missing
+	raw         []byte // The header lines, separated by \n
+}
+
+// readFrameHeader reads the outer header of the next message into fh,
+// skipping blank lines before it.
+func readFrameHeader(r *bufio.Reader, fh *frameHeader) error {
+	fh.contentType, fh.length, fh.raw = "", -1, fh.raw[:0]
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Longer than the buffer, which FreeSWITCH never sends.
+			return errMalformedHeader
+		}
+		if err != nil {
+			if err == io.EOF && (len(line) > 0 || len(fh.raw) > 0) {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			if len(fh.raw) == 0 {
+				continue
+			}
+			return nil
+		}
+		i := bytes.IndexByte(line, ':')
+		if i <= 0 {
+			return errMalformedHeader
+		}
+		k, v := line[:i], bytes.TrimSpace(line[i+1:])
+		switch {
+		case bytes.EqualFold(k, hdrContentType):
+			fh.contentType = contentType(v)
+		case bytes.EqualFold(k, hdrContentLength):
+			n, ok := atoiBytes(v)
+			if !ok {
+				return errMalformedHeader
+			}
+			fh.length = n
+		}
+		fh.raw = append(fh.raw, line...)
+		fh.raw = append(fh.raw, '\n')
+	}
+}
+
+// get returns the value of a header, by case insensitive name.
+func (fh *frameHeader) get(name string) string {
+	b := fh.raw
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		line := b[:i]
+		b = b[i+1:]
+		n := bytes.IndexByte(line, ':')
+		if bytes.EqualFold(line[:n], []byte(name)) {
+			return string(bytes.TrimSpace(line[n+1:]))
+		}
+	}
+	return ""
+}
+
+// copyTo adds the headers to the event, unescaping their values when
+// decode is set. Like in plain events, header names are capitalized, but
+// the names sent by FreeSWITCH are kept as well.
+func (fh *frameHeader) copyTo(ev *Event, decode bool) {
+	b := fh.raw
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		line := b[:i]
+		b = b[i+1:]
+		n := bytes.IndexByte(line, ':')
+		value := bytes.TrimSpace(line[n+1:])
+		if decode {
+			ev.addHeader(headerName(line[:n]), unescape(value))
+		} else {
+			ev.addHeader(headerName(line[:n]), string(value))
+		}
+	}
+}
+
+// contentType returns the content type, without allocating for the known
+// ones.
+func contentType(v []byte) string {
+	switch string(v) {
+	case "text/event-plain":
+		return "text/event-plain"
+	case "text/event-json":
+		return "text/event-json"
+	case "command/reply":
+		return "command/reply"
+	case "api/response":
+		return "api/response"
+	case "auth/request":
+		return "auth/request"
+	case "text/disconnect-notice":
+		return "text/disconnect-notice"
+	}
+	return string(v)
+}
+
+// atoiBytes parses a non-negative decimal number.
+func atoiBytes(b []byte) (int, bool) {
+	if len(b) == 0 || len(b) > 10 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+// bodyPool holds the buffers message bodies are read into, which are only
+// needed until the message is parsed.
+var bodyPool = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
+// readBody reads a body of the given length into a buffer of bodyPool,
+// which must be returned with putBody once the body is parsed.
+func readBody(r io.Reader, length int) (*[]byte, error) {
+	buf := bodyPool.Get().(*[]byte)
+	if cap(*buf) < length {
+		*buf = make([]byte, length)
+	}
+	*buf = (*buf)[:length]
+	if _, err := io.ReadFull(r, *buf); err != nil {
+		putBody(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// putBody returns a buffer to bodyPool, unless it's too large to keep.
+func putBody(buf *[]byte) {
+	if cap(*buf) > 1<<20 {
+		return
+	}
+	bodyPool.Put(buf)
+}
@@ -0,0 +1,222 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const gatewayPollInterval = 30 * time.Second
+
+// GatewayState is the state of a sofia gateway tracked by GatewayMonitor.
+type GatewayState struct {
+	Name    string    // Gateway name, without the profile
+	Profile string    // Profile of the gateway, if known
+	State   string    // Registration state, e.g. REGED, NOREG or FAIL_WAIT
+	Up      bool      // Whether calls can go through the gateway
+	Changed time.Time // When Up last changed
+	Updated time.Time // When the state was last reported
+}
+
+// GatewayMonitor keeps track of the state of sofia gateways, based on
+// sofia::gateway_state events and on polling "sofia status", and reports
+// gateways going up and down, for alerting or failover routing.
+//
+// Gateways that register are up when registered. Gateways that don't are
+// up unless they're pinged and don't reply.
+//
+// Example:
+//
+//	m := eventsocket.NewGatewayMonitor(c)
+//	m.OnDown = func(gw eventsocket.GatewayState) {
+//		log.Println("gateway down:", gw.Name, gw.State)
+//	}
+//	go m.Run(ctx)
+//	...
+//	if gw, ok := m.Gateway("provider"); ok && gw.Up {
+//		...
+//	}
+type GatewayMonitor struct {
+	// Interval between polls of sofia status. Defaults to 30s.
+	Interval time.Duration
+
+	// OnUp and OnDown, when set, are called when a gateway is first seen
+	// and every time it goes up or down. They're called from Run.
+	OnUp   func(GatewayState)
+	OnDown func(GatewayState)
+
+	conn     *Connection
+	mu       sync.Mutex
+	gateways map[string]*GatewayState
+}
+
+// NewGatewayMonitor creates a GatewayMonitor that issues commands on the
+// given connection.
+func NewGatewayMonitor(c *Connection) *GatewayMonitor {
+	return &GatewayMonitor{
+		conn:     c,
+		gateways: make(map[string]*GatewayState),
+	}
+}
+
+// Run subscribes to sofia::gateway_state events, polls sofia status, and
+// tracks the state of gateways until the context is cancelled or the
+// connection terminates.
+func (m *GatewayMonitor) Run(ctx context.Context) error {
+	events := newEventQueue()
+	cancel := m.conn.observe(func(ev *Event) bool {
+		if ev.peek("Event-Subclass") == "sofia::gateway_state" {
+			events.push(ev.retain())
+		}
+		return false
+	})
+	defer cancel()
+	if err := m.conn.Subscriptions().Subscribe("sofia::gateway_state"); err != nil {
+		return err
+	}
+	interval := m.Interval
+	if interval <= 0 {
+		interval = gatewayPollInterval
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		if err := m.Poll(); err != nil {
+			return err
+		}
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-m.conn.done:
+				return m.conn.err
+			case <-tick.C:
+				break wait
+			case <-events.wake:
+				for ev, ok := events.pop(); ok; ev, ok = events.pop() {
+					m.HandleEvent(ev)
+					ev.Release()
+				}
+			}
+		}
+	}
+}
+
+// Poll updates the state of all gateways from sofia status.
+func (m *GatewayMonitor) Poll() error {
+	entries, err := m.conn.SofiaStatus()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Type != "gateway" {
+			continue
+		}
+		profile, name := "", e.Name
+		if n := strings.Index(name, "::"); n >= 0 {
+			profile, name = name[:n], name[n+2:]
+		}
+		// The state may come with the ping status, e.g. REGED (UP).
+		state, status := e.State, ""
+		if n := strings.Index(state, " ("); n >= 0 {
+			state, status = state[:n], strings.Trim(state[n+2:], ")")
+		}
+		m.update(name, profile, state, status)
+	}
+	return nil
+}
+
+// HandleEvent updates the state of a gateway from a sofia::gateway_state
+// event. Other events are ignored. It's called by Run, and only needs to
+// be called directly by those not using Run.
+func (m *GatewayMonitor) HandleEvent(ev *Event) {
+	if ev.Get("Event-Subclass") != "sofia::gateway_state" {
+		return
+	}
+	name := ev.Get("Gateway")
+	if name == "" {
+		return
+	}
+	m.update(name, ev.Get("Profile-Name"), ev.Get("State"), ev.Get("Ping-Status"))
+}
+
+// Gateway returns the state of a gateway, and whether it's known.
+func (m *GatewayMonitor) Gateway(name string) (GatewayState, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if gw, ok := m.gateways[name]; ok {
+		return *gw, true
+	}
+	return GatewayState{}, false
+}
+
+// Gateways returns the state of all known gateways, sorted by name.
+func (m *GatewayMonitor) Gateways() []GatewayState {
+	m.mu.Lock()
+	list := make([]GatewayState, 0, len(m.gateways))
+	for _, gw := range m.gateways {
+		list = append(list, *gw)
+	}
+	m.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// update records the state of a gateway and reports transitions. The
+// status is the ping status, UP or DOWN, or empty if unknown.
+func (m *GatewayMonitor) update(name, profile, state, status string) {
+	up, known := gatewayUp(state, status)
+	now := time.Now()
+	m.mu.Lock()
+	gw, seen := m.gateways[name]
+	if !seen {
+		gw = &GatewayState{Name: name, Changed: now}
+		m.gateways[name] = gw
+	}
+	changed := known && (!seen || gw.Up != up)
+	if profile != "" {
+		gw.Profile = profile
+	}
+	gw.State = state
+	gw.Updated = now
+	if changed {
+		gw.Up = up
+		gw.Changed = now
+	}
+	snapshot := *gw
+	m.mu.Unlock()
+	if !changed {
+		return
+	}
+	if up && m.OnUp != nil {
+		m.OnUp(snapshot)
+	} else if !up && m.OnDown != nil {
+		m.OnDown(snapshot)
+	}
+}
+
+// gatewayUp tells whether a gateway is usable, from its registration
+// state and ping status. Transient states, like TRYING while registering
+// again, are not known to be either.
+func gatewayUp(state, status string) (up, known bool) {
+	switch strings.ToUpper(status) {
+	case "UP":
+		return true, true
+	case "DOWN":
+		return false, true
+	}
+	switch state {
+	case "REGED", "NOREG":
+		return true, true
+	case "FAILED", "FAIL_WAIT", "EXPIRED", "UNREGED", "TIMEOUT", "NOAVAIL":
+		return false, true
+	}
+	return false, false
+}
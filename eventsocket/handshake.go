@@ -0,0 +1,113 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"strconv"
+	"time"
+)
+
+// ChannelHandleFunc is the function called on new outbound connections by
+// AutoConnect, with the data of the channel.
+type ChannelHandleFunc func(*Connection, *ChannelData)
+
+// HandshakeOptions are the settings of the handshake done by AutoConnect.
+type HandshakeOptions struct {
+	// Format of the events, plain or json. Defaults to plain.
+	Format string
+
+	// Events to subscribe to, besides the events of the channel itself,
+	// e.g. CHANNEL_EXECUTE_COMPLETE of other channels, or DTMF.
+	Events []string
+
+	// NoLinger disables linger, which keeps the connection open after
+	// the channel hangs up so the last events aren't lost.
+	NoLinger bool
+
+	// LingerTime is how long to linger after hangup. Zero uses the
+	// FreeSWITCH default.
+	LingerTime time.Duration
+
+	// Resume makes the dialplan go on once the connection closes, see
+	// Connection.Resume.
+	Resume bool
+}
+
+// AutoConnect returns a HandleFunc for ListenAndServe that does the usual
+// handshake of outbound connections before calling fn: connect, myevents,
+// linger, resume if set, and the subscription to opts.Events, in that
+// order. Connections
+// whose handshake fails are closed. Nil options use the defaults.
+//
+// Example:
+//
+//	eventsocket.ListenAndServe(":9090", eventsocket.AutoConnect(handler, nil))
+//
+//	func handler(c *eventsocket.Connection, d *eventsocket.ChannelData) {
+//		fmt.Println("new call to", d.DestinationNumber)
+//		for {
+//			ev, err := c.ReadEvent()
+//			...
+//		}
+//	}
+func AutoConnect(fn ChannelHandleFunc, opts *HandshakeOptions) HandleFunc {
+	if opts == nil {
+		opts = &HandshakeOptions{}
+	}
+	return func(c *Connection) {
+		d, err := c.handshake(opts)
+		if err != nil {
+			c.Close()
+			return
+		}
+		fn(c, d)
+	}
+}
+
+// handshake connects to the channel and subscribes to its events.
+func (h *Connection) handshake(opts *HandshakeOptions) (*ChannelData, error) {
+	d, err := h.Connect()
+	if err != nil {
+		return nil, err
+	}
+	if err := h.subscribeChannel(opts); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// subscribeChannel does the handshake after connect.
+func (h *Connection) subscribeChannel(opts *HandshakeOptions) error {
+	format := opts.Format
+	if format == "" {
+		format = "plain"
+	}
+	if err := h.MyEvents("", format); err != nil {
+		return err
+	}
+	if !opts.NoLinger {
+		cmd := "linger"
+		if opts.LingerTime > 0 {
+			s := int64((opts.LingerTime + time.Second - 1) / time.Second)
+			cmd += " " + strconv.FormatInt(s, 10)
+		}
+		if _, err := h.Send(cmd); err != nil {
+			return err
+		}
+	}
+	if opts.Resume {
+		if _, err := h.Send("resume"); err != nil {
+			return err
+		}
+	}
+	if len(opts.Events) > 0 {
+		s := h.Subscriptions()
+		s.SetFormat(format)
+		if err := s.Subscribe(opts.Events...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
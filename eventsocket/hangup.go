@@ -0,0 +1,201 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "strconv"
+
+// HangupCause is the reason a call ended, using the Q.850 codes and the
+// FreeSWITCH extensions to them.
+//
+// See http://wiki.freeswitch.org/wiki/Hangup_causes for details.
+type HangupCause int
+
+// Hangup causes known to FreeSWITCH.
+const (
+	CauseUnspecified                 HangupCause = 0
+	CauseUnallocatedNumber           HangupCause = 1
+	CauseNoRouteTransitNet           HangupCause = 2
+	CauseNoRouteDestination          HangupCause = 3
+	CauseChannelUnacceptable         HangupCause = 6
+	CauseCallAwardedDelivered        HangupCause = 7
+	CauseNormalClearing              HangupCause = 16
+	CauseUserBusy                    HangupCause = 17
+	CauseNoUserResponse              HangupCause = 18
+	CauseNoAnswer                    HangupCause = 19
+	CauseSubscriberAbsent            HangupCause = 20
+	CauseCallRejected                HangupCause = 21
+	CauseNumberChanged               HangupCause = 22
+	CauseRedirectionToNewDestination HangupCause = 23
+	CauseExchangeRoutingError        HangupCause = 25
+	CauseDestinationOutOfOrder       HangupCause = 27
+	CauseInvalidNumberFormat         HangupCause = 28
+	CauseFacilityRejected            HangupCause = 29
+	CauseResponseToStatusEnquiry     HangupCause = 30
+	CauseNormalUnspecified           HangupCause = 31
+	CauseNormalCircuitCongestion     HangupCause = 34
+	CauseNetworkOutOfOrder           HangupCause = 38
+	CauseNormalTemporaryFailure      HangupCause = 41
+	CauseSwitchCongestion            HangupCause = 42
+	CauseAccessInfoDiscarded         HangupCause = 43
+	CauseRequestedChanUnavail        HangupCause = 44
+	CausePreEmpted                   HangupCause = 45
+	CauseFacilityNotSubscribed       HangupCause = 50
+	CauseOutgoingCallBarred          HangupCause = 52
+	CauseIncomingCallBarred          HangupCause = 54
+	CauseBearercapabilityNotAuth     HangupCause = 57
+	CauseBearercapabilityNotAvail    HangupCause = 58
+	CauseServiceUnavailable          HangupCause = 63
+	CauseBearercapabilityNotImpl     HangupCause = 65
+	CauseChanNotImplemented          HangupCause = 66
+	CauseFacilityNotImplemented      HangupCause = 69
+	CauseServiceNotImplemented       HangupCause = 79
+	CauseInvalidCallReference        HangupCause = 81
+	CauseIncompatibleDestination     HangupCause = 88
+	CauseInvalidMsgUnspecified       HangupCause = 95
+	CauseMandatoryIEMissing          HangupCause = 96
+	CauseMessageTypeNonexist         HangupCause = 97
+	CauseWrongMessage                HangupCause = 98
+	CauseIENonexist                  HangupCause = 99
+	CauseInvalidIEContents           HangupCause = 100
+	CauseWrongCallState              HangupCause = 101
+	CauseRecoveryOnTimerExpire       HangupCause = 102
+	CauseMandatoryIELengthError      HangupCause = 103
+	CauseProtocolError               HangupCause = 111
+	CauseInterworking                HangupCause = 127
+	CauseSuccess                     HangupCause = 142
+	CauseOriginatorCancel            HangupCause = 487
+	CauseCrash                       HangupCause = 700
+	CauseSystemShutdown              HangupCause = 701
+	CauseLoseRace                    HangupCause = 702
+	CauseManagerRequest              HangupCause = 703
+	CauseBlindTransfer               HangupCause = 800
+	CauseAttendedTransfer            HangupCause = 801
+	CauseAllottedTimeout             HangupCause = 602
+	CauseUserChallenge               HangupCause = 603
+	CauseMediaTimeout                HangupCause = 604
+	CausePickedOff                   HangupCause = 605
+	CauseUserNotRegistered           HangupCause = 606
+	CauseProgressTimeout             HangupCause = 607
+	CauseGatewayDown                 HangupCause = 609
+)
+
+// hangupCauses maps hangup causes to the names used by FreeSWITCH, e.g.
+// NORMAL_CLEARING.
+var hangupCauses = map[HangupCause]string{
+	CauseUnspecified:                 "UNSPECIFIED",
+	CauseUnallocatedNumber:           "UNALLOCATED_NUMBER",
+	CauseNoRouteTransitNet:           "NO_ROUTE_TRANSIT_NET",
+	CauseNoRouteDestination:          "NO_ROUTE_DESTINATION",
+	CauseChannelUnacceptable:         "CHANNEL_UNACCEPTABLE",
+	CauseCallAwardedDelivered:        "CALL_AWARDED_DELIVERED",
+	CauseNormalClearing:              "NORMAL_CLEARING",
+	CauseUserBusy:                    "USER_BUSY",
+	CauseNoUserResponse:              "NO_USER_RESPONSE",
+	CauseNoAnswer:                    "NO_ANSWER",
+	CauseSubscriberAbsent:            "SUBSCRIBER_ABSENT",
+	CauseCallRejected:                "CALL_REJECTED",
+	CauseNumberChanged:               "NUMBER_CHANGED",
+	CauseRedirectionToNewDestination: "REDIRECTION_TO_NEW_DESTINATION",
+	CauseExchangeRoutingError:        "EXCHANGE_ROUTING_ERROR",
+	CauseDestinationOutOfOrder:       "DESTINATION_OUT_OF_ORDER",
+	CauseInvalidNumberFormat:         "INVALID_NUMBER_FORMAT",
+	CauseFacilityRejected:            "FACILITY_REJECTED",
+	CauseResponseToStatusEnquiry:     "RESPONSE_TO_STATUS_ENQUIRY",
+	CauseNormalUnspecified:           "NORMAL_UNSPECIFIED",
+	CauseNormalCircuitCongestion:     "NORMAL_CIRCUIT_CONGESTION",
+	CauseNetworkOutOfOrder:           "NETWORK_OUT_OF_ORDER",
+	CauseNormalTemporaryFailure:      "NORMAL_TEMPORARY_FAILURE",
+	CauseSwitchCongestion:            "SWITCH_CONGESTION",
+	CauseAccessInfoDiscarded:         "ACCESS_INFO_DISCARDED",
+	CauseRequestedChanUnavail:        "REQUESTED_CHAN_UNAVAIL",
+	CausePreEmpted:                   "PRE_EMPTED",
+	CauseFacilityNotSubscribed:       "FACILITY_NOT_SUBSCRIBED",
+	CauseOutgoingCallBarred:          "OUTGOING_CALL_BARRED",
+	CauseIncomingCallBarred:          "INCOMING_CALL_BARRED",
+	CauseBearercapabilityNotAuth:     "BEARERCAPABILITY_NOTAUTH",
+	CauseBearercapabilityNotAvail:    "BEARERCAPABILITY_NOTAVAIL",
+	CauseServiceUnavailable:          "SERVICE_UNAVAILABLE",
+	CauseBearercapabilityNotImpl:     "BEARERCAPABILITY_NOTIMPL",
+	CauseChanNotImplemented:          "CHAN_NOT_IMPLEMENTED",
+	CauseFacilityNotImplemented:      "FACILITY_NOT_IMPLEMENTED",
+	CauseServiceNotImplemented:       "SERVICE_NOT_IMPLEMENTED",
+	CauseInvalidCallReference:        "INVALID_CALL_REFERENCE",
+	CauseIncompatibleDestination:     "INCOMPATIBLE_DESTINATION",
+	CauseInvalidMsgUnspecified:       "INVALID_MSG_UNSPECIFIED",
+	CauseMandatoryIEMissing:          "MANDATORY_IE_MISSING",
+	CauseMessageTypeNonexist:         "MESSAGE_TYPE_NONEXIST",
+	CauseWrongMessage:                "WRONG_MESSAGE",
+	CauseIENonexist:                  "IE_NONEXIST",
+	CauseInvalidIEContents:           "INVALID_IE_CONTENTS",
+	CauseWrongCallState:              "WRONG_CALL_STATE",
+	CauseRecoveryOnTimerExpire:       "RECOVERY_ON_TIMER_EXPIRE",
+	CauseMandatoryIELengthError:      "MANDATORY_IE_LENGTH_ERROR",
+	CauseProtocolError:               "PROTOCOL_ERROR",
+	CauseInterworking:                "INTERWORKING",
+	CauseSuccess:                     "SUCCESS",
+	CauseOriginatorCancel:            "ORIGINATOR_CANCEL",
+	CauseCrash:                       "CRASH",
+	CauseSystemShutdown:              "SYSTEM_SHUTDOWN",
+	CauseLoseRace:                    "LOSE_RACE",
+	CauseManagerRequest:              "MANAGER_REQUEST",
+	CauseBlindTransfer:               "BLIND_TRANSFER",
+	CauseAttendedTransfer:            "ATTENDED_TRANSFER",
+	CauseAllottedTimeout:             "ALLOTTED_TIMEOUT",
+	CauseUserChallenge:               "USER_CHALLENGE",
+	CauseMediaTimeout:                "MEDIA_TIMEOUT",
+	CausePickedOff:                   "PICKED_OFF",
+	CauseUserNotRegistered:           "USER_NOT_REGISTERED",
+	CauseProgressTimeout:             "PROGRESS_TIMEOUT",
+	CauseGatewayDown:                 "GATEWAY_DOWN",
+}
+
+// hangupCauseNames maps names to hangup causes, see ParseHangupCause.
+var hangupCauseNames = make(map[string]HangupCause, len(hangupCauses))
+
+func init() {
+	for c, name := range hangupCauses {
+		hangupCauseNames[name] = c
+	}
+}
+
+// String returns the name of the cause used by FreeSWITCH, e.g.
+// NORMAL_CLEARING, or its code for unknown causes.
+func (c HangupCause) String() string {
+	if name, ok := hangupCauses[c]; ok {
+		return name
+	}
+	return strconv.Itoa(int(c))
+}
+
+// ParseHangupCause returns the hangup cause of a name used by FreeSWITCH,
+// like NORMAL_CLEARING, or of its numeric code. It returns false for
+// unknown causes.
+func ParseHangupCause(name string) (HangupCause, bool) {
+	if c, ok := hangupCauseNames[name]; ok {
+		return c, true
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		_, ok := hangupCauses[HangupCause(n)]
+		return HangupCause(n), ok
+	}
+	return CauseUnspecified, false
+}
+
+// HangupCause returns the cause of hangup events, like CHANNEL_HANGUP,
+// from the Hangup-Cause header. It returns false if the header is missing
+// or unknown.
+func (r *Event) HangupCause() (HangupCause, bool) {
+	return ParseHangupCause(r.Get("Hangup-Cause"))
+}
+
+// Hangup hangs up a channel with the given cause, using uuid_kill. It
+// returns ErrNoSuchChannel when the channel doesn't exist.
+func (h *Connection) Hangup(uuid string, cause HangupCause) error {
+	if !validArg(uuid) {
+		return errInvalidArgument
+	}
+	_, err := h.api("uuid_kill " + uuid + " " + cause.String())
+	return err
+}
@@ -0,0 +1,238 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const heartbeatInterval = 20 * time.Second // FreeSWITCH default
+
+// Heartbeat is the status of FreeSWITCH, as reported by HEARTBEAT events.
+type Heartbeat struct {
+	Time              time.Time // When the event was fired
+	Hostname          string
+	Version           string        // FreeSWITCH version
+	Uptime            time.Duration // Since FreeSWITCH started
+	IdleCPU           float64       // Percentage of idle CPU
+	SessionCount      int           // Active sessions
+	MaxSessions       int           // Limit of sessions, if any
+	SessionsPerSecond int           // Sessions created in the last second
+	SessionsPeak      int           // Most active sessions since startup
+	SessionsTotal     int           // Sessions created since startup
+	Interval          time.Duration // Between heartbeats
+}
+
+// ParseHeartbeat parses a HEARTBEAT event. It returns false for other
+// events.
+func ParseHeartbeat(ev *Event) (*Heartbeat, bool) {
+	if ev.Get("Event-Name") != EventHeartbeat {
+		return nil, false
+	}
+	hb := &Heartbeat{
+		Hostname: ev.Get("Freeswitch-Hostname"),
+		Version:  ev.Get("Freeswitch-Version"),
+	}
+	hb.Time, _ = ev.Timestamp()
+	hb.Uptime, _ = ev.GetDuration("Uptime-Msec", time.Millisecond)
+	hb.IdleCPU, _ = ev.GetFloat("Idle-Cpu")
+	hb.SessionCount, _ = ev.GetInt("Session-Count")
+	hb.MaxSessions, _ = ev.GetInt("Max-Sessions")
+	hb.SessionsPeak, _ = ev.GetInt("Session-Peak-Max")
+	hb.SessionsTotal, _ = ev.GetInt("Session-Since-Startup")
+	// Session-Per-Sec is what's left of the limit in the current second.
+	hb.SessionsPerSecond, _ = ev.GetInt("Session-Per-Sec-Last")
+	hb.Interval, _ = ev.GetDuration("Heartbeat-Interval", time.Second)
+	return hb, true
+}
+
+// HealthMonitor tells whether FreeSWITCH is alive, based on HEARTBEAT
+// events, e.g. for liveness probes. FreeSWITCH is healthy when the last
+// heartbeat was received within its interval plus the tolerance.
+//
+// Example:
+//
+//	m := eventsocket.NewHealthMonitor(c)
+//	m.OnUnhealthy = func(last eventsocket.Heartbeat) {
+//		log.Println("freeswitch missed its heartbeats since", last.Time)
+//	}
+//	go m.Run(ctx)
+//	...
+//	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+//		if !m.Healthy() {
+//			w.WriteHeader(http.StatusServiceUnavailable)
+//		}
+//	})
+type HealthMonitor struct {
+	// Tolerance is how late heartbeats can be. Defaults to one interval,
+	// that is, FreeSWITCH is unhealthy after missing two heartbeats.
+	Tolerance time.Duration
+
+	// MinIdleCPU, when set, is the percentage of idle CPU below which
+	// FreeSWITCH is unhealthy, even if sending heartbeats.
+	MinIdleCPU float64
+
+	// OnHeartbeat, when set, is called for every heartbeat received.
+	// OnHealthy and OnUnhealthy, when set, are called when FreeSWITCH
+	// becomes healthy or unhealthy, with the last heartbeat received, if
+	// any. They're all called from Run.
+	OnHeartbeat func(Heartbeat)
+	OnHealthy   func(Heartbeat)
+	OnUnhealthy func(Heartbeat)
+
+	conn     *Connection
+	mu       sync.Mutex
+	last     Heartbeat
+	seen     bool      // Whether last is set
+	received time.Time // When last was received
+	reported bool      // Whether healthy was reported to the callbacks
+	healthy  bool      // As last reported to the callbacks
+}
+
+// NewHealthMonitor creates a HealthMonitor for the given connection.
+func NewHealthMonitor(c *Connection) *HealthMonitor {
+	return &HealthMonitor{conn: c}
+}
+
+// Run subscribes to HEARTBEAT events and tracks them until the context is
+// cancelled or the connection terminates. FreeSWITCH is unhealthy until
+// the first heartbeat is received.
+func (m *HealthMonitor) Run(ctx context.Context) error {
+	events := newEventQueue()
+	cancel := m.conn.observe(func(ev *Event) bool {
+		if ev.peek("Event-Name") == "HEARTBEAT" {
+			events.push(ev.retain())
+		}
+		return false
+	})
+	defer cancel()
+	if err := m.conn.Subscriptions().Subscribe("HEARTBEAT"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if !m.seen {
+		// Waits for the first heartbeat as long as for any other.
+		m.received = time.Now()
+	}
+	m.mu.Unlock()
+	timer := time.NewTimer(m.deadline())
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.conn.done:
+			m.check()
+			return m.conn.err
+		case <-events.wake:
+			for ev, ok := events.pop(); ok; ev, ok = events.pop() {
+				m.HandleEvent(ev)
+				ev.Release()
+			}
+		case <-timer.C:
+			m.check()
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(m.deadline())
+	}
+}
+
+// HandleEvent records HEARTBEAT events. Other events are ignored. It's
+// called by Run, and only needs to be called directly by those not using
+// Run.
+func (m *HealthMonitor) HandleEvent(ev *Event) {
+	hb, ok := ParseHeartbeat(ev)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	m.last = *hb
+	m.seen = true
+	m.received = time.Now()
+	m.mu.Unlock()
+	if m.OnHeartbeat != nil {
+		m.OnHeartbeat(*hb)
+	}
+	m.check()
+}
+
+// Healthy tells whether FreeSWITCH is alive: the connection is up, the last
+// heartbeat was received in time, and it had enough idle CPU.
+func (m *HealthMonitor) Healthy() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.healthyLocked(time.Now())
+}
+
+// Last returns the last heartbeat received, and whether there's any.
+func (m *HealthMonitor) Last() (Heartbeat, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last, m.seen
+}
+
+// check reports changes of health to the callbacks.
+func (m *HealthMonitor) check() {
+	m.mu.Lock()
+	healthy := m.healthyLocked(time.Now())
+	changed := !m.reported || healthy != m.healthy
+	m.reported, m.healthy = true, healthy
+	last := m.last
+	m.mu.Unlock()
+	if !changed {
+		return
+	}
+	if healthy && m.OnHealthy != nil {
+		m.OnHealthy(last)
+	} else if !healthy && m.OnUnhealthy != nil {
+		m.OnUnhealthy(last)
+	}
+}
+
+// healthyLocked is Healthy with mu held.
+func (m *HealthMonitor) healthyLocked(now time.Time) bool {
+	select {
+	case <-m.conn.done:
+		return false
+	default:
+	}
+	if !m.seen || now.Sub(m.received) > m.window() {
+		return false
+	}
+	return m.MinIdleCPU <= 0 || m.last.IdleCPU >= m.MinIdleCPU
+}
+
+// deadline returns how long until the next heartbeat is late.
+func (m *HealthMonitor) deadline() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := time.Until(m.received.Add(m.window()))
+	if d <= 0 {
+		// Already late, check again after another window.
+		d = m.window()
+	}
+	return d + time.Millisecond
+}
+
+// window returns how long after a heartbeat the next one is late, with mu
+// held.
+func (m *HealthMonitor) window() time.Duration {
+	interval := m.last.Interval
+	if interval <= 0 {
+		interval = heartbeatInterval
+	}
+	tolerance := m.Tolerance
+	if tolerance <= 0 {
+		tolerance = interval
+	}
+	return interval + tolerance
+}
@@ -0,0 +1,54 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+// Hold puts a channel on hold, using uuid_hold. The other leg of the call
+// hears music on hold. It returns ErrNoSuchChannel when the channel
+// doesn't exist.
+func (h *Connection) Hold(uuid string) error {
+	return h.hold("", uuid, "")
+}
+
+// HoldWithDisplay puts a channel on hold like Hold, and sends the display
+// message to the phone of the channel, e.g. OnHold.
+func (h *Connection) HoldWithDisplay(uuid, display string) error {
+	if !validArg(display) {
+		return errInvalidArgument
+	}
+	return h.hold("", uuid, display)
+}
+
+// Unhold takes a channel off hold.
+func (h *Connection) Unhold(uuid string) error {
+	return h.hold("off", uuid, "")
+}
+
+// ToggleHold puts a channel on hold, or takes it off hold if it's on hold.
+func (h *Connection) ToggleHold(uuid string) error {
+	return h.hold("toggle", uuid, "")
+}
+
+// hold runs uuid_hold.
+func (h *Connection) hold(mode, uuid, display string) error {
+	if !validArg(uuid) {
+		return errInvalidArgument
+	}
+	cmd := "uuid_hold "
+	if mode != "" {
+		cmd += mode + " "
+	}
+	cmd += uuid
+	if display != "" {
+		cmd += " " + display
+	}
+	_, err := h.api(cmd)
+	if err != nil && err != ErrNoSuchChannel {
+		// uuid_hold fails with "Operation failed" for unknown channels.
+		if exists, e := h.api("uuid_exists " + uuid); e == nil && exists != "true" {
+			return ErrNoSuchChannel
+		}
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrIdleTimeout is the error of connections terminated because nothing
+// was read from them for too long. See IdleTimeout.
+var ErrIdleTimeout = errors.New("Idle timeout")
+
+// IdleTimeout sets the longest the connection can go without reading
+// anything, not even a heartbeat, after which it's considered stale and
+// terminated with ErrIdleTimeout, returned by ReadEvent and pending
+// commands. Otherwise a TCP session silently dropped by the network keeps
+// ReadEvent blocked forever. A timeout of zero, the default, disables it.
+//
+// The timeout must be longer than the interval of the events expected,
+// e.g. subscribe to HEARTBEAT and set it to a few heartbeat intervals. For
+// connections without regular events, see KeepAlive.
+func (h *Connection) IdleTimeout(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.idle.Store(int64(d))
+	// Applies to the read in progress as well.
+	if d == 0 {
+		h.conn.SetReadDeadline(time.Time{})
+	} else {
+		h.conn.SetReadDeadline(time.Now().Add(d))
+	}
+}
+
+// extendDeadline moves the read deadline of the socket, if any, for
+// another IdleTimeout. It's called before every read.
+func (h *Connection) extendDeadline() {
+	if d := time.Duration(h.idle.Load()); d > 0 {
+		h.conn.SetReadDeadline(time.Now().Add(d))
+	}
+}
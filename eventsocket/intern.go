@@ -0,0 +1,193 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "strings"
+
+// commonHeaders are the names of the headers sent by FreeSWITCH in most
+// events. Their capitalized keys are computed once, rather than for every
+// event, and the names don't need to be stored in each event.
+var commonHeaders = []string{
+	"Answer-State",
+	"Application",
+	"Application-Data",
+	"Application-Response",
+	"Application-UUID",
+	"Bridge-A-Unique-ID",
+	"Bridge-B-Unique-ID",
+	"Call-Direction",
+	"Caller-ANI",
+	"Caller-Callee-ID-Name",
+	"Caller-Callee-ID-Number",
+	"Caller-Caller-ID-Name",
+	"Caller-Caller-ID-Number",
+	"Caller-Channel-Answered-Time",
+	"Caller-Channel-Bridged-Time",
+	"Caller-Channel-Created-Time",
+	"Caller-Channel-Hangup-Time",
+	"Caller-Channel-Hold-Accum",
+	"Caller-Channel-Last-Hold",
+	"Caller-Channel-Name",
+	"Caller-Channel-Progress-Media-Time",
+	"Caller-Channel-Progress-Time",
+	"Caller-Channel-Resurrect-Time",
+	"Caller-Channel-Transfer-Time",
+	"Caller-Context",
+	"Caller-Destination-Number",
+	"Caller-Dialplan",
+	"Caller-Direction",
+	"Caller-Logical-Direction",
+	"Caller-Network-Addr",
+	"Caller-Orig-Caller-ID-Name",
+	"Caller-Orig-Caller-ID-Number",
+	"Caller-Privacy-Hide-Name",
+	"Caller-Privacy-Hide-Number",
+	"Caller-Profile-Created-Time",
+	"Caller-Profile-Index",
+	"Caller-RDNIS",
+	"Caller-Screen-Bit",
+	"Caller-Source",
+	"Caller-Unique-ID",
+	"Caller-Username",
+	"Channel-Call-State",
+	"Channel-Call-UUID",
+	"Channel-HIT-Dialplan",
+	"Channel-Name",
+	"Channel-Presence-ID",
+	"Channel-Read-Codec-Bit-Rate",
+	"Channel-Read-Codec-Name",
+	"Channel-Read-Codec-Rate",
+	"Channel-State",
+	"Channel-State-Number",
+	"Channel-Write-Codec-Bit-Rate",
+	"Channel-Write-Codec-Name",
+	"Channel-Write-Codec-Rate",
+	"Content-Length",
+	"Content-Type",
+	"Core-UUID",
+	"DTMF-Digit",
+	"DTMF-Duration",
+	"Event-Calling-File",
+	"Event-Calling-Function",
+	"Event-Calling-Line-Number",
+	"Event-Date-GMT",
+	"Event-Date-Local",
+	"Event-Date-Timestamp",
+	"Event-Name",
+	"Event-Sequence",
+	"Event-Subclass",
+	"FreeSWITCH-Hostname",
+	"FreeSWITCH-IPv4",
+	"FreeSWITCH-IPv6",
+	"FreeSWITCH-Switchname",
+	"Hangup-Cause",
+	"Job-Command",
+	"Job-Command-Arg",
+	"Job-UUID",
+	"Other-Leg-Unique-ID",
+	"Other-Type",
+	"Presence-Call-Direction",
+	"Reply-Text",
+	"Unique-ID",
+}
+
+var (
+	commonKeys  = make(map[string]string, len(commonHeaders)) // name:key
+	commonNames = make(map[string]string, len(commonHeaders)) // key:name
+)
+
+func init() {
+	for _, name := range commonHeaders {
+		key := capitalize(name)
+		commonKeys[name] = key
+		commonNames[key] = name
+	}
+}
+
+// headerName returns the name of a header as a string, without allocating
+// for common headers.
+func headerName(b []byte) string {
+	if key, ok := commonKeys[string(b)]; ok {
+		return commonNames[key]
+	}
+	return string(b)
+}
+
+// headerKey returns the capitalized key of a header name.
+func headerKey(name string) string {
+	if key, ok := commonKeys[name]; ok {
+		return key
+	}
+	return capitalize(name)
+}
+
+// defaultName returns the name FreeSWITCH usually sends for a header key,
+// which doesn't need to be stored in the event.
+func defaultName(key string) string {
+	if name, ok := commonNames[key]; ok {
+		return name
+	}
+	if strings.HasPrefix(key, "Variable_") {
+		return "v" + key[1:]
+	}
+	return key
+}
+
+// hasDefaultName reports whether name is the defaultName of key, without
+// allocating.
+func hasDefaultName(key, name string) bool {
+	if n, ok := commonNames[key]; ok {
+		return n == name
+	}
+	if strings.HasPrefix(key, "Variable_") {
+		return len(name) == len(key) && name[0] == 'v' && name[1:] == key[1:]
+	}
+	return name == key
+}
+
+// unescape url decodes a header value, like url.QueryUnescape, with a
+// single allocation. Values with invalid escapes are returned as is.
+func unescape(b []byte) string {
+	n := 0
+	for _, c := range b {
+		if c == '%' || c == '+' {
+			n++
+		}
+	}
+	if n == 0 {
+		return string(b)
+	}
+	var s strings.Builder
+	s.Grow(len(b))
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; c {
+		case '%':
+			if i+2 >= len(b) || !ishex(b[i+1]) || !ishex(b[i+2]) {
+				return string(b)
+			}
+			s.WriteByte(unhex(b[i+1])<<4 | unhex(b[i+2]))
+			i += 2
+		case '+':
+			s.WriteByte(' ')
+		default:
+			s.WriteByte(c)
+		}
+	}
+	return s.String()
+}
+
+func ishex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
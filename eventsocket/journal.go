@@ -0,0 +1,300 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journalMagic starts journal files, followed by records of the events,
+// each with an 8 byte time in nanoseconds since the epoch, a 4 byte length,
+// and the event in json, in big endian.
+const journalMagic = "ESLJRN1\n"
+
+const (
+	journalExt     = ".esljrn"
+	journalMaxSize = 64 << 20
+)
+
+var (
+	errJournalFormat = errors.New("Not an event journal")
+	errJournalClosed = errors.New("Journal closed")
+)
+
+// EventJournal appends events to a log on disk, in files of a directory
+// that are rotated as they grow, and replays them later, e.g. for audit,
+// or to process again the events missed while a downstream system was
+// down.
+//
+// Events are written as they're appended, without buffering, and Sync
+// flushes them to stable storage.
+//
+// Example:
+//
+//	j, err := eventsocket.OpenEventJournal("/var/spool/esl")
+//	go j.Run(ctx, c)
+//	...
+//	err = j.Replay(since, time.Time{}, func(at time.Time, ev *eventsocket.Event) error {
+//		return publish(ev)
+//	})
+type EventJournal struct {
+	// MaxSize is the size of a file after which the journal rotates to a
+	// new one. Defaults to 64MiB.
+	MaxSize int64
+
+	// MaxFiles, when set, is how many files are kept. The oldest are
+	// removed on rotation.
+	MaxFiles int
+
+	dir    string
+	mu     sync.Mutex
+	f      *os.File // Current file, nil until the first append
+	size   int64    // Of the current file
+	closed bool
+}
+
+// OpenEventJournal opens the journal in the given directory, creating it if
+// needed. Events appended go to a new file; existing ones are only read
+// by Replay.
+func OpenEventJournal(dir string) (*EventJournal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &EventJournal{dir: dir}, nil
+}
+
+// Run appends every event received by the connection to the journal, until
+// the context is cancelled or the connection terminates. Events are
+// journaled as received, including those dropped by Deduplicate or
+// SampleEvents. It returns early if appending fails.
+func (j *EventJournal) Run(ctx context.Context, c *Connection) error {
+	events := newEventQueue()
+	cancel := c.observe(func(ev *Event) bool {
+		events.push(ev.retain())
+		return false
+	})
+	defer cancel()
+	for {
+		for ev, ok := events.pop(); ok; ev, ok = events.pop() {
+			err := j.Append(ev)
+			ev.Release()
+			if err != nil {
+				for ev, ok := events.pop(); ok; ev, ok = events.pop() {
+					ev.Release()
+				}
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.done:
+			return c.err
+		case <-events.wake:
+		}
+	}
+}
+
+// Append writes an event to the journal, with the current time, rotating
+// to a new file first if the current one reached MaxSize.
+func (j *EventJournal) Append(ev *Event) error {
+	b, err := ev.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return errJournalClosed
+	}
+	if j.f == nil || j.size >= j.maxSize() {
+		if err := j.rotate(now); err != nil {
+			return err
+		}
+	}
+	rec := make([]byte, 12+len(b))
+	binary.BigEndian.PutUint64(rec[:8], uint64(now.UnixNano()))
+	binary.BigEndian.PutUint32(rec[8:12], uint32(len(b)))
+	copy(rec[12:], b)
+	n, err := j.f.Write(rec)
+	j.size += int64(n)
+	return err
+}
+
+// rotate closes the current file and creates a new one, named after the
+// time of its first record, with mu held.
+func (j *EventJournal) rotate(now time.Time) error {
+	if j.f != nil {
+		if err := j.f.Close(); err != nil {
+			return err
+		}
+		j.f = nil
+	}
+	var (
+		f   *os.File
+		err error
+	)
+	for ts := now.UnixNano(); ; ts++ {
+		// Two files can't start at the same time.
+		f, err = os.OpenFile(j.path(ts), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !errors.Is(err, os.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, journalMagic); err != nil {
+		f.Close()
+		return err
+	}
+	j.f, j.size = f, int64(len(journalMagic))
+	if j.MaxFiles > 0 {
+		files, err := j.files()
+		if err != nil {
+			return err
+		}
+		for len(files) > j.MaxFiles {
+			os.Remove(j.path(files[0]))
+			files = files[1:]
+		}
+	}
+	return nil
+}
+
+// Replay calls fn with the events appended between from, inclusive, and
+// to, exclusive, in order, with the time they were appended. A zero to
+// replays until the end. Replay stops at the first error returned by fn,
+// and returns it.
+//
+// A record cut short, e.g. by a crash while appending, ends its file.
+func (j *EventJournal) Replay(from, to time.Time, fn func(at time.Time, ev *Event) error) error {
+	files, err := j.files()
+	if err != nil {
+		return err
+	}
+	for i, ts := range files {
+		if !to.IsZero() && ts >= to.UnixNano() {
+			break
+		}
+		if i+1 < len(files) && files[i+1] <= from.UnixNano() {
+			continue // Ends before from
+		}
+		if err := j.replayFile(j.path(ts), from, to, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayFile calls fn with the events of a file in the given range.
+func (j *EventJournal) replayFile(path string, from, to time.Time, fn func(time.Time, *Event) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	magic := make([]byte, len(journalMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != journalMagic {
+		return fmt.Errorf("%s: %w", path, errJournalFormat)
+	}
+	var hdr [12]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil
+		}
+		at := time.Unix(0, int64(binary.BigEndian.Uint64(hdr[:8])))
+		b := make([]byte, binary.BigEndian.Uint32(hdr[8:]))
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil
+		}
+		if at.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !at.Before(to) {
+			return nil
+		}
+		ev := new(Event)
+		if err := ev.UnmarshalJSON(b); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := fn(at, ev); err != nil {
+			return err
+		}
+	}
+}
+
+// files returns the start times of the files of the journal, oldest first.
+func (j *EventJournal) files() ([]int64, error) {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []int64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), journalExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		if ts, err := strconv.ParseInt(name, 10, 64); err == nil {
+			files = append(files, ts)
+		}
+	}
+	sort.Slice(files, func(a, b int) bool { return files[a] < files[b] })
+	return files, nil
+}
+
+// path returns the path of the file that starts at the given time.
+func (j *EventJournal) path(ts int64) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%020d%s", ts, journalExt))
+}
+
+// Sync flushes the current file to stable storage.
+func (j *EventJournal) Sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	return j.f.Sync()
+}
+
+// Close syncs and closes the current file. Appending after Close fails,
+// replaying still works.
+func (j *EventJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.closed = true
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Sync()
+	if cerr := j.f.Close(); err == nil {
+		err = cerr
+	}
+	j.f = nil
+	return err
+}
+
+func (j *EventJournal) maxSize() int64 {
+	if j.MaxSize > 0 {
+		return j.MaxSize
+	}
+	return journalMaxSize
+}
@@ -0,0 +1,176 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const (
+	kafkaBatchSize  = 100
+	kafkaBatchDelay = 100 * time.Millisecond
+)
+
+// KafkaMessage is an event encoded for Kafka by KafkaSink.
+type KafkaMessage struct {
+	Topic string
+	Key   []byte // Keeps the events of a channel in order
+	Value []byte // The event in json
+	Time  time.Time
+}
+
+// KafkaProducer writes messages to Kafka. It's implemented on top of any
+// Kafka client, e.g. with github.com/segmentio/kafka-go:
+//
+//	type producer struct{ w *kafka.Writer }
+//
+//	func (p producer) Produce(ctx context.Context, msgs []eventsocket.KafkaMessage) error {
+//		kmsgs := make([]kafka.Message, len(msgs))
+//		for i, m := range msgs {
+//			kmsgs[i] = kafka.Message{Topic: m.Topic, Key: m.Key, Value: m.Value, Time: m.Time}
+//		}
+//		return p.w.WriteMessages(ctx, kmsgs...)
+//	}
+type KafkaProducer interface {
+	// Produce writes all messages, or fails. Messages of a failed batch
+	// are produced again.
+	Produce(ctx context.Context, msgs []KafkaMessage) error
+}
+
+// KafkaSink publishes events to Kafka topics, in batches, retrying with
+// exponential backoff while the brokers fail.
+//
+// Example:
+//
+//	s := eventsocket.NewKafkaSink(producer{w})
+//	s.Topic = eventsocket.KafkaTopicByHeader("fs.", "Variable_domain_name", "default")
+//	s.Match = func(ev *eventsocket.Event) bool {
+//		return strings.HasPrefix(ev.Get("Event-Name"), "CHANNEL_")
+//	}
+//	go s.Run(ctx, c)
+type KafkaSink struct {
+	// Producer writes the messages to Kafka.
+	Producer KafkaProducer
+
+	// Match, when set, selects the events published. Defaults to all.
+	Match func(*Event) bool
+
+	// Topic returns the topic of an event. Defaults to
+	// KafkaTopicByEventName("freeswitch.").
+	Topic func(*Event) string
+
+	// Key returns the key of an event, which Kafka uses to keep the events
+	// with the same key in order. Defaults to the Unique-ID of the
+	// channel, if any.
+	Key func(*Event) string
+
+	// BatchSize is how many events are produced at once, 100 by default.
+	// BatchDelay is how long the first event of a batch waits for others,
+	// 100ms by default.
+	BatchSize  int
+	BatchDelay time.Duration
+
+	// MinBackoff and MaxBackoff bound the wait between attempts to
+	// produce a batch, which doubles after every failure. They default to
+	// 100ms and 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// NewKafkaSink creates a KafkaSink that produces messages with p.
+func NewKafkaSink(p KafkaProducer) *KafkaSink {
+	return &KafkaSink{Producer: p}
+}
+
+// Run publishes the events received by the connection until the context
+// is cancelled or the connection terminates. Events must be subscribed to
+// separately.
+func (s *KafkaSink) Run(ctx context.Context, c *Connection) error {
+	size := s.BatchSize
+	if size <= 0 {
+		size = kafkaBatchSize
+	}
+	delay := s.BatchDelay
+	if delay <= 0 {
+		delay = kafkaBatchDelay
+	}
+	topic := s.Topic
+	if topic == nil {
+		topic = KafkaTopicByEventName("freeswitch.")
+	}
+	key := s.Key
+	if key == nil {
+		key = func(ev *Event) string { return ev.Get("Unique-Id") }
+	}
+	return (&sink{
+		name:       "kafka",
+		match:      s.Match,
+		batchSize:  size,
+		batchDelay: delay,
+		minBackoff: s.MinBackoff,
+		maxBackoff: s.MaxBackoff,
+		publish: func(ctx context.Context, events []*Event) error {
+			msgs := make([]KafkaMessage, 0, len(events))
+			for _, ev := range events {
+				b, err := ev.MarshalJSON()
+				if err != nil {
+					continue // Can't ever be published
+				}
+				m := KafkaMessage{Topic: topic(ev), Value: b}
+				if k := key(ev); k != "" {
+					m.Key = []byte(k)
+				}
+				if m.Time, err = ev.Timestamp(); err != nil {
+					m.Time = time.Now()
+				}
+				msgs = append(msgs, m)
+			}
+			if len(msgs) == 0 {
+				return nil
+			}
+			return s.Producer.Produce(ctx, msgs)
+		},
+	}).run(ctx, c)
+}
+
+// KafkaTopicByEventName returns a Topic function that names topics after
+// the events, or their subclass for CUSTOM events, e.g.
+// freeswitch.CHANNEL_ANSWER or freeswitch.sofia__register. Characters
+// Kafka doesn't allow in topic names become underscores.
+func KafkaTopicByEventName(prefix string) func(*Event) string {
+	return func(ev *Event) string {
+		name := ev.Get("Event-Name")
+		if name == "CUSTOM" {
+			name = ev.Get("Event-Subclass")
+		}
+		return prefix + kafkaTopicName(name)
+	}
+}
+
+// KafkaTopicByHeader returns a Topic function that names topics after the
+// value of a header, e.g. Variable_domain_name for a topic per tenant, or
+// fallback for events without it.
+func KafkaTopicByHeader(prefix, key, fallback string) func(*Event) string {
+	return func(ev *Event) string {
+		v := ev.Get(key)
+		if v == "" {
+			v = fallback
+		}
+		return prefix + kafkaTopicName(v)
+	}
+}
+
+// kafkaTopicName replaces the characters not allowed in topic names.
+func kafkaTopicName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' ||
+			r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,104 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrKeepAliveTimeout is the error of connections terminated because
+// FreeSWITCH didn't answer keepalive pings. See KeepAlive.
+var ErrKeepAliveTimeout = errors.New("Keepalive timeout")
+
+var errNotTCP = errors.New("Not a TCP connection")
+
+// keepAlivePing is sent by KeepAlive. Any reply will do, even an error.
+var keepAlivePing = []byte("api uptime\n\n")
+
+// SetTCPKeepAlive enables or disables TCP keepalive on the socket, with the
+// given idle time, interval between probes and number of probes, so the
+// operating system detects dead peers. See net.KeepAliveConfig.
+//
+// TCP keepalive probes may be answered by NAT devices and firewalls on
+// behalf of FreeSWITCH; use KeepAlive to check that FreeSWITCH itself is
+// still there.
+func (h *Connection) SetTCPKeepAlive(cfg net.KeepAliveConfig) error {
+	c, ok := h.conn.(wireConn).Conn.(*net.TCPConn)
+	if !ok {
+		return errNotTCP
+	}
+	return c.SetKeepAliveConfig(cfg)
+}
+
+// KeepAlive pings FreeSWITCH whenever nothing was read from the connection
+// for the given interval, and terminates the connection with
+// ErrKeepAliveTimeout if nothing is read within timeout after the ping,
+// rather than waiting hours for a read error on sessions silently dropped
+// by NAT devices or firewalls. A timeout of zero is the same as the
+// interval. An interval of zero stops pinging.
+//
+// The ping is an api command, answered by FreeSWITCH even to connections
+// not subscribed to any events. Any data read counts as an answer.
+func (h *Connection) KeepAlive(interval, timeout time.Duration) {
+	h.kmu.Lock()
+	defer h.kmu.Unlock()
+	if h.kstop != nil {
+		close(h.kstop)
+		h.kstop = nil
+	}
+	if interval <= 0 {
+		return
+	}
+	if timeout <= 0 {
+		timeout = interval
+	}
+	h.kstop = make(chan struct{})
+	go h.keepAlive(interval, timeout, h.kstop)
+}
+
+// keepAlive pings the connection until stop is closed or it terminates.
+func (h *Connection) keepAlive(interval, timeout time.Duration, stop chan struct{}) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	var pinged time.Time // When the unanswered ping was sent, if any
+	for {
+		select {
+		case <-stop:
+			return
+		case <-h.done:
+			return
+		case <-timer.C:
+		}
+		now, last := time.Now(), h.lastRead()
+		if !pinged.IsZero() && last.After(pinged) {
+			pinged = time.Time{}
+		}
+		if !pinged.IsZero() {
+			if d := pinged.Add(timeout).Sub(now); d > 0 {
+				timer.Reset(d)
+				continue
+			}
+			h.log().Errorf("eventsocket: no keepalive reply from %s in %s",
+				h.conn.RemoteAddr(), timeout)
+			h.terminate(ErrKeepAliveTimeout)
+			return
+		}
+		if d := last.Add(interval).Sub(now); d > 0 {
+			timer.Reset(d)
+			continue
+		}
+		pinged = now
+		// Not waiting for writes stuck on a dead socket.
+		go h.write(keepAlivePing, false)
+		timer.Reset(timeout)
+	}
+}
+
+// lastRead returns when data was last read from the connection.
+func (h *Connection) lastRead() time.Time {
+	return time.Unix(0, h.readAt.Load())
+}
@@ -0,0 +1,75 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const keepChannelInterval = 5 * time.Second
+
+// ErrChannelHangup is returned by KeepChannel when the channel hangs up
+// while the application is still waiting.
+var ErrChannelHangup = errors.New("Channel hung up")
+
+// KeepChannel keeps the channel identified by uuid alive while fn runs,
+// which is usually a call to an external system like a payment gateway.
+//
+// Every interval (5s when set to 0) it checks that the channel still exists
+// using uuid_exists and, when silence is set, queues silence on the channel
+// so it isn't left without media. The queued silence is interrupted as soon
+// as fn returns.
+//
+// KeepChannel returns the error returned by fn, or ErrChannelHangup if the
+// channel goes away first. In that case fn is left running and should
+// abort on its own.
+//
+// Example:
+//
+//	err := c.KeepChannel(uuid, 0, true, func() error {
+//		return chargeCreditCard(card)
+//	})
+//	if err == eventsocket.ErrChannelHangup {
+//		refund(card)
+//	}
+func (h *Connection) KeepChannel(uuid string, interval time.Duration, silence bool, fn func() error) error {
+	if !validArg(uuid) {
+		return errInvalidArgument
+	}
+	if interval <= 0 {
+		interval = keepChannelInterval
+	}
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		exists, err := h.api("uuid_exists " + uuid)
+		if err != nil {
+			return err
+		}
+		if exists != "true" {
+			return ErrChannelHangup
+		}
+		if silence {
+			_, err = h.api(fmt.Sprintf(
+				"uuid_broadcast %s silence_stream://%d aleg",
+				uuid, interval/time.Millisecond))
+			if err != nil {
+				return err
+			}
+		}
+		select {
+		case err = <-done:
+			if silence {
+				h.api("uuid_break " + uuid + " all")
+			}
+			return err
+		case <-tick.C:
+		}
+	}
+}
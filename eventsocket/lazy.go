@@ -0,0 +1,65 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"bytes"
+	"sync"
+)
+
+var variablePrefix = []byte("variable_")
+
+// lazyHeaders holds the raw header lines of an event that weren't decoded
+// when the event was parsed.
+type lazyHeaders struct {
+	once sync.Once
+	raw  []byte
+}
+
+// LazyVariables enables or disables lazy decoding of channel variables in
+// plain events.
+//
+// With verbose_events enabled, events like CHANNEL_EXECUTE_COMPLETE carry
+// hundreds of variable_ headers. With lazy decoding they're kept raw until
+// first accessed through any Event method, like Get or Variable, so
+// consumers that only look at a few headers such as Application-Response
+// don't pay for decoding all of them. Events kept by the helpers that
+// watch the connection, like ExecuteAsync or sinks, are decoded in full
+// when received.
+//
+// Code that accesses the Event.Header map directly must call DecodeAll
+// first. Events in json format are always decoded in full.
+func (h *Connection) LazyVariables(enable bool) {
+	h.lazyVariables.Store(enable)
+}
+
+// DecodeAll decodes any headers of the event whose decoding was deferred
+// by LazyVariables, so they can be accessed in the Header map.
+func (r *Event) DecodeAll() {
+	r.load()
+}
+
+// load decodes the headers deferred by LazyVariables, only once.
+func (r *Event) load() {
+	if r.lazy == nil {
+		return
+	}
+	r.lazy.once.Do(func() {
+		for _, line := range bytes.Split(r.lazy.raw, []byte{'\n'}) {
+			if len(line) > 0 {
+				r.parseHeader(line)
+			}
+		}
+		r.lazy.raw = nil
+	})
+}
+
+// peek returns the value of a header that's never deferred by
+// LazyVariables, like Event-Name, without decoding the deferred ones. It's
+// meant for code that looks at every event in the read loop.
+func (r *Event) peek(key string) string {
+	v, _ := r.Header[key].(string)
+	return v
+}
@@ -0,0 +1,45 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestLazyVariablesObserved checks that events handed over by observers,
+// here to ExecuteAsync, can be read while the read loop still looks at
+// them. Run it with -race.
+func TestLazyVariablesObserved(t *testing.T) {
+	h, _ := pipeServer(t, func(cmd *pipeCommand) string {
+		body := fmt.Sprintf("Event-Name: CHANNEL_EXECUTE_COMPLETE\n"+
+			"Application-UUID: %s\nApplication-Response: FILE%%20PLAYED\n"+
+			"variable_a: 1\nvariable_b: 2\nvariable_c: 3\n\n", cmd.header["event-uuid"])
+		return commandReply("+OK") + fmt.Sprintf(
+			"Content-Length: %d\nContent-Type: text/event-plain\n\n%s", len(body), body)
+	})
+	h.LazyVariables(true)
+	h.PoolEvents(true)
+	h.Deduplicate(NewDeduplicator(0))
+	events := readEvents(t, h, 100)
+	for i := 0; i < 100; i++ {
+		ex, err := h.ExecuteAsync("", "playback", "test.wav")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev, err := ex.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := ex.Response(); v != "FILE PLAYED" {
+			t.Fatalf("response is %q", v)
+		}
+		if v := ev.Variable("b"); v != "2" {
+			t.Fatalf("variable b is %q", v)
+		}
+		ev.Release()
+	}
+	<-events
+}
@@ -0,0 +1,52 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+// Logger receives the log messages of connections, so what happens inside
+// the library can be observed. Connections don't log anything unless a
+// Logger is set with SetLogger.
+//
+// Methods may be called from multiple goroutines at the same time.
+type Logger interface {
+	Debugf(format string, v ...interface{}) // Details, e.g. commands sent
+	Infof(format string, v ...interface{})  // e.g. connection terminated
+	Errorf(format string, v ...interface{}) // e.g. unexpected data received
+}
+
+// SetLogger sets where the connection logs to, or stops logging if l is
+// nil. The same Logger can be shared by multiple connections.
+//
+// Example with the standard log package:
+//
+//	type stdLogger struct{}
+//
+//	func (stdLogger) Debugf(f string, v ...interface{}) {}
+//	func (stdLogger) Infof(f string, v ...interface{})  { log.Printf(f, v...) }
+//	func (stdLogger) Errorf(f string, v ...interface{}) { log.Printf(f, v...) }
+//
+//	c.SetLogger(stdLogger{})
+func (h *Connection) SetLogger(l Logger) {
+	if l == nil {
+		h.logger.Store(nil)
+		return
+	}
+	h.logger.Store(&l)
+}
+
+// log returns the Logger of the connection, or one that discards
+// everything.
+func (h *Connection) log() Logger {
+	if l := h.logger.Load(); l != nil {
+		return *l
+	}
+	return nopLogger{}
+}
+
+// nopLogger discards all log messages.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, v ...interface{}) {}
+func (nopLogger) Infof(format string, v ...interface{})  {}
+func (nopLogger) Errorf(format string, v ...interface{}) {}
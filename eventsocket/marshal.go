@@ -0,0 +1,188 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var errMalformedJSON = errors.New("Malformed json event")
+
+// MarshalPlain encodes the event in the text/event-plain format, exactly as
+// FreeSWITCH sends it to event socket clients: an outer Content-Length and
+// Content-Type, followed by the URL encoded event headers and the body.
+//
+// Events that went through MarshalPlain can be parsed back by this package,
+// written to other event socket clients, or injected into FreeSWITCH.
+func (r *Event) MarshalPlain() ([]byte, error) {
+	var ev bytes.Buffer
+	for _, k := range r.Keys() {
+		if k == "Content-Length" {
+			continue // Recalculated below
+		}
+		if strings.IndexAny(k, ":\r\n") >= 0 {
+			return nil, fmt.Errorf("Invalid header name: %q", k)
+		}
+		ev.WriteString(r.name(k))
+		ev.WriteString(": ")
+		ev.WriteString(urlEncode(plainValue(r.Header[k])))
+		ev.WriteByte('\n')
+	}
+	if r.Body != "" {
+		ev.WriteString("Content-Length: ")
+		ev.WriteString(strconv.Itoa(len(r.Body)))
+		ev.WriteString("\n\n")
+		ev.WriteString(r.Body)
+	} else {
+		ev.WriteByte('\n')
+	}
+	b := bytes.NewBuffer(make([]byte, 0, ev.Len()+64))
+	fmt.Fprintf(b, "Content-Length: %d\nContent-Type: text/event-plain\n\n",
+		ev.Len())
+	ev.WriteTo(b)
+	return b.Bytes(), nil
+}
+
+// WriteTo writes the event to w in the text/event-plain format. See
+// MarshalPlain for details.
+func (r *Event) WriteTo(w io.Writer) (int64, error) {
+	b, err := r.MarshalPlain()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// MarshalJSON encodes the event in the same json format FreeSWITCH uses
+// for "events json". Header names are the ones sent by FreeSWITCH, e.g.
+// Caller-Caller-ID-Name rather than Caller-Caller-Id-Name, and the body, if
+// any, is stored under the "_body" key. Headers are in the order of Keys,
+// followed by the body.
+func (r *Event) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	field := func(k string, v interface{}) error {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		name, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+		return nil
+	}
+	for _, k := range r.Keys() {
+		if err := field(r.name(k), r.Header[k]); err != nil {
+			return nil, err
+		}
+	}
+	if r.Body != "" {
+		if err := field("_body", r.Body); err != nil {
+			return nil, err
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// UnmarshalJSON decodes events in the json format used by FreeSWITCH and
+// MarshalJSON, capitalizing header keys for consistency with plain events.
+// The order of the headers is kept, see Keys.
+func (r *Event) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return errMalformedJSON
+	}
+	r.Header = make(EventHeader)
+	r.Body = ""
+	r.names = nil
+	r.order = nil
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		k, _ := t.(string)
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		switch k {
+		case "":
+		case "_body":
+			if body, ok := v.(string); ok {
+				r.Body = body
+			}
+		default:
+			r.addHeader(k, v)
+		}
+	}
+	_, err := dec.Token() // }
+	return err
+}
+
+// plainValue converts header values to the string used in plain events.
+// Arrays, which only come in json events, use FreeSWITCH's ARRAY:: notation.
+func plainValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return "ARRAY::" + strings.Join(v, "|:")
+	case []interface{}:
+		s := make([]string, len(v))
+		for n, item := range v {
+			s[n] = fmt.Sprint(item)
+		}
+		return "ARRAY::" + strings.Join(s, "|:")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// urlEncode escapes s the way FreeSWITCH escapes header values in plain
+// events. Unlike url.QueryEscape, spaces become %20 rather than +, and
+// everything but letters, digits and -._~ is escaped.
+func urlEncode(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+			'0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			if b != nil {
+				b = append(b, c)
+			}
+			continue
+		}
+		if b == nil {
+			b = make([]byte, i, len(s)+16)
+			copy(b, s[:i])
+		}
+		b = append(b, '%', hex[c>>4], hex[c&15])
+	}
+	if b == nil {
+		return s
+	}
+	return string(b)
+}
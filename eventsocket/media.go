@@ -0,0 +1,192 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Displace plays a file into a live call, using uuid_displace, e.g. "this
+// call may be recorded". The file replaces the audio of the channel, or
+// is mixed with it when mux is set. It stops after limit, rounded up to
+// seconds, or when the file ends when limit is 0.
+//
+// Example:
+//
+//	c.Displace(uuid, "/prompts/recorded.wav", 0, true)
+func (h *Connection) Displace(uuid, file string, limit time.Duration, mux bool) error {
+	if !validArg(uuid) || !validArg(file) || limit < 0 {
+		return errInvalidArgument
+	}
+	cmd := "uuid_displace " + uuid + " start " + file
+	// The limit is positional, it can only be omitted when mux is too.
+	if limit > 0 || mux {
+		s := int64((limit + time.Second - 1) / time.Second)
+		cmd += " " + strconv.FormatInt(s, 10)
+	}
+	if mux {
+		cmd += " mux"
+	}
+	_, err := h.api(cmd)
+	return err
+}
+
+// StopDisplace stops playing a file started by Displace.
+func (h *Connection) StopDisplace(uuid, file string) error {
+	if !validArg(uuid) || !validArg(file) {
+		return errInvalidArgument
+	}
+	_, err := h.api("uuid_displace " + uuid + " stop " + file)
+	return err
+}
+
+// AudioDirection is the direction of the audio adjusted by AudioControl.
+type AudioDirection string
+
+// Audio directions, from the point of view of FreeSWITCH.
+const (
+	AudioRead  AudioDirection = "read"  // Audio from the channel, e.g. the agent's voice
+	AudioWrite AudioDirection = "write" // Audio sent to the channel
+)
+
+// Volume levels accepted by uuid_audio. Levels out of range are clamped.
+const (
+	MinAudioLevel = -4
+	MaxAudioLevel = 4
+)
+
+// AudioLevels are the volume levels and mute state of a channel.
+type AudioLevels struct {
+	ReadLevel  int
+	WriteLevel int
+	ReadMute   bool
+	WriteMute  bool
+}
+
+// AudioControl adjusts the volume of channels and mutes them, using
+// uuid_audio, and keeps track of the levels set, which FreeSWITCH can't be
+// queried for.
+//
+// It can be fed with events read from the connection to forget channels
+// once they're gone, which requires CHANNEL_DESTROY events.
+//
+// Example:
+//
+//	a := eventsocket.NewAudioControl(c)
+//	a.Mute(agentUUID, eventsocket.AudioRead, true) // The customer can't hear the agent
+//	levels, _ := a.Levels(agentUUID)
+type AudioControl struct {
+	conn   *Connection
+	mu     sync.Mutex
+	levels map[string]*AudioLevels
+}
+
+// NewAudioControl creates an AudioControl that issues commands on the
+// given connection.
+func NewAudioControl(c *Connection) *AudioControl {
+	return &AudioControl{conn: c, levels: make(map[string]*AudioLevels)}
+}
+
+// SetLevel sets the volume level of a channel in the given direction, from
+// MinAudioLevel to MaxAudioLevel, 0 being the original volume.
+func (a *AudioControl) SetLevel(uuid string, dir AudioDirection, level int) error {
+	if level < MinAudioLevel {
+		level = MinAudioLevel
+	} else if level > MaxAudioLevel {
+		level = MaxAudioLevel
+	}
+	err := a.audio(uuid, dir, "level "+strconv.Itoa(level))
+	if err != nil {
+		return err
+	}
+	a.update(uuid, func(l *AudioLevels) {
+		if dir == AudioRead {
+			l.ReadLevel = level
+		} else {
+			l.WriteLevel = level
+		}
+	})
+	return nil
+}
+
+// Mute mutes or unmutes a channel in the given direction.
+func (a *AudioControl) Mute(uuid string, dir AudioDirection, mute bool) error {
+	n := 0
+	if mute {
+		n = 1
+	}
+	if err := a.audio(uuid, dir, "mute "+strconv.Itoa(n)); err != nil {
+		return err
+	}
+	a.update(uuid, func(l *AudioLevels) {
+		if dir == AudioRead {
+			l.ReadMute = mute
+		} else {
+			l.WriteMute = mute
+		}
+	})
+	return nil
+}
+
+// Reset stops adjusting the audio of a channel, restoring the original
+// volume in both directions.
+func (a *AudioControl) Reset(uuid string) error {
+	if !validArg(uuid) {
+		return errInvalidArgument
+	}
+	if _, err := a.conn.api("uuid_audio " + uuid + " stop"); err != nil {
+		return err
+	}
+	a.forget(uuid)
+	return nil
+}
+
+// Levels returns the levels set on a channel, and whether any were set.
+func (a *AudioControl) Levels(uuid string) (AudioLevels, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if l, ok := a.levels[uuid]; ok {
+		return *l, true
+	}
+	return AudioLevels{}, false
+}
+
+// HandleEvent forgets the levels of channels that are destroyed. Other
+// events are ignored.
+func (a *AudioControl) HandleEvent(ev *Event) {
+	if ev.Get("Event-Name") == "CHANNEL_DESTROY" {
+		a.forget(ev.Get("Unique-Id"))
+	}
+}
+
+// audio runs uuid_audio start.
+func (a *AudioControl) audio(uuid string, dir AudioDirection, args string) error {
+	if !validArg(uuid) || dir != AudioRead && dir != AudioWrite {
+		return errInvalidArgument
+	}
+	_, err := a.conn.api("uuid_audio " + uuid + " start " + string(dir) + " " + args)
+	return err
+}
+
+// update changes the levels of a channel.
+func (a *AudioControl) update(uuid string, fn func(*AudioLevels)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	l, ok := a.levels[uuid]
+	if !ok {
+		l = &AudioLevels{}
+		a.levels[uuid] = l
+	}
+	fn(l)
+}
+
+// forget removes the levels of a channel.
+func (a *AudioControl) forget(uuid string) {
+	a.mu.Lock()
+	delete(a.levels, uuid)
+	a.mu.Unlock()
+}
@@ -0,0 +1,87 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"strings"
+	"time"
+)
+
+// Metrics receives measurements of what connections are doing, for
+// exporting to monitoring systems. See PrometheusMetrics.
+//
+// Methods are called from the read loop and from callers sending commands,
+// possibly from multiple connections at the same time, and must not block.
+type Metrics interface {
+	// EventReceived is called for every event received, by name: the
+	// Event-Name, or the Event-Subclass of CUSTOM events.
+	EventReceived(name string)
+
+	// EventDropped is called for events received but not delivered to
+	// ReadEvent, e.g. suppressed by SampleEvents.
+	EventDropped(name string)
+
+	// CommandSent is called when the reply to a command arrives, or the
+	// command fails, with how long it took. The command is its first
+	// word, and the api command for api and bgapi, e.g. "api status".
+	CommandSent(command string, latency time.Duration, err error)
+
+	// EventsLost is called with the number of events missing in gaps of
+	// the Event-Sequence, when tracked. See OnSequenceGap.
+	EventsLost(n uint64)
+
+	// BytesRead is called with the number of bytes read from the socket.
+	BytesRead(n int)
+
+	// Reconnected is called by clients that reconnect, every time they
+	// establish a new connection after losing one.
+	Reconnected()
+}
+
+// SetMetrics sets where the connection reports its measurements, or stops
+// reporting them if m is nil. The same Metrics can be shared by multiple
+// connections.
+func (h *Connection) SetMetrics(m Metrics) {
+	if m == nil {
+		h.metrics.Store(nil)
+		return
+	}
+	h.metrics.Store(&m)
+}
+
+// stats returns the Metrics of the connection, or nil.
+func (h *Connection) stats() Metrics {
+	if m := h.metrics.Load(); m != nil {
+		return *m
+	}
+	return nil
+}
+
+// eventName returns the name of the event for metrics and sampling: the
+// Event-Name, or the Event-Subclass of CUSTOM events.
+func eventName(ev *Event) string {
+	name := ev.peek("Event-Name")
+	if name == "CUSTOM" {
+		name = ev.peek("Event-Subclass")
+	}
+	return name
+}
+
+// commandName returns the name of a command for metrics, e.g. "api status"
+// for "api status\r\n\r\n".
+func commandName(cmd []byte) string {
+	s := string(cmd)
+	if n := strings.IndexAny(s, "\r\n"); n >= 0 {
+		s = s[:n]
+	}
+	f := strings.Fields(s)
+	switch {
+	case len(f) == 0:
+		return ""
+	case len(f) > 1 && (f[0] == "api" || f[0] == "bgapi"):
+		return f[0] + " " + f[1]
+	}
+	return f[0]
+}
@@ -0,0 +1,46 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "errors"
+
+var errOwnChannel = errors.New("Outbound connections only get the events of their own channel")
+
+// MyEvents subscribes to the events of a single channel, in the given
+// format, plain or json, which defaults to plain.
+//
+// On inbound connections the channel must be given, and it's sent as
+// "myevents <uuid> <format>". On outbound connections, after Connect,
+// it's always the channel of the connection, so the UUID may be empty,
+// and it's sent as "myevents <format>".
+//
+// Example:
+//
+//	c, err := eventsocket.Dial("localhost:8021", "ClueCon")
+//	...
+//	err = c.MyEvents(uuid, "json")
+func (h *Connection) MyEvents(uuid, format string) error {
+	switch format {
+	case "":
+		format = "plain"
+	case "plain", "json":
+	default:
+		return errInvalidArgument
+	}
+	cmd := "myevents " + format
+	if d := h.ChannelData(); d == nil {
+		if uuid == "" {
+			return errUUIDRequired
+		}
+		if !validArg(uuid) {
+			return errInvalidArgument
+		}
+		cmd = "myevents " + uuid + " " + format
+	} else if uuid != "" && uuid != d.UUID {
+		return errOwnChannel
+	}
+	_, err := h.Send(cmd)
+	return err
+}
@@ -0,0 +1,109 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const natsSubject = "fs.events.{event}"
+
+// NATSPublisher publishes messages to NATS. It's implemented on top of any
+// NATS client, e.g. with github.com/nats-io/nats.go, either to core NATS:
+//
+//	type publisher struct{ nc *nats.Conn }
+//
+//	func (p publisher) Publish(ctx context.Context, subject string, data []byte) error {
+//		return p.nc.Publish(subject, data)
+//	}
+//
+// or to JetStream, for persistence, where Publish returns once the stream
+// stored the message:
+//
+//	type publisher struct{ js jetstream.JetStream }
+//
+//	func (p publisher) Publish(ctx context.Context, subject string, data []byte) error {
+//		_, err := p.js.Publish(ctx, subject, data)
+//		return err
+//	}
+type NATSPublisher interface {
+	Publish(ctx context.Context, subject string, data []byte) error
+}
+
+// NATSSink publishes events to NATS subjects as json, retrying with
+// exponential backoff while publishing fails, e.g. while the client
+// reconnects.
+//
+// Example:
+//
+//	s := eventsocket.NewNATSSink(publisher{nc})
+//	s.Subject = "fs.{FreeSWITCH-Hostname}.{event}"
+//	go s.Run(ctx, c)
+type NATSSink struct {
+	// Publisher publishes the messages to NATS.
+	Publisher NATSPublisher
+
+	// Match, when set, selects the events published. Defaults to all.
+	Match func(*Event) bool
+
+	// Subject is the template of the subjects, where {event} is replaced
+	// by the name of the event, or its subclass for CUSTOM events, and
+	// {Header-Name} by the value of that header. Characters NATS doesn't
+	// allow in tokens, like dots, become underscores, as do empty values.
+	// Defaults to fs.events.{event}, e.g. fs.events.CHANNEL_ANSWER.
+	Subject string
+
+	// MinBackoff and MaxBackoff bound the wait between attempts to
+	// publish an event, which doubles after every failure. They default to
+	// 100ms and 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// NewNATSSink creates a NATSSink that publishes messages with p.
+func NewNATSSink(p NATSPublisher) *NATSSink {
+	return &NATSSink{Publisher: p}
+}
+
+// Run publishes the events received by the connection until the context
+// is cancelled or the connection terminates. Events must be subscribed to
+// separately.
+func (s *NATSSink) Run(ctx context.Context, c *Connection) error {
+	subject := s.Subject
+	if subject == "" {
+		subject = natsSubject
+	}
+	return (&sink{
+		name:       "nats",
+		match:      s.Match,
+		batchSize:  1, // Messages are published one by one
+		minBackoff: s.MinBackoff,
+		maxBackoff: s.MaxBackoff,
+		publish: func(ctx context.Context, events []*Event) error {
+			ev := events[0]
+			b, err := ev.MarshalJSON()
+			if err != nil {
+				return nil // Can't ever be published
+			}
+			return s.Publisher.Publish(ctx, expandTemplate(subject, ev, natsToken), b)
+		},
+	}).run(ctx, c)
+}
+
+// natsToken replaces the characters not allowed in a token of a subject.
+func natsToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,301 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errNoEndpoint = errors.New("No endpoint to originate to")
+	errOriginate  = errors.New("Unexpected originate result")
+)
+
+// OriginateError is the failure of a call made by Originate.
+type OriginateError struct {
+	// Cause is the hangup cause reported by FreeSWITCH, like NO_ANSWER,
+	// USER_BUSY or CALL_REJECTED.
+	Cause string
+}
+
+func (e *OriginateError) Error() string {
+	return "Originate failed: " + e.Cause
+}
+
+// Originate makes a call in the background, using bgapi, and waits for it
+// to be answered. It returns the UUID of the new channel, or an
+// *OriginateError with the reason the call failed.
+//
+// The connection must be subscribed to BACKGROUND_JOB events. Cancelling
+// the context stops waiting, but doesn't stop the call.
+//
+// Example:
+//
+//	c.Send("events plain BACKGROUND_JOB")
+//	uuid, err := c.Originate(ctx, eventsocket.NewOriginate().
+//		Endpoint("user/1000").
+//		Extension("9000", "XML", "default"))
+//	if e, ok := err.(*eventsocket.OriginateError); ok {
+//		fmt.Println("call failed:", e.Cause)
+//	}
+func (h *Connection) Originate(ctx context.Context, b *OriginateBuilder) (string, error) {
+	cmd, err := b.Build()
+	if err != nil {
+		return "", err
+	}
+	j, err := h.BgAPI(cmd)
+	if err != nil {
+		return "", err
+	}
+	select {
+	case <-ctx.Done():
+		j.cancel()
+		return "", ctx.Err()
+	case <-j.done:
+	case <-h.done:
+	}
+	if _, err := j.Wait(); err != nil && j.Event() == nil {
+		return "", err
+	}
+	return parseOriginate(j.Event().Body)
+}
+
+// parseOriginate parses the result of originate, +OK uuid or -ERR cause.
+func parseOriginate(result string) (string, error) {
+	result = strings.TrimSpace(result)
+	switch {
+	case strings.HasPrefix(result, "+OK "):
+		return strings.TrimSpace(result[4:]), nil
+	case strings.HasPrefix(result, "-ERR"):
+		cause := strings.TrimSpace(result[4:])
+		if cause == "" {
+			return "", errOriginate
+		}
+		return "", &OriginateError{Cause: cause}
+	default:
+		return "", errOriginate
+	}
+}
+
+// OriginateBuilder builds originate commands, taking care of the syntax of
+// dial strings: channel variables, simultaneous and sequential legs, and
+// enterprise originate.
+//
+// Endpoints added with Endpoint are called simultaneously, those added
+// with Then are called once the previous ones failed, and those added
+// after Enterprise are called in parallel with all others, each group with
+// its own settings. Variables set with Var apply to all legs, GroupVar to
+// the current group, and LegVar to the last endpoint added.
+//
+// See http://wiki.freeswitch.org/wiki/Mod_commands#originate for details.
+//
+// Example:
+//
+//	cmd, err := eventsocket.NewOriginate().
+//		CallerID("Support", "5551000").
+//		Timeout(30 * time.Second).
+//		Endpoint("user/1000").
+//		Endpoint("user/1001").LegVar("leg_delay_start", "5").
+//		Enterprise().
+//		Endpoint("sofia/gateway/pstn/5551234").
+//		Extension("9000", "XML", "default").
+//		Build()
+type OriginateBuilder struct {
+	vars   []channelVar
+	groups []*originateGroup
+	target string
+}
+
+// originateGroup is a group of legs of an enterprise originate.
+type originateGroup struct {
+	vars []channelVar
+	legs []*originateLeg
+}
+
+// originateLeg is an endpoint with its own variables. Legs after a
+// sequential one are only called if the previous ones fail.
+type originateLeg struct {
+	vars       []channelVar
+	endpoint   string
+	sequential bool
+}
+
+// NewOriginate creates an OriginateBuilder. Calls are parked unless a
+// target is set with App or Extension.
+func NewOriginate() *OriginateBuilder {
+	return &OriginateBuilder{groups: []*originateGroup{{}}}
+}
+
+// Endpoint adds an endpoint, like user/1000 or sofia/gateway/pstn/5551234,
+// called simultaneously with the other endpoints of the current group.
+func (b *OriginateBuilder) Endpoint(dialstring string) *OriginateBuilder {
+	g := b.group()
+	g.legs = append(g.legs, &originateLeg{endpoint: dialstring})
+	return b
+}
+
+// Then adds an endpoint called only if all the previous ones of the group
+// fail. Endpoints added after it are called simultaneously with it.
+func (b *OriginateBuilder) Then(dialstring string) *OriginateBuilder {
+	g := b.group()
+	g.legs = append(g.legs, &originateLeg{endpoint: dialstring, sequential: true})
+	return b
+}
+
+// Enterprise starts a new group of endpoints, called in parallel with all
+// the other groups. The first group to answer wins.
+func (b *OriginateBuilder) Enterprise() *OriginateBuilder {
+	b.groups = append(b.groups, &originateGroup{})
+	return b
+}
+
+// Var sets a channel variable of all legs.
+func (b *OriginateBuilder) Var(name, value string) *OriginateBuilder {
+	b.vars = setVar(b.vars, name, value)
+	return b
+}
+
+// GroupVar sets a channel variable of all legs of the current group.
+func (b *OriginateBuilder) GroupVar(name, value string) *OriginateBuilder {
+	g := b.group()
+	g.vars = setVar(g.vars, name, value)
+	return b
+}
+
+// LegVar sets a channel variable of the last endpoint added, like
+// leg_timeout or leg_delay_start. It's ignored when there's no endpoint.
+func (b *OriginateBuilder) LegVar(name, value string) *OriginateBuilder {
+	g := b.group()
+	if len(g.legs) > 0 {
+		leg := g.legs[len(g.legs)-1]
+		leg.vars = setVar(leg.vars, name, value)
+	}
+	return b
+}
+
+// CallerID sets the caller ID name and number presented to the endpoints.
+// Empty values are not set.
+func (b *OriginateBuilder) CallerID(name, number string) *OriginateBuilder {
+	if name != "" {
+		b.Var("origination_caller_id_name", name)
+	}
+	if number != "" {
+		b.Var("origination_caller_id_number", number)
+	}
+	return b
+}
+
+// Timeout sets how long to wait for the endpoints to answer, rounded up to
+// seconds.
+func (b *OriginateBuilder) Timeout(d time.Duration) *OriginateBuilder {
+	s := int64((d + time.Second - 1) / time.Second)
+	return b.Var("originate_timeout", strconv.FormatInt(s, 10))
+}
+
+// App makes the answered call run an application, like park or
+// playback, instead of going to the dialplan.
+func (b *OriginateBuilder) App(appName, appArg string) *OriginateBuilder {
+	b.target = QuoteArg("&" + appName + "(" + appArg + ")")
+	return b
+}
+
+// Extension makes the answered call go to an extension of the dialplan.
+// The dialplan and context may be empty, in which case FreeSWITCH uses
+// XML and default.
+func (b *OriginateBuilder) Extension(extension, dialplan, context string) *OriginateBuilder {
+	b.target = QuoteArg(extension)
+	if dialplan != "" || context != "" {
+		if dialplan == "" {
+			dialplan = "XML"
+		}
+		b.target += " " + QuoteArg(dialplan)
+		if context != "" {
+			b.target += " " + QuoteArg(context)
+		}
+	}
+	return b
+}
+
+// Dialstring returns the dial string of the endpoints and variables, also
+// usable with the bridge application.
+func (b *OriginateBuilder) Dialstring() (string, error) {
+	var groups []*originateGroup
+	for _, g := range b.groups {
+		if len(g.legs) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	if len(groups) == 0 {
+		return "", errNoEndpoint
+	}
+	var s []string
+	prefix := ""
+	if len(groups) > 1 && len(b.vars) > 0 {
+		v, err := formatVars('<', '>', b.vars)
+		if err != nil {
+			return "", err
+		}
+		prefix = v
+	}
+	for _, g := range groups {
+		vars := g.vars
+		if len(groups) == 1 {
+			vars = append(append([]channelVar(nil), b.vars...), g.vars...)
+		}
+		v, err := formatVars('{', '}', vars)
+		if err != nil {
+			return "", err
+		}
+		for n, leg := range g.legs {
+			if n > 0 {
+				if leg.sequential {
+					v += "|"
+				} else {
+					v += ","
+				}
+			}
+			lv, err := formatVars('[', ']', leg.vars)
+			if err != nil {
+				return "", err
+			}
+			v += lv + leg.endpoint
+		}
+		s = append(s, v)
+	}
+	return prefix + strings.Join(s, ":_:"), nil
+}
+
+// Build returns the originate command, without the api or bgapi prefix.
+func (b *OriginateBuilder) Build() (string, error) {
+	ds, err := b.Dialstring()
+	if err != nil {
+		return "", err
+	}
+	target := b.target
+	if target == "" {
+		target = "&park()"
+	}
+	return "originate " + ds + " " + target, nil
+}
+
+// group returns the current group.
+func (b *OriginateBuilder) group() *originateGroup {
+	return b.groups[len(b.groups)-1]
+}
+
+// setVar sets a variable, replacing its previous value if any.
+func setVar(vars []channelVar, name, value string) []channelVar {
+	for n := range vars {
+		if vars[n].name == name {
+			vars[n].value = value
+			return vars
+		}
+	}
+	return append(vars, channelVar{name, value})
+}
@@ -0,0 +1,95 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "errors"
+
+var errUUIDRequired = errors.New("UUID required on inbound connections")
+var errNotFull = errors.New("Other channels can only be controlled in full mode")
+
+// Async reports whether the connection is an outbound connection in async
+// mode, once Connect was called. In async mode, sendmsg returns right
+// away, so applications executed without event-lock may run out of order;
+// in sync mode, it returns once the application is running, and the
+// async option of ExecuteOptions skips the wait.
+func (h *Connection) Async() bool {
+	d := h.ChannelData()
+	return d != nil && d.Async
+}
+
+// Full reports whether the connection is an outbound connection with full
+// access, once Connect was called. Outbound connections without it can
+// only control their own channel.
+func (h *Connection) Full() bool {
+	d := h.ChannelData()
+	return d != nil && d.Full
+}
+
+// TargetUUID returns the UUID that commands about the given channel, like
+// sendmsg, must carry: none for the channel of an outbound connection,
+// which is the default, or the UUID itself. It fails for an empty UUID on
+// inbound connections, and for other channels on outbound connections
+// without full access.
+//
+// Example:
+//
+//	uuid, err := c.TargetUUID(other)
+//	...
+//	c.ExecuteWith("playback", file, &eventsocket.ExecuteOptions{UUID: uuid})
+func (h *Connection) TargetUUID(uuid string) (string, error) {
+	d := h.ChannelData()
+	switch {
+	case d == nil && uuid == "":
+		return "", errUUIDRequired
+	case d == nil:
+		return uuid, nil
+	case uuid == "" || uuid == d.UUID:
+		return "", nil
+	case !d.Full:
+		return "", errNotFull
+	}
+	return uuid, nil
+}
+
+// Resume makes the dialplan go on with the next application once the
+// socket application ends, when the connection closes, instead of hanging
+// up the channel. It lets the socket application do part of the call, e.g.
+// a lookup that sets variables, and the dialplan the rest. It only applies
+// to outbound connections, after Connect.
+//
+// Example:
+//
+//	func handler(c *eventsocket.Connection, d *eventsocket.ChannelData) {
+//		c.Resume()
+//		c.Execute("set", "route="+lookup(d.CallerIDNumber), true)
+//		c.Close() // The dialplan goes on, with ${route}
+//	}
+func (h *Connection) Resume() error {
+	if h.ChannelData() == nil {
+		return errNotConnected
+	}
+	_, err := h.Send("resume")
+	return err
+}
+
+// RouteOtherChannels hands the events of channels other than the one of
+// the outbound connection to fn, in order, instead of ReadEvent, until
+// cancel is called or the connection terminates. On connections with full
+// access subscribed to all events, it keeps ReadEvent for the events of
+// the call, while fn tracks the rest of the system. Events without a
+// Unique-ID, like HEARTBEAT, still go to ReadEvent.
+//
+// It must be called after Connect. fn runs in its own goroutine, and
+// the events are handed over as if returned by ReadEvent.
+func (h *Connection) RouteOtherChannels(fn func(*Event)) (cancel func()) {
+	own := ""
+	if d := h.ChannelData(); d != nil {
+		own = d.UUID
+	}
+	return h.startRoute(&h.others, func(ev *Event) bool {
+		uuid := ev.peek("Unique-Id")
+		return uuid != "" && uuid != own
+	}, fn)
+}
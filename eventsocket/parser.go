@@ -0,0 +1,128 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+var errUnsupportedContent = errors.New("Unsupported content type")
+
+// Parser reads the messages of the event socket protocol from any reader,
+// e.g. a file with data captured from a socket, without a Connection.
+//
+// Example:
+//
+//	p := eventsocket.NewParser(f)
+//	for {
+//		ev, err := p.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+type Parser struct {
+	r  *bufio.Reader
+	fh frameHeader
+}
+
+// NewParser creates a Parser that reads from r.
+func NewParser(r io.Reader) *Parser {
+	return &Parser{r: bufio.NewReaderSize(r, bufferSize)}
+}
+
+// Next reads and returns the next message: events in plain or json format,
+// disconnect notices, command replies and api responses, the latter with
+// their headers and body as sent by FreeSWITCH. It returns io.EOF at the
+// end of the reader.
+//
+// Messages with unsupported content types are skipped and reported as an
+// error, after which Next can be called again.
+func (p *Parser) Next() (*Event, error) {
+	if err := readFrameHeader(p.r, &p.fh); err != nil {
+		return nil, err
+	}
+	var body []byte
+	if p.fh.length > 0 {
+		buf, err := readBody(p.r, p.fh.length)
+		if err != nil {
+			return nil, err
+		}
+		defer putBody(buf)
+		body = *buf
+	}
+	return parseMessage(&p.fh, body, false, false)
+}
+
+// ParseEvent parses a single message of the event socket protocol, e.g.
+//
+//	Content-Length: 526
+//	Content-Type: text/event-plain
+//
+//	Event-Name: CHANNEL_ANSWER
+//	...
+//
+// See Parser for details.
+func ParseEvent(b []byte) (*Event, error) {
+	size := len(b)
+	if size < 16 {
+		size = 16 // bufio's minimum
+	}
+	p := &Parser{r: bufio.NewReaderSize(bytes.NewReader(b), size)}
+	ev, err := p.Next()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return ev, err
+}
+
+// parseMessage returns the Event of a message, given its headers and body.
+// When lazy is set, channel variables of plain events are only decoded on
+// first access. When pooled is set, events are leased from eventPool.
+func parseMessage(fh *frameHeader, body []byte, lazy, pooled bool) (*Event, error) {
+	var ev *Event
+	switch fh.contentType {
+	case "text/event-plain", "text/event-json":
+		ev = newEvent(pooled)
+	default:
+		ev = &Event{}
+	}
+	switch fh.contentType {
+	case "command/reply":
+		// Replies starting with % are url encoded.
+		text := fh.get("Reply-Text")
+		ev.Header = make(EventHeader)
+		fh.copyTo(ev, text != "" && text[0] == '%')
+		ev.Body = string(body)
+	case "api/response", "text/disconnect-notice", "auth/request":
+		ev.Header = make(EventHeader)
+		fh.copyTo(ev, false)
+		ev.Body = string(body)
+	case "text/event-plain":
+		// Sized for all headers, rather than growing as they're added.
+		// Pooled events reuse theirs.
+		if ev.Header == nil {
+			n := bytes.Count(body, []byte{'\n'})
+			ev.Header = make(EventHeader, n)
+			ev.order = make([]string, 0, n)
+		}
+		if err := parsePlain(body, ev, lazy); err != nil {
+			ev.Release()
+			return nil, err
+		}
+	case "text/event-json":
+		if err := json.Unmarshal(body, ev); err != nil {
+			ev.Release()
+			return nil, err
+		}
+	default:
+		return nil, errUnsupportedContent
+	}
+	return ev, nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// plainEventBody is a CHANNEL_ANSWER event with the usual headers and a
+// few channel variables, as sent by FreeSWITCH.
+const plainEventBody = `Event-Name: CHANNEL_ANSWER
+Core-UUID: 0a3b1a9c-5f45-4b0e-9a5c-0f2d3c4b5a69
+FreeSWITCH-Hostname: fs1.example.com
+FreeSWITCH-Switchname: fs1
+FreeSWITCH-IPv4: 10.0.0.1
+FreeSWITCH-IPv6: %3A%3A1
+Event-Date-Local: 2024-01-02%2003%3A04%3A05
+Event-Date-GMT: Tue,%2002%20Jan%202024%2003%3A04%3A05%20GMT
+Event-Date-Timestamp: 1704164645123456
+Event-Calling-File: switch_channel.c
+Event-Calling-Function: switch_channel_perform_mark_answered
+Event-Calling-Line-Number: 3927
+Event-Sequence: 4711
+Channel-State: CS_EXECUTE
+Channel-Call-State: ACTIVE
+Channel-State-Number: 4
+Channel-Name: sofia/internal/1000%40example.com
+Unique-ID: 5b2c9f0e-7d1a-4c3b-8e6f-1a2b3c4d5e6f
+Call-Direction: inbound
+Presence-Call-Direction: inbound
+Channel-HIT-Dialplan: true
+Channel-Presence-ID: 1000%40example.com
+Channel-Call-UUID: 5b2c9f0e-7d1a-4c3b-8e6f-1a2b3c4d5e6f
+Answer-State: answered
+Caller-Direction: inbound
+Caller-Username: 1000
+Caller-Dialplan: XML
+Caller-Caller-ID-Name: Alice
+Caller-Caller-ID-Number: 1000
+Caller-Network-Addr: 10.0.0.2
+Caller-Destination-Number: 9000
+Caller-Unique-ID: 5b2c9f0e-7d1a-4c3b-8e6f-1a2b3c4d5e6f
+Caller-Source: mod_sofia
+Caller-Context: default
+Caller-Channel-Name: sofia/internal/1000%40example.com
+Caller-Profile-Index: 1
+Caller-Channel-Created-Time: 1704164640000000
+Caller-Channel-Answered-Time: 1704164645123456
+variable_direction: inbound
+variable_uuid: 5b2c9f0e-7d1a-4c3b-8e6f-1a2b3c4d5e6f
+variable_session_id: 42
+variable_sip_from_user: 1000
+variable_sip_from_host: example.com
+variable_sip_user_agent: Example%20Phone%201.0
+variable_sip_call_id: 1a2b3c4d%4010.0.0.2
+variable_read_codec: PCMU
+variable_write_codec: PCMU
+variable_current_application: answer
+
+`
+
+// benchMessages returns the event in plain and json format, as messages of
+// the protocol.
+func benchMessages(tb testing.TB) map[string][]byte {
+	ev, err := ParseEvent([]byte(fmt.Sprintf(
+		"Content-Length: %d\nContent-Type: text/event-plain\n\n%s",
+		len(plainEventBody), plainEventBody)))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	js, err := json.Marshal(ev)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return map[string][]byte{
+		"plain": []byte(fmt.Sprintf("Content-Length: %d\nContent-Type: text/event-plain\n\n%s",
+			len(plainEventBody), plainEventBody)),
+		"json": []byte(fmt.Sprintf("Content-Length: %d\nContent-Type: text/event-json\n\n%s",
+			len(js), js)),
+	}
+}
+
+// readMessage reads and parses a message like the read loop does.
+func readMessage(r *bufio.Reader, fh *frameHeader, lazy, pooled bool) (*Event, error) {
+	if err := readFrameHeader(r, fh); err != nil {
+		return nil, err
+	}
+	buf, err := readBody(r, fh.length)
+	if err != nil {
+		return nil, err
+	}
+	defer putBody(buf)
+	return parseMessage(fh, *buf, lazy, pooled)
+}
+
+func TestParseEventFormats(t *testing.T) {
+	for format, msg := range benchMessages(t) {
+		ev, err := ParseEvent(msg)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for k, want := range map[string]string{
+			"Event-Name":                "CHANNEL_ANSWER",
+			"Channel-Name":              "sofia/internal/1000@example.com",
+			"Caller-Destination-Number": "9000",
+		} {
+			if v := ev.Get(k); v != want {
+				t.Fatalf("%s: %s is %q, want %q", format, k, v, want)
+			}
+		}
+		if v := ev.Variable("sip_user_agent"); v != "Example Phone 1.0" {
+			t.Fatalf("%s: sip_user_agent is %q", format, v)
+		}
+	}
+}
+
+// TestReadFrameHeaderAllocs checks that reading the outer header of events
+// doesn't allocate, as it's done for every message read.
+func TestReadFrameHeaderAllocs(t *testing.T) {
+	msg := benchMessages(t)["plain"]
+	br := bytes.NewReader(msg)
+	r := bufio.NewReaderSize(br, bufferSize)
+	var fh frameHeader
+	readFrameHeader(r, &fh) // Grows fh.raw
+	allocs := testing.AllocsPerRun(100, func() {
+		br.Reset(msg)
+		r.Reset(br)
+		if err := readFrameHeader(r, &fh); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("readFrameHeader allocates %v times per message, want 0", allocs)
+	}
+}
+
+// TestHeaderNameAllocs checks that the names of common headers are
+// interned.
+func TestHeaderNameAllocs(t *testing.T) {
+	name := []byte("Event-Name")
+	allocs := testing.AllocsPerRun(100, func() {
+		if headerName(name) != "Event-Name" {
+			t.Fatal("unexpected header name")
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("headerName allocates %v times, want 0", allocs)
+	}
+}
+
+// TestParsePooledAllocs checks that parsing plain events into pooled
+// events, with lazy variables, only allocates for the values of eager
+// headers: the string, and storing it in the EventHeader. Names and maps
+// are reused.
+func TestParsePooledAllocs(t *testing.T) {
+	msg := benchMessages(t)["plain"]
+	br := bytes.NewReader(msg)
+	r := bufio.NewReaderSize(br, bufferSize)
+	var fh frameHeader
+	parse := func() {
+		br.Reset(msg)
+		r.Reset(br)
+		ev, err := readMessage(r, &fh, true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev.Release()
+	}
+	parse() // Warms up the pools
+	lines := strings.Count(plainEventBody, "\n") - 1
+	eager := lines - strings.Count(plainEventBody, "\nvariable_")
+	// Plus a few for growing the buffer of the deferred variables.
+	max := float64(2*eager + 8)
+	if allocs := testing.AllocsPerRun(100, parse); allocs > max {
+		t.Fatalf("parsing allocates %v times per event, want at most %v", allocs, max)
+	}
+}
+
+func BenchmarkReadFrameHeader(b *testing.B) {
+	msg := benchMessages(b)["plain"]
+	br := bytes.NewReader(msg)
+	r := bufio.NewReaderSize(br, bufferSize)
+	var fh frameHeader
+	b.ReportAllocs()
+	b.SetBytes(int64(len(msg)))
+	for i := 0; i < b.N; i++ {
+		br.Reset(msg)
+		r.Reset(br)
+		if err := readFrameHeader(r, &fh); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseEvent(b *testing.B) {
+	msgs := benchMessages(b)
+	for _, bc := range []struct {
+		name         string
+		format       string
+		lazy, pooled bool
+	}{
+		{"plain", "plain", false, false},
+		{"plain-lazy", "plain", true, false},
+		{"plain-pooled", "plain", false, true},
+		{"plain-lazy-pooled", "plain", true, true},
+		{"json", "json", false, false},
+		{"json-pooled", "json", false, true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			msg := msgs[bc.format]
+			br := bytes.NewReader(msg)
+			r := bufio.NewReaderSize(br, bufferSize)
+			var fh frameHeader
+			b.ReportAllocs()
+			b.SetBytes(int64(len(msg)))
+			for i := 0; i < b.N; i++ {
+				br.Reset(msg)
+				r.Reset(br)
+				ev, err := readMessage(r, &fh, bc.lazy, bc.pooled)
+				if err != nil {
+					b.Fatal(err)
+				}
+				ev.Release()
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "strconv"
+
+// PhoneEvent is an action requested from a SIP phone by SendPhoneEvent.
+type PhoneEvent string
+
+// Phone events supported by uuid_phone_event.
+const (
+	PhoneTalk PhoneEvent = "talk" // Answer the call on the phone
+	PhoneHold PhoneEvent = "hold" // Put the call on hold on the phone
+)
+
+// SendPhoneEvent asks the SIP phone of the channel identified by uuid to
+// perform an action, like answering the call in click-to-answer
+// integrations with desk phones. The phone must support talk/hold events.
+//
+// ErrNoSuchChannel is returned if the channel doesn't exist.
+func (h *Connection) SendPhoneEvent(uuid string, action PhoneEvent) error {
+	if !validArg(uuid) {
+		return errInvalidArgument
+	}
+	if action != PhoneTalk && action != PhoneHold {
+		return errInvalidArgument
+	}
+	_, err := h.api("uuid_phone_event " + uuid + " " + string(action))
+	return err
+}
+
+// PhoneFeature is the state of the feature keys of a SIP phone, like do not
+// disturb and call forwarding, as found in PHONE_FEATURE events.
+type PhoneFeature struct {
+	User   string
+	Host   string
+	Device string
+
+	// Feature is what the event is about: DoNotDisturbEvent,
+	// ForwardingEvent, or init when the phone subscribes.
+	Feature string
+
+	DoNotDisturb     bool
+	ForwardImmediate string // Destination, "" when disabled
+	ForwardBusy      string // Destination, "" when disabled
+	ForwardNoAnswer  string // Destination, "" when disabled
+	RingCount        int    // Rings before forwarding on no answer
+}
+
+// ParsePhoneFeature parses PHONE_FEATURE events sent by mod_sofia.
+func ParsePhoneFeature(ev *Event) (*PhoneFeature, error) {
+	if ev.Get("Event-Name") != "PHONE_FEATURE" {
+		return nil, errUnexpectedEvent
+	}
+	f := &PhoneFeature{
+		User:    ev.Get("User"),
+		Host:    ev.Get("Host"),
+		Device:  ev.Get("Device"),
+		Feature: ev.Get("Feature-Event"),
+	}
+	f.DoNotDisturb, _ = ev.GetBool("Donotdisturbon")
+	forward := func(kind string) string {
+		on, _ := ev.GetBool("Forward_" + kind + "_Enabled")
+		if !on {
+			return ""
+		}
+		return ev.Get("Forward_" + kind)
+	}
+	f.ForwardImmediate = forward("Immediate")
+	f.ForwardBusy = forward("Busy")
+	f.ForwardNoAnswer = forward("No_Answer")
+	f.RingCount, _ = ev.GetInt("Ringcount")
+	return f, nil
+}
+
+// SendPhoneFeature updates the feature keys of the SIP phones registered as
+// f.User@f.Host, e.g. to turn the do not disturb light on when the user
+// enables it elsewhere. The phones must support as-feature-event.
+func (h *Connection) SendPhoneFeature(f *PhoneFeature) error {
+	hdr := map[string]string{
+		"Feature-Event":  f.Feature,
+		"user":           f.User,
+		"host":           f.Host,
+		"device":         f.Device,
+		"doNotDisturbOn": strconv.FormatBool(f.DoNotDisturb),
+		"ringCount":      strconv.Itoa(f.RingCount),
+	}
+	for kind, dest := range map[string]string{
+		"immediate": f.ForwardImmediate,
+		"busy":      f.ForwardBusy,
+		"no_answer": f.ForwardNoAnswer,
+	} {
+		hdr["forward_"+kind+"_enabled"] = strconv.FormatBool(dest != "")
+		hdr["forward_"+kind] = dest
+	}
+	_, err := h.SendEvent("PHONE_FEATURE", hdr, "")
+	return err
+}
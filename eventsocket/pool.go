@@ -0,0 +1,84 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// eventPool holds released events, for reuse by connections that pool
+// events.
+var eventPool = sync.Pool{
+	New: func() interface{} { return &Event{pooled: true} },
+}
+
+// PoolEvents enables or disables pooling of events.
+//
+// By default every event is a new Event, with its own Header map, left for
+// the garbage collector once the consumer is done with it. For high volume
+// consumers like event collectors, that churn may dominate GC time. With
+// pooling, events returned by ReadEvent are leased from a pool and must be
+// given back with Release when done with them, after which neither the
+// event nor its Header map may be used. Copy any values that are needed
+// afterwards.
+//
+// Events that are never released are simply left for the garbage
+// collector, as without pooling. Only events are pooled, not replies to
+// commands.
+func (h *Connection) PoolEvents(enable bool) {
+	h.poolEvents.Store(enable)
+}
+
+// Release gives a pooled event back to the pool, for reuse by upcoming
+// events. The event must not be used after that. It does nothing for
+// events that aren't pooled, see PoolEvents.
+func (r *Event) Release() {
+	if !r.pooled {
+		return
+	}
+	switch n := atomic.AddInt32(&r.refs, -1); {
+	case n > 0:
+		return // Still held by someone else, e.g. HealthMonitor.
+	case n < 0:
+		panic("eventsocket: event released more than once")
+	}
+	r.reset()
+	eventPool.Put(r)
+}
+
+// retain takes another reference to a pooled event, for code that keeps
+// events received by observers. Each reference is given back with Release.
+//
+// The headers deferred by LazyVariables are decoded first: observers hand
+// the event to other goroutines while the read loop still peeks at it, and
+// decoding writes to the Header map.
+func (r *Event) retain() *Event {
+	r.load()
+	if r.pooled {
+		atomic.AddInt32(&r.refs, 1)
+	}
+	return r
+}
+
+// reset empties the event for reuse, keeping the memory of its Header map
+// and order slice.
+func (r *Event) reset() {
+	clear(r.Header)
+	clear(r.names)
+	r.order = r.order[:0]
+	r.Body = ""
+	r.lazy = nil
+}
+
+// newEvent returns an empty event, leased from the pool if pooled is set.
+func newEvent(pooled bool) *Event {
+	if !pooled {
+		return &Event{}
+	}
+	ev := eventPool.Get().(*Event)
+	atomic.StoreInt32(&ev.refs, 1)
+	return ev
+}
@@ -0,0 +1,238 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PresenceState is the presence of a user, as found in PRESENCE_IN and
+// sofia::presence events, and sent by SendPresence.
+type PresenceState struct {
+	User      string    // from, e.g. 1000@example.com
+	Proto     string    // e.g. sip, the default when sent
+	Status    string    // Shown by phones, e.g. Available or On The Phone
+	RPID      string    // e.g. unknown, busy or away
+	UUID      string    // Of the call the state is about, if any
+	State     string    // answer-state of the call, e.g. early or confirmed
+	Direction string    // presence-call-direction, inbound or outbound
+	Updated   time.Time // When the event was fired
+}
+
+// Busy reports whether the user is in a call, ringing or answered, which
+// is what the lamps of BLF keys show.
+func (p *PresenceState) Busy() bool {
+	switch p.State {
+	case "early", "confirmed", "ringing":
+		return true
+	}
+	return false
+}
+
+// ParsePresence parses a PRESENCE_IN or sofia::presence event.
+func ParsePresence(ev *Event) (*PresenceState, error) {
+	if ev.Get("Event-Name") != EventPresenceIn && ev.Get("Event-Subclass") != "sofia::presence" {
+		return nil, errUnexpectedEvent
+	}
+	p := &PresenceState{
+		User:      ev.Get("From"),
+		Proto:     ev.Get("Proto"),
+		Status:    ev.Get("Status"),
+		RPID:      ev.Get("Rpid"),
+		UUID:      ev.Get("Unique-Id"),
+		State:     ev.Get("Answer-State"),
+		Direction: ev.Get("Presence-Call-Direction"),
+	}
+	if p.User == "" {
+		return nil, ErrMissingHeader
+	}
+	var err error
+	if p.Updated, err = ev.Timestamp(); err != nil || p.Updated.IsZero() {
+		p.Updated = time.Now()
+	}
+	return p, nil
+}
+
+// SendPresence fires a PRESENCE_IN event with sendevent, so the phones
+// watching the user, e.g. with BLF keys, are notified of its state. Proto
+// defaults to sip, and RPID to unknown.
+//
+// Example:
+//
+//	c.SendPresence(&eventsocket.PresenceState{
+//		User:   "queue-sales@example.com",
+//		Status: "3 calls waiting",
+//		State:  "confirmed", // Lamp on
+//	})
+func (h *Connection) SendPresence(p *PresenceState) error {
+	if !validArg(p.User) {
+		return errInvalidArgument
+	}
+	hdr := map[string]string{
+		"proto":          p.Proto,
+		"from":           p.User,
+		"login":          p.User,
+		"status":         p.Status,
+		"rpid":           p.RPID,
+		"event_type":     "presence",
+		"alt_event_type": "dialog",
+		"event_count":    "1",
+	}
+	if hdr["proto"] == "" {
+		hdr["proto"] = "sip"
+	}
+	if hdr["rpid"] == "" {
+		hdr["rpid"] = "unknown"
+	}
+	if p.UUID != "" {
+		hdr["unique-id"] = p.UUID
+	}
+	if p.State != "" {
+		hdr["answer-state"] = p.State
+	}
+	if p.Direction != "" {
+		hdr["presence-call-direction"] = p.Direction
+	}
+	_, err := h.SendEvent(EventPresenceIn, hdr, "")
+	return err
+}
+
+// Presence keeps track of the presence of users, based on PRESENCE_IN and
+// sofia::presence events, and answers PRESENCE_PROBE events, for building
+// BLF-style features like busy lamps and operator panels.
+//
+// Example:
+//
+//	p := eventsocket.NewPresence(c)
+//	p.OnChange = func(s eventsocket.PresenceState) {
+//		log.Println(s.User, s.Status, s.Busy())
+//	}
+//	go p.Run(ctx)
+//	...
+//	if s, ok := p.Lookup("1000@example.com"); ok && s.Busy() {
+//		...
+//	}
+type Presence struct {
+	// OnChange, when set, is called with the new state of a user.
+	// OnProbe, when set, is called for every PRESENCE_PROBE, with who
+	// asks for the presence of whom, e.g. to answer it with
+	// SendPresence. Otherwise probes for users whose state is known are
+	// answered with it. They're called from Run.
+	OnChange func(PresenceState)
+	OnProbe  func(from, to string)
+
+	conn  *Connection
+	mu    sync.Mutex
+	users map[string]*PresenceState // user:state
+}
+
+// NewPresence creates a Presence that issues commands on the given
+// connection.
+func NewPresence(c *Connection) *Presence {
+	return &Presence{
+		conn:  c,
+		users: make(map[string]*PresenceState),
+	}
+}
+
+// Run subscribes to presence events, and keeps track of them until the
+// context is cancelled or the connection terminates.
+func (p *Presence) Run(ctx context.Context) error {
+	events := newEventQueue()
+	cancel := p.conn.observe(func(ev *Event) bool {
+		switch ev.peek("Event-Name") {
+		case EventPresenceIn, EventPresenceProbe:
+			events.push(ev.retain())
+		case EventCustom:
+			if ev.peek("Event-Subclass") == "sofia::presence" {
+				events.push(ev.retain())
+			}
+		}
+		return false
+	})
+	defer cancel()
+	err := p.conn.Subscriptions().Subscribe(
+		EventPresenceIn, EventPresenceProbe, "sofia::presence")
+	if err != nil {
+		return err
+	}
+	for {
+		for ev, ok := events.pop(); ok; ev, ok = events.pop() {
+			p.HandleEvent(ev)
+			ev.Release()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.conn.done:
+			return p.conn.err
+		case <-events.wake:
+		}
+	}
+}
+
+// HandleEvent updates the state of users from presence events, and
+// answers probes. Other events are ignored. It's called by Run, and only
+// needs to be called directly by those not using Run.
+func (p *Presence) HandleEvent(ev *Event) {
+	if ev.Get("Event-Name") == EventPresenceProbe {
+		p.probe(ev.Get("From"), ev.Get("To"))
+		return
+	}
+	s, err := ParsePresence(ev)
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	p.users[s.User] = s
+	p.mu.Unlock()
+	if p.OnChange != nil {
+		p.OnChange(*s)
+	}
+}
+
+// probe answers a PRESENCE_PROBE for the presence of to.
+func (p *Presence) probe(from, to string) {
+	if p.OnProbe != nil {
+		p.OnProbe(from, to)
+		return
+	}
+	// Probes are e.g. for sip:1000@example.com, states for 1000@example.com.
+	to = strings.TrimPrefix(to, "sip:")
+	s, ok := p.Lookup(to)
+	if !ok {
+		return
+	}
+	if err := p.conn.SendPresence(&s); err != nil {
+		p.conn.log().Errorf("eventsocket: answering presence probe of %s: %v", to, err)
+	}
+}
+
+// Lookup returns the last state of a user, e.g. 1000@example.com.
+func (p *Presence) Lookup(user string) (PresenceState, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.users[user]
+	if !ok {
+		return PresenceState{}, false
+	}
+	return *s, true
+}
+
+// Snapshot returns the state of all users, sorted by user.
+func (p *Presence) Snapshot() []PresenceState {
+	p.mu.Lock()
+	list := make([]PresenceState, 0, len(p.users))
+	for _, s := range p.users {
+		list = append(list, *s)
+	}
+	p.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].User < list[j].User })
+	return list
+}
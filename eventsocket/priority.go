@@ -0,0 +1,45 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+// PriorityEvents delivers events of the given types through a separate
+// lane, so ReadEvent returns them ahead of any backlog of other events.
+// It's meant for call controllers subscribed to chatty events like
+// RE_SCHEDULE or API, that must still see e.g. CHANNEL_HANGUP promptly:
+//
+//	c.PriorityEvents("CHANNEL_HANGUP", "CHANNEL_HANGUP_COMPLETE")
+//
+// The type is the Event-Name, or the Event-Subclass for CUSTOM events.
+// While there's any priority type, disconnect notices are delivered
+// through the priority lane as well, being followed by the end of the
+// connection. Events in each lane are still returned in the order they
+// were received, but priority events may be returned before others that
+// were received earlier. Calling it with no types disables the lane.
+//
+// Regardless of the lane, the end of the connection is signalled by
+// Context as soon as it's read, ahead of any events waiting for ReadEvent.
+func (h *Connection) PriorityEvents(names ...string) {
+	if len(names) == 0 {
+		h.priority.Store(nil)
+		return
+	}
+	m := make(map[string]bool, len(names))
+	for _, name := range names {
+		m[name] = true
+	}
+	h.priority.Store(&m)
+}
+
+// urgentEvent reports whether the event goes through the priority lane.
+func (h *Connection) urgentEvent(ev *Event) bool {
+	m := h.priority.Load()
+	if m == nil {
+		return false
+	}
+	if ev.peek("Content-Type") == "text/disconnect-notice" {
+		return true
+	}
+	return (*m)[eventName(ev)]
+}
@@ -0,0 +1,306 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the command
+// latency histogram of PrometheusMetrics.
+var DefaultLatencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// PrometheusMetrics is a Metrics that exports the measurements of
+// connections in the Prometheus text format, when served over HTTP:
+//
+//	eventsocket_events_received_total{name="CHANNEL_CREATE"} 12
+//	eventsocket_events_dropped_total{name="HEARTBEAT"} 3
+//	eventsocket_events_lost_total 0
+//	eventsocket_commands_total{command="api status",result="ok"} 1
+//	eventsocket_command_duration_seconds_bucket{command="api status",le="0.001"} 1
+//	eventsocket_bytes_read_total 3527
+//	eventsocket_reconnects_total 0
+//
+// Example:
+//
+//	m := eventsocket.NewPrometheusMetrics()
+//	http.Handle("/metrics", m)
+//	...
+//	c, err := eventsocket.Dial("localhost:8021", "ClueCon")
+//	c.SetMetrics(m)
+type PrometheusMetrics struct {
+	buckets    []float64
+	mu         sync.Mutex
+	received   map[string]uint64
+	dropped    map[string]uint64
+	commands   map[[2]string]uint64 // command, result
+	latency    map[string]*histogram
+	lost       atomic.Uint64
+	bytes      atomic.Uint64
+	reconnects atomic.Uint64
+	traffic    []*TrafficStats // See ExportTraffic
+	servers    []*Server       // See ExportServer
+}
+
+// histogram counts observations in cumulative buckets.
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative, plus +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheusMetrics creates a PrometheusMetrics with the given command
+// latency buckets, in seconds, or DefaultLatencyBuckets if none.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &PrometheusMetrics{
+		buckets:  b,
+		received: make(map[string]uint64),
+		dropped:  make(map[string]uint64),
+		commands: make(map[[2]string]uint64),
+		latency:  make(map[string]*histogram),
+	}
+}
+
+// EventReceived implements Metrics.
+func (p *PrometheusMetrics) EventReceived(name string) {
+	p.mu.Lock()
+	p.received[name]++
+	p.mu.Unlock()
+}
+
+// EventDropped implements Metrics.
+func (p *PrometheusMetrics) EventDropped(name string) {
+	p.mu.Lock()
+	p.dropped[name]++
+	p.mu.Unlock()
+}
+
+// CommandSent implements Metrics.
+func (p *PrometheusMetrics) CommandSent(command string, latency time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	sec := latency.Seconds()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.commands[[2]string{command, result}]++
+	h, ok := p.latency[command]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(p.buckets)+1)}
+		p.latency[command] = h
+	}
+	h.counts[sort.SearchFloat64s(p.buckets, sec)]++
+	h.sum += sec
+	h.count++
+}
+
+// EventsLost implements Metrics.
+func (p *PrometheusMetrics) EventsLost(n uint64) {
+	p.lost.Add(n)
+}
+
+// BytesRead implements Metrics.
+func (p *PrometheusMetrics) BytesRead(n int) {
+	p.bytes.Add(uint64(n))
+}
+
+// Reconnected implements Metrics.
+func (p *PrometheusMetrics) Reconnected() {
+	p.reconnects.Add(1)
+}
+
+// ExportTraffic adds the statistics of s to the metrics, as gauges of its
+// window, e.g. for a window of one minute:
+//
+//	eventsocket_traffic_calls_per_second{window="1m0s"} 2.5
+//	eventsocket_traffic_asr{window="1m0s"} 0.6
+//	eventsocket_traffic_acd_seconds{window="1m0s"} 94.2
+//	eventsocket_traffic_concurrent_calls{window="1m0s"} 37
+//
+// TrafficStats of different connections should have different windows,
+// or their gauges will be reported with the same labels.
+func (p *PrometheusMetrics) ExportTraffic(s *TrafficStats) {
+	p.mu.Lock()
+	p.traffic = append(p.traffic, s)
+	p.mu.Unlock()
+}
+
+// ExportServer adds the counters of s to the metrics, labeled with its
+// Addr:
+//
+//	eventsocket_server_connections{addr=":9090"} 37
+//	eventsocket_server_accepted_total{addr=":9090"} 1204
+//	eventsocket_server_rejected_total{addr=":9090"} 0
+//	eventsocket_server_panics_total{addr=":9090"} 0
+//	eventsocket_server_events_total{addr=":9090"} 30110
+//	eventsocket_server_events_per_second{addr=":9090"} 24.2
+//	eventsocket_server_handler_seconds{addr=":9090"} 94.2
+func (p *PrometheusMetrics) ExportServer(s *Server) {
+	p.mu.Lock()
+	p.servers = append(p.servers, s)
+	p.mu.Unlock()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	p.write(bw)
+	bw.Flush()
+}
+
+// write writes the metrics in the Prometheus text format.
+func (p *PrometheusMetrics) write(w *bufio.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	header := func(name, typ, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	header("eventsocket_events_received_total", "counter",
+		"Events received from FreeSWITCH, by name.")
+	for _, name := range sortedKeys(p.received) {
+		fmt.Fprintf(w, "eventsocket_events_received_total{name=%s} %d\n",
+			promLabel(name), p.received[name])
+	}
+	header("eventsocket_events_dropped_total", "counter",
+		"Events received but not delivered, by name.")
+	for _, name := range sortedKeys(p.dropped) {
+		fmt.Fprintf(w, "eventsocket_events_dropped_total{name=%s} %d\n",
+			promLabel(name), p.dropped[name])
+	}
+	header("eventsocket_events_lost_total", "counter",
+		"Events missing in gaps of the Event-Sequence.")
+	fmt.Fprintf(w, "eventsocket_events_lost_total %d\n", p.lost.Load())
+	header("eventsocket_commands_total", "counter",
+		"Commands sent to FreeSWITCH, by command and result.")
+	keys := make([][2]string, 0, len(p.commands))
+	for k := range p.commands {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "eventsocket_commands_total{command=%s,result=%s} %d\n",
+			promLabel(k[0]), promLabel(k[1]), p.commands[k])
+	}
+	header("eventsocket_command_duration_seconds", "histogram",
+		"Time until the reply to commands, by command.")
+	names := make([]string, 0, len(p.latency))
+	for name := range p.latency {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h, label := p.latency[name], promLabel(name)
+		var n uint64
+		for i, le := range p.buckets {
+			n += h.counts[i]
+			fmt.Fprintf(w, "eventsocket_command_duration_seconds_bucket{command=%s,le=\"%s\"} %d\n",
+				label, strconv.FormatFloat(le, 'g', -1, 64), n)
+		}
+		fmt.Fprintf(w, "eventsocket_command_duration_seconds_bucket{command=%s,le=\"+Inf\"} %d\n",
+			label, h.count)
+		fmt.Fprintf(w, "eventsocket_command_duration_seconds_sum{command=%s} %s\n",
+			label, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "eventsocket_command_duration_seconds_count{command=%s} %d\n",
+			label, h.count)
+	}
+	header("eventsocket_bytes_read_total", "counter",
+		"Bytes read from FreeSWITCH.")
+	fmt.Fprintf(w, "eventsocket_bytes_read_total %d\n", p.bytes.Load())
+	header("eventsocket_reconnects_total", "counter",
+		"Connections established again after being lost.")
+	fmt.Fprintf(w, "eventsocket_reconnects_total %d\n", p.reconnects.Load())
+	p.writeServers(w, header)
+	if len(p.traffic) == 0 {
+		return
+	}
+	snapshots := make([]TrafficSnapshot, len(p.traffic))
+	for i, s := range p.traffic {
+		snapshots[i] = s.Snapshot()
+	}
+	gauge := func(name, help string, value func(t *TrafficSnapshot) float64) {
+		header(name, "gauge", help)
+		for i := range snapshots {
+			t := &snapshots[i]
+			fmt.Fprintf(w, "%s{window=%s} %s\n", name, promLabel(t.Window.String()),
+				strconv.FormatFloat(value(t), 'g', -1, 64))
+		}
+	}
+	gauge("eventsocket_traffic_calls_per_second", "Calls created per second.",
+		func(t *TrafficSnapshot) float64 { return t.CPS })
+	gauge("eventsocket_traffic_asr", "Answer-seizure ratio of the calls completed.",
+		func(t *TrafficSnapshot) float64 { return t.ASR })
+	gauge("eventsocket_traffic_acd_seconds", "Average duration of the calls answered.",
+		func(t *TrafficSnapshot) float64 { return t.ACD.Seconds() })
+	gauge("eventsocket_traffic_concurrent_calls", "Calls up.",
+		func(t *TrafficSnapshot) float64 { return float64(t.Concurrent) })
+}
+
+// writeServers writes the counters of the servers exported, with mu held.
+func (p *PrometheusMetrics) writeServers(w *bufio.Writer, header func(name, typ, help string)) {
+	if len(p.servers) == 0 {
+		return
+	}
+	stats := make([]ServerStats, len(p.servers))
+	for i, s := range p.servers {
+		stats[i] = s.Stats()
+	}
+	metric := func(name, typ, help string, value func(st *ServerStats) float64) {
+		header(name, typ, help)
+		for i, s := range p.servers {
+			fmt.Fprintf(w, "%s{addr=%s} %s\n", name, promLabel(s.Addr),
+				strconv.FormatFloat(value(&stats[i]), 'g', -1, 64))
+		}
+	}
+	metric("eventsocket_server_connections", "gauge", "Connections open.",
+		func(st *ServerStats) float64 { return float64(st.Active) })
+	metric("eventsocket_server_accepted_total", "counter", "Connections accepted.",
+		func(st *ServerStats) float64 { return float64(st.Accepted) })
+	metric("eventsocket_server_rejected_total", "counter", "Connections rejected by limits.",
+		func(st *ServerStats) float64 { return float64(st.Rejected) })
+	metric("eventsocket_server_panics_total", "counter", "Connections closed by a panic.",
+		func(st *ServerStats) float64 { return float64(st.Panics) })
+	metric("eventsocket_server_events_total", "counter", "Events received by the connections.",
+		func(st *ServerStats) float64 { return float64(st.Events) })
+	metric("eventsocket_server_events_per_second", "gauge", "Events received per second.",
+		func(st *ServerStats) float64 { return st.EventsPerSecond })
+	metric("eventsocket_server_handler_seconds", "gauge", "Average time handlers ran.",
+		func(st *ServerStats) float64 { return st.HandlerTime.Seconds() })
+}
+
+// sortedKeys returns the keys of m, sorted.
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// promLabel quotes a label value for the Prometheus text format.
+func promLabel(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,538 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	proxyMaxPending = 1000
+	proxyMaxBody    = 1 << 20
+)
+
+var errPermissionDenied = errors.New("permission denied")
+
+// Proxy holds one authenticated connection to FreeSWITCH, upstream, and
+// accepts any number of event socket clients, downstream, as if it were
+// FreeSWITCH: their commands are funneled to the upstream connection, and
+// the events it receives are fanned out to the clients subscribed to them,
+// in the format they asked for, through their own filters.
+//
+// Clients authenticate with Password, or Authenticate, and each command
+// they send can be checked by Authorize, and each event by Match, e.g. to
+// give dashboards read-only access to the events of their tenant.
+//
+// Events subscribed to by any client are subscribed to upstream, which
+// stays subscribed when clients unsubscribe or leave. Commands that make
+// no sense through a proxy, like linger, myevents and log, are rejected.
+//
+// The proxy reads the events of the upstream connection: they're not
+// returned by its ReadEvent to anyone else.
+//
+// Example:
+//
+//	c, err := eventsocket.Dial("localhost:8021", "ClueCon")
+//	p := eventsocket.NewProxy(c, "s3cr3t")
+//	p.Authorize = func(user, command string) bool {
+//		return !strings.HasPrefix(command, "api originate")
+//	}
+//	err = p.ListenAndServe(":8022")
+type Proxy struct {
+	// Password is what clients authenticate with, unless Authenticate is
+	// set.
+	Password string
+
+	// Authenticate, when set, checks the password of a client, and
+	// returns the user name Authorize and Match are called with.
+	Authenticate func(passwd string) (user string, ok bool)
+
+	// Authorize, when set, tells whether a user can send a command, e.g.
+	// api status or event plain ALL. Commands denied fail with
+	// -ERR permission denied.
+	Authorize func(user, command string) bool
+
+	// Match, when set, tells whether an event can be sent to a user.
+	Match func(user string, ev *Event) bool
+
+	// MaxPending is how many events can wait to be sent to a client before
+	// it's disconnected, for being too slow. Defaults to 1000.
+	MaxPending int
+
+	upstream *Connection
+	once     sync.Once
+	mu       sync.Mutex
+	clients  map[*proxyClient]bool
+}
+
+// proxyClient is a downstream client of a Proxy.
+type proxyClient struct {
+	p        *Proxy
+	conn     net.Conn
+	r        *bufio.Reader
+	wmu      sync.Mutex // Serializes messages written
+	w        *bufio.Writer
+	user     string
+	mu       sync.Mutex
+	format   string // plain or json
+	all      bool
+	events   map[string]bool     // Event names and subclasses
+	filters  map[string][]string // header:values
+	queue    *eventQueue
+	overflow atomic.Bool
+	done     chan struct{} // Closed when the client goes away
+}
+
+// NewProxy creates a Proxy for the given upstream connection, that clients
+// authenticate to with passwd.
+func NewProxy(upstream *Connection, passwd string) *Proxy {
+	return &Proxy{
+		Password: passwd,
+		upstream: upstream,
+		clients:  make(map[*proxyClient]bool),
+	}
+}
+
+// ListenAndServe listens on the TCP network address addr and serves
+// clients, see Serve.
+func (p *Proxy) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(ln)
+}
+
+// Serve accepts clients on the listener until it fails, or the upstream
+// connection terminates, which closes the listener and all clients and
+// returns its error.
+func (p *Proxy) Serve(ln net.Listener) error {
+	p.once.Do(func() { go p.fanOut() })
+	go func() {
+		<-p.upstream.done
+		ln.Close()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-p.upstream.done:
+				return p.upstream.err
+			default:
+				return err
+			}
+		}
+		go p.ServeConn(conn)
+	}
+}
+
+// fanOut reads the events of the upstream connection and queues them for
+// the clients subscribed to them.
+func (p *Proxy) fanOut() {
+	max := p.MaxPending
+	if max <= 0 {
+		max = proxyMaxPending
+	}
+	for {
+		ev, err := p.upstream.ReadEvent()
+		if err != nil {
+			return
+		}
+		name := eventName(ev)
+		p.mu.Lock()
+		for cl := range p.clients {
+			if !cl.wants(name) {
+				continue
+			}
+			if cl.queue.len() >= max {
+				cl.overflow.Store(true)
+				cl.queue.signal()
+				continue
+			}
+			cl.queue.push(ev.retain())
+		}
+		p.mu.Unlock()
+		ev.Release()
+	}
+}
+
+// ServeConn authenticates a client and serves it until it goes away, or
+// the upstream connection terminates. The connection is closed when it
+// returns.
+func (p *Proxy) ServeConn(conn net.Conn) {
+	p.once.Do(func() { go p.fanOut() })
+	cl := &proxyClient{
+		p:       p,
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriter(conn),
+		format:  "plain",
+		events:  make(map[string]bool),
+		filters: make(map[string][]string),
+		queue:   newEventQueue(),
+		done:    make(chan struct{}),
+	}
+	defer conn.Close()
+	if !cl.authenticate() {
+		return
+	}
+	p.mu.Lock()
+	p.clients[cl] = true
+	p.mu.Unlock()
+	p.upstream.log().Infof("eventsocket: proxy client %s connected as %q",
+		conn.RemoteAddr(), cl.user)
+	writer := make(chan struct{})
+	go func() {
+		cl.writeEvents()
+		conn.Close() // Stops the reader
+		close(writer)
+	}()
+	cl.readCommands()
+	close(cl.done)
+	<-writer
+	p.mu.Lock()
+	delete(p.clients, cl)
+	p.mu.Unlock()
+	for ev, ok := cl.queue.pop(); ok; ev, ok = cl.queue.pop() {
+		ev.Release()
+	}
+	p.upstream.log().Infof("eventsocket: proxy client %s disconnected", conn.RemoteAddr())
+}
+
+// authenticate asks the client for its password, and checks it.
+func (cl *proxyClient) authenticate() bool {
+	cl.write("Content-Type: auth/request\n\n")
+	cmd, err := readProxyCommand(cl.r)
+	if err != nil {
+		return false
+	}
+	name, passwd, _ := strings.Cut(cmd.line, " ")
+	ok := false
+	if name == "auth" {
+		if cl.p.Authenticate != nil {
+			cl.user, ok = cl.p.Authenticate(passwd)
+		} else {
+			ok = passwd == cl.p.Password
+		}
+	}
+	if !ok {
+		cl.reply("-ERR invalid")
+		return false
+	}
+	cl.reply("+OK accepted")
+	return true
+}
+
+// readCommands handles the commands of the client until it goes away.
+func (cl *proxyClient) readCommands() {
+	for {
+		cmd, err := readProxyCommand(cl.r)
+		if err != nil {
+			return
+		}
+		if !cl.handle(cmd) {
+			return
+		}
+	}
+}
+
+// handle replies to a command, handling subscriptions and filters locally
+// and sending everything else upstream. It returns false when the client
+// must be disconnected.
+func (cl *proxyClient) handle(cmd *proxyCommand) bool {
+	name, args, _ := strings.Cut(cmd.line, " ")
+	args = strings.TrimSpace(args)
+	if name == "exit" {
+		cl.reply("+OK bye")
+		return false
+	}
+	if cl.p.Authorize != nil && !cl.p.Authorize(cl.user, cmd.line) {
+		if name == "api" {
+			cl.apiResponse("-ERR " + errPermissionDenied.Error() + "\n")
+		} else {
+			cl.reply("-ERR " + errPermissionDenied.Error())
+		}
+		return true
+	}
+	switch name {
+	case "api":
+		ev, err := cl.p.upstream.Send(cmd.raw)
+		if err != nil {
+			cl.apiResponse("-ERR " + err.Error() + "\n")
+		} else {
+			cl.apiResponse(ev.Body)
+		}
+	case "bgapi", "sendmsg", "sendevent":
+		ev, err := cl.p.upstream.Send(cmd.raw)
+		if err != nil {
+			cl.reply("-ERR " + err.Error())
+		} else if job := ev.Get("Job-Uuid"); job != "" {
+			cl.reply(ev.Get("Reply-Text"), "Job-UUID", job)
+		} else {
+			cl.reply(ev.Get("Reply-Text"))
+		}
+	case "event", "events":
+		if err := cl.subscribe(args); err != nil {
+			cl.reply("-ERR " + err.Error())
+			break
+		}
+		cl.mu.Lock()
+		format := cl.format
+		cl.mu.Unlock()
+		cl.reply("+OK event listener enabled " + format)
+	case "nixevent":
+		cl.mu.Lock()
+		for _, name := range strings.Fields(args) {
+			if name == "ALL" {
+				cl.all = false
+			}
+			delete(cl.events, name)
+		}
+		cl.mu.Unlock()
+		cl.reply("+OK events nixed")
+	case "noevents":
+		cl.mu.Lock()
+		cl.all = false
+		clear(cl.events)
+		cl.mu.Unlock()
+		cl.reply("+OK no longer listening for events")
+	case "filter":
+		cl.filter(args)
+	default:
+		cl.reply("-ERR command not found")
+	}
+	return true
+}
+
+// subscribe handles the arguments of the event command, e.g. "plain
+// CHANNEL_ANSWER CUSTOM sofia::register", subscribing upstream too.
+func (cl *proxyClient) subscribe(args string) error {
+	f := strings.Fields(args)
+	format := "plain"
+	if len(f) > 0 {
+		format, f = f[0], f[1:]
+	}
+	if format != "plain" && format != "json" {
+		return fmt.Errorf("unsupported format %s", format)
+	}
+	var names []string
+	for _, name := range f {
+		if name != "CUSTOM" {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		if err := cl.p.upstream.Subscriptions().Subscribe(names...); err != nil {
+			return err
+		}
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.format = format
+	for _, name := range names {
+		if name == "ALL" {
+			cl.all = true
+		} else {
+			cl.events[name] = true
+		}
+	}
+	return nil
+}
+
+// filter handles the arguments of the filter command, e.g. "Unique-ID
+// 4f8e..." or "delete Unique-ID 4f8e...".
+func (cl *proxyClient) filter(args string) {
+	del := false
+	if rest, ok := strings.CutPrefix(args, "delete "); ok {
+		del, args = true, strings.TrimSpace(rest)
+	}
+	header, value, _ := strings.Cut(args, " ")
+	value = strings.TrimSpace(value)
+	if header == "" {
+		cl.reply("-ERR invalid syntax")
+		return
+	}
+	key := capitalize(header)
+	cl.mu.Lock()
+	switch {
+	case !del:
+		cl.filters[key] = appendNew(cl.filters[key], value)
+	case value == "":
+		delete(cl.filters, key)
+	default:
+		if values := removeValue(cl.filters[key], value); len(values) > 0 {
+			cl.filters[key] = values
+		} else {
+			delete(cl.filters, key)
+		}
+	}
+	cl.mu.Unlock()
+	if del {
+		cl.reply(fmt.Sprintf("+OK filter deleted. [%s]=[%s]", header, value))
+	} else {
+		cl.reply(fmt.Sprintf("+OK filter added. [%s]=[%s]", header, value))
+	}
+}
+
+// writeEvents sends the events queued for the client until it goes away,
+// falls behind, or the upstream connection terminates.
+func (cl *proxyClient) writeEvents() {
+	for {
+		if cl.overflow.Load() {
+			cl.p.upstream.log().Errorf("eventsocket: proxy client %s is too slow, disconnecting",
+				cl.conn.RemoteAddr())
+			return
+		}
+		for ev, ok := cl.queue.pop(); ok; ev, ok = cl.queue.pop() {
+			var err error
+			if cl.match(ev) {
+				err = cl.sendEvent(ev)
+			}
+			ev.Release()
+			if err != nil {
+				return
+			}
+		}
+		select {
+		case <-cl.done:
+			return
+		case <-cl.p.upstream.done:
+			body := "Disconnected, goodbye.\n"
+			cl.write("Content-Type: text/disconnect-notice\nContent-Length: %d\n\n%s",
+				len(body), body)
+			return
+		case <-cl.queue.wake:
+		}
+	}
+}
+
+// wants reports whether the client subscribed to events with the given
+// name, or subclass.
+func (cl *proxyClient) wants(name string) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.all || cl.events[name]
+}
+
+// match reports whether an event passes the filters of the client, and
+// Match.
+func (cl *proxyClient) match(ev *Event) bool {
+	if cl.p.Match != nil && !cl.p.Match(cl.user, ev) {
+		return false
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if len(cl.filters) == 0 {
+		return true
+	}
+	for key, values := range cl.filters {
+		v := ev.Get(key)
+		for _, want := range values {
+			if v == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendEvent writes an event in the format the client subscribed with.
+func (cl *proxyClient) sendEvent(ev *Event) error {
+	cl.mu.Lock()
+	format := cl.format
+	cl.mu.Unlock()
+	if format == "json" {
+		b, err := ev.MarshalJSON()
+		if err != nil {
+			return nil // Skipped
+		}
+		return cl.write("Content-Length: %d\nContent-Type: text/event-json\n\n%s", len(b), b)
+	}
+	b, err := ev.MarshalPlain()
+	if err != nil {
+		return nil // Skipped
+	}
+	return cl.write("%s", b)
+}
+
+// reply writes a command/reply with the given Reply-Text and headers.
+func (cl *proxyClient) reply(text string, headers ...string) error {
+	var b strings.Builder
+	b.WriteString("Content-Type: command/reply\n")
+	for n := 0; n+1 < len(headers); n += 2 {
+		fmt.Fprintf(&b, "%s: %s\n", headers[n], headers[n+1])
+	}
+	fmt.Fprintf(&b, "Reply-Text: %s\n\n", text)
+	return cl.write("%s", b.String())
+}
+
+// apiResponse writes an api/response with the given body.
+func (cl *proxyClient) apiResponse(body string) error {
+	return cl.write("Content-Type: api/response\nContent-Length: %d\n\n%s", len(body), body)
+}
+
+// write writes a formatted message to the client.
+func (cl *proxyClient) write(format string, v ...interface{}) error {
+	cl.wmu.Lock()
+	defer cl.wmu.Unlock()
+	fmt.Fprintf(cl.w, format, v...)
+	return cl.w.Flush()
+}
+
+// proxyCommand is a command of a client.
+type proxyCommand struct {
+	line string // First line, e.g. api status
+	raw  string // The command as sent upstream: line, headers and body
+}
+
+// readProxyCommand reads a command: the first line, headers, and the body
+// if there's a Content-Length.
+func readProxyCommand(r *bufio.Reader) (*proxyCommand, error) {
+	var (
+		lines []string
+		n     int
+	)
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		l = strings.TrimRight(l, "\r\n")
+		if l == "" {
+			if len(lines) == 0 {
+				continue // Blank lines between commands
+			}
+			break
+		}
+		if k, v, ok := strings.Cut(l, ":"); ok && len(lines) > 0 &&
+			strings.EqualFold(strings.TrimSpace(k), "Content-Length") {
+			n, err = strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || n < 0 || n > proxyMaxBody {
+				return nil, errContentLength
+			}
+		}
+		lines = append(lines, l)
+	}
+	cmd := &proxyCommand{
+		line: strings.TrimSpace(lines[0]),
+		raw:  strings.Join(lines, "\n"),
+	}
+	if n > 0 {
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, err
+		}
+		cmd.raw += "\n\n" + string(body)
+	}
+	return cmd, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// eventQueue is the queue of events between the read loop and ReadEvent.
+//
+// It's unbounded so the read loop never waits for consumers: replies to
+// commands are read and delivered in real time no matter how many events
+// are waiting to be read, and so are the completions of ExecuteAsync and
+// BgAPI, which are matched before events are queued.
+type eventQueue struct {
+	mu     sync.Mutex
+	events []*Event
+	head   int           // Index of the next event in events
+	wake   chan struct{} // Signaled when events are pushed
+}
+
+// minCompact is how many events must have been consumed before the queue
+// is compacted, so small queues aren't copied over and over.
+const minCompact = 64
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{wake: make(chan struct{}, 1)}
+}
+
+// push adds an event to the queue and wakes up a consumer.
+func (q *eventQueue) push(ev *Event) {
+	q.mu.Lock()
+	q.events = append(q.events, ev)
+	q.mu.Unlock()
+	q.signal()
+}
+
+// pop removes and returns the oldest event, if any.
+func (q *eventQueue) pop() (*Event, bool) {
+	q.mu.Lock()
+	if q.head == len(q.events) {
+		q.mu.Unlock()
+		return nil, false
+	}
+	ev := q.events[q.head]
+	q.events[q.head] = nil
+	q.head++
+	more := q.head < len(q.events)
+	if !more {
+		// Reuse the slice once it's drained.
+		q.events = q.events[:0]
+		q.head = 0
+	} else if q.head > len(q.events)/2 && q.head >= minCompact {
+		// Move the events left to the front once most of the slice
+		// was consumed, so it doesn't grow forever when consumers lag
+		// behind and it's never drained.
+		n := copy(q.events, q.events[q.head:])
+		clear(q.events[n:])
+		q.events = q.events[:n]
+		q.head = 0
+	}
+	q.mu.Unlock()
+	if more {
+		// Pass the signal on to other consumers.
+		q.signal()
+	}
+	return ev, true
+}
+
+// len returns the number of events in the queue.
+func (q *eventQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events) - q.head
+}
+
+func (q *eventQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// eventRoute hands the events it matches to a function instead of
+// ReadEvent, see RouteOtherChannels, RouteDivertedEvents and
+// SubscribeCustom.
+type eventRoute struct {
+	match  func(*Event) bool // Called by the read loop
+	events *eventQueue
+	stop   chan struct{}
+}
+
+// startRoute sets the route in p, replacing the previous one, and calls fn
+// with the events routed, in a new goroutine, until cancel is called or
+// the connection terminates. Events already routed are still handed over.
+func (h *Connection) startRoute(p *atomic.Pointer[eventRoute], match func(*Event) bool, fn func(*Event)) (cancel func()) {
+	r := h.newRoute(match, fn)
+	if prev := p.Swap(r); prev != nil {
+		close(prev.stop)
+	}
+	return func() {
+		if p.CompareAndSwap(r, nil) {
+			close(r.stop)
+		}
+	}
+}
+
+// newRoute creates a route, and calls fn with the events routed to it, in
+// a new goroutine, until its stop channel is closed or the connection
+// terminates.
+func (h *Connection) newRoute(match func(*Event) bool, fn func(*Event)) *eventRoute {
+	r := &eventRoute{match: match, events: newEventQueue(), stop: make(chan struct{})}
+	go func() {
+		for {
+			for ev, ok := r.events.pop(); ok; ev, ok = r.events.pop() {
+				fn(ev)
+			}
+			select {
+			case <-r.stop:
+			case <-h.done:
+			case <-r.events.wake:
+				continue
+			}
+			for ev, ok := r.events.pop(); ok; ev, ok = r.events.pop() {
+				fn(ev)
+			}
+			return
+		}
+	}()
+	return r
+}
+
+// routeEvent queues the event for the first route that matches it, if
+// any, and reports whether one did.
+func (h *Connection) routeEvent(ev *Event) bool {
+	for _, p := range [...]*atomic.Pointer[eventRoute]{&h.others, &h.diverted} {
+		if r := p.Load(); r != nil && r.match(ev) {
+			r.events.push(ev)
+			return true
+		}
+	}
+	if m := h.custom.Load(); m != nil {
+		if r := (*m)[ev.peek("Event-Subclass")]; r != nil {
+			r.events.push(ev)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "testing"
+
+// TestEventQueueLagging checks that the queue doesn't grow when consumers
+// always lag behind by a few events, so it's never drained.
+func TestEventQueueLagging(t *testing.T) {
+	q := newEventQueue()
+	for i := 0; i < 10; i++ {
+		q.push(&Event{})
+	}
+	for i := 0; i < 100000; i++ {
+		q.push(&Event{})
+		if _, ok := q.pop(); !ok {
+			t.Fatal("queue is empty")
+		}
+	}
+	if n := q.len(); n != 10 {
+		t.Fatalf("queue has %d events, want 10", n)
+	}
+	if n := cap(q.events); n > 4*minCompact {
+		t.Fatalf("queue grew to %d events", n)
+	}
+}
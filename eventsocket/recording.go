@@ -0,0 +1,318 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RecordOptions are the optional settings of StartRecording.
+type RecordOptions struct {
+	// Limit stops the recording after the given duration, rounded up to
+	// seconds. Zero means no limit.
+	Limit time.Duration
+
+	// Stereo records each leg of the call on its own channel.
+	Stereo bool
+
+	// Append appends to the file, if it exists, rather than replacing it.
+	Append bool
+}
+
+// StartRecording starts recording a channel to the given path, using
+// uuid_record. Nil options use the defaults. It returns ErrNoSuchChannel
+// when the channel doesn't exist.
+//
+// Stereo and Append are channel variables, and apply to the recordings
+// started later on the channel as well.
+func (h *Connection) StartRecording(uuid, path string, opts *RecordOptions) error {
+	if !validArg(uuid) || !validArg(path) {
+		return errInvalidArgument
+	}
+	if opts == nil {
+		opts = &RecordOptions{}
+	}
+	vars := []struct {
+		name string
+		set  bool
+	}{
+		{"RECORD_STEREO", opts.Stereo},
+		{"RECORD_APPEND", opts.Append},
+	}
+	for _, v := range vars {
+		if v.set {
+			if _, err := h.api("uuid_setvar " + uuid + " " + v.name + " true"); err != nil {
+				return err
+			}
+		}
+	}
+	cmd := "uuid_record " + uuid + " start " + path
+	if opts.Limit > 0 {
+		s := int64((opts.Limit + time.Second - 1) / time.Second)
+		cmd += " " + strconv.FormatInt(s, 10)
+	}
+	_, err := h.api(cmd)
+	return err
+}
+
+// StopRecording stops recording a channel to the given path, or all of
+// its recordings when path is "all".
+func (h *Connection) StopRecording(uuid, path string) error {
+	return h.record(uuid, "stop", path)
+}
+
+// MaskRecording replaces the audio of a recording with silence until it's
+// unmasked, e.g. while the caller enters a credit card number.
+func (h *Connection) MaskRecording(uuid, path string) error {
+	return h.record(uuid, "mask", path)
+}
+
+// UnmaskRecording resumes recording audio after MaskRecording.
+func (h *Connection) UnmaskRecording(uuid, path string) error {
+	return h.record(uuid, "unmask", path)
+}
+
+// record runs uuid_record without options.
+func (h *Connection) record(uuid, action, path string) error {
+	if !validArg(uuid) || !validArg(path) {
+		return errInvalidArgument
+	}
+	_, err := h.api("uuid_record " + uuid + " " + action + " " + path)
+	return err
+}
+
+// RecordingResult is the outcome of a recording, from a RECORD_STOP event.
+type RecordingResult struct {
+	UUID     string        // Channel recorded
+	Path     string        // File written by FreeSWITCH
+	Duration time.Duration // Length of the recording, if known
+
+	// Terminator is the DTMF digit that ended the recording, if any.
+	Terminator string
+
+	// CompletionCause is why the recording ended, if reported by
+	// FreeSWITCH, e.g. success-silence or success-maxtime.
+	CompletionCause string
+
+	// Event is the RECORD_STOP event.
+	Event *Event
+}
+
+// ParseRecordingResult parses RECORD_STOP events, and RECORD_START events
+// which lack the duration and the other results. It returns
+// ErrMissingHeader for events without Record-File-Path.
+func ParseRecordingResult(ev *Event) (*RecordingResult, error) {
+	r := &RecordingResult{
+		UUID:            ev.Get("Unique-Id"),
+		Path:            ev.Get("Record-File-Path"),
+		Terminator:      ev.Variable("playback_terminator_used"),
+		CompletionCause: ev.Get("Record-Completion-Cause"),
+		Event:           ev,
+	}
+	if r.Path == "" {
+		return nil, ErrMissingHeader
+	}
+	r.Duration, _ = recordDuration(ev)
+	return r, nil
+}
+
+// recordDuration returns the length of the last recording of the channel,
+// from its variables.
+func recordDuration(ev *Event) (time.Duration, bool) {
+	if d, err := ev.GetDuration("Variable_record_ms", time.Millisecond); err == nil {
+		return d, true
+	}
+	if d, err := ev.GetDuration("Variable_record_seconds", time.Second); err == nil {
+		return d, true
+	}
+	return 0, false
+}
+
+// Recording is a call recording tracked by RecordingManager.
+type Recording struct {
+	UUID     string        // Channel being recorded
+	Path     string        // File being written by FreeSWITCH
+	Started  time.Time     // When the recording started
+	Stopped  time.Time     // When it stopped, zero while recording
+	Duration time.Duration // Length of the recording, set once stopped
+}
+
+// RecordPolicy decides whether an answered call is recorded automatically.
+// It's called with the CHANNEL_ANSWER event and returns the path of the
+// recording, or "" to leave the call alone.
+type RecordPolicy func(ev *Event) (path string)
+
+// RecordingManager tracks the active recordings of each channel, either
+// started by the manager itself or by anyone else, like the dialplan.
+//
+// It must be fed with events read from the connection, which needs to be
+// subscribed to CHANNEL_ANSWER, RECORD_START, RECORD_STOP and
+// CHANNEL_DESTROY.
+//
+// Example:
+//
+//	m := eventsocket.NewRecordingManager(c)
+//	m.Policy = func(ev *eventsocket.Event) string {
+//		if ev.Get("Caller-Context") != "sales" {
+//			return ""
+//		}
+//		return "/var/recordings/" + ev.Get("Unique-Id") + ".wav"
+//	}
+//	m.OnStop = func(r *eventsocket.Recording) {
+//		fmt.Println(r.Path, r.Duration)
+//	}
+//	c.Send("events plain CHANNEL_ANSWER CHANNEL_DESTROY RECORD_START RECORD_STOP")
+//	for {
+//		ev, _ := c.ReadEvent()
+//		m.HandleEvent(ev)
+//	}
+type RecordingManager struct {
+	// Policy, when set, is consulted for every answered call.
+	Policy RecordPolicy
+
+	// OnStop, when set, is called for every recording that stops.
+	OnStop func(r *Recording)
+
+	// OnError, when set, is called when recording an answered call
+	// selected by Policy fails.
+	OnError func(uuid string, err error)
+
+	conn   *Connection
+	mu     sync.Mutex
+	active map[string]map[string]*Recording // uuid:path:recording
+}
+
+// NewRecordingManager creates a RecordingManager that issues commands on the
+// given connection.
+func NewRecordingManager(c *Connection) *RecordingManager {
+	return &RecordingManager{
+		conn:   c,
+		active: make(map[string]map[string]*Recording),
+	}
+}
+
+// Start starts recording the channel to the given path.
+func (m *RecordingManager) Start(uuid, path string) error {
+	return m.start(uuid, path, m.track(uuid, path, time.Now()))
+}
+
+// start starts a recording that's already tracked, so RECORD_STOP and
+// CHANNEL_DESTROY find it even if they're handled before uuid_record
+// returns. It's untracked if it fails and added is set, that is, it wasn't
+// tracked before.
+func (m *RecordingManager) start(uuid, path string, added bool) error {
+	err := m.conn.StartRecording(uuid, path, nil)
+	if err != nil && added {
+		m.untrack(uuid, path)
+	}
+	return err
+}
+
+// Stop stops recording the channel to the given path. The recording is
+// reported to OnStop once FreeSWITCH confirms it with RECORD_STOP.
+func (m *RecordingManager) Stop(uuid, path string) error {
+	return m.conn.StopRecording(uuid, path)
+}
+
+// Active returns the recordings in progress for the given channel.
+func (m *RecordingManager) Active(uuid string) []Recording {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var recs []Recording
+	for _, r := range m.active[uuid] {
+		recs = append(recs, *r)
+	}
+	return recs
+}
+
+// HandleEvent updates the state of recordings based on the event. Events
+// the manager doesn't care about are ignored.
+func (m *RecordingManager) HandleEvent(ev *Event) {
+	uuid := ev.Get("Unique-Id")
+	switch ev.Get("Event-Name") {
+	case "CHANNEL_ANSWER":
+		if m.Policy == nil {
+			return
+		}
+		if path := m.Policy(ev); path != "" {
+			added := m.track(uuid, path, time.Now())
+			// Don't block the caller, which is usually reading events.
+			go func() {
+				if err := m.start(uuid, path, added); err != nil && m.OnError != nil {
+					m.OnError(uuid, err)
+				}
+			}()
+		}
+	case "RECORD_START":
+		t, err := ev.Timestamp()
+		if err != nil {
+			t = time.Now()
+		}
+		m.track(uuid, ev.Get("Record-File-Path"), t)
+	case "RECORD_STOP":
+		if r := m.untrack(uuid, ev.Get("Record-File-Path")); r != nil {
+			m.stopped(r, ev)
+		}
+	case "CHANNEL_DESTROY":
+		m.mu.Lock()
+		recs := m.active[uuid]
+		delete(m.active, uuid)
+		m.mu.Unlock()
+		for _, r := range recs {
+			m.stopped(r, ev)
+		}
+	}
+}
+
+// track adds a recording, unless it's already known, and reports whether
+// it was added.
+func (m *RecordingManager) track(uuid, path string, started time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	recs := m.active[uuid]
+	if recs == nil {
+		recs = make(map[string]*Recording)
+		m.active[uuid] = recs
+	}
+	if _, ok := recs[path]; ok {
+		return false
+	}
+	recs[path] = &Recording{UUID: uuid, Path: path, Started: started}
+	return true
+}
+
+// untrack removes and returns a recording, or nil if it's unknown.
+func (m *RecordingManager) untrack(uuid, path string) *Recording {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	recs := m.active[uuid]
+	r := recs[path]
+	if r == nil {
+		return nil
+	}
+	delete(recs, path)
+	if len(recs) == 0 {
+		delete(m.active, uuid)
+	}
+	return r
+}
+
+// stopped fills in the end of the recording and reports it.
+func (m *RecordingManager) stopped(r *Recording, ev *Event) {
+	var err error
+	if r.Stopped, err = ev.Timestamp(); err != nil {
+		r.Stopped = time.Now()
+	}
+	if d, ok := recordDuration(ev); ok {
+		r.Duration = d
+	} else {
+		r.Duration = r.Stopped.Sub(r.Started)
+	}
+	if m.OnStop != nil {
+		m.OnStop(r)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+	"github.com/fiorix/go-eventsocket/eventsocket/eventsockettest"
+)
+
+// TestRecordingManagerStopWhileStarting checks that a recording started by
+// the policy is tracked before uuid_record returns, so a RECORD_STOP that
+// comes meanwhile doesn't leave it behind as active.
+func TestRecordingManagerStopWhileStarting(t *testing.T) {
+	s := eventsockettest.NewServer()
+	defer s.Close()
+	release := make(chan struct{})
+	s.HandleAPI("uuid_record", func(args string) string {
+		<-release
+		return "-ERR Cannot locate session!"
+	})
+	c, err := eventsocket.Dial(s.Addr, s.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	m := eventsocket.NewRecordingManager(c)
+	m.Policy = func(ev *eventsocket.Event) string { return "/tmp/a.wav" }
+	stopped := make(chan *eventsocket.Recording, 1)
+	m.OnStop = func(r *eventsocket.Recording) { stopped <- r }
+	failed := make(chan error, 1)
+	m.OnError = func(uuid string, err error) { failed <- err }
+
+	ev := func(name string) *eventsocket.Event {
+		return &eventsocket.Event{Header: eventsocket.EventHeader{
+			"Event-Name":       name,
+			"Unique-Id":        "u1",
+			"Record-File-Path": "/tmp/a.wav",
+		}}
+	}
+	m.HandleEvent(ev("CHANNEL_ANSWER"))
+	if n := len(m.Active("u1")); n != 1 {
+		t.Fatalf("%d active recordings before uuid_record returns, want 1", n)
+	}
+	m.HandleEvent(ev("RECORD_STOP"))
+	select {
+	case r := <-stopped:
+		if r.Path != "/tmp/a.wav" {
+			t.Fatalf("stopped %q", r.Path)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("recording didn't stop")
+	}
+	close(release)
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("uuid_record didn't fail")
+	}
+	if n := len(m.Active("u1")); n != 0 {
+		t.Fatalf("%d active recordings, want 0", n)
+	}
+}
+
+// TestRecordingManagerStartFails checks that a recording is untracked when
+// uuid_record fails.
+func TestRecordingManagerStartFails(t *testing.T) {
+	s := eventsockettest.NewServer()
+	defer s.Close()
+	s.HandleAPI("uuid_record", func(args string) string {
+		return "-ERR Cannot locate session!"
+	})
+	c, err := eventsocket.Dial(s.Addr, s.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	m := eventsocket.NewRecordingManager(c)
+	if err := m.Start("u1", "/tmp/a.wav"); err == nil {
+		t.Fatal("Start succeeded")
+	}
+	if n := len(m.Active("u1")); n != 0 {
+		t.Fatalf("%d active recordings, want 0", n)
+	}
+}
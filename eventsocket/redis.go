@@ -0,0 +1,159 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+const (
+	redisKey       = "fs:{FreeSWITCH-Hostname}:{event}"
+	redisBatchSize = 100
+)
+
+// RedisExecutor runs Redis commands. It's implemented on top of any Redis
+// client, e.g. with github.com/redis/go-redis, in a pipeline:
+//
+//	type executor struct{ rdb *redis.Client }
+//
+//	func (e executor) Exec(ctx context.Context, cmds [][]string) error {
+//		_, err := e.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+//			for _, cmd := range cmds {
+//				args := make([]interface{}, len(cmd))
+//				for i, arg := range cmd {
+//					args[i] = arg
+//				}
+//				p.Do(ctx, args...)
+//			}
+//			return nil
+//		})
+//		return err
+//	}
+type RedisExecutor interface {
+	// Exec runs all commands, e.g. PUBLISH or XADD, or fails. Commands of
+	// a failed batch are run again.
+	Exec(ctx context.Context, cmds [][]string) error
+}
+
+// RedisMode tells RedisSink how to forward events.
+type RedisMode int
+
+// Redis modes.
+const (
+	// RedisPubSub publishes events to Pub/Sub channels, for consumers that
+	// are only interested in events while they're listening.
+	RedisPubSub RedisMode = iota
+
+	// RedisStream adds events to streams with XADD, where they're kept
+	// for consumers to read at their own pace.
+	RedisStream
+)
+
+// RedisSink forwards events to Redis, as json, either to Pub/Sub channels
+// or to streams, in pipelined batches, retrying with exponential backoff
+// while Redis fails. A failed batch is forwarded again in full, so some of
+// its events may be seen twice.
+//
+// Stream entries have the fields event, with the name of the event, and
+// json, with the event.
+//
+// Example:
+//
+//	s := eventsocket.NewRedisSink(executor{rdb}, eventsocket.RedisStream)
+//	s.MaxLen = 10000
+//	go s.Run(ctx, c)
+type RedisSink struct {
+	// Executor runs the commands on Redis.
+	Executor RedisExecutor
+
+	// Mode tells whether events go to Pub/Sub channels or streams.
+	Mode RedisMode
+
+	// Match, when set, selects the events forwarded. Defaults to all.
+	Match func(*Event) bool
+
+	// Key is the template of the channels or streams, where {event} is
+	// replaced by the name of the event, or its subclass for CUSTOM
+	// events, and {Header-Name} by the value of that header. Defaults to
+	// fs:{FreeSWITCH-Hostname}:{event}, e.g. fs:pbx1:CHANNEL_ANSWER.
+	Key string
+
+	// MaxLen, when set, caps streams at about that many entries, see
+	// XADD's MAXLEN ~.
+	MaxLen int
+
+	// BatchSize is how many commands are pipelined at once, 100 by
+	// default.
+	BatchSize int
+
+	// MinBackoff and MaxBackoff bound the wait between attempts to forward
+	// a batch, which doubles after every failure. They default to 100ms
+	// and 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// NewRedisSink creates a RedisSink that runs commands with e.
+func NewRedisSink(e RedisExecutor, mode RedisMode) *RedisSink {
+	return &RedisSink{Executor: e, Mode: mode}
+}
+
+// Run forwards the events received by the connection until the context is
+// cancelled or the connection terminates. Events must be subscribed to
+// separately.
+func (s *RedisSink) Run(ctx context.Context, c *Connection) error {
+	key := s.Key
+	if key == "" {
+		key = redisKey
+	}
+	size := s.BatchSize
+	if size <= 0 {
+		size = redisBatchSize
+	}
+	return (&sink{
+		name:       "redis",
+		match:      s.Match,
+		batchSize:  size,
+		minBackoff: s.MinBackoff,
+		maxBackoff: s.MaxBackoff,
+		publish: func(ctx context.Context, events []*Event) error {
+			cmds := make([][]string, 0, len(events))
+			for _, ev := range events {
+				b, err := ev.MarshalJSON()
+				if err != nil {
+					continue // Can't ever be forwarded
+				}
+				cmds = append(cmds, s.command(expandTemplate(key, ev, redisToken), ev, b))
+			}
+			if len(cmds) == 0 {
+				return nil
+			}
+			return s.Executor.Exec(ctx, cmds)
+		},
+	}).run(ctx, c)
+}
+
+// command returns the command that forwards an event.
+func (s *RedisSink) command(key string, ev *Event, b []byte) []string {
+	if s.Mode != RedisStream {
+		return []string{"PUBLISH", key, string(b)}
+	}
+	cmd := []string{"XADD", key}
+	if s.MaxLen > 0 {
+		cmd = append(cmd, "MAXLEN", "~", strconv.Itoa(s.MaxLen))
+	}
+	return append(cmd, "*", "event", eventName(ev), "json", string(b))
+}
+
+// redisToken returns "_" for empty values, so keys don't end up with empty
+// parts.
+func redisToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return s
+}
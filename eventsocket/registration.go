@@ -0,0 +1,238 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registration is a SIP registration of a device, tracked by
+// RegistrationTracker.
+type Registration struct {
+	User        string    // e.g. 1000
+	Domain      string    // e.g. example.com
+	Contact     string    // Where the device can be reached
+	CallID      string    // Call-ID of the REGISTER, unique per device
+	Profile     string    // Sofia profile the device registered to
+	UserAgent   string    // e.g. the phone model
+	NetworkIP   string    // IP the registration came from
+	NetworkPort string    // Port the registration came from
+	Expires     time.Time // When the registration expires, if known
+}
+
+// AOR returns the address of record of the registration, user@domain.
+func (r *Registration) AOR() string {
+	return r.User + "@" + r.Domain
+}
+
+// RegistrationTracker keeps track of the devices registered to sofia, based
+// on "show registrations" and on the sofia::register, sofia::unregister and
+// sofia::expire events that follow.
+//
+// Example:
+//
+//	t := eventsocket.NewRegistrationTracker(c)
+//	go t.Run(ctx)
+//	...
+//	for _, r := range t.Lookup("1000@example.com") {
+//		fmt.Println(r.Contact, r.UserAgent)
+//	}
+type RegistrationTracker struct {
+	conn *Connection
+	mu   sync.Mutex
+	regs map[string]map[string]*Registration // aor:call-id:registration
+}
+
+// NewRegistrationTracker creates a RegistrationTracker that issues commands
+// on the given connection.
+func NewRegistrationTracker(c *Connection) *RegistrationTracker {
+	return &RegistrationTracker{
+		conn: c,
+		regs: make(map[string]map[string]*Registration),
+	}
+}
+
+// Run subscribes to registration events, loads the current registrations
+// with Sync, and keeps them up to date until the context is cancelled or
+// the connection terminates.
+func (t *RegistrationTracker) Run(ctx context.Context) error {
+	events := newEventQueue()
+	cancel := t.conn.observe(func(ev *Event) bool {
+		switch ev.peek("Event-Subclass") {
+		case "sofia::register", "sofia::unregister", "sofia::expire":
+			events.push(ev.retain())
+		}
+		return false
+	})
+	defer cancel()
+	err := t.conn.Subscriptions().Subscribe(
+		"sofia::register", "sofia::unregister", "sofia::expire")
+	if err != nil {
+		return err
+	}
+	// Events received meanwhile are queued, and applied after the sync.
+	if err := t.Sync(); err != nil {
+		return err
+	}
+	for {
+		for ev, ok := events.pop(); ok; ev, ok = events.pop() {
+			t.HandleEvent(ev)
+			ev.Release()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.conn.done:
+			return t.conn.err
+		case <-events.wake:
+		}
+	}
+}
+
+// Sync replaces the registrations tracked with the ones listed by
+// "show registrations".
+func (t *RegistrationTracker) Sync() error {
+	var rows []struct {
+		User        string    `show:"reg_user"`
+		Realm       string    `show:"realm"`
+		URL         string    `show:"url"`
+		Token       string    `show:"token"`
+		Expires     time.Time `show:"expires"`
+		NetworkIP   string    `show:"network_ip"`
+		NetworkPort string    `show:"network_port"`
+	}
+	if err := t.conn.Show("registrations", &rows); err != nil {
+		return err
+	}
+	regs := make(map[string]map[string]*Registration)
+	for _, row := range rows {
+		r := &Registration{
+			User:        row.User,
+			Domain:      row.Realm,
+			Contact:     row.URL,
+			CallID:      row.Token,
+			NetworkIP:   row.NetworkIP,
+			NetworkPort: row.NetworkPort,
+			Expires:     row.Expires,
+		}
+		// The url is e.g. sofia/internal/sip:1000@host
+		if p := strings.SplitN(row.URL, "/", 3); len(p) == 3 {
+			r.Profile = p[1]
+		}
+		addRegistration(regs, r)
+	}
+	t.mu.Lock()
+	t.regs = regs
+	t.mu.Unlock()
+	return nil
+}
+
+// HandleEvent updates the registrations from sofia::register,
+// sofia::unregister and sofia::expire events. Other events are ignored.
+// It's called by Run, and only needs to be called directly by those not
+// using Run.
+func (t *RegistrationTracker) HandleEvent(ev *Event) {
+	switch ev.Get("Event-Subclass") {
+	case "sofia::register":
+		r := parseRegistration(ev)
+		t.mu.Lock()
+		addRegistration(t.regs, r)
+		t.mu.Unlock()
+	case "sofia::unregister":
+		t.remove(ev.Get("From-User")+"@"+ev.Get("From-Host"), ev.Get("Call-Id"))
+	case "sofia::expire":
+		t.remove(ev.Get("User")+"@"+ev.Get("Host"), ev.Get("Call-Id"))
+	}
+}
+
+// parseRegistration parses a sofia::register event.
+func parseRegistration(ev *Event) *Registration {
+	r := &Registration{
+		User:        ev.Get("From-User"),
+		Domain:      ev.Get("From-Host"),
+		Contact:     ev.Get("Contact"),
+		CallID:      ev.Get("Call-Id"),
+		Profile:     ev.Get("Profile-Name"),
+		UserAgent:   ev.Get("User-Agent"),
+		NetworkIP:   ev.Get("Network-Ip"),
+		NetworkPort: ev.Get("Network-Port"),
+	}
+	if sec, err := strconv.Atoi(ev.Get("Expires")); err == nil && sec > 0 {
+		r.Expires = time.Now().Add(time.Duration(sec) * time.Second)
+	}
+	return r
+}
+
+// Lookup returns the devices registered for an address of record, e.g.
+// 1000@example.com, leaving out expired registrations.
+func (t *RegistrationTracker) Lookup(aor string) []Registration {
+	now := time.Now()
+	t.mu.Lock()
+	var list []Registration
+	for _, r := range t.regs[aor] {
+		if r.Expires.IsZero() || r.Expires.After(now) {
+			list = append(list, *r)
+		}
+	}
+	t.mu.Unlock()
+	sortRegistrations(list)
+	return list
+}
+
+// Snapshot returns all registrations, including expired ones that weren't
+// reported by FreeSWITCH yet, sorted by address of record.
+func (t *RegistrationTracker) Snapshot() []Registration {
+	t.mu.Lock()
+	var list []Registration
+	for _, regs := range t.regs {
+		for _, r := range regs {
+			list = append(list, *r)
+		}
+	}
+	t.mu.Unlock()
+	sortRegistrations(list)
+	return list
+}
+
+// remove removes a registration, or all registrations of the address of
+// record if the call-id is unknown.
+func (t *RegistrationTracker) remove(aor, callID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	regs := t.regs[aor]
+	if callID == "" {
+		delete(t.regs, aor)
+		return
+	}
+	delete(regs, callID)
+	if len(regs) == 0 {
+		delete(t.regs, aor)
+	}
+}
+
+// addRegistration adds a registration to regs, replacing the previous one
+// of the same device.
+func addRegistration(regs map[string]map[string]*Registration, r *Registration) {
+	aor := r.AOR()
+	if regs[aor] == nil {
+		regs[aor] = make(map[string]*Registration)
+	}
+	regs[aor][r.CallID] = r
+}
+
+// sortRegistrations sorts registrations by address of record and contact.
+func sortRegistrations(list []Registration) {
+	sort.Slice(list, func(i, j int) bool {
+		if a, b := list[i].AOR(), list[j].AOR(); a != b {
+			return a < b
+		}
+		return list[i].Contact < list[j].Contact
+	})
+}
@@ -0,0 +1,215 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// recordMagic starts recordings, followed by frames of the data read, each
+// with an 8 byte offset in nanoseconds since the recording started, a 4
+// byte length, and the data, in big endian.
+const recordMagic = "ESLREC1\n"
+
+var errRecordFormat = errors.New("Not an event socket recording")
+
+// Record writes everything read from the socket to w, with its timing,
+// until stop is called, which returns the first error writing to w, if
+// any. Recordings can be replayed by ReplayConnection, to reproduce what
+// happened in a connection, e.g. in tests.
+//
+// Recording starts at the beginning of the first message received after
+// Record is called. Only one recording can be made at a time, a new one
+// stops the previous.
+//
+// Example:
+//
+//	f, _ := os.Create("incident.eslrec")
+//	stop := c.Record(f)
+//	...
+//	err := stop()
+//	f.Close()
+func (h *Connection) Record(w io.Writer) (stop func() error) {
+	r := &recorder{w: w}
+	h.recorder.Store(r)
+	return func() error {
+		h.recorder.CompareAndSwap(r, nil)
+		return r.stop()
+	}
+}
+
+// recorder writes the data read from a socket to a recording.
+type recorder struct {
+	mu      sync.Mutex
+	w       io.Writer
+	start   time.Time // When the first frame was read, zero until then
+	stopped bool
+	err     error
+}
+
+// begin starts the recording with data already buffered, at the beginning
+// of a message.
+func (r *recorder) begin(b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.start.IsZero() || r.stopped || r.err != nil {
+		return
+	}
+	r.start = time.Now()
+	if _, r.err = io.WriteString(r.w, recordMagic); r.err == nil && len(b) > 0 {
+		r.frame(b)
+	}
+}
+
+// started reports whether the recording started.
+func (r *recorder) started() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.start.IsZero()
+}
+
+// write records data read from the socket, once the recording started.
+func (r *recorder) write(b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.start.IsZero() || r.stopped || r.err != nil {
+		return
+	}
+	r.frame(b)
+}
+
+// frame writes a frame with mu held.
+func (r *recorder) frame(b []byte) {
+	var hdr [12]byte
+	binary.BigEndian.PutUint64(hdr[:8], uint64(time.Since(r.start)))
+	binary.BigEndian.PutUint32(hdr[8:], uint32(len(b)))
+	if _, r.err = r.w.Write(hdr[:]); r.err == nil {
+		_, r.err = r.w.Write(b)
+	}
+}
+
+func (r *recorder) stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+	return r.err
+}
+
+// recordBoundary is called by the read loop at the beginning of every message, to
+// start pending recordings, see Record.
+func (h *Connection) recordBoundary() {
+	n := h.reader.Buffered()
+	h.boundary.Store(n == 0)
+	if r := h.recorder.Load(); r != nil && n > 0 && !r.started() {
+		b, _ := h.reader.Peek(n)
+		r.begin(b)
+	}
+}
+
+// recordRead records data read from the socket, when recording.
+func (h *Connection) recordRead(b []byte) {
+	boundary := h.boundary.Swap(false)
+	r := h.recorder.Load()
+	if r == nil {
+		return
+	}
+	if boundary && !r.started() {
+		r.begin(b)
+		return
+	}
+	r.write(b)
+}
+
+// RecordReader reads the frames of a recording made by Record.
+type RecordReader struct {
+	r *bufio.Reader
+}
+
+// NewRecordReader checks that r is a recording, and returns a RecordReader
+// to read its frames.
+func NewRecordReader(r io.Reader) (*RecordReader, error) {
+	rr := &RecordReader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(recordMagic))
+	if _, err := io.ReadFull(rr.r, magic); err != nil || string(magic) != recordMagic {
+		return nil, errRecordFormat
+	}
+	return rr, nil
+}
+
+// Next returns the next frame of the recording: when it was read, since
+// the recording started, and the data. It returns io.EOF at the end.
+func (rr *RecordReader) Next() (at time.Duration, b []byte, err error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(rr.r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	at = time.Duration(binary.BigEndian.Uint64(hdr[:8]))
+	b = make([]byte, binary.BigEndian.Uint32(hdr[8:]))
+	if _, err := io.ReadFull(rr.r, b); err != nil {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	return at, b, nil
+}
+
+// Replay writes the data of a recording to w, e.g. the connection of a
+// fake server, with the original timing divided by speed: 1 for the
+// original timing, 10 for ten times faster, or 0 for no delays at all.
+func Replay(w io.Writer, r io.Reader, speed float64) error {
+	rr, err := NewRecordReader(r)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	for {
+		at, b, err := rr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if speed > 0 {
+			time.Sleep(time.Until(start.Add(time.Duration(float64(at) / speed))))
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+}
+
+// ReplayConnection returns a Connection that reads a recording as if it
+// were the socket, with the timing of Replay. Events recorded are returned
+// by ReadEvent, and once they're over, the connection terminates with
+// io.EOF. Commands can be sent, but only get the replies recorded.
+//
+// Example:
+//
+//	f, _ := os.Open("incident.eslrec")
+//	c, err := eventsocket.ReplayConnection(f, 0)
+//	for {
+//		ev, err := c.ReadEvent()
+//		...
+//	}
+func ReplayConnection(r io.Reader, speed float64) (*Connection, error) {
+	rr := bufio.NewReader(r)
+	if b, err := rr.Peek(len(recordMagic)); err != nil || string(b) != recordMagic {
+		return nil, errRecordFormat
+	}
+	client, server := net.Pipe()
+	go io.Copy(io.Discard, server) // Commands sent
+	go func() {
+		Replay(server, rr, speed)
+		server.Close()
+	}()
+	h := newConnection(client)
+	h.setState(StateReady)
+	go h.readLoop()
+	return h, nil
+}
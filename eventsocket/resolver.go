@@ -0,0 +1,56 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Resolver returns the addresses of the nodes of a Cluster, e.g. from
+// service discovery.
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// ResolverFunc is an adapter to use ordinary functions as Resolvers.
+type ResolverFunc func(ctx context.Context) ([]string, error)
+
+// Resolve calls fn(ctx).
+func (fn ResolverFunc) Resolve(ctx context.Context) ([]string, error) {
+	return fn(ctx)
+}
+
+// SRVResolver resolves the nodes of a Cluster with DNS SRV records, e.g.
+// _esl._tcp.example.com, ordered by priority and randomized by weight.
+// See net.LookupSRV.
+type SRVResolver struct {
+	Service string // e.g. esl, or empty to look up Name directly
+	Proto   string // e.g. tcp
+	Name    string // e.g. example.com
+
+	// Resolver is the DNS resolver to use, or net.DefaultResolver if nil.
+	Resolver *net.Resolver
+}
+
+// Resolve implements Resolver.
+func (r *SRVResolver) Resolve(ctx context.Context) ([]string, error) {
+	res := r.Resolver
+	if res == nil {
+		res = net.DefaultResolver
+	}
+	_, srvs, err := res.LookupSRV(ctx, r.Service, r.Proto, r.Name)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(srvs))
+	for i, srv := range srvs {
+		host := strings.TrimSuffix(srv.Target, ".")
+		addrs[i] = net.JoinHostPort(host, strconv.Itoa(int(srv.Port)))
+	}
+	return addrs, nil
+}
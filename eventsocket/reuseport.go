@@ -0,0 +1,28 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package eventsocket
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// reusePort sets SO_REUSEPORT on sockets, see Server.ReusePort.
+func reusePort(network, address string, c syscall.RawConn) error {
+	opt := 0x200 // SO_REUSEPORT of BSDs, not in syscall on all platforms
+	if runtime.GOOS == "linux" {
+		opt = 0xf
+	}
+	var err error
+	cerr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, opt, 1)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,19 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package eventsocket
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errReusePort = errors.New("SO_REUSEPORT is not supported on this system")
+
+// reusePort fails, see Server.ReusePort.
+func reusePort(network, address string, c syscall.RawConn) error {
+	return errReusePort
+}
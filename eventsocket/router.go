@@ -0,0 +1,93 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Router dispatches outbound connections to different handlers by the
+// application name given to the socket application after host:port, like
+// an HTTP router for calls. With the dialplan:
+//
+//	<action application="socket" data="127.0.0.1:9090 ivr async full"/>
+//	<action application="socket" data="127.0.0.1:9090 queue sales async full"/>
+//
+// connections are routed with:
+//
+//	r := eventsocket.NewRouter()
+//	r.Handle("ivr", ivr)
+//	r.Handle("queue", queue) // d.SocketArgs is [sales]
+//	s := &eventsocket.Server{Addr: ":9090", Handler: r}
+//	err := s.ListenAndServe()
+//
+// ServeConn sends connect to learn the application name, so handlers must
+// not send it again: the channel data is given to them, and also returned
+// by ChannelData.
+type Router struct {
+	// Handshake, if set, is the rest of the handshake of AutoConnect to
+	// do after connect, before calling the handler: myevents, linger,
+	// resume and the subscription to its events.
+	Handshake *HandshakeOptions
+
+	// NotFound is called for connections whose application has no
+	// handler. By default they're closed, which ends the socket
+	// application in the dialplan.
+	NotFound ChannelHandleFunc
+
+	mu     sync.RWMutex
+	routes map[string]ChannelHandleFunc
+}
+
+// NewRouter creates a Router without routes.
+func NewRouter() *Router {
+	return &Router{routes: make(map[string]ChannelHandleFunc)}
+}
+
+// Handle registers the handler of an application name, replacing the
+// previous one, if any. The empty name is for connections without one.
+func (r *Router) Handle(app string, fn ChannelHandleFunc) {
+	r.mu.Lock()
+	r.routes[app] = fn
+	r.mu.Unlock()
+}
+
+// Remove removes the handler of an application name.
+func (r *Router) Remove(app string) {
+	r.mu.Lock()
+	delete(r.routes, app)
+	r.mu.Unlock()
+}
+
+// ServeConn implements Handler. It sends connect, and calls the handler
+// of the application of the channel, after the handshake if set.
+// Connections whose handshake fails, or without a handler, are closed, and
+// the error returned.
+func (r *Router) ServeConn(c *Connection) error {
+	d, err := c.Connect()
+	if err != nil {
+		c.Close()
+		return err
+	}
+	r.mu.RLock()
+	fn := r.routes[d.SocketApp]
+	r.mu.RUnlock()
+	if fn == nil {
+		fn = r.NotFound
+	}
+	if fn == nil {
+		c.Close()
+		return fmt.Errorf("No handler for socket application %q", d.SocketApp)
+	}
+	if r.Handshake != nil {
+		if err := c.subscribeChannel(r.Handshake); err != nil {
+			c.Close()
+			return err
+		}
+	}
+	fn(c, d)
+	return nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// RPCBackend is what RPCGateway sends commands to and reads events from:
+// a Connection, a Client or a Cluster.
+type RPCBackend interface {
+	Send(command string) (*Event, error)
+	ReadEvent() (*Event, error)
+}
+
+// RPCGateway implements the commands and the event stream of the gRPC
+// facade defined in rpc/eventsocket.proto, independently of gRPC, so
+// services in any language can control FreeSWITCH through one Go gateway.
+//
+// Run reads the events of the backend, and hands them to every call of
+// StreamEvents; the backend's events must not be read by anyone else.
+// Subscriptions are up to the backend, e.g. Setup of a Client.
+//
+// The gRPC server, and the code generated from rpc/eventsocket.proto, are
+// in the rpc module, so this package doesn't depend on gRPC:
+//
+//	gw := eventsocket.NewRPCGateway(cluster)
+//	go gw.Run()
+//	s := grpc.NewServer()
+//	rpc.RegisterEventSocketServer(s, rpc.NewServer(gw))
+//	s.Serve(ln)
+type RPCGateway struct {
+	backend  RPCBackend
+	mu       sync.Mutex
+	streams  map[int]*eventQueue
+	streamID int
+	done     chan struct{} // Closed when Run returns
+	err      error         // Why Run returned, set before done is closed
+}
+
+// NewRPCGateway creates an RPCGateway for the given backend.
+func NewRPCGateway(b RPCBackend) *RPCGateway {
+	return &RPCGateway{
+		backend: b,
+		streams: make(map[int]*eventQueue),
+		done:    make(chan struct{}),
+	}
+}
+
+// Run reads the events of the backend and hands them to the streams, until
+// reading fails, e.g. once the backend is closed. Streams end with its
+// error.
+func (g *RPCGateway) Run() error {
+	for {
+		ev, err := g.backend.ReadEvent()
+		if err != nil {
+			g.err = err
+			close(g.done)
+			return err
+		}
+		g.mu.Lock()
+		for _, q := range g.streams {
+			q.push(ev.retain())
+		}
+		g.mu.Unlock()
+		ev.Release()
+	}
+}
+
+// API runs an api command and returns its output. Error responses are
+// returned as errors.
+func (g *RPCGateway) API(ctx context.Context, command, args string) (string, error) {
+	ev, err := g.send(ctx, "api", command, args)
+	if err != nil {
+		return "", err
+	}
+	body := strings.TrimSpace(ev.Body)
+	if strings.HasPrefix(body, "-") {
+		return "", replyError(body)
+	}
+	return body, nil
+}
+
+// BgAPI runs an api command in the background and returns its job UUID.
+func (g *RPCGateway) BgAPI(ctx context.Context, command, args string) (string, error) {
+	ev, err := g.send(ctx, "bgapi", command, args)
+	if err != nil {
+		return "", err
+	}
+	return ev.Get("Job-Uuid"), nil
+}
+
+// Execute runs a dialplan application on a channel, with event-lock if
+// lock is set.
+func (g *RPCGateway) Execute(ctx context.Context, uuid, app, args string, lock bool) error {
+	if !validArg(uuid) || !validArg(app) || strings.ContainsAny(args, "\r\n") {
+		return errInvalidCommand
+	}
+	cmd := fmt.Sprintf("sendmsg %s\ncall-command: execute\nexecute-app-name: %s", uuid, app)
+	if args != "" {
+		cmd += "\nexecute-app-arg: " + args
+	}
+	if lock {
+		cmd += "\nevent-lock: true"
+	}
+	_, err := g.do(ctx, cmd)
+	return err
+}
+
+// send sends an api or bgapi command.
+func (g *RPCGateway) send(ctx context.Context, verb, command, args string) (*Event, error) {
+	if !validArg(command) || strings.ContainsAny(args, "\r\n") {
+		return nil, errInvalidCommand
+	}
+	cmd := verb + " " + command
+	if args != "" {
+		cmd += " " + args
+	}
+	return g.do(ctx, cmd)
+}
+
+// do sends a command, and stops waiting for its reply once the context is
+// cancelled.
+func (g *RPCGateway) do(ctx context.Context, cmd string) (*Event, error) {
+	ch := make(chan *reply, 1)
+	go func() {
+		ev, err := g.backend.Send(cmd)
+		ch <- &reply{ev: ev, err: err}
+	}()
+	select {
+	case r := <-ch:
+		return r.ev, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// StreamEvents calls send with the events received, in order, until the
+// context is cancelled, send fails, or Run returns, and returns why. Only
+// events with the given names, or CUSTOM subclasses, are sent, or all if
+// none is given, and only those that have all headers of filters with the
+// values given.
+func (g *RPCGateway) StreamEvents(ctx context.Context, names []string, filters map[string]string, send func(*Event) error) error {
+	want := make(map[string]bool, len(names))
+	for _, name := range names {
+		want[name] = true
+	}
+	q := newEventQueue()
+	g.mu.Lock()
+	g.streamID++
+	id := g.streamID
+	g.streams[id] = q
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.streams, id)
+		g.mu.Unlock()
+		for ev, ok := q.pop(); ok; ev, ok = q.pop() {
+			ev.Release()
+		}
+	}()
+	for {
+		for ev, ok := q.pop(); ok; ev, ok = q.pop() {
+			var err error
+			if rpcMatch(ev, want, filters) {
+				err = send(ev)
+			}
+			ev.Release()
+			if err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-g.done:
+			return g.err
+		case <-q.wake:
+		}
+	}
+}
+
+// StreamEventHeaders is StreamEvents for the rpc module, which can't refer
+// to Event: send is called with the headers and body of the events.
+func (g *RPCGateway) StreamEventHeaders(ctx context.Context, names []string, filters map[string]string, send func(headers map[string]string, body string) error) error {
+	return g.StreamEvents(ctx, names, filters, func(ev *Event) error {
+		headers := make(map[string]string)
+		for _, k := range ev.Keys() {
+			headers[k] = ev.Get(k)
+		}
+		return send(headers, ev.Body)
+	})
+}
+
+// rpcMatch reports whether an event has one of the names wanted, if any,
+// and all headers of filters.
+func rpcMatch(ev *Event, want map[string]bool, filters map[string]string) bool {
+	if len(want) > 0 && !want["ALL"] && !want[eventName(ev)] {
+		return false
+	}
+	for k, v := range filters {
+		if ev.Get(capitalize(k)) != v {
+			return false
+		}
+	}
+	return true
+}
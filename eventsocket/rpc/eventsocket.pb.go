@@ -0,0 +1,489 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Service definition of the gRPC facade of eventsocket.RPCGateway.
+//
+// The eventsocket package only depends on the standard library, so the
+// code generated from this file, and the server, live in this module of
+// their own. After changing it, regenerate the code with:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//		--go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//		eventsocket.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: eventsocket.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type APIRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Command       string                 `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"` // e.g. status, or originate
+	Args          string                 `protobuf:"bytes,2,opt,name=args,proto3" json:"args,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *APIRequest) Reset() {
+	*x = APIRequest{}
+	mi := &file_eventsocket_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *APIRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*APIRequest) ProtoMessage() {}
+
+func (x *APIRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_eventsocket_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use APIRequest.ProtoReflect.Descriptor instead.
+func (*APIRequest) Descriptor() ([]byte, []int) {
+	return file_eventsocket_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *APIRequest) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *APIRequest) GetArgs() string {
+	if x != nil {
+		return x.Args
+	}
+	return ""
+}
+
+type APIResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Body          string                 `protobuf:"bytes,1,opt,name=body,proto3" json:"body,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *APIResponse) Reset() {
+	*x = APIResponse{}
+	mi := &file_eventsocket_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *APIResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*APIResponse) ProtoMessage() {}
+
+func (x *APIResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_eventsocket_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use APIResponse.ProtoReflect.Descriptor instead.
+func (*APIResponse) Descriptor() ([]byte, []int) {
+	return file_eventsocket_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *APIResponse) GetBody() string {
+	if x != nil {
+		return x.Body
+	}
+	return ""
+}
+
+type BgAPIResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobUuid       string                 `protobuf:"bytes,1,opt,name=job_uuid,json=jobUuid,proto3" json:"job_uuid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BgAPIResponse) Reset() {
+	*x = BgAPIResponse{}
+	mi := &file_eventsocket_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BgAPIResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BgAPIResponse) ProtoMessage() {}
+
+func (x *BgAPIResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_eventsocket_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BgAPIResponse.ProtoReflect.Descriptor instead.
+func (*BgAPIResponse) Descriptor() ([]byte, []int) {
+	return file_eventsocket_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BgAPIResponse) GetJobUuid() string {
+	if x != nil {
+		return x.JobUuid
+	}
+	return ""
+}
+
+type ExecuteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Uuid          string                 `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"` // Of the channel
+	App           string                 `protobuf:"bytes,2,opt,name=app,proto3" json:"app,omitempty"`   // e.g. playback
+	Args          string                 `protobuf:"bytes,3,opt,name=args,proto3" json:"args,omitempty"`
+	Lock          bool                   `protobuf:"varint,4,opt,name=lock,proto3" json:"lock,omitempty"` // Whether to run with event-lock
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecuteRequest) Reset() {
+	*x = ExecuteRequest{}
+	mi := &file_eventsocket_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecuteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecuteRequest) ProtoMessage() {}
+
+func (x *ExecuteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_eventsocket_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecuteRequest.ProtoReflect.Descriptor instead.
+func (*ExecuteRequest) Descriptor() ([]byte, []int) {
+	return file_eventsocket_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ExecuteRequest) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *ExecuteRequest) GetApp() string {
+	if x != nil {
+		return x.App
+	}
+	return ""
+}
+
+func (x *ExecuteRequest) GetArgs() string {
+	if x != nil {
+		return x.Args
+	}
+	return ""
+}
+
+func (x *ExecuteRequest) GetLock() bool {
+	if x != nil {
+		return x.Lock
+	}
+	return false
+}
+
+type ExecuteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecuteResponse) Reset() {
+	*x = ExecuteResponse{}
+	mi := &file_eventsocket_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecuteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecuteResponse) ProtoMessage() {}
+
+func (x *ExecuteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_eventsocket_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecuteResponse.ProtoReflect.Descriptor instead.
+func (*ExecuteResponse) Descriptor() ([]byte, []int) {
+	return file_eventsocket_proto_rawDescGZIP(), []int{4}
+}
+
+type EventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Event names or subclasses of CUSTOM events, or empty for all.
+	Events []string `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	// Headers the events must have, with the given values.
+	Filters       map[string]string `protobuf:"bytes,2,rep,name=filters,proto3" json:"filters,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EventsRequest) Reset() {
+	*x = EventsRequest{}
+	mi := &file_eventsocket_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventsRequest) ProtoMessage() {}
+
+func (x *EventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_eventsocket_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventsRequest.ProtoReflect.Descriptor instead.
+func (*EventsRequest) Descriptor() ([]byte, []int) {
+	return file_eventsocket_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *EventsRequest) GetEvents() []string {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+func (x *EventsRequest) GetFilters() map[string]string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Headers       map[string]string      `protobuf:"bytes,1,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Body          string                 `protobuf:"bytes,2,opt,name=body,proto3" json:"body,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_eventsocket_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_eventsocket_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_eventsocket_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Event) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *Event) GetBody() string {
+	if x != nil {
+		return x.Body
+	}
+	return ""
+}
+
+var File_eventsocket_proto protoreflect.FileDescriptor
+
+const file_eventsocket_proto_rawDesc = "" +
+	"\n" +
+	"\x11eventsocket.proto\x12\veventsocket\":\n" +
+	"\n" +
+	"APIRequest\x12\x18\n" +
+	"\acommand\x18\x01 \x01(\tR\acommand\x12\x12\n" +
+	"\x04args\x18\x02 \x01(\tR\x04args\"!\n" +
+	"\vAPIResponse\x12\x12\n" +
+	"\x04body\x18\x01 \x01(\tR\x04body\"*\n" +
+	"\rBgAPIResponse\x12\x19\n" +
+	"\bjob_uuid\x18\x01 \x01(\tR\ajobUuid\"^\n" +
+	"\x0eExecuteRequest\x12\x12\n" +
+	"\x04uuid\x18\x01 \x01(\tR\x04uuid\x12\x10\n" +
+	"\x03app\x18\x02 \x01(\tR\x03app\x12\x12\n" +
+	"\x04args\x18\x03 \x01(\tR\x04args\x12\x12\n" +
+	"\x04lock\x18\x04 \x01(\bR\x04lock\"\x11\n" +
+	"\x0fExecuteResponse\"\xa6\x01\n" +
+	"\rEventsRequest\x12\x16\n" +
+	"\x06events\x18\x01 \x03(\tR\x06events\x12A\n" +
+	"\afilters\x18\x02 \x03(\v2'.eventsocket.EventsRequest.FiltersEntryR\afilters\x1a:\n" +
+	"\fFiltersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x92\x01\n" +
+	"\x05Event\x129\n" +
+	"\aheaders\x18\x01 \x03(\v2\x1f.eventsocket.Event.HeadersEntryR\aheaders\x12\x12\n" +
+	"\x04body\x18\x02 \x01(\tR\x04body\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x012\x87\x02\n" +
+	"\vEventSocket\x128\n" +
+	"\x03API\x12\x17.eventsocket.APIRequest\x1a\x18.eventsocket.APIResponse\x12<\n" +
+	"\x05BgAPI\x12\x17.eventsocket.APIRequest\x1a\x1a.eventsocket.BgAPIResponse\x12D\n" +
+	"\aExecute\x12\x1b.eventsocket.ExecuteRequest\x1a\x1c.eventsocket.ExecuteResponse\x12:\n" +
+	"\x06Events\x12\x1a.eventsocket.EventsRequest\x1a\x12.eventsocket.Event0\x01B6Z4github.com/fiorix/go-eventsocket/eventsocket/rpc;rpcb\x06proto3"
+
+var (
+	file_eventsocket_proto_rawDescOnce sync.Once
+	file_eventsocket_proto_rawDescData []byte
+)
+
+func file_eventsocket_proto_rawDescGZIP() []byte {
+	file_eventsocket_proto_rawDescOnce.Do(func() {
+		file_eventsocket_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_eventsocket_proto_rawDesc), len(file_eventsocket_proto_rawDesc)))
+	})
+	return file_eventsocket_proto_rawDescData
+}
+
+var file_eventsocket_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_eventsocket_proto_goTypes = []any{
+	(*APIRequest)(nil),      // 0: eventsocket.APIRequest
+	(*APIResponse)(nil),     // 1: eventsocket.APIResponse
+	(*BgAPIResponse)(nil),   // 2: eventsocket.BgAPIResponse
+	(*ExecuteRequest)(nil),  // 3: eventsocket.ExecuteRequest
+	(*ExecuteResponse)(nil), // 4: eventsocket.ExecuteResponse
+	(*EventsRequest)(nil),   // 5: eventsocket.EventsRequest
+	(*Event)(nil),           // 6: eventsocket.Event
+	nil,                     // 7: eventsocket.EventsRequest.FiltersEntry
+	nil,                     // 8: eventsocket.Event.HeadersEntry
+}
+var file_eventsocket_proto_depIdxs = []int32{
+	7, // 0: eventsocket.EventsRequest.filters:type_name -> eventsocket.EventsRequest.FiltersEntry
+	8, // 1: eventsocket.Event.headers:type_name -> eventsocket.Event.HeadersEntry
+	0, // 2: eventsocket.EventSocket.API:input_type -> eventsocket.APIRequest
+	0, // 3: eventsocket.EventSocket.BgAPI:input_type -> eventsocket.APIRequest
+	3, // 4: eventsocket.EventSocket.Execute:input_type -> eventsocket.ExecuteRequest
+	5, // 5: eventsocket.EventSocket.Events:input_type -> eventsocket.EventsRequest
+	1, // 6: eventsocket.EventSocket.API:output_type -> eventsocket.APIResponse
+	2, // 7: eventsocket.EventSocket.BgAPI:output_type -> eventsocket.BgAPIResponse
+	4, // 8: eventsocket.EventSocket.Execute:output_type -> eventsocket.ExecuteResponse
+	6, // 9: eventsocket.EventSocket.Events:output_type -> eventsocket.Event
+	6, // [6:10] is the sub-list for method output_type
+	2, // [2:6] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_eventsocket_proto_init() }
+func file_eventsocket_proto_init() {
+	if File_eventsocket_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_eventsocket_proto_rawDesc), len(file_eventsocket_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_eventsocket_proto_goTypes,
+		DependencyIndexes: file_eventsocket_proto_depIdxs,
+		MessageInfos:      file_eventsocket_proto_msgTypes,
+	}.Build()
+	File_eventsocket_proto = out.File
+	file_eventsocket_proto_goTypes = nil
+	file_eventsocket_proto_depIdxs = nil
+}
@@ -0,0 +1,265 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Service definition of the gRPC facade of eventsocket.RPCGateway.
+//
+// The eventsocket package only depends on the standard library, so the
+// code generated from this file, and the server, live in this module of
+// their own. After changing it, regenerate the code with:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//		--go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//		eventsocket.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: eventsocket.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	EventSocket_API_FullMethodName     = "/eventsocket.EventSocket/API"
+	EventSocket_BgAPI_FullMethodName   = "/eventsocket.EventSocket/BgAPI"
+	EventSocket_Execute_FullMethodName = "/eventsocket.EventSocket/Execute"
+	EventSocket_Events_FullMethodName  = "/eventsocket.EventSocket/Events"
+)
+
+// EventSocketClient is the client API for EventSocket service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EventSocketClient interface {
+	// API runs an api command and returns its output.
+	API(ctx context.Context, in *APIRequest, opts ...grpc.CallOption) (*APIResponse, error)
+	// BgAPI runs an api command in the background and returns its job
+	// UUID. The result comes in a BACKGROUND_JOB event.
+	BgAPI(ctx context.Context, in *APIRequest, opts ...grpc.CallOption) (*BgAPIResponse, error)
+	// Execute runs a dialplan application on a channel.
+	Execute(ctx context.Context, in *ExecuteRequest, opts ...grpc.CallOption) (*ExecuteResponse, error)
+	// Events streams the events received, filtered, until the client
+	// cancels the call.
+	Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type eventSocketClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEventSocketClient(cc grpc.ClientConnInterface) EventSocketClient {
+	return &eventSocketClient{cc}
+}
+
+func (c *eventSocketClient) API(ctx context.Context, in *APIRequest, opts ...grpc.CallOption) (*APIResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(APIResponse)
+	err := c.cc.Invoke(ctx, EventSocket_API_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventSocketClient) BgAPI(ctx context.Context, in *APIRequest, opts ...grpc.CallOption) (*BgAPIResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BgAPIResponse)
+	err := c.cc.Invoke(ctx, EventSocket_BgAPI_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventSocketClient) Execute(ctx context.Context, in *ExecuteRequest, opts ...grpc.CallOption) (*ExecuteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExecuteResponse)
+	err := c.cc.Invoke(ctx, EventSocket_Execute_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventSocketClient) Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &EventSocket_ServiceDesc.Streams[0], EventSocket_Events_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventSocket_EventsClient = grpc.ServerStreamingClient[Event]
+
+// EventSocketServer is the server API for EventSocket service.
+// All implementations must embed UnimplementedEventSocketServer
+// for forward compatibility.
+type EventSocketServer interface {
+	// API runs an api command and returns its output.
+	API(context.Context, *APIRequest) (*APIResponse, error)
+	// BgAPI runs an api command in the background and returns its job
+	// UUID. The result comes in a BACKGROUND_JOB event.
+	BgAPI(context.Context, *APIRequest) (*BgAPIResponse, error)
+	// Execute runs a dialplan application on a channel.
+	Execute(context.Context, *ExecuteRequest) (*ExecuteResponse, error)
+	// Events streams the events received, filtered, until the client
+	// cancels the call.
+	Events(*EventsRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedEventSocketServer()
+}
+
+// UnimplementedEventSocketServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEventSocketServer struct{}
+
+func (UnimplementedEventSocketServer) API(context.Context, *APIRequest) (*APIResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method API not implemented")
+}
+func (UnimplementedEventSocketServer) BgAPI(context.Context, *APIRequest) (*BgAPIResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BgAPI not implemented")
+}
+func (UnimplementedEventSocketServer) Execute(context.Context, *ExecuteRequest) (*ExecuteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Execute not implemented")
+}
+func (UnimplementedEventSocketServer) Events(*EventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Events not implemented")
+}
+func (UnimplementedEventSocketServer) mustEmbedUnimplementedEventSocketServer() {}
+func (UnimplementedEventSocketServer) testEmbeddedByValue()                     {}
+
+// UnsafeEventSocketServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EventSocketServer will
+// result in compilation errors.
+type UnsafeEventSocketServer interface {
+	mustEmbedUnimplementedEventSocketServer()
+}
+
+func RegisterEventSocketServer(s grpc.ServiceRegistrar, srv EventSocketServer) {
+	// If the following call pancis, it indicates UnimplementedEventSocketServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&EventSocket_ServiceDesc, srv)
+}
+
+func _EventSocket_API_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(APIRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventSocketServer).API(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EventSocket_API_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventSocketServer).API(ctx, req.(*APIRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EventSocket_BgAPI_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(APIRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventSocketServer).BgAPI(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EventSocket_BgAPI_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventSocketServer).BgAPI(ctx, req.(*APIRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EventSocket_Execute_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecuteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventSocketServer).Execute(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EventSocket_Execute_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventSocketServer).Execute(ctx, req.(*ExecuteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EventSocket_Events_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EventSocketServer).Events(m, &grpc.GenericServerStream[EventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventSocket_EventsServer = grpc.ServerStreamingServer[Event]
+
+// EventSocket_ServiceDesc is the grpc.ServiceDesc for EventSocket service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EventSocket_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "eventsocket.EventSocket",
+	HandlerType: (*EventSocketServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "API",
+			Handler:    _EventSocket_API_Handler,
+		},
+		{
+			MethodName: "BgAPI",
+			Handler:    _EventSocket_BgAPI_Handler,
+		},
+		{
+			MethodName: "Execute",
+			Handler:    _EventSocket_Execute_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Events",
+			Handler:       _EventSocket_Events_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "eventsocket.proto",
+}
@@ -0,0 +1,92 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package rpc is the gRPC facade of eventsocket, so services in any
+// language can control FreeSWITCH through one Go gateway. It has the code
+// generated from eventsocket.proto, and Server, which implements the
+// service with an eventsocket.RPCGateway.
+//
+// It's a module of its own, so eventsocket doesn't depend on gRPC.
+//
+// Example:
+//
+//	gw := eventsocket.NewRPCGateway(cluster)
+//	go gw.Run()
+//	s := grpc.NewServer()
+//	rpc.RegisterEventSocketServer(s, rpc.NewServer(gw))
+//	s.Serve(ln)
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/status"
+)
+
+// Gateway runs the commands of the service and streams events. It's
+// implemented by eventsocket.RPCGateway, see its documentation.
+type Gateway interface {
+	API(ctx context.Context, command, args string) (string, error)
+	BgAPI(ctx context.Context, command, args string) (string, error)
+	Execute(ctx context.Context, uuid, app, args string, lock bool) error
+	StreamEventHeaders(ctx context.Context, names []string, filters map[string]string, send func(headers map[string]string, body string) error) error
+}
+
+// Server implements EventSocketServer with a Gateway.
+type Server struct {
+	UnimplementedEventSocketServer
+	gw Gateway
+}
+
+// NewServer creates a Server for the given gateway.
+func NewServer(gw Gateway) *Server {
+	return &Server{gw: gw}
+}
+
+// API implements EventSocketServer.
+func (s *Server) API(ctx context.Context, r *APIRequest) (*APIResponse, error) {
+	body, err := s.gw.API(ctx, r.GetCommand(), r.GetArgs())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &APIResponse{Body: body}, nil
+}
+
+// BgAPI implements EventSocketServer.
+func (s *Server) BgAPI(ctx context.Context, r *APIRequest) (*BgAPIResponse, error) {
+	job, err := s.gw.BgAPI(ctx, r.GetCommand(), r.GetArgs())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &BgAPIResponse{JobUuid: job}, nil
+}
+
+// Execute implements EventSocketServer.
+func (s *Server) Execute(ctx context.Context, r *ExecuteRequest) (*ExecuteResponse, error) {
+	err := s.gw.Execute(ctx, r.GetUuid(), r.GetApp(), r.GetArgs(), r.GetLock())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &ExecuteResponse{}, nil
+}
+
+// Events implements EventSocketServer.
+func (s *Server) Events(r *EventsRequest, stream EventSocket_EventsServer) error {
+	err := s.gw.StreamEventHeaders(stream.Context(), r.GetEvents(), r.GetFilters(),
+		func(headers map[string]string, body string) error {
+			return stream.Send(&Event{Headers: headers, Body: body})
+		})
+	return statusError(err)
+}
+
+// statusError converts the errors of the context to their gRPC status.
+// Others, like the -ERR replies of FreeSWITCH, are returned with code
+// Unknown.
+func statusError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	return err
+}
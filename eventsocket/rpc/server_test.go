@@ -0,0 +1,123 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeGateway answers commands, and streams the events of its channel.
+type fakeGateway struct {
+	events chan map[string]string
+	names  chan []string // Of the streams started
+}
+
+func (g *fakeGateway) API(ctx context.Context, command, args string) (string, error) {
+	if command == "fail" {
+		return "", errors.New("command not found")
+	}
+	return command + " " + args, nil
+}
+
+func (g *fakeGateway) BgAPI(ctx context.Context, command, args string) (string, error) {
+	return "job-" + command, nil
+}
+
+func (g *fakeGateway) Execute(ctx context.Context, uuid, app, args string, lock bool) error {
+	if uuid == "" {
+		return errors.New("no such channel")
+	}
+	return nil
+}
+
+func (g *fakeGateway) StreamEventHeaders(ctx context.Context, names []string, filters map[string]string, send func(map[string]string, string) error) error {
+	g.names <- names
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case h := <-g.events:
+			if err := send(h, "body"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// dial serves gw over an in-memory listener, and returns a client of it.
+func dial(t *testing.T, gw Gateway) EventSocketClient {
+	t.Helper()
+	ln := bufconn.Listen(1 << 16)
+	s := grpc.NewServer()
+	RegisterEventSocketServer(s, NewServer(gw))
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewEventSocketClient(conn)
+}
+
+func TestServer(t *testing.T) {
+	gw := &fakeGateway{
+		events: make(chan map[string]string),
+		names:  make(chan []string, 1),
+	}
+	c := dial(t, gw)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	api, err := c.API(ctx, &APIRequest{Command: "show", Args: "channels"})
+	if err != nil || api.GetBody() != "show channels" {
+		t.Fatalf("API returned %v, %v", api, err)
+	}
+	if _, err := c.API(ctx, &APIRequest{Command: "fail"}); status.Convert(err).Message() != "command not found" {
+		t.Fatalf("failed API returned %v", err)
+	}
+	job, err := c.BgAPI(ctx, &APIRequest{Command: "originate"})
+	if err != nil || job.GetJobUuid() != "job-originate" {
+		t.Fatalf("BgAPI returned %v, %v", job, err)
+	}
+	if _, err := c.Execute(ctx, &ExecuteRequest{Uuid: "abc", App: "answer"}); err != nil {
+		t.Fatalf("Execute returned %v", err)
+	}
+	if _, err := c.Execute(ctx, &ExecuteRequest{App: "answer"}); err == nil {
+		t.Fatal("Execute without UUID succeeded")
+	}
+
+	sctx, scancel := context.WithCancel(ctx)
+	stream, err := c.Events(sctx, &EventsRequest{Events: []string{"CHANNEL_ANSWER"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := <-gw.names; len(names) != 1 || names[0] != "CHANNEL_ANSWER" {
+		t.Fatalf("stream of %v", names)
+	}
+	gw.events <- map[string]string{"Event-Name": "CHANNEL_ANSWER"}
+	ev, err := stream.Recv()
+	if err != nil || ev.GetHeaders()["Event-Name"] != "CHANNEL_ANSWER" || ev.GetBody() != "body" {
+		t.Fatalf("Recv returned %v, %v", ev, err)
+	}
+	scancel()
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Fatalf("cancelled stream returned %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "sync"
+
+// SampleStats are the counters of a sampled event type.
+type SampleStats struct {
+	Rate       int    // One in Rate events is kept
+	Seen       uint64 // Events received from FreeSWITCH
+	Suppressed uint64 // Events dropped by sampling
+}
+
+// sampler drops events of high volume types, keeping one in every n.
+type sampler struct {
+	mu    sync.Mutex
+	types map[string]*SampleStats
+}
+
+// SampleEvents keeps only one in every n events of the given type, and
+// drops the others before they reach ReadEvent. It's meant for high volume
+// events like HEARTBEAT or RE_SCHEDULE, when downstream consumers only need
+// a signal rather than every single event. Setting n to 1 or less stops
+// sampling the type.
+//
+// The type is the Event-Name, or the Event-Subclass for CUSTOM events,
+// e.g. SampleEvents("conference::maintenance", 10).
+//
+// The first event of each type is always kept. Use SampleStats to find out
+// how many events were suppressed.
+func (h *Connection) SampleEvents(name string, n int) {
+	s := &h.sampler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n <= 1 {
+		delete(s.types, name)
+		return
+	}
+	if s.types == nil {
+		s.types = make(map[string]*SampleStats)
+	}
+	if st, ok := s.types[name]; ok {
+		st.Rate = n
+		return
+	}
+	s.types[name] = &SampleStats{Rate: n}
+}
+
+// SampleStats returns the counters of each sampled event type.
+func (h *Connection) SampleStats() map[string]SampleStats {
+	s := &h.sampler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[string]SampleStats, len(s.types))
+	for name, st := range s.types {
+		stats[name] = *st
+	}
+	return stats
+}
+
+// keep reports whether the event should be delivered.
+func (s *sampler) keep(ev *Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.types) == 0 {
+		return true
+	}
+	st, ok := s.types[eventName(ev)]
+	if !ok {
+		return true
+	}
+	st.Seen++
+	if (st.Seen-1)%uint64(st.Rate) == 0 {
+		return true
+	}
+	st.Suppressed++
+	return false
+}
@@ -0,0 +1,235 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"container/heap"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errSchedulerClosed = errors.New("Scheduler closed")
+
+// Priority of commands queued in a Scheduler.
+type Priority int
+
+// Command priorities, from lowest to highest.
+const (
+	PriorityBackground Priority = iota // Stats polling and the like
+	PriorityNormal                     // Regular administrative commands
+	PriorityEmergency                  // Ignores rate limits, runs first
+)
+
+// ScheduledCommand is a command queued in a Scheduler.
+type ScheduledCommand struct {
+	Node     string
+	Command  string
+	Priority Priority
+
+	seq  uint64 // FIFO order within the same priority
+	done chan struct{}
+	ev   *Event
+	err  error
+}
+
+// Done returns a channel that's closed once the command has run.
+func (c *ScheduledCommand) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait waits for the command to run and returns its response.
+func (c *ScheduledCommand) Wait() (*Event, error) {
+	<-c.done
+	return c.ev, c.err
+}
+
+// Scheduler queues commands for several FreeSWITCH nodes, like the members
+// of a cluster, and runs them one at a time on each node, in order of
+// priority and respecting per-node rate limits.
+//
+// It's meant for administrative bulk operations. Emergency commands, like
+// hanging up all calls on a node, skip ahead of everything already queued
+// and aren't rate limited, so they're never stuck behind background jobs
+// like stats polling. Commands that are already running are not
+// interrupted.
+//
+// Cluster.Scheduler creates one for the nodes of a cluster. Otherwise,
+// commands are run by a function given the node, e.g.:
+//
+//	s := eventsocket.NewScheduler(10, func(node, cmd string) (*eventsocket.Event, error) {
+//		return conns[node].Send(cmd)
+//	})
+//	s.Submit("fs1", eventsocket.PriorityBackground, "api show calls count")
+//	cmd := s.Submit("fs1", eventsocket.PriorityEmergency, "api hupall")
+//	ev, err := cmd.Wait()
+type Scheduler struct {
+	exec func(node, command string) (*Event, error)
+	rate float64
+
+	mu     sync.Mutex
+	nodes  map[string]*nodeQueue
+	seq    uint64
+	closed bool
+}
+
+// nodeQueue holds the commands waiting to run on a node.
+type nodeQueue struct {
+	queue commandQueue
+	rate  float64
+	wake  chan struct{}
+}
+
+// NewScheduler creates a Scheduler that runs commands using exec, at most
+// perSecond commands per second on each node, or unlimited when 0.
+func NewScheduler(perSecond float64, exec func(node, command string) (*Event, error)) *Scheduler {
+	return &Scheduler{
+		exec:  exec,
+		rate:  perSecond,
+		nodes: make(map[string]*nodeQueue),
+	}
+}
+
+// SetRate sets the rate limit of a single node, overriding the default.
+func (s *Scheduler) SetRate(node string, perSecond float64) {
+	s.mu.Lock()
+	s.node(node).rate = perSecond
+	s.mu.Unlock()
+}
+
+// Submit queues a command to run on node, and returns immediately.
+func (s *Scheduler) Submit(node string, p Priority, command string) *ScheduledCommand {
+	c := &ScheduledCommand{
+		Node:     node,
+		Command:  command,
+		Priority: p,
+		done:     make(chan struct{}),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.err = errSchedulerClosed
+		close(c.done)
+		return c
+	}
+	s.seq++
+	c.seq = s.seq
+	n := s.node(node)
+	heap.Push(&n.queue, c)
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+	return c
+}
+
+// Pending returns the number of commands waiting to run on node.
+func (s *Scheduler) Pending(node string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.nodes[node]; ok {
+		return n.queue.Len()
+	}
+	return 0
+}
+
+// Close stops the scheduler. Commands still queued fail, commands already
+// running are allowed to finish.
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, n := range s.nodes {
+		for n.queue.Len() > 0 {
+			c := heap.Pop(&n.queue).(*ScheduledCommand)
+			c.err = errSchedulerClosed
+			close(c.done)
+		}
+		close(n.wake)
+	}
+}
+
+// node returns the queue of a node, starting its worker on first use.
+// It must be called with s.mu held.
+func (s *Scheduler) node(name string) *nodeQueue {
+	n, ok := s.nodes[name]
+	if !ok {
+		n = &nodeQueue{rate: s.rate, wake: make(chan struct{}, 1)}
+		s.nodes[name] = n
+		go s.run(n)
+	}
+	return n
+}
+
+// run executes the commands queued for a node until the scheduler closes.
+func (s *Scheduler) run(n *nodeQueue) {
+	var last time.Time
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		var wait time.Duration
+		var c *ScheduledCommand
+		if n.queue.Len() > 0 {
+			next := n.queue[0]
+			if n.rate > 0 && next.Priority < PriorityEmergency {
+				interval := time.Duration(float64(time.Second) / n.rate)
+				wait = last.Add(interval).Sub(time.Now())
+			}
+			if wait <= 0 {
+				c = heap.Pop(&n.queue).(*ScheduledCommand)
+			}
+		}
+		s.mu.Unlock()
+		if c != nil {
+			last = time.Now()
+			c.ev, c.err = s.exec(c.Node, c.Command)
+			close(c.done)
+			continue
+		}
+		if wait > 0 {
+			// Wake up early if something more urgent comes in.
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-n.wake:
+			}
+			timer.Stop()
+		} else if _, ok := <-n.wake; !ok {
+			return
+		}
+	}
+}
+
+// commandQueue is a priority queue of commands, implementing heap.Interface.
+type commandQueue []*ScheduledCommand
+
+func (q commandQueue) Len() int { return len(q) }
+
+func (q commandQueue) Less(i, j int) bool {
+	if q[i].Priority != q[j].Priority {
+		return q[i].Priority > q[j].Priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q commandQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *commandQueue) Push(x interface{}) {
+	*q = append(*q, x.(*ScheduledCommand))
+}
+
+func (q *commandQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return c
+}
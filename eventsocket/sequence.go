@@ -0,0 +1,61 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "strconv"
+
+// SequenceGap is a gap in the Event-Sequence of the events received,
+// meaning events were lost in between.
+type SequenceGap struct {
+	Last uint64 // Sequence of the last event received before the gap
+	Next uint64 // Sequence of the event received after the gap
+}
+
+// Lost returns the number of events missing in the gap.
+func (g SequenceGap) Lost() uint64 {
+	return g.Next - g.Last - 1
+}
+
+// OnSequenceGap sets fn to be called whenever the Event-Sequence of the
+// events received skips numbers, meaning events were lost, e.g. dropped by
+// FreeSWITCH when the socket couldn't keep up. Gaps are reported to
+// Metrics.EventsLost as well, if any. Setting fn to nil stops tracking.
+//
+// FreeSWITCH numbers all events it fires in a single sequence, so gaps are
+// only meaningful for connections subscribed to all events, without
+// filters, e.g. event collectors.
+//
+// fn is called from the read loop of the connection and must not block.
+func (h *Connection) OnSequenceGap(fn func(SequenceGap)) {
+	if fn == nil {
+		h.onGap.Store(nil)
+		return
+	}
+	h.onGap.Store(&fn)
+}
+
+// checkSequence reports gaps in the Event-Sequence of events. It's only
+// called from the read loop.
+func (h *Connection) checkSequence(ev *Event) {
+	fn := h.onGap.Load()
+	if fn == nil {
+		return
+	}
+	seq, err := strconv.ParseUint(ev.peek("Event-Sequence"), 10, 64)
+	if err != nil {
+		return
+	}
+	last := h.sequence
+	h.sequence = seq
+	// Starts over from the first event, or if FreeSWITCH restarted.
+	if last == 0 || seq <= last+1 {
+		return
+	}
+	gap := SequenceGap{Last: last, Next: seq}
+	if m := h.stats(); m != nil {
+		m.EventsLost(gap.Lost())
+	}
+	(*fn)(gap)
+}
@@ -0,0 +1,509 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server accepts outbound connections from FreeSWITCH, and calls Handler
+// in a new goroutine for each of them, like ListenAndServe, with more
+// settings.
+//
+// A panic in a handler, or in a callback called by the read loop of a
+// connection, like those of OnStateChange, closes that connection with a
+// *PanicError and is logged, instead of crashing the program.
+//
+// Example:
+//
+//	allow, err := eventsocket.ParseCIDRs("127.0.0.1", "10.0.0.0/8")
+//	...
+//	s := &eventsocket.Server{
+//		Addr:    ":9090",
+//		Handler: eventsocket.AutoConnect(handler, nil),
+//		Logger:  logger,
+//		Allow:   allow,
+//	}
+//	err = s.ListenAndServe()
+type Server struct {
+	// Addr is the address to listen on, e.g. :9090.
+	Addr string
+
+	// Addrs are more addresses to listen on, e.g. one per interface of a
+	// multi-homed host. The same handler serves them all.
+	Addrs []string
+
+	// ReusePort sets SO_REUSEPORT on the listeners of ListenAndServe, so
+	// several processes can listen on the same addresses, with the
+	// kernel balancing connections among them. It's not supported on all
+	// systems.
+	ReusePort bool
+
+	// Handler is called for every connection, e.g. a HandleFunc, or a
+	// HandlerFunc that returns errors. The connection is closed if it
+	// returns an error.
+	Handler Handler
+
+	// BaseContext, if set, returns the context the contexts of the
+	// connections accepted by the listener derive from, see
+	// Connection.Context. Defaults to context.Background.
+	BaseContext func(ln net.Listener) context.Context
+
+	// ConnContext, if set, returns the context of a new connection,
+	// derived from ctx, e.g. with values for its handler.
+	ConnContext func(ctx context.Context, c net.Conn) context.Context
+
+	// ErrorHandler, if set, is called with the errors returned by
+	// Handler, and the *PanicError of connections closed by a panic, once
+	// they terminate. By default they're logged.
+	ErrorHandler func(c *Connection, err error)
+
+	// Logger, if set, is set on the connections, see SetLogger, and logs
+	// the panics.
+	Logger Logger
+
+	// Metrics, if set, is set on the connections, see SetMetrics. The
+	// counters of the server itself are in Stats, and exported by
+	// PrometheusMetrics.ExportServer.
+	Metrics Metrics
+
+	// NoRecover lets panics crash the program, with the stack trace of
+	// the goroutine that panicked, e.g. for debugging.
+	NoRecover bool
+
+	// MaxConnections, when set, is how many connections can be open at
+	// a time, so a dialplan looping on the socket application can't
+	// exhaust file descriptors and memory.
+	MaxConnections int
+
+	// AcceptRate, when set, is how many connections are accepted per
+	// second, in bursts of up to AcceptBurst, which defaults to the rate
+	// rounded up.
+	AcceptRate  float64
+	AcceptBurst int
+
+	// Allow, when set, are the networks connections may come from, e.g.
+	// 10.0.0.0/8, since the port is otherwise an unauthenticated control
+	// channel. Others are rejected.
+	Allow []*net.IPNet
+
+	// AllowFunc, when set, reports whether a connection may come from the
+	// given address, after Allow.
+	AllowFunc func(addr net.Addr) bool
+
+	mu        sync.Mutex
+	listeners map[net.Listener]bool
+	conns     map[*Connection]bool
+	closed    bool // See Shutdown
+	active    int
+	accepted  uint64
+	rejected  uint64
+	panics    uint64
+	handled   uint64        // Handlers returned
+	handling  time.Duration // Time spent by the handlers returned
+	tokens    float64       // Of AcceptRate
+	refill    time.Time     // When tokens were last refilled
+
+	emu    sync.Mutex // Guards the event counters
+	events uint64
+	perSec [serverRateWindow + 1]struct {
+		sec int64 // Unix time
+		n   uint64
+	}
+}
+
+// serverRateWindow is the number of seconds of ServerStats.EventsPerSecond.
+const serverRateWindow = 10
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Shutdown
+// or Close.
+var ErrServerClosed = errors.New("Server closed")
+
+// ServerStats are the counters of a Server.
+type ServerStats struct {
+	Active   int    // Connections open
+	Accepted uint64 // Connections accepted, in total
+	Rejected uint64 // Connections rejected by limits, in total
+	Panics   uint64 // Connections closed by a panic, in total
+	Events   uint64 // Events received by the connections, in total
+
+	// EventsPerSecond is the rate of events received in the last ten
+	// seconds.
+	EventsPerSecond float64
+
+	// HandlerTime is the average time handlers ran, of those that
+	// returned.
+	HandlerTime time.Duration
+}
+
+// PanicError is the error of connections closed because of a panic, and
+// the value of the panic.
+type PanicError struct {
+	Value interface{}
+	Stack []byte // Of the goroutine that panicked
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// ListenAndServe listens on Addr and Addrs, and calls Serve for each of
+// them. If any fails, the others are closed, and its error returned.
+func (s *Server) ListenAndServe() error {
+	addrs := s.Addrs
+	if s.Addr != "" || len(addrs) == 0 {
+		addrs = append([]string{s.Addr}, addrs...)
+	}
+	var lc net.ListenConfig
+	if s.ReusePort {
+		lc.Control = reusePort
+	}
+	var lns []net.Listener
+	for _, addr := range addrs {
+		ln, err := lc.Listen(context.Background(), "tcp", addr)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return err
+		}
+		lns = append(lns, ln)
+	}
+	errc := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func() { errc <- s.Serve(ln) }()
+	}
+	err := <-errc
+	for _, ln := range lns {
+		ln.Close()
+	}
+	for range lns[1:] {
+		<-errc
+	}
+	return err
+}
+
+// Serve accepts connections from the listener until it fails, and returns
+// why, or ErrServerClosed after Shutdown. The listener is closed when it
+// returns. It may be called for several listeners at the same time.
+//
+// Connections not allowed, or beyond MaxConnections or AcceptRate, are
+// rejected: closed right away, before the handler is called, which fails
+// the socket application in the dialplan, and counted in Stats.
+func (s *Server) Serve(ln net.Listener) error {
+	defer ln.Close()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]bool)
+	}
+	s.listeners[ln] = true
+	s.mu.Unlock()
+	base := context.Background()
+	if s.BaseContext != nil {
+		base = s.BaseContext(ln)
+	}
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, ln)
+		s.mu.Unlock()
+	}()
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if reason := s.admit(s.allowed(c.RemoteAddr())); reason != "" {
+			if s.Logger != nil {
+				s.Logger.Errorf("eventsocket: rejected connection from %s: %s",
+					c.RemoteAddr(), reason)
+			}
+			c.Close()
+			continue
+		}
+		h := newConnection(c)
+		ctx := context.WithValue(base, connInfoKey{}, &ConnInfo{
+			Server:     s,
+			Conn:       h,
+			RemoteAddr: c.RemoteAddr(),
+			LocalAddr:  c.LocalAddr(),
+			Accepted:   time.Now(),
+		})
+		if s.ConnContext != nil {
+			ctx = s.ConnContext(ctx, c)
+		}
+		h.cancel()
+		h.ctx, h.cancel = context.WithCancel(ctx)
+		if s.Logger != nil {
+			h.SetLogger(s.Logger)
+		}
+		h.noRecover = s.NoRecover
+		if s.Metrics != nil {
+			h.SetMetrics(s.Metrics)
+		}
+		h.observe(func(*Event) bool {
+			s.countEvent()
+			return false
+		})
+		s.mu.Lock()
+		if s.conns == nil {
+			s.conns = make(map[*Connection]bool)
+		}
+		s.conns[h] = true
+		s.mu.Unlock()
+		h.setState(StateReady)
+		go h.readLoop()
+		go s.serveConn(h)
+	}
+}
+
+// allowed reports whether connections may come from addr, by Allow and
+// AllowFunc.
+func (s *Server) allowed(addr net.Addr) bool {
+	if len(s.Allow) > 0 {
+		tcp, ok := addr.(*net.TCPAddr)
+		if !ok {
+			return false
+		}
+		found := false
+		for _, n := range s.Allow {
+			if n.Contains(tcp.IP) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return s.AllowFunc == nil || s.AllowFunc(addr)
+}
+
+// ParseCIDRs parses networks in CIDR notation, e.g. for Server.Allow.
+// Addresses without a prefix length are networks of a single address.
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: cidr}
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// admit counts a new connection, and returns why it's rejected, if it is.
+func (s *Server) admit(allowed bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reason := ""
+	switch {
+	case !allowed:
+		reason = "address not allowed"
+	case s.MaxConnections > 0 && s.active >= s.MaxConnections:
+		reason = "too many connections"
+	case s.AcceptRate > 0 && !s.take():
+		reason = "accept rate exceeded"
+	}
+	if reason != "" {
+		s.rejected++
+		return reason
+	}
+	s.active++
+	s.accepted++
+	return ""
+}
+
+// take takes a token of AcceptRate, if any is left, with mu held.
+func (s *Server) take() bool {
+	burst := float64(s.AcceptBurst)
+	if burst <= 0 {
+		burst = math.Ceil(s.AcceptRate)
+	}
+	now := time.Now()
+	if s.refill.IsZero() {
+		s.tokens = burst
+	} else {
+		s.tokens = math.Min(burst, s.tokens+now.Sub(s.refill).Seconds()*s.AcceptRate)
+	}
+	s.refill = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// countEvent counts an event received by a connection.
+func (s *Server) countEvent() {
+	sec := time.Now().Unix()
+	s.emu.Lock()
+	s.events++
+	b := &s.perSec[sec%int64(len(s.perSec))]
+	if b.sec != sec {
+		b.sec, b.n = sec, 0
+	}
+	b.n++
+	s.emu.Unlock()
+}
+
+// Stats returns the counters of the server.
+func (s *Server) Stats() ServerStats {
+	s.mu.Lock()
+	st := ServerStats{
+		Active:   s.active,
+		Accepted: s.accepted,
+		Rejected: s.rejected,
+		Panics:   s.panics,
+	}
+	if s.handled > 0 {
+		st.HandlerTime = s.handling / time.Duration(s.handled)
+	}
+	s.mu.Unlock()
+	now := time.Now().Unix()
+	var n uint64
+	s.emu.Lock()
+	st.Events = s.events
+	for _, b := range s.perSec {
+		if b.sec < now && b.sec >= now-serverRateWindow {
+			n += b.n // Full seconds only
+		}
+	}
+	s.emu.Unlock()
+	st.EventsPerSecond = float64(n) / serverRateWindow
+	return st
+}
+
+// serveConn calls the handler of a connection, which counts as open until
+// it terminates.
+func (s *Server) serveConn(h *Connection) {
+	start := time.Now()
+	var err error
+	defer func() { s.release(h, start, err) }()
+	if !s.NoRecover {
+		defer h.recoverPanic("handler")
+	}
+	if err = s.Handler.ServeConn(h); err != nil {
+		h.Close()
+	}
+}
+
+// release counts a connection whose handler returned, once it
+// terminates, and reports the error of the handler or the panic, if any.
+func (s *Server) release(h *Connection, start time.Time, err error) {
+	d := time.Since(start)
+	<-h.done
+	_, panicked := h.err.(*PanicError)
+	s.mu.Lock()
+	s.active--
+	delete(s.conns, h)
+	s.handled++
+	s.handling += d
+	if panicked {
+		s.panics++
+	}
+	s.mu.Unlock()
+	if err == nil && panicked {
+		err = h.err
+	}
+	switch {
+	case err == nil:
+	case s.ErrorHandler != nil:
+		s.ErrorHandler(h, err)
+	case !panicked: // Panics are logged by recoverPanic
+		h.log().Errorf("eventsocket: handler of %s failed: %v", h.conn.RemoteAddr(), err)
+	}
+}
+
+// Shutdown stops the server gracefully: it closes the listeners, so Serve
+// and ListenAndServe return ErrServerClosed, cancels the contexts of the
+// connections, so their handlers can wrap up, and waits for them to
+// terminate, e.g. once their calls hang up. If the context is done first,
+// the connections left are closed, and its error returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	for h := range s.conns {
+		h.cancel()
+	}
+	s.mu.Unlock()
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+	for {
+		s.mu.Lock()
+		n := s.active
+		s.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			for h := range s.conns {
+				h.Close()
+			}
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Close stops the server right away, closing the listeners and all
+// connections.
+func (s *Server) Close() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Shutdown(ctx); err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// recoverPanic, deferred by the goroutines of a connection, closes it if
+// the goroutine panics.
+func (h *Connection) recoverPanic(where string) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	err := &PanicError{Value: v, Stack: debug.Stack()}
+	h.log().Errorf("eventsocket: panic in %s of %s: %v\n%s",
+		where, h.conn.RemoteAddr(), v, err.Stack)
+	h.terminate(err)
+}
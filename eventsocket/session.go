@@ -0,0 +1,140 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session controls the channel of an outbound connection, the ones handled
+// by ListenAndServe, with methods that execute dialplan applications and
+// wait for them to complete.
+//
+// Events of the channel are still queued for ReadEvent, but don't need to
+// be read for the applications to complete.
+//
+// Example:
+//
+//	func handler(c *eventsocket.Connection) {
+//		s, err := eventsocket.NewSession(c)
+//		if err != nil {
+//			return
+//		}
+//		s.Answer()
+//		s.Playback("/tmp/welcome.wav")
+//		s.Bridge("user/1000")
+//		s.Hangup(eventsocket.CauseNormalClearing)
+//	}
+type Session struct {
+	// UUID of the channel.
+	UUID string
+
+	// Data is the state of the channel when the session started.
+	Data *ChannelData
+
+	h *Connection
+}
+
+// NewSession sends connect and myevents on a new outbound connection, and
+// returns the Session of its channel.
+func NewSession(c *Connection) (*Session, error) {
+	d, err := c.Connect()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.Send("myevents"); err != nil {
+		return nil, err
+	}
+	return &Session{UUID: d.UUID, Data: d, h: c}, nil
+}
+
+// Conn returns the connection of the session.
+func (s *Session) Conn() *Connection {
+	return s.h
+}
+
+// Execute executes an application on the channel and waits for it to
+// complete, returning its CHANNEL_EXECUTE_COMPLETE event. Responses
+// starting with -ERR are returned as errors.
+func (s *Session) Execute(appName, appArg string) (*Event, error) {
+	e, err := s.h.ExecuteAsyncWith(appName, appArg, &ExecuteOptions{UUID: s.UUID})
+	if err != nil {
+		return nil, err
+	}
+	ev, err := e.Wait()
+	if err != nil {
+		return nil, err
+	}
+	if resp := ev.Get("Application-Response"); strings.HasPrefix(resp, "-ERR") {
+		return ev, replyError(resp)
+	}
+	return ev, nil
+}
+
+// Answer answers the channel.
+func (s *Session) Answer() error {
+	_, err := s.Execute("answer", "")
+	return err
+}
+
+// Hangup hangs up the channel with the given cause. It's not an error for
+// the connection to terminate as a result.
+func (s *Session) Hangup(cause HangupCause) error {
+	_, err := s.Execute("hangup", cause.String())
+	if err != nil {
+		select {
+		case <-s.h.done:
+			return nil
+		default:
+		}
+	}
+	return err
+}
+
+// Playback plays a file, or anything else supported by the playback
+// application, like tone_stream:// or say:, and waits for it to finish.
+func (s *Session) Playback(file string) error {
+	ev, err := s.Execute("playback", file)
+	if err != nil {
+		return err
+	}
+	if resp := ev.Get("Application-Response"); resp != "" && resp != "FILE PLAYED" {
+		return errors.New(resp)
+	}
+	return nil
+}
+
+// Bridge bridges the channel to the given dial string, e.g. user/1000,
+// and waits for the bridge to end. Calls that fail to connect return an
+// *OriginateError with the reason.
+func (s *Session) Bridge(dialstring string) error {
+	ev, err := s.Execute("bridge", dialstring)
+	if err != nil {
+		return err
+	}
+	switch cause := ev.Variable("originate_disposition"); cause {
+	case "", "SUCCESS", "ANSWER":
+		return nil
+	default:
+		return &OriginateError{Cause: cause}
+	}
+}
+
+// Set sets a channel variable.
+func (s *Session) Set(name, value string) error {
+	_, err := s.Execute("set", name+"="+value)
+	return err
+}
+
+// Sleep pauses the channel for the given duration, at millisecond
+// precision.
+func (s *Session) Sleep(d time.Duration) error {
+	ms := int64(d / time.Millisecond)
+	_, err := s.Execute("sleep", strconv.FormatInt(ms, 10))
+	return err
+}
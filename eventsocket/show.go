@@ -0,0 +1,253 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errShowOutput   = errors.New("Unexpected show output")
+	errShowRowCount = errors.New("Number of rows differs from the count of show")
+	errShowTarget   = errors.New("Show needs a pointer to a slice of structs")
+)
+
+// ChannelInfo is an active channel, as listed by ShowChannels.
+type ChannelInfo struct {
+	UUID              string    `show:"uuid"`
+	CallUUID          string    `show:"call_uuid"` // Other leg, when bridged
+	Direction         string    `show:"direction"` // inbound or outbound
+	Name              string    `show:"name"`      // e.g. sofia/internal/1000@host
+	State             string    `show:"state"`     // e.g. CS_EXECUTE
+	CallState         string    `show:"callstate"` // e.g. ACTIVE, RINGING, HELD
+	CallerIDName      string    `show:"cid_name"`
+	CallerIDNumber    string    `show:"cid_num"`
+	CalleeIDName      string    `show:"callee_name"`
+	CalleeIDNumber    string    `show:"callee_num"`
+	DestinationNumber string    `show:"dest"`
+	Context           string    `show:"context"`
+	Application       string    `show:"application"` // e.g. bridge
+	ApplicationData   string    `show:"application_data"`
+	ReadCodec         string    `show:"read_codec"`
+	WriteCodec        string    `show:"write_codec"`
+	Hostname          string    `show:"hostname"`
+	Created           time.Time `show:"created_epoch"`
+}
+
+// ShowChannels returns the active channels, from "show channels as json",
+// or the plain "show channels" of old versions without json output.
+func (h *Connection) ShowChannels() ([]ChannelInfo, error) {
+	var channels []ChannelInfo
+	if err := h.Show("channels", &channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// Show runs "show <what> as json", e.g. show calls or show registrations,
+// and decodes its rows into v, which must be a pointer to a slice of
+// structs. It falls back to the plain output of "show <what>" on old
+// versions without json output. The number of rows is checked against the
+// count reported by FreeSWITCH.
+//
+// Struct fields are matched with columns by their show tag, or their name
+// in lower case. Fields can be strings, numbers, bools, or time.Time for
+// columns with seconds since the epoch, like created_epoch. Empty values
+// and columns without fields are ignored.
+//
+// Example:
+//
+//	var calls []struct {
+//		UUID    string    `show:"uuid"`
+//		Callee  string    `show:"callee_num"`
+//		Created time.Time `show:"created_epoch"`
+//	}
+//	err := c.Show("calls", &calls)
+func (h *Connection) Show(what string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice ||
+		rv.Elem().Type().Elem().Kind() != reflect.Struct {
+		return errShowTarget
+	}
+	rows, err := h.show(what)
+	if err != nil {
+		return err
+	}
+	slice := rv.Elem()
+	typ := slice.Type().Elem()
+	fields := showFields(typ)
+	out := reflect.MakeSlice(slice.Type(), len(rows), len(rows))
+	for n, row := range rows {
+		item := out.Index(n)
+		for col, value := range row {
+			idx, ok := fields[col]
+			if !ok || value == "" {
+				continue
+			}
+			if err := setShowField(item.Field(idx), value); err != nil {
+				return fmt.Errorf("Invalid value of %s: %q", col, value)
+			}
+		}
+	}
+	slice.Set(out)
+	return nil
+}
+
+// showFields maps column names to the index of the struct fields.
+func showFields(typ reflect.Type) map[string]int {
+	fields := make(map[string]int, typ.NumField())
+	for n := 0; n < typ.NumField(); n++ {
+		f := typ.Field(n)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		name := f.Tag.Get("show")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = n
+	}
+	return fields
+}
+
+// setShowField sets a struct field from a value of show.
+func setShowField(f reflect.Value, value string) error {
+	if f.Type() == reflect.TypeOf(time.Time{}) {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(epoch(value)))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	default:
+		return errShowTarget
+	}
+	return nil
+}
+
+// show runs "show <what> as json" and returns its rows, falling back to
+// the comma separated output of "show <what>" when json isn't supported.
+func (h *Connection) show(what string) ([]map[string]string, error) {
+	result, err := h.api("show " + what + " as json")
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(result, "{") {
+		return parseShowJSON(result)
+	}
+	result, err = h.api("show " + what)
+	if err != nil {
+		return nil, err
+	}
+	return parseShowCSV(result)
+}
+
+// parseShowJSON parses the json output of show, e.g.
+//
+//	{"row_count":1,"rows":[{"uuid":"...","direction":"inbound",...}]}
+//
+// Without rows, FreeSWITCH replies {"row_count":0}.
+func parseShowJSON(result string) ([]map[string]string, error) {
+	var list struct {
+		RowCount int                      `json:"row_count"`
+		Rows     []map[string]interface{} `json:"rows"`
+	}
+	if err := json.Unmarshal([]byte(result), &list); err != nil {
+		return nil, err
+	}
+	if len(list.Rows) != list.RowCount {
+		return nil, errShowRowCount
+	}
+	rows := make([]map[string]string, len(list.Rows))
+	for n, r := range list.Rows {
+		row := make(map[string]string, len(r))
+		for k, v := range r {
+			if v != nil {
+				row[k] = fmt.Sprint(v)
+			}
+		}
+		rows[n] = row
+	}
+	return rows, nil
+}
+
+// parseShowCSV parses the plain output of show, e.g.
+//
+//	uuid,direction,created,created_epoch,name,...
+//	4a5e...,inbound,2013-01-01 10:00:00,1357034400,sofia/internal/1000@host,...
+//
+//	1 total.
+//
+// Values aren't quoted by FreeSWITCH, so rows with commas in values have
+// more fields than the header. They're skipped, which makes the count
+// check fail.
+func parseShowCSV(result string) ([]map[string]string, error) {
+	lines := strings.Split(result, "\n")
+	if len(lines) == 0 || !strings.Contains(lines[0], ",") {
+		return nil, errShowOutput
+	}
+	header := strings.Split(strings.TrimSpace(lines[0]), ",")
+	var rows []map[string]string
+	count := -1
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		if strings.HasSuffix(line, " total.") {
+			count = atoi(strings.TrimSuffix(line, " total."))
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != len(header) {
+			continue
+		}
+		row := make(map[string]string, len(header))
+		for n, k := range header {
+			row[k] = fields[n]
+		}
+		rows = append(rows, row)
+	}
+	if count != len(rows) {
+		return nil, errShowRowCount
+	}
+	return rows, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"errors"
+)
+
+var errNotConnected = errors.New("Connect was not called")
+
+// Shutdown closes the connection gracefully. It sends "exit" and waits for
+// FreeSWITCH to send the events it has queued, if lingering, followed by
+// the disconnect notice, and to close the socket. Unlike Close, events
+// still in flight aren't dropped: all events received are returned by
+// ReadEvent before the error of the closed connection.
+//
+// If the context is done first, the connection is closed right away, as
+// with Close, and the error of the context is returned.
+func (h *Connection) Shutdown(ctx context.Context) error {
+	h.closing.Store(true)
+	h.setState(StateDraining)
+	if _, err := h.write([]byte("exit\n\n"), false); err != nil {
+		return nil // Terminated already.
+	}
+	select {
+	case <-h.done:
+		return nil
+	case <-ctx.Done():
+		h.terminate(errClosed)
+		return ctx.Err()
+	}
+}
+
+// CloseWithCause ends an outbound session: it hangs up the channel returned
+// by Connect with the given cause, waits for its CHANNEL_HANGUP_COMPLETE
+// event when wait is set, and closes the connection with Shutdown, so
+// events sent by FreeSWITCH meanwhile can still be read with ReadEvent.
+//
+// Waiting requires the events of the channel, e.g. with myevents, and
+// linger, otherwise FreeSWITCH closes the connection as soon as the
+// channel hangs up, which also ends the wait. It's not an error if the
+// channel is gone already.
+//
+// Example:
+//
+//	func handler(c *eventsocket.Connection) {
+//		d, err := c.Connect()
+//		...
+//		defer c.CloseWithCause(ctx, eventsocket.CauseNormalClearing, true)
+//		...
+//	}
+func (h *Connection) CloseWithCause(ctx context.Context, cause HangupCause, wait bool) error {
+	d := h.ChannelData()
+	if d == nil {
+		return errNotConnected
+	}
+	complete := make(chan struct{})
+	if wait {
+		// Registered before hanging up, not to miss the event.
+		cancel := h.observe(func(ev *Event) bool {
+			if ev.peek("Event-Name") == "CHANNEL_HANGUP_COMPLETE" &&
+				ev.peek("Unique-Id") == d.UUID {
+				close(complete)
+				return true
+			}
+			return false
+		})
+		defer cancel()
+	}
+	switch err := h.Hangup(d.UUID, cause); {
+	case err == ErrNoSuchChannel:
+		wait = false // The event is gone as well.
+	case err != nil:
+		select {
+		case <-h.done:
+			return nil // Hung up and disconnected already.
+		default:
+			return err
+		}
+	}
+	if wait {
+		select {
+		case <-complete:
+		case <-h.done:
+			return nil
+		case <-ctx.Done():
+			h.terminate(errClosed)
+			return ctx.Err()
+		}
+	}
+	return h.Shutdown(ctx)
+}
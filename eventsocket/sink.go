@@ -0,0 +1,157 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const (
+	sinkMinBackoff = 100 * time.Millisecond
+	sinkMaxBackoff = 30 * time.Second
+)
+
+// sink moves the events of a connection to an external system, in
+// batches, retrying with exponential backoff until they're published.
+// Sinks like KafkaSink are built on it.
+//
+// Sinks take the client of the external system as an interface, like
+// KafkaProducer, implemented by the application with the client of its
+// choice, which keeps this package free of dependencies.
+type sink struct {
+	name       string // For logging, e.g. kafka
+	match      func(*Event) bool
+	batchSize  int
+	batchDelay time.Duration // How long a batch waits to fill up
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	publish    func(ctx context.Context, events []*Event) error
+}
+
+// run publishes the events received by the connection until the context
+// is cancelled or the connection terminates. Events received before the
+// connection terminated are published before run returns its error.
+func (s *sink) run(ctx context.Context, c *Connection) error {
+	events := newEventQueue()
+	cancel := c.observe(func(ev *Event) bool {
+		events.push(ev.retain())
+		return false
+	})
+	defer cancel()
+	var (
+		batch  []*Event
+		timer  <-chan time.Time // Fires when the batch is due
+		due    bool
+		closed bool
+	)
+	defer func() {
+		for _, ev := range batch {
+			ev.Release()
+		}
+		for ev, ok := events.pop(); ok; ev, ok = events.pop() {
+			ev.Release()
+		}
+	}()
+	for {
+		for len(batch) < s.batchSize {
+			ev, ok := events.pop()
+			if !ok {
+				break
+			}
+			if s.match != nil && !s.match(ev) {
+				ev.Release()
+				continue
+			}
+			batch = append(batch, ev)
+			if len(batch) == 1 && s.batchDelay > 0 {
+				timer = time.After(s.batchDelay)
+			}
+		}
+		if len(batch) > 0 && (due || len(batch) >= s.batchSize || s.batchDelay <= 0) {
+			err := s.send(ctx, c, batch)
+			for _, ev := range batch {
+				ev.Release()
+			}
+			batch, timer, due = batch[:0], nil, closed
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if closed {
+			return c.err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.done:
+			closed, due = true, true
+		case <-events.wake:
+		case <-timer:
+			due = true
+		}
+	}
+}
+
+// send publishes a batch, retrying with exponential backoff until it
+// succeeds or the context is cancelled.
+func (s *sink) send(ctx context.Context, c *Connection, batch []*Event) error {
+	backoff := s.minBackoff
+	if backoff <= 0 {
+		backoff = sinkMinBackoff
+	}
+	for {
+		err := s.publish(ctx, batch)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.log().Errorf("eventsocket: %s: %v, retrying in %s", s.name, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		max := s.maxBackoff
+		if max <= 0 {
+			max = sinkMaxBackoff
+		}
+		if backoff *= 2; backoff > max {
+			backoff = max
+		}
+	}
+}
+
+// expandTemplate replaces the placeholders of a template, like the subject
+// of NATSSink, with the values of the event: {event} with the name of the
+// event, or its subclass for CUSTOM events, and {Header-Name} with the
+// value of that header, after going through token.
+func expandTemplate(tmpl string, ev *Event, token func(string) string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(tmpl, '{')
+		end := strings.IndexByte(tmpl[start+1:], '}')
+		if start < 0 || end < 0 {
+			b.WriteString(tmpl)
+			return b.String()
+		}
+		b.WriteString(tmpl[:start])
+		var v string
+		if key := tmpl[start+1 : start+1+end]; key == "event" {
+			v = ev.Get("Event-Name")
+			if v == "CUSTOM" {
+				v = ev.Get("Event-Subclass")
+			}
+		} else {
+			v = ev.Get(capitalize(key))
+		}
+		b.WriteString(token(v))
+		tmpl = tmpl[start+end+2:]
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errSofiaStatus = errors.New("Unexpected sofia status output")
+
+// SofiaEntry is a line of "sofia status": a profile, gateway or alias.
+type SofiaEntry struct {
+	Name  string // e.g. internal, or external::provider for gateways
+	Type  string // profile, gateway or alias
+	Data  string // URL of profiles and gateways, profile of aliases
+	State string // e.g. RUNNING (0), REGED, NOREG, ALIASED
+}
+
+// SofiaProfile is the status of a sofia profile.
+type SofiaProfile struct {
+	Name           string
+	Dialplan       string
+	Context        string
+	URL            string
+	BindURL        string
+	CallsIn        int
+	FailedCallsIn  int
+	CallsOut       int
+	FailedCallsOut int
+	Registrations  int
+
+	// Fields has all the fields reported by FreeSWITCH, by name.
+	Fields map[string]string
+}
+
+// SofiaGateway is the status of a sofia gateway.
+type SofiaGateway struct {
+	Name           string
+	Profile        string
+	Username       string
+	Realm          string
+	Proxy          string
+	State          string        // Registration state, e.g. REGED or NOREG
+	Status         string        // UP or DOWN, based on pings
+	PingState      string        // e.g. 0/0/0
+	PingTime       time.Duration // Round trip of the last ping
+	Uptime         time.Duration
+	CallsIn        int
+	CallsOut       int
+	FailedCallsIn  int
+	FailedCallsOut int
+
+	// Fields has all the fields reported by FreeSWITCH, by name.
+	Fields map[string]string
+}
+
+// SofiaStatus returns the profiles, gateways and aliases of mod_sofia,
+// from "sofia status".
+func (h *Connection) SofiaStatus() ([]SofiaEntry, error) {
+	result, err := h.api("sofia status")
+	if err != nil {
+		return nil, err
+	}
+	lines, err := sofiaTable(result)
+	if err != nil {
+		return nil, err
+	}
+	var entries []SofiaEntry
+	for _, line := range lines {
+		f := strings.Split(line, "\t")
+		if len(f) < 4 {
+			continue
+		}
+		entries = append(entries, SofiaEntry{
+			Name:  strings.TrimSpace(f[0]),
+			Type:  strings.TrimSpace(f[1]),
+			Data:  strings.TrimSpace(f[2]),
+			State: strings.TrimSpace(f[3]),
+		})
+	}
+	return entries, nil
+}
+
+// SofiaProfile returns the status of a profile, from
+// "sofia status profile <name>".
+func (h *Connection) SofiaProfile(name string) (*SofiaProfile, error) {
+	f, err := h.sofiaFields("profile", name)
+	if err != nil {
+		return nil, err
+	}
+	return &SofiaProfile{
+		Name:           f["Name"],
+		Dialplan:       f["Dialplan"],
+		Context:        f["Context"],
+		URL:            f["URL"],
+		BindURL:        f["BIND-URL"],
+		CallsIn:        atoi(f["CALLS-IN"]),
+		FailedCallsIn:  atoi(f["FAILED-CALLS-IN"]),
+		CallsOut:       atoi(f["CALLS-OUT"]),
+		FailedCallsOut: atoi(f["FAILED-CALLS-OUT"]),
+		Registrations:  atoi(f["REGISTRATIONS"]),
+		Fields:         f,
+	}, nil
+}
+
+// SofiaGateway returns the status of a gateway, from
+// "sofia status gateway <name>".
+func (h *Connection) SofiaGateway(name string) (*SofiaGateway, error) {
+	f, err := h.sofiaFields("gateway", name)
+	if err != nil {
+		return nil, err
+	}
+	gw := &SofiaGateway{
+		Name:           f["Name"],
+		Profile:        f["Profile"],
+		Username:       f["Username"],
+		Realm:          f["Realm"],
+		Proxy:          f["Proxy"],
+		State:          f["State"],
+		Status:         f["Status"],
+		PingState:      f["PingState"],
+		Uptime:         time.Duration(atoi(f["Uptime"])) * time.Second,
+		CallsIn:        atoi(f["CallsIN"]),
+		CallsOut:       atoi(f["CallsOUT"]),
+		FailedCallsIn:  atoi(f["FailedCallsIN"]),
+		FailedCallsOut: atoi(f["FailedCallsOUT"]),
+		Fields:         f,
+	}
+	// PingTime is in milliseconds, with decimals.
+	if ms, err := strconv.ParseFloat(f["PingTime"], 64); err == nil {
+		gw.PingTime = time.Duration(ms * float64(time.Millisecond))
+	}
+	return gw, nil
+}
+
+// sofiaFields runs "sofia status <kind> <name>", which reports fields as
+// name, tab, value lines.
+func (h *Connection) sofiaFields(kind, name string) (map[string]string, error) {
+	if !validArg(name) {
+		return nil, errInvalidArgument
+	}
+	result, err := h.api("sofia status " + kind + " " + name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(result, "Invalid") {
+		// e.g. Invalid Profile!
+		return nil, errors.New(strings.TrimSuffix(result, "!"))
+	}
+	lines, err := sofiaTable(result)
+	if err != nil {
+		return nil, err
+	}
+	f := make(map[string]string, len(lines))
+	for _, line := range lines {
+		kv := strings.SplitN(line, "\t", 2)
+		if len(kv) == 2 {
+			f[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return f, nil
+}
+
+// sofiaTable returns the lines between the first two lines of = of the
+// output of sofia status commands, skipping the column titles if any.
+func sofiaTable(result string) ([]string, error) {
+	var lines []string
+	rule := 0
+	for _, line := range strings.Split(result, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "=====") {
+			if rule++; rule == 2 {
+				return lines, nil
+			}
+			continue
+		}
+		if rule == 1 && strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return nil, errSofiaStatus
+}
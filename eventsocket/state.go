@@ -0,0 +1,89 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "strconv"
+
+// State is a stage of the lifecycle of a connection.
+type State int32
+
+// States of connections, see Connection.State.
+const (
+	StateConnecting     State = iota // Connecting to FreeSWITCH
+	StateAuthenticating              // Connected, waiting for authentication
+	StateReady                       // Sending commands and receiving events
+	StateLingering                   // Channel hung up, receiving its last events
+	StateDraining                    // Closing gracefully, see Shutdown
+	StateClosed                      // Terminated
+)
+
+var stateNames = [...]string{
+	StateConnecting:     "connecting",
+	StateAuthenticating: "authenticating",
+	StateReady:          "ready",
+	StateLingering:      "lingering",
+	StateDraining:       "draining",
+	StateClosed:         "closed",
+}
+
+// String returns the name of the state, e.g. "ready".
+func (s State) String() string {
+	if s >= 0 && int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+// State returns the current state of the connection.
+//
+// Connections created by Dial are ready once authenticated, and those
+// accepted by ListenAndServe right away. Outbound connections with linger
+// enabled are lingering after the channel hangs up, until FreeSWITCH
+// closes them. Connections are draining during Shutdown, and closed once
+// terminated, for whatever reason.
+func (h *Connection) State() State {
+	return State(h.state.Load())
+}
+
+// OnStateChange registers fn to be called whenever the state of the
+// connection changes, and returns a function that unregisters it. It's
+// meant for dashboards and supervision logic.
+//
+// fn is called from whatever goroutine changed the state, e.g. the read
+// loop, and must not block, nor register or unregister callbacks.
+func (h *Connection) OnStateChange(fn func(from, to State)) (cancel func()) {
+	h.smu.Lock()
+	defer h.smu.Unlock()
+	if h.stateFuncs == nil {
+		h.stateFuncs = make(map[int]func(from, to State))
+	}
+	h.stateID++
+	id := h.stateID
+	h.stateFuncs[id] = fn
+	return func() {
+		h.smu.Lock()
+		delete(h.stateFuncs, id)
+		h.smu.Unlock()
+	}
+}
+
+// setState moves the connection to a new state and calls the callbacks.
+// Closed connections stay closed, and draining ones can only be closed.
+func (h *Connection) setState(to State) {
+	h.smu.Lock()
+	defer h.smu.Unlock()
+	from := h.State()
+	switch {
+	case from == to, from == StateClosed:
+		return
+	case from == StateDraining && to != StateClosed:
+		return
+	}
+	h.state.Store(int32(to))
+	h.log().Debugf("eventsocket: connection to %s is %s", h.conn.RemoteAddr(), to)
+	for _, fn := range h.stateFuncs {
+		fn(from, to)
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// These tests race commands, replies, events and disconnects on a
+// connection to a fake FreeSWITCH over net.Pipe, and are meant to be run
+// with -race. They fail by hanging if the read loop and the callers
+// deadlock, hence the deadlines.
+
+// pipeCommand is a command received by the fake server: its first line,
+// e.g. "api status" or "sendmsg", and the headers of sendmsg.
+type pipeCommand struct {
+	line   string
+	header map[string]string
+}
+
+// pipeServer starts a connection to a fake FreeSWITCH that answers every
+// command with what reply returns: one or more messages, written at once.
+// The returned net.Conn is the server side, closing it disconnects.
+func pipeServer(t *testing.T, reply func(cmd *pipeCommand) string) (*Connection, net.Conn) {
+	t.Helper()
+	cli, srv := net.Pipe()
+	h := newConnection(cli)
+	go h.readLoop()
+	go func() {
+		r := bufio.NewReader(srv)
+		for {
+			cmd, err := readPipeCommand(r)
+			if err != nil {
+				return
+			}
+			if _, err := io.WriteString(srv, reply(cmd)); err != nil {
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		h.Close()
+		srv.Close()
+	})
+	return h, srv
+}
+
+// readPipeCommand reads a command, up to the empty line that ends it.
+func readPipeCommand(r *bufio.Reader) (*pipeCommand, error) {
+	cmd := &pipeCommand{header: make(map[string]string)}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			return cmd, nil
+		case cmd.line == "":
+			cmd.line = line
+		default:
+			k, v, _ := strings.Cut(line, ": ")
+			cmd.header[k] = v
+		}
+	}
+}
+
+func commandReply(text string) string {
+	return "Content-Type: command/reply\nReply-Text: " + text + "\n\n"
+}
+
+func apiResponse(body string) string {
+	return fmt.Sprintf("Content-Type: api/response\nContent-Length: %d\n\n%s",
+		len(body), body)
+}
+
+func stressEvent(seq int) string {
+	body := fmt.Sprintf("Event-Name: CUSTOM\nEvent-Subclass: stress::test\nStress-Seq: %d\n\n", seq)
+	return fmt.Sprintf("Content-Length: %d\nContent-Type: text/event-plain\n\n%s",
+		len(body), body)
+}
+
+// readEvents reads n events in the background, and returns a channel
+// closed once they're all read.
+func readEvents(t *testing.T, h *Connection, n int) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < n; i++ {
+			ev, err := h.ReadEvent()
+			if err != nil {
+				t.Errorf("reading event %d of %d: %v", i+1, n, err)
+				return
+			}
+			ev.Release()
+		}
+	}()
+	return done
+}
+
+// within fails the test if wg isn't done in time.
+func within(t *testing.T, d time.Duration, wg *sync.WaitGroup) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(d):
+		t.Fatal("deadlock: callers didn't return in", d)
+	}
+}
+
+// stressReply answers "api echo <id>" with <id>, and sendmsg with an
+// X-Id header with +OK <id>. Either reply is followed by an event.
+func stressReply(seq *atomic.Int64, fail bool) func(cmd *pipeCommand) string {
+	return func(cmd *pipeCommand) string {
+		ev := stressEvent(int(seq.Add(1)))
+		if id, ok := strings.CutPrefix(cmd.line, "api echo "); ok {
+			if fail {
+				return apiResponse("-ERR "+id+"\n") + ev
+			}
+			return apiResponse(id+"\n") + ev
+		}
+		if fail {
+			return commandReply("-ERR "+cmd.header["X-Id"]) + ev
+		}
+		return commandReply("+OK "+cmd.header["X-Id"]) + ev
+	}
+}
+
+// sendStress sends n commands from each of the workers, alternating api
+// commands and sendmsg, and calls check with the id of each command and
+// its result.
+func sendStress(t *testing.T, h *Connection, workers, n int, check func(id string, ev *Event, err error)) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				id := strconv.Itoa(w*n + i)
+				var ev *Event
+				var err error
+				if i%2 == 0 {
+					ev, err = h.Send("api echo " + id)
+				} else {
+					ev, err = h.SendMsg(MSG{"X-Id": id}, "", "")
+				}
+				check(id, ev, err)
+			}
+		}(w)
+	}
+	within(t, 30*time.Second, &wg)
+}
+
+// TestConcurrentCommands checks that concurrent callers of Send and
+// SendMsg get the reply to their own command, while events arrive between
+// the replies.
+func TestConcurrentCommands(t *testing.T) {
+	const workers, n = 16, 50
+	var seq atomic.Int64
+	h, _ := pipeServer(t, stressReply(&seq, false))
+	events := readEvents(t, h, workers*n)
+	sendStress(t, h, workers, n, func(id string, ev *Event, err error) {
+		switch {
+		case err != nil:
+			t.Errorf("command %s: %v", id, err)
+		case ev.Body != "" && strings.TrimSpace(ev.Body) != id:
+			t.Errorf("command %s got the reply of %q", id, ev.Body)
+		case ev.Body == "" && ev.Get("Reply-Text") != "+OK "+id:
+			t.Errorf("command %s got the reply of %q", id, ev.Get("Reply-Text"))
+		}
+	})
+	select {
+	case <-events:
+	case <-time.After(10 * time.Second):
+		t.Fatal("events weren't delivered")
+	}
+}
+
+// TestErrorRepliesWithEvents checks that -ERR replies immediately followed
+// by events, which used to deadlock the read loop, are returned as errors
+// to the right callers, and the events still delivered.
+func TestErrorRepliesWithEvents(t *testing.T) {
+	const workers, n = 16, 50
+	var seq atomic.Int64
+	h, _ := pipeServer(t, stressReply(&seq, true))
+	events := readEvents(t, h, workers*n)
+	sendStress(t, h, workers, n, func(id string, ev *Event, err error) {
+		if err == nil || err.Error() != id {
+			t.Errorf("command %s returned %v, %v", id, ev, err)
+		}
+	})
+	select {
+	case <-events:
+	case <-time.After(10 * time.Second):
+		t.Fatal("events weren't delivered")
+	}
+}
+
+// TestCommandTimeout checks that a command times out when the reply
+// doesn't come, and that its late reply isn't taken by the next command.
+func TestCommandTimeout(t *testing.T) {
+	defer func(d time.Duration) { timeoutPeriod = d }(timeoutPeriod)
+	timeoutPeriod = 100 * time.Millisecond
+	release := make(chan struct{})
+	h, _ := pipeServer(t, func(cmd *pipeCommand) string {
+		if cmd.line == "api slow" {
+			<-release
+		}
+		return apiResponse(strings.TrimPrefix(cmd.line, "api "))
+	})
+	if _, err := h.Send("api slow"); err != errTimeout {
+		t.Fatalf("slow command returned %v, want %v", err, errTimeout)
+	}
+	type result struct {
+		ev  *Event
+		err error
+	}
+	fast := make(chan result, 1)
+	go func() {
+		ev, err := h.Send("api fast")
+		fast <- result{ev, err}
+	}()
+	close(release)
+	select {
+	case r := <-fast:
+		if r.err != nil || r.ev.Body != "fast" {
+			t.Fatalf("fast command returned %v, %v", r.ev, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fast command didn't return")
+	}
+}
+
+// TestDisconnectPending checks that commands waiting for their reply
+// return the error of the connection when it terminates, either because
+// the server disconnected or because it was closed, and that commands sent
+// afterwards fail right away.
+func TestDisconnectPending(t *testing.T) {
+	for _, remote := range []bool{true, false} {
+		t.Run(fmt.Sprintf("remote=%v", remote), func(t *testing.T) {
+			received := make(chan struct{}, 16)
+			stop := make(chan struct{})
+			defer close(stop)
+			h, srv := pipeServer(t, func(cmd *pipeCommand) string {
+				received <- struct{}{}
+				<-stop // Never replies
+				return ""
+			})
+			var wg sync.WaitGroup
+			errs := make(chan error, 1)
+			for i := 0; i < cap(received); i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, err := h.Send(fmt.Sprintf("api pending %d", i))
+					if err == nil {
+						t.Errorf("pending command %d succeeded", i)
+					}
+					select {
+					case errs <- err:
+					default:
+					}
+				}(i)
+			}
+			<-received // At least one command is pending
+			if remote {
+				srv.Close()
+			} else {
+				h.Close()
+			}
+			within(t, 5*time.Second, &wg)
+			err := <-errs
+			if err == errTimeout {
+				t.Fatal("pending command timed out instead of failing")
+			}
+			if _, err := h.Send("api after"); err == nil {
+				t.Fatal("command succeeded after the connection terminated")
+			}
+			if _, err := h.ReadEvent(); err == nil {
+				t.Fatal("ReadEvent succeeded after the connection terminated")
+			}
+		})
+	}
+}
+
+// TestDisconnectStorm disconnects while commands, error replies and
+// events race, and checks that everyone returns.
+func TestDisconnectStorm(t *testing.T) {
+	const workers = 16
+	var seq atomic.Int64
+	h, srv := pipeServer(t, func(cmd *pipeCommand) string {
+		if seq.Load()%3 == 0 {
+			return stressReply(&seq, true)(cmd)
+		}
+		return stressReply(&seq, false)(cmd)
+	})
+	reader := make(chan struct{})
+	go func() {
+		defer close(reader)
+		for {
+			ev, err := h.ReadEvent()
+			if err != nil {
+				return
+			}
+			ev.Release()
+		}
+	}()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				id := strconv.Itoa(w*1000000 + i)
+				if _, err := h.Send("api echo " + id); err == nil {
+					continue
+				}
+				select {
+				case <-h.done:
+					if _, err := h.Send("api echo " + id); err == nil {
+						t.Errorf("command %s succeeded after the connection terminated", id)
+					}
+					return
+				default:
+					// An error reply.
+				}
+			}
+		}(w)
+	}
+	for seq.Load() < 1000 {
+		time.Sleep(time.Millisecond)
+	}
+	srv.Close()
+	within(t, 5*time.Second, &wg)
+	select {
+	case <-reader:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadEvent didn't return after the connection terminated")
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Subscriptions keeps track of the events a connection is subscribed to,
+// and the filters in place.
+//
+// Subscribe and Unsubscribe only send the commands needed to go from the
+// current state to the requested one, so the same event is never
+// subscribed twice. Filters added with Filter and events removed with
+// Nixevent are tracked as well, but commands sent with Send are not.
+//
+// Example:
+//
+//	s := c.Subscriptions()
+//	s.Subscribe("CHANNEL_ANSWER", "CHANNEL_HANGUP", "sofia::register")
+//	s.Subscribe("CHANNEL_ANSWER", "DTMF") // Only sends event plain DTMF
+//	s.Unsubscribe("DTMF")
+//	fmt.Println(s)
+type Subscriptions struct {
+	h       *Connection
+	mu      sync.Mutex
+	format  string
+	events  map[string]bool
+	custom  map[string]bool
+	filters map[string][]string
+}
+
+// Subscriptions returns the subscription tracker of the connection.
+func (h *Connection) Subscriptions() *Subscriptions {
+	h.subsOnce.Do(func() {
+		h.subs = &Subscriptions{
+			h:       h,
+			format:  "plain",
+			events:  make(map[string]bool),
+			custom:  make(map[string]bool),
+			filters: make(map[string][]string),
+		}
+	})
+	return h.subs
+}
+
+// SetFormat sets the format of events subscribed to from now on: plain,
+// json or xml. The default is plain. FreeSWITCH uses the format of the
+// last subscription for all events of the connection.
+func (s *Subscriptions) SetFormat(format string) {
+	s.mu.Lock()
+	s.format = format
+	s.mu.Unlock()
+}
+
+// Subscribe subscribes to the given events, which are either event names
+// like CHANNEL_ANSWER, subclasses of CUSTOM events like sofia::register,
+// or ALL. Events already subscribed to are skipped.
+func (s *Subscriptions) Subscribe(names ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events, custom, err := s.diff(names, false)
+	if err != nil {
+		return err
+	}
+	return s.send("event "+s.format, events, custom, s.remember)
+}
+
+// Unsubscribe unsubscribes from the given events, using nixevent. Events
+// not subscribed to are skipped.
+func (s *Subscriptions) Unsubscribe(names ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events, custom, err := s.diff(names, true)
+	if err != nil {
+		return err
+	}
+	return s.send("nixevent", events, custom, s.forget)
+}
+
+// UnsubscribeAll unsubscribes from all events, using noevents. Filters
+// are kept.
+func (s *Subscriptions) UnsubscribeAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.h.command("noevents"); err != nil {
+		return err
+	}
+	s.events = make(map[string]bool)
+	s.custom = make(map[string]bool)
+	return nil
+}
+
+// Events returns the events subscribed to, sorted. Subclasses of CUSTOM
+// events are included as such.
+func (s *Subscriptions) Events() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.events)+len(s.custom))
+	for name := range s.events {
+		names = append(names, name)
+	}
+	for name := range s.custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Filters returns the filters in place, as header:values.
+func (s *Subscriptions) Filters() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	filters := make(map[string][]string, len(s.filters))
+	for k, v := range s.filters {
+		filters[k] = append([]string(nil), v...)
+	}
+	return filters
+}
+
+// String returns the state of the subscriptions, for debugging.
+func (s *Subscriptions) String() string {
+	events := s.Events()
+	filters := s.Filters()
+	keys := make([]string, 0, len(filters))
+	for k := range filters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var f []string
+	for _, k := range keys {
+		for _, v := range filters[k] {
+			f = append(f, k+"="+v)
+		}
+	}
+	s.mu.Lock()
+	format := s.format
+	s.mu.Unlock()
+	return fmt.Sprintf("format=%s events=[%s] filters=[%s]",
+		format, strings.Join(events, " "), strings.Join(f, " "))
+}
+
+// diff splits names into events and CUSTOM subclasses, keeping only those
+// whose state is not the wanted one. It must be called with s.mu held.
+func (s *Subscriptions) diff(names []string, subscribed bool) (events, custom []string, err error) {
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if !validArg(name) {
+			return nil, nil, errInvalidArgument
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if strings.Contains(name, "::") {
+			if s.custom[name] == subscribed {
+				custom = append(custom, name)
+			}
+		} else if s.events[name] == subscribed {
+			events = append(events, name)
+		}
+	}
+	return events, custom, nil
+}
+
+// send sends cmd for events, and for CUSTOM subclasses, and calls record
+// with those of each command as soon as it succeeds, so the state still
+// matches FreeSWITCH's when the second command fails.
+func (s *Subscriptions) send(cmd string, events, custom []string, record func(events, custom []string)) error {
+	if len(events) > 0 {
+		if err := s.h.command(cmd + " " + strings.Join(events, " ")); err != nil {
+			return err
+		}
+		record(events, nil)
+	}
+	if len(custom) > 0 {
+		if err := s.h.command(cmd + " CUSTOM " + strings.Join(custom, " ")); err != nil {
+			return err
+		}
+		record(nil, custom)
+	}
+	return nil
+}
+
+// remember adds events and subclasses. It must be called with s.mu held.
+func (s *Subscriptions) remember(events, custom []string) {
+	for _, name := range events {
+		s.events[name] = true
+	}
+	for _, name := range custom {
+		s.custom[name] = true
+	}
+}
+
+// forget removes events and subclasses. It must be called with s.mu held.
+func (s *Subscriptions) forget(events, custom []string) {
+	for _, name := range events {
+		delete(s.events, name)
+	}
+	for _, name := range custom {
+		delete(s.custom, name)
+	}
+}
+
+// addFilter records a filter added by Filter.
+func (s *Subscriptions) addFilter(header, value string) {
+	s.mu.Lock()
+	s.filters[header] = append(s.filters[header], value)
+	s.mu.Unlock()
+}
+
+// deleteFilter records a filter removed by FilterDelete. An empty header
+// removes all filters, an empty value all filters of the header.
+func (s *Subscriptions) deleteFilter(header, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case header == "":
+		s.filters = make(map[string][]string)
+	case value == "":
+		delete(s.filters, header)
+	default:
+		values := s.filters[header][:0]
+		for _, v := range s.filters[header] {
+			if v != value {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			delete(s.filters, header)
+		} else {
+			s.filters[header] = values
+		}
+	}
+}
+
+// nixevent records events removed by Nixevent.
+func (s *Subscriptions) nixevent(names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events, custom []string
+	for _, name := range names {
+		if strings.Contains(name, "::") {
+			custom = append(custom, name)
+		} else {
+			events = append(events, name)
+		}
+	}
+	s.forget(events, custom)
+}
@@ -0,0 +1,42 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSubscriptionsPartialFailure checks that when the command for CUSTOM
+// subclasses fails, the events of the command that succeeded before it
+// are still tracked.
+func TestSubscriptionsPartialFailure(t *testing.T) {
+	failCustom := true
+	h, _ := pipeServer(t, func(cmd *pipeCommand) string {
+		if failCustom && strings.Contains(cmd.line, " CUSTOM ") {
+			return commandReply("-ERR no custom for you")
+		}
+		return commandReply("+OK")
+	})
+	s := h.Subscriptions()
+	if err := s.Subscribe("CHANNEL_ANSWER", "sofia::register"); err == nil {
+		t.Fatal("Subscribe succeeded")
+	}
+	if got, want := s.Events(), []string{"CHANNEL_ANSWER"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("subscribed to %v, want %v", got, want)
+	}
+	failCustom = false
+	if err := s.Subscribe("CHANNEL_ANSWER", "sofia::register"); err != nil {
+		t.Fatal(err)
+	}
+	failCustom = true
+	if err := s.Unsubscribe("CHANNEL_ANSWER", "sofia::register"); err == nil {
+		t.Fatal("Unsubscribe succeeded")
+	}
+	if got, want := s.Events(), []string{"sofia::register"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("subscribed to %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "time"
+
+// Timestamp returns the time the event was fired by FreeSWITCH, from the
+// Event-Date-Timestamp header (microseconds since the epoch), or from
+// Event-Date-GMT when the former is missing.
+func (r *Event) Timestamp() (time.Time, error) {
+	if _, ok := r.GetOk("Event-Date-Timestamp"); ok {
+		return r.GetTime("Event-Date-Timestamp")
+	}
+	return r.GetTime("Event-Date-Gmt")
+}
+
+// ChannelTimes holds the timestamps of a channel's life cycle, as found in
+// the Caller-Channel-*-Time headers of channel events. Times that didn't
+// happen (yet) are zero.
+type ChannelTimes struct {
+	Created       time.Time
+	Answered      time.Time
+	Progress      time.Time // Ringing
+	ProgressMedia time.Time // Early media
+	Bridged       time.Time
+	Transfer      time.Time
+	Hangup        time.Time
+}
+
+// ChannelTimes returns the channel timestamps carried by the event.
+func (r *Event) ChannelTimes() ChannelTimes {
+	get := func(key string) time.Time {
+		t, _ := r.GetTime(key)
+		return t
+	}
+	return ChannelTimes{
+		Created:       get("Caller-Channel-Created-Time"),
+		Answered:      get("Caller-Channel-Answered-Time"),
+		Progress:      get("Caller-Channel-Progress-Time"),
+		ProgressMedia: get("Caller-Channel-Progress-Media-Time"),
+		Bridged:       get("Caller-Channel-Bridged-Time"),
+		Transfer:      get("Caller-Channel-Transfer-Time"),
+		Hangup:        get("Caller-Channel-Hangup-Time"),
+	}
+}
+
+// Billsec returns how long the call was up, from answer to hangup.
+//
+// It uses the billmsec/billsec channel variables set by FreeSWITCH on
+// hangup events, and falls back to the channel timestamps otherwise. Calls
+// that were never answered, or didn't hang up yet, return 0.
+func (r *Event) Billsec() (time.Duration, error) {
+	return r.elapsed("billmsec", "billsec",
+		"Caller-Channel-Answered-Time", "Caller-Channel-Hangup-Time")
+}
+
+// CallDuration returns the total duration of the call, from the creation
+// of the channel to hangup.
+func (r *Event) CallDuration() (time.Duration, error) {
+	return r.elapsed("mduration", "duration",
+		"Caller-Channel-Created-Time", "Caller-Channel-Hangup-Time")
+}
+
+// ProgressDelay returns how long the call took to start ringing.
+func (r *Event) ProgressDelay() (time.Duration, error) {
+	return r.elapsed("progressmsec", "progresssec",
+		"Caller-Channel-Created-Time", "Caller-Channel-Progress-Time")
+}
+
+// ProgressMediaDelay returns how long the call took to get early media.
+func (r *Event) ProgressMediaDelay() (time.Duration, error) {
+	return r.elapsed("progress_mediamsec", "progress_mediasec",
+		"Caller-Channel-Created-Time", "Caller-Channel-Progress-Media-Time")
+}
+
+// AnswerDelay returns how long the call took to be answered.
+func (r *Event) AnswerDelay() (time.Duration, error) {
+	return r.elapsed("answermsec", "answersec",
+		"Caller-Channel-Created-Time", "Caller-Channel-Answered-Time")
+}
+
+// elapsed returns the duration stored in the msec or sec channel variables,
+// or the time between the from and to timestamp headers.
+func (r *Event) elapsed(msec, sec, from, to string) (time.Duration, error) {
+	if _, ok := r.VariableOk(msec); ok {
+		return r.GetDuration("Variable_"+msec, time.Millisecond)
+	}
+	if _, ok := r.VariableOk(sec); ok {
+		return r.GetDuration("Variable_"+sec, time.Second)
+	}
+	start, err := r.GetTime(from)
+	if err != nil {
+		return 0, err
+	}
+	end, err := r.GetTime(to)
+	if err != nil {
+		return 0, err
+	}
+	if start.IsZero() || end.IsZero() {
+		return 0, nil
+	}
+	return end.Sub(start), nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceDirection tells whether traced data was read or written.
+type TraceDirection int
+
+// Directions of traced data.
+const (
+	TraceRead  TraceDirection = iota // From FreeSWITCH
+	TraceWrite                       // To FreeSWITCH
+)
+
+func (d TraceDirection) String() string {
+	if d == TraceWrite {
+		return "write"
+	}
+	return "read"
+}
+
+// Trace writes every line read from and written to the socket to w, with
+// a timestamp and the direction, << for read and >> for written:
+//
+//	2013-01-01 10:00:00.000123 >> api status
+//	2013-01-01 10:00:00.000125 >>
+//	2013-01-01 10:00:00.001432 << Content-Type: api/response
+//	2013-01-01 10:00:00.001432 << Content-Length: 383
+//
+// With headersOnly, the bodies of events and replies are left out, only
+// the headers of each message are traced. Setting w to nil stops tracing.
+func (h *Connection) Trace(w io.Writer, headersOnly bool) {
+	if w == nil {
+		h.TraceFunc(nil, false)
+		return
+	}
+	tw := &traceWriter{w: w}
+	h.TraceFunc(tw.trace, headersOnly)
+}
+
+// TraceFunc calls fn with every chunk of data read from and written to the
+// socket, as it's read or written, or only with the headers of messages
+// when headersOnly is set. fn is never called concurrently, and must not
+// keep b after returning. Setting fn to nil stops tracing.
+func (h *Connection) TraceFunc(fn func(t time.Time, dir TraceDirection, b []byte), headersOnly bool) {
+	if fn == nil {
+		h.tracer.Store(nil)
+		return
+	}
+	h.tracer.Store(&tracer{fn: fn, headersOnly: headersOnly})
+}
+
+// wireConn is the connection to FreeSWITCH, reporting the bytes read and
+// written to the metrics, tracer and recorder of the Connection, and when
+// data was last read to KeepAlive.
+type wireConn struct {
+	net.Conn
+	h *Connection
+}
+
+func (c wireConn) Read(p []byte) (int, error) {
+	c.h.extendDeadline()
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.h.readAt.Store(time.Now().UnixNano())
+		if m := c.h.stats(); m != nil {
+			m.BytesRead(n)
+		}
+		if t := c.h.tracer.Load(); t != nil {
+			t.trace(TraceRead, p[:n])
+		}
+		c.h.recordRead(p[:n])
+	}
+	return n, err
+}
+
+func (c wireConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		if t := c.h.tracer.Load(); t != nil {
+			t.trace(TraceWrite, p[:n])
+		}
+	}
+	return n, err
+}
+
+// tracer hands the data read and written to fn.
+type tracer struct {
+	fn          func(time.Time, TraceDirection, []byte)
+	headersOnly bool
+	mu          sync.Mutex
+	frames      [2]traceFrame // Per direction
+}
+
+func (t *tracer) trace(dir TraceDirection, b []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.headersOnly {
+		if b = t.frames[dir].headers(b); len(b) == 0 {
+			return
+		}
+	}
+	t.fn(time.Now(), dir, b)
+}
+
+// traceFrame follows the messages of one direction of the socket, to tell
+// headers from bodies.
+type traceFrame struct {
+	line   []byte // Incomplete header line
+	length int64  // Content-Length of the current message
+	body   int64  // Bytes of the body yet to be skipped
+}
+
+// headers returns the bytes of headers in b, skipping bodies.
+func (f *traceFrame) headers(b []byte) []byte {
+	var out []byte
+	for len(b) > 0 {
+		if f.body > 0 {
+			n := f.body
+			if n > int64(len(b)) {
+				n = int64(len(b))
+			}
+			b, f.body = b[n:], f.body-n
+			continue
+		}
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			f.line = append(f.line, b...)
+			out = append(out, b...)
+			break
+		}
+		out = append(out, b[:i+1]...)
+		line := bytes.TrimRight(append(f.line, b[:i]...), "\r")
+		f.line, b = f.line[:0], b[i+1:]
+		if len(line) == 0 {
+			// End of headers.
+			f.body, f.length = f.length, 0
+			continue
+		}
+		k, v, ok := strings.Cut(string(line), ":")
+		if ok && strings.EqualFold(strings.TrimSpace(k), "Content-Length") {
+			f.length, _ = strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		}
+	}
+	return out
+}
+
+// traceWriter writes traced data to w, line by line.
+type traceWriter struct {
+	w       io.Writer
+	partial [2][]byte // Incomplete line, per direction
+}
+
+func (tw *traceWriter) trace(t time.Time, dir TraceDirection, b []byte) {
+	prefix := "<<"
+	if dir == TraceWrite {
+		prefix = ">>"
+	}
+	buf := append(tw.partial[dir], b...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := bytes.TrimRight(buf[:i], "\r")
+		if len(line) == 0 {
+			fmt.Fprintf(tw.w, "%s %s\n", t.Format("2006-01-02 15:04:05.000000"), prefix)
+		} else {
+			fmt.Fprintf(tw.w, "%s %s %s\n", t.Format("2006-01-02 15:04:05.000000"), prefix, line)
+		}
+		buf = buf[i+1:]
+	}
+	tw.partial[dir] = append(tw.partial[dir][:0], buf...)
+}
@@ -0,0 +1,198 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const trafficWindow = time.Minute
+
+// TrafficSnapshot are the statistics of the calls of a sliding window of
+// time, computed by TrafficStats.
+type TrafficSnapshot struct {
+	Window     time.Duration // Length of the window
+	Created    int           // Calls created in the window
+	Completed  int           // Calls that hung up in the window
+	Answered   int           // Of the completed calls, those answered
+	Failed     int           // Of the completed calls, those not answered
+	CPS        float64       // Calls created per second
+	ASR        float64       // Answer-seizure ratio, answered/completed
+	ACD        time.Duration // Average duration of the answered calls
+	Concurrent int           // Calls up now, not limited to the window
+}
+
+// TrafficStats computes traffic statistics over a sliding window of time,
+// from channel events: calls per second, answer-seizure ratio (ASR),
+// average call duration (ACD) and concurrent calls. They can be exported
+// with PrometheusMetrics.ExportTraffic.
+//
+// Every channel is a call, so bridged calls count twice, unless Direction
+// is set.
+//
+// Example:
+//
+//	s := eventsocket.NewTrafficStats(c, 5*time.Minute)
+//	s.Direction = "inbound"
+//	go s.Run(ctx)
+//	...
+//	t := s.Snapshot()
+//	fmt.Printf("cps=%.1f asr=%.0f%% acd=%s\n", t.CPS, t.ASR*100, t.ACD)
+type TrafficStats struct {
+	// Direction, when set, only counts channels of that Call-Direction,
+	// e.g. inbound to count each call that comes into FreeSWITCH once.
+	Direction string
+
+	conn       *Connection
+	window     time.Duration
+	mu         sync.Mutex
+	buckets    []trafficBucket // Per second, circular
+	concurrent int
+}
+
+// trafficBucket holds the counters of one second.
+type trafficBucket struct {
+	sec       int64 // Unix time of the second
+	created   int
+	completed int
+	answered  int
+	billsec   time.Duration // Sum of the answered calls
+}
+
+// NewTrafficStats creates a TrafficStats for the given connection, over a
+// sliding window of the given length in seconds, or of one minute if
+// shorter than a second.
+func NewTrafficStats(c *Connection, window time.Duration) *TrafficStats {
+	if window < time.Second {
+		window = trafficWindow
+	}
+	window = window.Truncate(time.Second)
+	return &TrafficStats{
+		conn:    c,
+		window:  window,
+		buckets: make([]trafficBucket, window/time.Second),
+	}
+}
+
+// Run subscribes to channel events, counts the calls up with "show
+// channels", and computes the statistics until the context is cancelled
+// or the connection terminates.
+func (s *TrafficStats) Run(ctx context.Context) error {
+	events := newEventQueue()
+	cancel := s.conn.observe(func(ev *Event) bool {
+		switch ev.peek("Event-Name") {
+		case "CHANNEL_CREATE", "CHANNEL_HANGUP_COMPLETE", "CHANNEL_DESTROY":
+			events.push(ev.retain())
+		}
+		return false
+	})
+	defer cancel()
+	err := s.conn.Subscriptions().Subscribe(
+		"CHANNEL_CREATE", "CHANNEL_HANGUP_COMPLETE", "CHANNEL_DESTROY")
+	if err != nil {
+		return err
+	}
+	channels, err := s.conn.ShowChannels()
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, ch := range channels {
+		if s.Direction == "" || ch.Direction == s.Direction {
+			n++
+		}
+	}
+	s.mu.Lock()
+	s.concurrent = n
+	s.mu.Unlock()
+	for {
+		for ev, ok := events.pop(); ok; ev, ok = events.pop() {
+			s.HandleEvent(ev)
+			ev.Release()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.conn.done:
+			return s.conn.err
+		case <-events.wake:
+		}
+	}
+}
+
+// HandleEvent counts CHANNEL_CREATE, CHANNEL_HANGUP_COMPLETE and
+// CHANNEL_DESTROY events. Other events are ignored. It's called by Run,
+// and only needs to be called directly by those not using Run.
+func (s *TrafficStats) HandleEvent(ev *Event) {
+	if s.Direction != "" && ev.Get("Call-Direction") != s.Direction {
+		return
+	}
+	switch ev.Get("Event-Name") {
+	case "CHANNEL_CREATE":
+		s.mu.Lock()
+		s.bucket(time.Now()).created++
+		s.concurrent++
+		s.mu.Unlock()
+	case "CHANNEL_HANGUP_COMPLETE":
+		answered := !ev.ChannelTimes().Answered.IsZero()
+		billsec, _ := ev.Billsec()
+		s.mu.Lock()
+		b := s.bucket(time.Now())
+		b.completed++
+		if answered {
+			b.answered++
+			b.billsec += billsec
+		}
+		s.mu.Unlock()
+	case "CHANNEL_DESTROY":
+		s.mu.Lock()
+		if s.concurrent > 0 {
+			s.concurrent--
+		}
+		s.mu.Unlock()
+	}
+}
+
+// bucket returns the bucket of the given time, emptied if it was last used
+// in a previous window, with mu held.
+func (s *TrafficStats) bucket(now time.Time) *trafficBucket {
+	sec := now.Unix()
+	b := &s.buckets[sec%int64(len(s.buckets))]
+	if b.sec != sec {
+		*b = trafficBucket{sec: sec}
+	}
+	return b
+}
+
+// Snapshot returns the statistics of the current window.
+func (s *TrafficStats) Snapshot() TrafficSnapshot {
+	now := time.Now().Unix()
+	oldest := now - int64(len(s.buckets)) + 1
+	t := TrafficSnapshot{Window: s.window}
+	var billsec time.Duration
+	s.mu.Lock()
+	for _, b := range s.buckets {
+		if b.sec < oldest || b.sec > now {
+			continue
+		}
+		t.Created += b.created
+		t.Completed += b.completed
+		t.Answered += b.answered
+		billsec += b.billsec
+	}
+	t.Concurrent = s.concurrent
+	s.mu.Unlock()
+	t.Failed = t.Completed - t.Answered
+	t.CPS = float64(t.Created) / s.window.Seconds()
+	if t.Completed > 0 {
+		t.ASR = float64(t.Answered) / float64(t.Completed)
+	}
+	if t.Answered > 0 {
+		t.ACD = billsec / time.Duration(t.Answered)
+	}
+	return t
+}
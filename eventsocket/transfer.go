@@ -0,0 +1,61 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import "strings"
+
+// Transfer transfers a live channel to an extension of the dialplan, using
+// uuid_transfer. The dialplan and context may be empty, in which case
+// FreeSWITCH uses XML and the context of the channel. It returns
+// ErrNoSuchChannel when the channel doesn't exist.
+//
+// Example:
+//
+//	c.Transfer(uuid, "9000", "XML", "default")
+//	c.Transfer(uuid, "playback:/tmp/bye.wav,hangup", "inline", "")
+func (h *Connection) Transfer(uuid, dest, dialplan, context string) error {
+	return h.transfer(uuid, "", dest, dialplan, context)
+}
+
+// TransferBLeg transfers the other leg of a bridged call, leaving the
+// channel identified by uuid alone. See Transfer for details.
+func (h *Connection) TransferBLeg(uuid, dest, dialplan, context string) error {
+	return h.transfer(uuid, "-bleg", dest, dialplan, context)
+}
+
+// TransferBoth transfers both legs of a bridged call. See Transfer for
+// details.
+func (h *Connection) TransferBoth(uuid, dest, dialplan, context string) error {
+	return h.transfer(uuid, "-both", dest, dialplan, context)
+}
+
+// transfer runs uuid_transfer.
+func (h *Connection) transfer(uuid, leg, dest, dialplan, context string) error {
+	if !validArg(uuid) || !validArg(dest) {
+		return errInvalidArgument
+	}
+	args := []string{"uuid_transfer", uuid}
+	if leg != "" {
+		args = append(args, leg)
+	}
+	args = append(args, dest)
+	if dialplan != "" || context != "" {
+		if dialplan == "" {
+			dialplan = "XML"
+		}
+		if !validArg(dialplan) {
+			return errInvalidArgument
+		}
+		args = append(args, dialplan)
+		if context != "" {
+			if !validArg(context) {
+				return errInvalidArgument
+			}
+			args = append(args, context)
+		}
+	}
+	_, err := h.api(strings.Join(args, " "))
+	return err
+}
@@ -0,0 +1,222 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	webhookConcurrency = 4
+	webhookMaxAttempts = 5
+	webhookTimeout     = 10 * time.Second
+
+	// WebhookSignatureHeader is the header of the requests of WebhookSink
+	// with the signature of their body, see WebhookSink.Secret.
+	WebhookSignatureHeader = "X-Eventsocket-Signature"
+)
+
+// webhookClient is the default client of WebhookSink, shared to reuse
+// connections.
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// WebhookSink POSTs events as json to a URL, concurrently, retrying with
+// exponential backoff while the server fails. One sink is needed for each
+// URL, each with its own Match.
+//
+// Requests that fail with 5xx or 429 status codes, or with network errors,
+// are retried; others are dropped, as are those that failed MaxAttempts
+// times, and logged.
+//
+// Example:
+//
+//	s := eventsocket.NewWebhookSink("https://crm.example.com/hooks/calls")
+//	s.Match = func(ev *eventsocket.Event) bool {
+//		return ev.Get("Event-Name") == "CHANNEL_HANGUP_COMPLETE"
+//	}
+//	s.Secret = []byte("s3cr3t")
+//	go s.Run(ctx, c)
+type WebhookSink struct {
+	// URL is where events are posted.
+	URL string
+
+	// Match, when set, selects the events posted. Defaults to all.
+	Match func(*Event) bool
+
+	// Secret, when set, signs the body of requests with HMAC-SHA256, in
+	// the X-Eventsocket-Signature header, e.g. sha256=4f8e..., for the
+	// server to check it with:
+	//
+	//	mac := hmac.New(sha256.New, secret)
+	//	mac.Write(body)
+	//	ok := hmac.Equal([]byte(r.Header.Get(eventsocket.WebhookSignatureHeader)),
+	//		[]byte("sha256="+hex.EncodeToString(mac.Sum(nil))))
+	Secret []byte
+
+	// Header, when set, is added to every request, e.g. for an
+	// Authorization header.
+	Header http.Header
+
+	// Client sends the requests. Defaults to a client with a 10s timeout.
+	Client *http.Client
+
+	// Concurrency is how many requests can be in flight at once, 4 by
+	// default. Events are posted in order, but with more than one request
+	// in flight they can arrive out of order.
+	Concurrency int
+
+	// MaxAttempts is how many times an event is posted before it's
+	// dropped, 5 by default.
+	MaxAttempts int
+
+	// MinBackoff and MaxBackoff bound the wait between attempts to post an
+	// event, which doubles after every failure. They default to 100ms and
+	// 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// NewWebhookSink creates a WebhookSink that posts events to url.
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{URL: url}
+}
+
+// Run posts the events received by the connection until the context is
+// cancelled or the connection terminates. Events must be subscribed to
+// separately. Events received before the connection terminated are posted
+// before Run returns its error.
+func (s *WebhookSink) Run(ctx context.Context, c *Connection) error {
+	events := newEventQueue()
+	cancel := c.observe(func(ev *Event) bool {
+		events.push(ev.retain())
+		return false
+	})
+	defer cancel()
+	n := s.Concurrency
+	if n <= 0 {
+		n = webhookConcurrency
+	}
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	closed := false
+	for {
+		for ev, ok := events.pop(); ok; ev, ok = events.pop() {
+			if s.Match != nil && !s.Match(ev) {
+				ev.Release()
+				continue
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				ev.Release()
+				for ev, ok := events.pop(); ok; ev, ok = events.pop() {
+					ev.Release()
+				}
+				return ctx.Err()
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.deliver(ctx, c, ev)
+				ev.Release()
+				<-sem
+			}()
+		}
+		if closed {
+			return c.err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.done:
+			closed = true
+		case <-events.wake:
+		}
+	}
+}
+
+// deliver posts an event, retrying with exponential backoff.
+func (s *WebhookSink) deliver(ctx context.Context, c *Connection, ev *Event) {
+	body, err := ev.MarshalJSON()
+	if err != nil {
+		c.log().Errorf("eventsocket: webhook: %v", err)
+		return
+	}
+	attempts := s.MaxAttempts
+	if attempts <= 0 {
+		attempts = webhookMaxAttempts
+	}
+	backoff := s.MinBackoff
+	if backoff <= 0 {
+		backoff = sinkMinBackoff
+	}
+	max := s.MaxBackoff
+	if max <= 0 {
+		max = sinkMaxBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, body)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		if !retry || attempt >= attempts {
+			c.log().Errorf("eventsocket: webhook: dropping %s event, attempt %d: %v",
+				eventName(ev), attempt, err)
+			return
+		}
+		c.log().Errorf("eventsocket: webhook: %v, retrying in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > max {
+			backoff = max
+		}
+	}
+}
+
+// post sends a request with the body, and tells whether it's worth
+// retrying if it fails.
+func (s *WebhookSink) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Secret != nil {
+		mac := hmac.New(sha256.New, s.Secret)
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	client := s.Client
+	if client == nil {
+		client = webhookClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, resp.Body) // Lets the connection be reused
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("%s returned %s", s.URL, resp.Status)
+}
@@ -0,0 +1,295 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package eventsocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const wsMaxPending = 1000
+
+var errMissingHeader = errors.New("Missing header")
+
+// WebSocket close codes.
+const (
+	wsGoingAway       = 1001
+	wsPolicyViolation = 1008
+)
+
+// WebSocketGateway is an http.Handler that streams the events of a
+// connection to WebSocket clients, e.g. browsers of live dashboards, as
+// json text messages in the format of MarshalJSON.
+//
+// Clients receive no events until they subscribe, either with the events
+// parameter of the URL, e.g. ws://host/events?events=CHANNEL_ANSWER,DTMF,
+// or with messages:
+//
+//	{"action": "subscribe", "events": ["CHANNEL_ANSWER", "sofia::register"]}
+//	{"action": "unsubscribe", "events": ["CHANNEL_ANSWER"]}
+//	{"action": "filter", "header": "Caller-Caller-ID-Number", "value": "1000"}
+//	{"action": "unfilter", "header": "Caller-Caller-ID-Number", "value": "1000"}
+//
+// Like FreeSWITCH's filters, once a client has filters it only receives
+// events that match any of them. Messages that fail are answered with
+// {"error": "..."}.
+//
+// The connection is subscribed to the events clients subscribe to, and
+// stays subscribed when they unsubscribe or leave.
+//
+// Example:
+//
+//	http.Handle("/events", eventsocket.NewWebSocketGateway(c))
+//	http.ListenAndServe(":8080", nil)
+type WebSocketGateway struct {
+	// CheckOrigin, when set, tells whether a request can be upgraded,
+	// from its Origin header. Defaults to requests without Origin, or
+	// from the same host.
+	CheckOrigin func(*http.Request) bool
+
+	// Match, when set, tells whether an event can be sent to the client
+	// of a request, e.g. to limit users to the events of their domain.
+	Match func(r *http.Request, ev *Event) bool
+
+	// MaxPending is how many events can wait to be sent to a client before
+	// it's disconnected, for being too slow. Defaults to 1000.
+	MaxPending int
+
+	conn *Connection
+}
+
+// wsClient is a client of a WebSocketGateway.
+type wsClient struct {
+	ws       *wsConn
+	mu       sync.Mutex
+	events   map[string]bool     // Event names and subclasses, or ALL
+	filters  map[string][]string // header:values
+	queue    *eventQueue
+	overflow atomic.Bool
+	done     chan struct{} // Closed when the client goes away
+}
+
+// wsCommand is a message of a client.
+type wsCommand struct {
+	Action string   `json:"action"`
+	Events []string `json:"events"`
+	Header string   `json:"header"`
+	Value  string   `json:"value"`
+}
+
+// NewWebSocketGateway creates a WebSocketGateway for the events of the
+// given connection.
+func NewWebSocketGateway(c *Connection) *WebSocketGateway {
+	return &WebSocketGateway{conn: c}
+}
+
+// ServeHTTP upgrades the request to WebSocket and streams events to the
+// client until it goes away or the connection terminates.
+func (g *WebSocketGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !g.checkOrigin(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+	ws, err := wsUpgrade(w, r)
+	if err != nil {
+		return
+	}
+	cl := &wsClient{
+		ws:      ws,
+		events:  make(map[string]bool),
+		filters: make(map[string][]string),
+		queue:   newEventQueue(),
+		done:    make(chan struct{}),
+	}
+	if v := r.URL.Query().Get("events"); v != "" {
+		if err := g.subscribe(cl, strings.Split(v, ",")); err != nil {
+			cl.reply(err)
+			ws.close(wsPolicyViolation)
+			return
+		}
+	}
+	max := g.MaxPending
+	if max <= 0 {
+		max = wsMaxPending
+	}
+	cancel := g.conn.observe(func(ev *Event) bool {
+		if !cl.wants(eventName(ev)) {
+			return false
+		}
+		if cl.queue.len() >= max {
+			cl.overflow.Store(true)
+			cl.queue.signal()
+			return false
+		}
+		cl.queue.push(ev.retain())
+		return false
+	})
+	defer cancel()
+	go g.readCommands(cl)
+	code := g.writeEvents(r, cl)
+	ws.close(code)
+	for ev, ok := cl.queue.pop(); ok; ev, ok = cl.queue.pop() {
+		ev.Release()
+	}
+}
+
+// writeEvents sends the events queued for a client until it goes away or
+// the connection terminates, and returns the close code.
+func (g *WebSocketGateway) writeEvents(r *http.Request, cl *wsClient) uint16 {
+	for {
+		if cl.overflow.Load() {
+			g.conn.log().Errorf("eventsocket: websocket client %s is too slow, disconnecting",
+				r.RemoteAddr)
+			return wsPolicyViolation
+		}
+		for ev, ok := cl.queue.pop(); ok; ev, ok = cl.queue.pop() {
+			var err error
+			if cl.match(ev) && (g.Match == nil || g.Match(r, ev)) {
+				var b []byte
+				if b, err = ev.MarshalJSON(); err == nil {
+					err = cl.ws.writeText(b)
+				}
+			}
+			ev.Release()
+			if err != nil {
+				return wsGoingAway
+			}
+		}
+		select {
+		case <-cl.done:
+			return wsGoingAway
+		case <-g.conn.done:
+			return wsGoingAway
+		case <-cl.queue.wake:
+		}
+	}
+}
+
+// readCommands handles the messages of a client until it goes away.
+func (g *WebSocketGateway) readCommands(cl *wsClient) {
+	defer close(cl.done)
+	for {
+		b, err := cl.ws.readMessage()
+		if err != nil {
+			return
+		}
+		var cmd wsCommand
+		if err := json.Unmarshal(b, &cmd); err != nil {
+			cl.reply(err)
+			continue
+		}
+		switch cmd.Action {
+		case "subscribe":
+			err = g.subscribe(cl, cmd.Events)
+		case "unsubscribe":
+			cl.mu.Lock()
+			for _, name := range cmd.Events {
+				delete(cl.events, name)
+			}
+			cl.mu.Unlock()
+		case "filter", "unfilter":
+			if cmd.Header == "" {
+				err = errMissingHeader
+				break
+			}
+			key := capitalize(cmd.Header)
+			cl.mu.Lock()
+			values := cl.filters[key]
+			if cmd.Action == "filter" {
+				values = appendNew(values, cmd.Value)
+			} else {
+				values = removeValue(values, cmd.Value)
+			}
+			if len(values) == 0 {
+				delete(cl.filters, key)
+			} else {
+				cl.filters[key] = values
+			}
+			cl.mu.Unlock()
+		default:
+			err = fmt.Errorf("Unknown action: %q", cmd.Action)
+		}
+		if err != nil {
+			cl.reply(err)
+		}
+	}
+}
+
+// subscribe subscribes the connection and the client to the given events.
+func (g *WebSocketGateway) subscribe(cl *wsClient, names []string) error {
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+	}
+	if err := g.conn.Subscriptions().Subscribe(names...); err != nil {
+		return err
+	}
+	cl.mu.Lock()
+	for _, name := range names {
+		cl.events[name] = true
+	}
+	cl.mu.Unlock()
+	return nil
+}
+
+// checkOrigin tells whether a request can be upgraded.
+func (g *WebSocketGateway) checkOrigin(r *http.Request) bool {
+	if g.CheckOrigin != nil {
+		return g.CheckOrigin(r)
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// wants reports whether the client subscribed to events with the given
+// name, or subclass.
+func (cl *wsClient) wants(name string) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.events["ALL"] || cl.events[name]
+}
+
+// match reports whether an event passes the filters of the client.
+func (cl *wsClient) match(ev *Event) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if len(cl.filters) == 0 {
+		return true
+	}
+	for key, values := range cl.filters {
+		v := ev.Get(key)
+		for _, want := range values {
+			if v == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reply sends an error to the client.
+func (cl *wsClient) reply(err error) {
+	b, _ := json.Marshal(map[string]string{"error": err.Error()})
+	cl.ws.writeText(b)
+}
+
+// removeValue returns list without s.
+func removeValue(list []string, s string) []string {
+	for i, v := range list {
+		if v == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
@@ -0,0 +1,350 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package fsclient is a high level FreeSWITCH client built on top of the
+// eventsocket package.
+//
+// It wraps an inbound event socket connection in a Client that owns the
+// event stream and exposes typed helpers for the most common tasks:
+// originating calls, listing channels, checking the status of the server,
+// running background jobs and subscribing to events. The underlying
+// eventsocket.Connection is still available through Conn for anything the
+// Client doesn't cover.
+//
+// Example:
+//
+//	c, err := fsclient.Dial("localhost:8021", "ClueCon")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer c.Close()
+//	c.Subscribe(func(ev *eventsocket.Event) {
+//		fmt.Println("answered:", ev.Get("Unique-Id"))
+//	}, "CHANNEL_ANSWER")
+//	uuid, err := c.Originate(ctx, "user/1000", "&park()")
+package fsclient
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+)
+
+// Client is a high level FreeSWITCH client.
+//
+// It reads events from the connection and hands them to subscribers, so
+// the connection's ReadEvent must not be used by anyone else.
+type Client struct {
+	conn *eventsocket.Connection
+
+	mu     sync.Mutex
+	subs   map[int]*subscription
+	subID  int
+	events map[string]int // Event name:number of subscribers
+	jobs   map[string]*eventsocket.Job
+	err    error
+	done   chan struct{}
+}
+
+// subscription is an event handler registered by Subscribe.
+type subscription struct {
+	names map[string]bool
+	fn    func(*eventsocket.Event)
+}
+
+// Dial connects to FreeSWITCH and returns a Client.
+func Dial(addr, passwd string) (*Client, error) {
+	conn, err := eventsocket.Dial(addr, passwd)
+	if err != nil {
+		return nil, err
+	}
+	c, err := New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// New creates a Client on an authenticated inbound connection, and
+// subscribes to BACKGROUND_JOB events, used by Jobs.
+func New(conn *eventsocket.Connection) (*Client, error) {
+	c := &Client{
+		conn:   conn,
+		subs:   make(map[int]*subscription),
+		events: make(map[string]int),
+		jobs:   make(map[string]*eventsocket.Job),
+		done:   make(chan struct{}),
+	}
+	if err := conn.Subscriptions().Subscribe(eventsocket.EventBackgroundJob); err != nil {
+		return nil, err
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// Conn returns the underlying connection, for raw protocol access.
+func (c *Client) Conn() *eventsocket.Connection {
+	return c.conn
+}
+
+// Close closes the connection.
+func (c *Client) Close() {
+	c.conn.Close()
+}
+
+// Done returns a channel that's closed when the connection terminates.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error that terminated the connection, if any.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// readLoop hands events to subscribers until the connection terminates.
+func (c *Client) readLoop() {
+	for {
+		ev, err := c.conn.ReadEvent()
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			close(c.done)
+			return
+		}
+		name := ev.Get("Event-Name")
+		if name == eventsocket.EventCustom {
+			name = ev.Get("Event-Subclass")
+		}
+		c.mu.Lock()
+		var fns []func(*eventsocket.Event)
+		for _, s := range c.subs {
+			if s.names[name] || s.names["ALL"] {
+				fns = append(fns, s.fn)
+			}
+		}
+		c.mu.Unlock()
+		for _, fn := range fns {
+			fn(ev)
+		}
+	}
+}
+
+// Subscribe calls fn for every event with one of the given names, which
+// are either event names like CHANNEL_ANSWER, subclasses of CUSTOM events
+// like sofia::register, or ALL. It returns a function that cancels the
+// subscription.
+//
+// fn is called from the goroutine reading events, and should not block.
+func (c *Client) Subscribe(fn func(*eventsocket.Event), names ...string) (cancel func(), err error) {
+	if len(names) == 0 {
+		return nil, errors.New("No events to subscribe to")
+	}
+	s := &subscription{names: make(map[string]bool), fn: fn}
+	var add []string
+	c.mu.Lock()
+	for _, name := range names {
+		s.names[name] = true
+		if c.events[name] == 0 {
+			add = append(add, name)
+		}
+		c.events[name]++
+	}
+	c.subID++
+	id := c.subID
+	c.subs[id] = s
+	c.mu.Unlock()
+	if err := c.conn.Subscriptions().Subscribe(add...); err != nil {
+		c.unsubscribe(id)
+		return nil, err
+	}
+	return func() { c.unsubscribe(id) }, nil
+}
+
+// unsubscribe removes a subscription and stops receiving the events
+// nobody else is interested in.
+func (c *Client) unsubscribe(id int) {
+	c.mu.Lock()
+	s, ok := c.subs[id]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.subs, id)
+	var del []string
+	for name := range s.names {
+		if c.events[name]--; c.events[name] <= 0 {
+			delete(c.events, name)
+			if name != eventsocket.EventBackgroundJob {
+				del = append(del, name)
+			}
+		}
+	}
+	c.mu.Unlock()
+	c.conn.Subscriptions().Unsubscribe(del...)
+}
+
+// API runs an api command and returns its result. Results starting with
+// -ERR, or -USAGE, are returned as errors.
+func (c *Client) API(command string) (string, error) {
+	return c.conn.API(command)
+}
+
+// Job runs an api command in the background, see Jobs.
+func (c *Client) Job(command string) (*eventsocket.Job, error) {
+	j, err := c.conn.BgAPI(command)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.jobs[j.UUID] = j
+	c.mu.Unlock()
+	go func() {
+		select {
+		case <-j.Done():
+		case <-c.done:
+		}
+		c.mu.Lock()
+		delete(c.jobs, j.UUID)
+		c.mu.Unlock()
+	}()
+	return j, nil
+}
+
+// Jobs returns the background jobs started by Job that are still running.
+func (c *Client) Jobs() []*eventsocket.Job {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	jobs := make([]*eventsocket.Job, 0, len(c.jobs))
+	for _, j := range c.jobs {
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
+
+// Originate calls the endpoint, e.g. user/1000 or
+// sofia/gateway/provider/5551234, and sends the call to target once
+// answered, e.g. &park() or 9999 XML default, or parks it if target is
+// empty. It returns the UUID of the new channel, or an
+// *eventsocket.OriginateError with the cause reported by FreeSWITCH, like
+// NO_ANSWER. See eventsocket.Connection.Originate for calls with more
+// options.
+func (c *Client) Originate(ctx context.Context, endpoint, target string) (string, error) {
+	b := eventsocket.NewOriginate().Endpoint(endpoint)
+	if app, ok := strings.CutPrefix(target, "&"); ok {
+		name, arg, _ := strings.Cut(app, "(")
+		b.App(name, strings.TrimSuffix(arg, ")"))
+	} else if f := strings.Fields(target); len(f) > 0 {
+		f = append(f, "", "")
+		b.Extension(f[0], f[1], f[2])
+	}
+	return c.conn.Originate(ctx, b)
+}
+
+// Channel is an active channel, as listed by Channels.
+type Channel = eventsocket.ChannelInfo
+
+// Channels returns the active channels.
+func (c *Client) Channels() ([]Channel, error) {
+	return c.conn.ShowChannels()
+}
+
+// Status is the status of the server, as reported by the status api.
+type Status struct {
+	Ready                bool
+	Version              string
+	Uptime               time.Duration
+	Sessions             int     // Current sessions
+	SessionsSinceStartup int     // Total sessions since startup
+	SessionsPeak         int     // Peak of sessions
+	SessionsPerSecond    int     // Current sessions per second
+	MaxSessionsPerSecond int     // Configured limit of sessions per second
+	MaxSessions          int     // Configured limit of sessions
+	IdleCPU              float64 // Current idle cpu, percent
+}
+
+var (
+	statusUptime  = regexp.MustCompile(`(\d+) (year|day|hour|minute|second|millisecond|microsecond)s?`)
+	statusVersion = regexp.MustCompile(`\(Version ([^)]+)\)`)
+	statusNumbers = regexp.MustCompile(`\d+(\.\d+)?`)
+)
+
+// Status returns the status of the server.
+func (c *Client) Status() (*Status, error) {
+	body, err := c.API("status")
+	if err != nil {
+		return nil, err
+	}
+	return parseStatus(body), nil
+}
+
+// parseStatus parses the output of the status api, e.g.:
+//
+//	UP 0 years, 0 days, 1 hour, 2 minutes, 3 seconds, 4 milliseconds, 5 microseconds
+//	FreeSWITCH (Version 1.10.7 -release 64bit) is ready
+//	12 session(s) since startup
+//	2 session(s) - peak 3, last 5min 2
+//	0 session(s) per Sec out of max 30, peak 1, last 5min 0
+//	1000 session(s) max
+//	min idle cpu 0.00/98.70
+func parseStatus(body string) *Status {
+	units := map[string]time.Duration{
+		"year":        365 * 24 * time.Hour,
+		"day":         24 * time.Hour,
+		"hour":        time.Hour,
+		"minute":      time.Minute,
+		"second":      time.Second,
+		"millisecond": time.Millisecond,
+		"microsecond": time.Microsecond,
+	}
+	st := &Status{}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		nums := statusNumbers.FindAllString(line, -1)
+		num := func(n int) int {
+			if n >= len(nums) {
+				return 0
+			}
+			v, _ := strconv.Atoi(nums[n])
+			return v
+		}
+		switch {
+		case strings.HasPrefix(line, "UP "):
+			for _, m := range statusUptime.FindAllStringSubmatch(line, -1) {
+				n, _ := strconv.Atoi(m[1])
+				st.Uptime += time.Duration(n) * units[m[2]]
+			}
+		case strings.HasPrefix(line, "FreeSWITCH"):
+			if m := statusVersion.FindStringSubmatch(line); m != nil {
+				st.Version = m[1]
+			}
+			st.Ready = strings.HasSuffix(line, "is ready")
+		case strings.HasSuffix(line, "since startup"):
+			st.SessionsSinceStartup = num(0)
+		case strings.Contains(line, "per Sec"):
+			st.SessionsPerSecond = num(0)
+			st.MaxSessionsPerSecond = num(1)
+		case strings.Contains(line, "- peak"):
+			st.Sessions = num(0)
+			st.SessionsPeak = num(1)
+		case strings.HasSuffix(line, "session(s) max"):
+			st.MaxSessions = num(0)
+		case strings.HasPrefix(line, "min idle cpu"):
+			if i := strings.LastIndex(line, "/"); i >= 0 {
+				st.IdleCPU, _ = strconv.ParseFloat(line[i+1:], 64)
+			}
+		}
+	}
+	return st
+}
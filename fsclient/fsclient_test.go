@@ -0,0 +1,65 @@
+// Copyright 2013 Alexandre Fiori
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package fsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+	"github.com/fiorix/go-eventsocket/eventsocket/eventsockettest"
+)
+
+func TestOriginate(t *testing.T) {
+	s := eventsockettest.NewServer()
+	defer s.Close()
+	var got []string
+	s.HandleAPI("originate", func(args string) string {
+		got = append(got, args)
+		if len(got) == 1 {
+			return "+OK 1234\n"
+		}
+		return "-ERR NO_ANSWER\n"
+	})
+	c, err := Dial(s.Addr, s.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	uuid, err := c.Originate(ctx, "user/1000", "9000 XML default")
+	if err != nil || uuid != "1234" {
+		t.Fatalf("got %q, %v, want 1234", uuid, err)
+	}
+	_, err = c.Originate(ctx, "user/1000", "&playback(/tmp/a b.wav)")
+	if e, ok := err.(*eventsocket.OriginateError); !ok || e.Cause != "NO_ANSWER" {
+		t.Fatalf("got %v, want NO_ANSWER", err)
+	}
+	want := []string{
+		"user/1000 9000 XML default",
+		"user/1000 '&playback(/tmp/a b.wav)'",
+	}
+	for n := range want {
+		if n >= len(got) || got[n] != want[n] {
+			t.Fatalf("originated %q, want %q", got, want)
+		}
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	s := eventsockettest.NewServer()
+	defer s.Close()
+	s.HandleAPI("uuid_kill", func(string) string { return "-USAGE: <uuid> [cause]\n" })
+	c, err := Dial(s.Addr, s.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if body, err := c.API("uuid_kill"); err == nil {
+		t.Fatalf("got %q, want an error", body)
+	}
+}